@@ -7,6 +7,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"net/http"
+	"strings"
 	"text/template"
 	"time"
 
@@ -70,6 +71,7 @@ const (
 	BasicAuthUser AuthTypeEnum = "basic_auth_user"
 	JWTClaim      AuthTypeEnum = "jwt_claim"
 	OIDCUser      AuthTypeEnum = "oidc_user"
+	CertIdentity  AuthTypeEnum = "certificate_identity"
 	OAuthKey      AuthTypeEnum = "oauth_key"
 	UnsetAuth     AuthTypeEnum = ""
 
@@ -473,11 +475,171 @@ type ServiceDiscoveryConfiguration struct {
 type OIDProviderConfig struct {
 	Issuer    string            `bson:"issuer" json:"issuer"`
 	ClientIDs map[string]string `bson:"client_ids" json:"client_ids"`
+	// DiscoveryURL overrides the default <issuer>/.well-known/openid-configuration location.
+	DiscoveryURL string `bson:"discovery_url" json:"discovery_url"`
+	// Audiences lists the accepted "aud" values, in addition to the keys of ClientIDs.
+	Audiences []string `bson:"audiences" json:"audiences"`
+	// AuthorizedParties lists the accepted "azp" values. When empty, "azp" must be one of the accepted audiences.
+	AuthorizedParties []string             `bson:"authorized_parties" json:"authorized_parties"`
+	ClaimPolicies     []OIDClaimPolicyRule `bson:"claim_policies" json:"claim_policies"`
+}
+
+// OIDClaimPolicyRule maps a claim value to a policy. Claim may be a dot separated path
+// into nested claims (e.g. realm_access.roles), array claims match if any element matches.
+type OIDClaimPolicyRule struct {
+	Claim    string `bson:"claim" json:"claim"`
+	Value    string `bson:"value" json:"value"`
+	PolicyID string `bson:"policy_id" json:"policy_id"`
 }
 
 type OpenIDOptions struct {
 	Providers         []OIDProviderConfig `bson:"providers" json:"providers"`
 	SegregateByClient bool                `bson:"segregate_by_client" json:"segregate_by_client"`
+	// ValidateNonce requires the "nonce" claim of bearer tokens to match the value sent in NonceHeaderName.
+	// The ID tokens of browser sessions are always checked against the nonce of their login.
+	ValidateNonce   bool   `bson:"validate_nonce" json:"validate_nonce"`
+	NonceHeaderName string `bson:"nonce_header_name" json:"nonce_header_name"`
+	// ForwardClaims maps claim names to upstream request header names.
+	ForwardClaims map[string]string `bson:"forward_claims" json:"forward_claims"`
+	BrowserLogin  OIDCBrowserLogin  `bson:"browser_login" json:"browser_login"`
+}
+
+// OIDCBrowserLogin configures the relying party login flow, which authenticates
+// browsers with a session cookie instead of a bearer token.
+type OIDCBrowserLogin struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Issuer selects one of the configured providers, defaults to the first one.
+	Issuer   string `bson:"issuer" json:"issuer"`
+	ClientID string `bson:"client_id" json:"client_id"`
+	// ClientSecret may be a reference to one of the kv stores allowed by kv.api_definition_stores.
+	ClientSecret string   `bson:"client_secret" json:"client_secret"`
+	Scopes       []string `bson:"scopes" json:"scopes"`
+	// RedirectURL is the absolute callback URL registered with the provider.
+	// Defaults to <listen_path>/oidc/callback on the requested host.
+	RedirectURL string `bson:"redirect_url" json:"redirect_url"`
+	// PostLogoutRedirectURL is where browsers are sent once logged out with a POST to <listen_path>/oidc/logout.
+	PostLogoutRedirectURL string `bson:"post_logout_redirect_url" json:"post_logout_redirect_url"`
+	CookieName            string `bson:"cookie_name" json:"cookie_name"`
+	// CookieSecret is used to encrypt and authenticate the cookies, it may be a reference to one of the
+	// kv stores allowed by kv.api_definition_stores.
+	CookieSecret string `bson:"cookie_secret" json:"cookie_secret"`
+	CookieDomain string `bson:"cookie_domain" json:"cookie_domain"`
+	// SessionLifetime is the maximum lifetime of a browser session in seconds from the login, defaults to 24 hours.
+	// Refreshing the tokens doesn't extend it.
+	SessionLifetime int64 `bson:"session_lifetime" json:"session_lifetime"`
+}
+
+// Audience returns the client ID of the browser login when the ID tokens of
+// the i-th provider, whose issuer is given, are issued to it.
+func (b OIDCBrowserLogin) Audience(i int, issuer string) string {
+	if !b.Enabled || b.ClientID == "" {
+		return ""
+	}
+	if strings.TrimSuffix(b.Issuer, "/") == strings.TrimSuffix(issuer, "/") || b.Issuer == "" && i == 0 {
+		return b.ClientID
+	}
+	return ""
+}
+
+// CertificateIdentity authenticates clients by their TLS certificate, which
+// must be issued by one of the trusted CAs. The identity is extracted from the
+// certificate subject or SANs and mapped to a policy by the first matching rule.
+type CertificateIdentity struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// CACertificates are the IDs of the certificate manager CA certificates the client certificates are verified against.
+	CACertificates []string `bson:"ca_certificates" json:"ca_certificates"`
+	// CRLFile is the path of a PEM or DER encoded certificate revocation list, reloaded when modified.
+	CRLFile string                    `bson:"crl_file" json:"crl_file"`
+	Rules   []CertificateIdentityRule `bson:"rules" json:"rules"`
+}
+
+// CertificateIdentityRule maps certificate identities to a policy. Source is one of
+// "cn", "dns", "uri", "spiffe" or "email", Pattern is a regular expression the
+// whole identity should match, an empty pattern matches any identity of the source.
+type CertificateIdentityRule struct {
+	Source   string `bson:"source" json:"source"`
+	Pattern  string `bson:"pattern" json:"pattern"`
+	PolicyID string `bson:"policy_id" json:"policy_id"`
+}
+
+// AccessLogConfig overrides whether the requests to an API are written to the
+// access logs. Disabled takes precedence over Enabled.
+type AccessLogConfig struct {
+	// Enabled logs the requests even when access logs aren't enabled for all APIs.
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Disabled stops logging the requests.
+	Disabled bool `bson:"disabled" json:"disabled"`
+}
+
+// Redaction modes
+const (
+	RedactionReplace = "replace"
+	RedactionHash    = "hash"
+)
+
+// AnalyticsRedactionConfig removes sensitive data from the requests and
+// responses stored by detailed recording.
+type AnalyticsRedactionConfig struct {
+	// Headers are the names of the headers whose values are redacted.
+	Headers []string `bson:"headers" json:"headers"`
+	// JSONPaths are dot separated paths of JSON body values to redact, such as
+	// `card.number`. A `*` segment matches any object key or array item.
+	JSONPaths []string `bson:"json_paths" json:"json_paths"`
+	// FormFields are the names of the form fields and query parameters to redact.
+	FormFields []string `bson:"form_fields" json:"form_fields"`
+	// Patterns are regular expressions whose matches in the bodies are redacted.
+	Patterns []string `bson:"patterns" json:"patterns"`
+	// Mode is either `replace` (default), to replace the values with
+	// Replacement, or `hash`, to replace them with their SHA-256 hash.
+	Mode string `bson:"mode" json:"mode"`
+	// Replacement replaces the redacted values. Defaults to `[REDACTED]`.
+	Replacement string `bson:"replacement" json:"replacement"`
+	// MaxBodySize truncates the bodies to this number of bytes. 0 keeps the whole body.
+	MaxBodySize int64 `bson:"max_body_size" json:"max_body_size"`
+	// ContentTypes are the media types whose bodies are recorded, other bodies
+	// are dropped. All bodies are recorded when empty.
+	ContentTypes []string `bson:"content_types" json:"content_types"`
+}
+
+// SLO types
+const (
+	SLOAvailability = "availability"
+	SLOLatency      = "latency"
+)
+
+// SLOObjective is a service level objective of an API, evaluated by the
+// Gateway which fires burn rate events when its error budget is consumed too
+// quickly.
+type SLOObjective struct {
+	// Name identifies the objective in the events.
+	Name string `bson:"name" json:"name"`
+	// Type is either `availability`, where the requests answered with a 5xx
+	// status are bad, or `latency`, where the requests slower than
+	// LatencyThreshold are bad.
+	Type string `bson:"type" json:"type"`
+	// Target is the percentage of good requests, such as 99.9.
+	Target float64 `bson:"target" json:"target"`
+	// LatencyThreshold is the number of milliseconds above which a request is
+	// bad for latency objectives.
+	LatencyThreshold int64 `bson:"latency_threshold" json:"latency_threshold"`
+	// FastBurn fires SLOFastBurn events. Defaults to a burn rate of 14.4 over
+	// 1 hour and 5 minutes.
+	FastBurn SLOBurnRateAlert `bson:"fast_burn" json:"fast_burn"`
+	// SlowBurn fires SLOSlowBurn events. Defaults to a burn rate of 6 over
+	// 6 hours and 30 minutes.
+	SlowBurn SLOBurnRateAlert `bson:"slow_burn" json:"slow_burn"`
+}
+
+// SLOBurnRateAlert fires when the error budget of an objective burns at
+// BurnRate times the sustainable rate over both the long and short windows.
+type SLOBurnRateAlert struct {
+	// LongWindow is the number of seconds of the long window.
+	LongWindow int64 `bson:"long_window" json:"long_window"`
+	// ShortWindow is the number of seconds of the short window, which lets
+	// the alert resolve quickly once the burn stops.
+	ShortWindow int64 `bson:"short_window" json:"short_window"`
+	// BurnRate is the multiple of the sustainable error rate to alert on.
+	BurnRate float64 `bson:"burn_rate" json:"burn_rate"`
 }
 
 type ScopeClaim struct {
@@ -523,68 +685,72 @@ type APIDefinition struct {
 		BodyUserRegexp     string `bson:"body_user_regexp" json:"body_user_regexp"`
 		BodyPasswordRegexp string `bson:"body_password_regexp" json:"body_password_regexp"`
 	} `bson:"basic_auth" json:"basic_auth"`
-	UseMutualTLSAuth           bool                   `bson:"use_mutual_tls_auth" json:"use_mutual_tls_auth"`
-	ClientCertificates         []string               `bson:"client_certificates" json:"client_certificates"`
-	UpstreamCertificates       map[string]string      `bson:"upstream_certificates" json:"upstream_certificates"`
-	PinnedPublicKeys           map[string]string      `bson:"pinned_public_keys" json:"pinned_public_keys"`
-	EnableJWT                  bool                   `bson:"enable_jwt" json:"enable_jwt"`
-	UseStandardAuth            bool                   `bson:"use_standard_auth" json:"use_standard_auth"`
-	UseGoPluginAuth            bool                   `bson:"use_go_plugin_auth" json:"use_go_plugin_auth"`
-	EnableCoProcessAuth        bool                   `bson:"enable_coprocess_auth" json:"enable_coprocess_auth"`
-	JWTSigningMethod           string                 `bson:"jwt_signing_method" json:"jwt_signing_method"`
-	JWTSource                  string                 `bson:"jwt_source" json:"jwt_source"`
-	JWTIdentityBaseField       string                 `bson:"jwt_identit_base_field" json:"jwt_identity_base_field"`
-	JWTClientIDBaseField       string                 `bson:"jwt_client_base_field" json:"jwt_client_base_field"`
-	JWTPolicyFieldName         string                 `bson:"jwt_policy_field_name" json:"jwt_policy_field_name"`
-	JWTDefaultPolicies         []string               `bson:"jwt_default_policies" json:"jwt_default_policies"`
-	JWTIssuedAtValidationSkew  uint64                 `bson:"jwt_issued_at_validation_skew" json:"jwt_issued_at_validation_skew"`
-	JWTExpiresAtValidationSkew uint64                 `bson:"jwt_expires_at_validation_skew" json:"jwt_expires_at_validation_skew"`
-	JWTNotBeforeValidationSkew uint64                 `bson:"jwt_not_before_validation_skew" json:"jwt_not_before_validation_skew"`
-	JWTSkipKid                 bool                   `bson:"jwt_skip_kid" json:"jwt_skip_kid"`
-	Scopes                     Scopes                 `bson:"scopes" json:"scopes"`
-	JWTScopeToPolicyMapping    map[string]string      `bson:"jwt_scope_to_policy_mapping" json:"jwt_scope_to_policy_mapping"` // Deprecated: use Scopes.JWT.ScopeToPolicy or Scopes.OIDC.ScopeToPolicy
-	JWTScopeClaimName          string                 `bson:"jwt_scope_claim_name" json:"jwt_scope_claim_name"`               // Deprecated: use Scopes.JWT.ScopeClaimName or Scopes.OIDC.ScopeClaimName
-	NotificationsDetails       NotificationsManager   `bson:"notifications" json:"notifications"`
-	EnableSignatureChecking    bool                   `bson:"enable_signature_checking" json:"enable_signature_checking"`
-	HmacAllowedClockSkew       float64                `bson:"hmac_allowed_clock_skew" json:"hmac_allowed_clock_skew"`
-	HmacAllowedAlgorithms      []string               `bson:"hmac_allowed_algorithms" json:"hmac_allowed_algorithms"`
-	RequestSigning             RequestSigningMeta     `bson:"request_signing" json:"request_signing"`
-	BaseIdentityProvidedBy     AuthTypeEnum           `bson:"base_identity_provided_by" json:"base_identity_provided_by"`
-	VersionDefinition          VersionDefinition      `bson:"definition" json:"definition"`
-	VersionData                VersionData            `bson:"version_data" json:"version_data"` // Deprecated. Use VersionDefinition instead.
-	UptimeTests                UptimeTests            `bson:"uptime_tests" json:"uptime_tests"`
-	Proxy                      ProxyConfig            `bson:"proxy" json:"proxy"`
-	DisableRateLimit           bool                   `bson:"disable_rate_limit" json:"disable_rate_limit"`
-	DisableQuota               bool                   `bson:"disable_quota" json:"disable_quota"`
-	CustomMiddleware           MiddlewareSection      `bson:"custom_middleware" json:"custom_middleware"`
-	CustomMiddlewareBundle     string                 `bson:"custom_middleware_bundle" json:"custom_middleware_bundle"`
-	CacheOptions               CacheOptions           `bson:"cache_options" json:"cache_options"`
-	SessionLifetime            int64                  `bson:"session_lifetime" json:"session_lifetime"`
-	Active                     bool                   `bson:"active" json:"active"`
-	Internal                   bool                   `bson:"internal" json:"internal"`
-	AuthProvider               AuthProviderMeta       `bson:"auth_provider" json:"auth_provider"`
-	SessionProvider            SessionProviderMeta    `bson:"session_provider" json:"session_provider"`
-	EventHandlers              EventHandlerMetaConfig `bson:"event_handlers" json:"event_handlers"`
-	EnableBatchRequestSupport  bool                   `bson:"enable_batch_request_support" json:"enable_batch_request_support"`
-	EnableIpWhiteListing       bool                   `mapstructure:"enable_ip_whitelisting" bson:"enable_ip_whitelisting" json:"enable_ip_whitelisting"`
-	AllowedIPs                 []string               `mapstructure:"allowed_ips" bson:"allowed_ips" json:"allowed_ips"`
-	EnableIpBlacklisting       bool                   `mapstructure:"enable_ip_blacklisting" bson:"enable_ip_blacklisting" json:"enable_ip_blacklisting"`
-	BlacklistedIPs             []string               `mapstructure:"blacklisted_ips" bson:"blacklisted_ips" json:"blacklisted_ips"`
-	DontSetQuotasOnCreate      bool                   `mapstructure:"dont_set_quota_on_create" bson:"dont_set_quota_on_create" json:"dont_set_quota_on_create"`
-	ExpireAnalyticsAfter       int64                  `mapstructure:"expire_analytics_after" bson:"expire_analytics_after" json:"expire_analytics_after"` // must have an expireAt TTL index set (http://docs.mongodb.org/manual/tutorial/expire-data/)
-	ResponseProcessors         []ResponseProcessor    `bson:"response_processors" json:"response_processors"`
-	CORS                       CORSConfig             `bson:"CORS" json:"CORS"`
-	Domain                     string                 `bson:"domain" json:"domain"`
-	Certificates               []string               `bson:"certificates" json:"certificates"`
-	DoNotTrack                 bool                   `bson:"do_not_track" json:"do_not_track"`
-	Tags                       []string               `bson:"tags" json:"tags"`
-	EnableContextVars          bool                   `bson:"enable_context_vars" json:"enable_context_vars"`
-	ConfigData                 map[string]interface{} `bson:"config_data" json:"config_data"`
-	TagHeaders                 []string               `bson:"tag_headers" json:"tag_headers"`
-	GlobalRateLimit            GlobalRateLimit        `bson:"global_rate_limit" json:"global_rate_limit"`
-	StripAuthData              bool                   `bson:"strip_auth_data" json:"strip_auth_data"`
-	EnableDetailedRecording    bool                   `bson:"enable_detailed_recording" json:"enable_detailed_recording"`
-	GraphQL                    GraphQLConfig          `bson:"graphql" json:"graphql"`
+	UseMutualTLSAuth           bool                     `bson:"use_mutual_tls_auth" json:"use_mutual_tls_auth"`
+	ClientCertificates         []string                 `bson:"client_certificates" json:"client_certificates"`
+	CertificateIdentity        CertificateIdentity      `bson:"certificate_identity" json:"certificate_identity"`
+	UpstreamCertificates       map[string]string        `bson:"upstream_certificates" json:"upstream_certificates"`
+	PinnedPublicKeys           map[string]string        `bson:"pinned_public_keys" json:"pinned_public_keys"`
+	EnableJWT                  bool                     `bson:"enable_jwt" json:"enable_jwt"`
+	UseStandardAuth            bool                     `bson:"use_standard_auth" json:"use_standard_auth"`
+	UseGoPluginAuth            bool                     `bson:"use_go_plugin_auth" json:"use_go_plugin_auth"`
+	EnableCoProcessAuth        bool                     `bson:"enable_coprocess_auth" json:"enable_coprocess_auth"`
+	JWTSigningMethod           string                   `bson:"jwt_signing_method" json:"jwt_signing_method"`
+	JWTSource                  string                   `bson:"jwt_source" json:"jwt_source"`
+	JWTIdentityBaseField       string                   `bson:"jwt_identit_base_field" json:"jwt_identity_base_field"`
+	JWTClientIDBaseField       string                   `bson:"jwt_client_base_field" json:"jwt_client_base_field"`
+	JWTPolicyFieldName         string                   `bson:"jwt_policy_field_name" json:"jwt_policy_field_name"`
+	JWTDefaultPolicies         []string                 `bson:"jwt_default_policies" json:"jwt_default_policies"`
+	JWTIssuedAtValidationSkew  uint64                   `bson:"jwt_issued_at_validation_skew" json:"jwt_issued_at_validation_skew"`
+	JWTExpiresAtValidationSkew uint64                   `bson:"jwt_expires_at_validation_skew" json:"jwt_expires_at_validation_skew"`
+	JWTNotBeforeValidationSkew uint64                   `bson:"jwt_not_before_validation_skew" json:"jwt_not_before_validation_skew"`
+	JWTSkipKid                 bool                     `bson:"jwt_skip_kid" json:"jwt_skip_kid"`
+	Scopes                     Scopes                   `bson:"scopes" json:"scopes"`
+	JWTScopeToPolicyMapping    map[string]string        `bson:"jwt_scope_to_policy_mapping" json:"jwt_scope_to_policy_mapping"` // Deprecated: use Scopes.JWT.ScopeToPolicy or Scopes.OIDC.ScopeToPolicy
+	JWTScopeClaimName          string                   `bson:"jwt_scope_claim_name" json:"jwt_scope_claim_name"`               // Deprecated: use Scopes.JWT.ScopeClaimName or Scopes.OIDC.ScopeClaimName
+	NotificationsDetails       NotificationsManager     `bson:"notifications" json:"notifications"`
+	EnableSignatureChecking    bool                     `bson:"enable_signature_checking" json:"enable_signature_checking"`
+	HmacAllowedClockSkew       float64                  `bson:"hmac_allowed_clock_skew" json:"hmac_allowed_clock_skew"`
+	HmacAllowedAlgorithms      []string                 `bson:"hmac_allowed_algorithms" json:"hmac_allowed_algorithms"`
+	RequestSigning             RequestSigningMeta       `bson:"request_signing" json:"request_signing"`
+	BaseIdentityProvidedBy     AuthTypeEnum             `bson:"base_identity_provided_by" json:"base_identity_provided_by"`
+	VersionDefinition          VersionDefinition        `bson:"definition" json:"definition"`
+	VersionData                VersionData              `bson:"version_data" json:"version_data"` // Deprecated. Use VersionDefinition instead.
+	UptimeTests                UptimeTests              `bson:"uptime_tests" json:"uptime_tests"`
+	Proxy                      ProxyConfig              `bson:"proxy" json:"proxy"`
+	DisableRateLimit           bool                     `bson:"disable_rate_limit" json:"disable_rate_limit"`
+	DisableQuota               bool                     `bson:"disable_quota" json:"disable_quota"`
+	CustomMiddleware           MiddlewareSection        `bson:"custom_middleware" json:"custom_middleware"`
+	CustomMiddlewareBundle     string                   `bson:"custom_middleware_bundle" json:"custom_middleware_bundle"`
+	CacheOptions               CacheOptions             `bson:"cache_options" json:"cache_options"`
+	SessionLifetime            int64                    `bson:"session_lifetime" json:"session_lifetime"`
+	Active                     bool                     `bson:"active" json:"active"`
+	Internal                   bool                     `bson:"internal" json:"internal"`
+	AuthProvider               AuthProviderMeta         `bson:"auth_provider" json:"auth_provider"`
+	SessionProvider            SessionProviderMeta      `bson:"session_provider" json:"session_provider"`
+	EventHandlers              EventHandlerMetaConfig   `bson:"event_handlers" json:"event_handlers"`
+	EnableBatchRequestSupport  bool                     `bson:"enable_batch_request_support" json:"enable_batch_request_support"`
+	EnableIpWhiteListing       bool                     `mapstructure:"enable_ip_whitelisting" bson:"enable_ip_whitelisting" json:"enable_ip_whitelisting"`
+	AllowedIPs                 []string                 `mapstructure:"allowed_ips" bson:"allowed_ips" json:"allowed_ips"`
+	EnableIpBlacklisting       bool                     `mapstructure:"enable_ip_blacklisting" bson:"enable_ip_blacklisting" json:"enable_ip_blacklisting"`
+	BlacklistedIPs             []string                 `mapstructure:"blacklisted_ips" bson:"blacklisted_ips" json:"blacklisted_ips"`
+	DontSetQuotasOnCreate      bool                     `mapstructure:"dont_set_quota_on_create" bson:"dont_set_quota_on_create" json:"dont_set_quota_on_create"`
+	ExpireAnalyticsAfter       int64                    `mapstructure:"expire_analytics_after" bson:"expire_analytics_after" json:"expire_analytics_after"` // must have an expireAt TTL index set (http://docs.mongodb.org/manual/tutorial/expire-data/)
+	ResponseProcessors         []ResponseProcessor      `bson:"response_processors" json:"response_processors"`
+	CORS                       CORSConfig               `bson:"CORS" json:"CORS"`
+	Domain                     string                   `bson:"domain" json:"domain"`
+	Certificates               []string                 `bson:"certificates" json:"certificates"`
+	DoNotTrack                 bool                     `bson:"do_not_track" json:"do_not_track"`
+	AccessLog                  AccessLogConfig          `bson:"access_log" json:"access_log"`
+	Tags                       []string                 `bson:"tags" json:"tags"`
+	EnableContextVars          bool                     `bson:"enable_context_vars" json:"enable_context_vars"`
+	ConfigData                 map[string]interface{}   `bson:"config_data" json:"config_data"`
+	TagHeaders                 []string                 `bson:"tag_headers" json:"tag_headers"`
+	GlobalRateLimit            GlobalRateLimit          `bson:"global_rate_limit" json:"global_rate_limit"`
+	StripAuthData              bool                     `bson:"strip_auth_data" json:"strip_auth_data"`
+	EnableDetailedRecording    bool                     `bson:"enable_detailed_recording" json:"enable_detailed_recording"`
+	AnalyticsRedaction         AnalyticsRedactionConfig `bson:"analytics_redaction" json:"analytics_redaction"`
+	SLOs                       []SLOObjective           `bson:"slos" json:"slos"`
+	GraphQL                    GraphQLConfig            `bson:"graphql" json:"graphql"`
 }
 
 type UptimeTests struct {
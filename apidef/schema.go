@@ -42,6 +42,9 @@ const Schema = `{
         "do_not_track": {
             "type": "boolean"
         },
+        "access_log": {
+            "type": ["object", "null"]
+        },
         "enable_jwt": {
             "type": "boolean"
         },
@@ -156,6 +159,9 @@ const Schema = `{
         "client_certificates": {
             "type": ["array", "null"]
         },
+        "certificate_identity": {
+            "type": ["object", "null"]
+        },
         "upstream_certificates": {
             "type": ["object", "null"]
         },
@@ -253,6 +259,12 @@ const Schema = `{
         "enable_detailed_recording": {
             "type": "boolean"
         },
+        "analytics_redaction": {
+            "type": ["object", "null"]
+        },
+        "slos": {
+            "type": ["array", "null"]
+        },
         "enable_signature_checking": {
             "type": "boolean"
         },
@@ -3,6 +3,8 @@ package apidef
 import (
 	"errors"
 	"strings"
+
+	"github.com/TykTechnologies/tyk/regexp"
 )
 
 type ValidationResult struct {
@@ -51,6 +53,9 @@ type ValidationRuleSet []ValidationRule
 
 var DefaultValidationRuleSet = ValidationRuleSet{
 	&RuleUniqueDataSourceNames{},
+	&RuleOpenIDAudiences{},
+	&RuleCertificateIdentityCAs{},
+	&RuleAnalyticsRedactionPatterns{},
 }
 
 func Validate(definition *APIDefinition, ruleSet ValidationRuleSet) ValidationResult {
@@ -91,3 +96,57 @@ func (r *RuleUniqueDataSourceNames) Validate(apiDef *APIDefinition, validationRe
 		usedNames[trimmedName] = true
 	}
 }
+
+var ErrOpenIDNoAudience = errors.New("OpenID Connect providers should have at least one client ID or audience")
+
+// RuleOpenIDAudiences rejects OpenID Connect providers accepting no audience,
+// as their tokens would be issued to any client.
+type RuleOpenIDAudiences struct{}
+
+func (r *RuleOpenIDAudiences) Validate(apiDef *APIDefinition, validationResult *ValidationResult) {
+	if !apiDef.UseOpenID {
+		return
+	}
+
+	for i, provider := range apiDef.OpenIDOptions.Providers {
+		if len(provider.ClientIDs) > 0 || len(provider.Audiences) > 0 ||
+			apiDef.OpenIDOptions.BrowserLogin.Audience(i, provider.Issuer) != "" {
+			continue
+		}
+
+		validationResult.IsValid = false
+		validationResult.AppendError(ErrOpenIDNoAudience)
+		return
+	}
+}
+
+var ErrCertificateIdentityNoCA = errors.New("certificate identity requires at least one CA certificate")
+
+// RuleCertificateIdentityCAs rejects certificate identity without trusted CAs,
+// which would reject every client certificate.
+type RuleCertificateIdentityCAs struct{}
+
+func (r *RuleCertificateIdentityCAs) Validate(apiDef *APIDefinition, validationResult *ValidationResult) {
+	if !apiDef.CertificateIdentity.Enabled || len(apiDef.CertificateIdentity.CACertificates) > 0 {
+		return
+	}
+
+	validationResult.IsValid = false
+	validationResult.AppendError(ErrCertificateIdentityNoCA)
+}
+
+var ErrInvalidRedactionPattern = errors.New("invalid analytics redaction pattern")
+
+// RuleAnalyticsRedactionPatterns rejects analytics redaction patterns which
+// aren't valid regular expressions, as the data they should redact would be recorded.
+type RuleAnalyticsRedactionPatterns struct{}
+
+func (r *RuleAnalyticsRedactionPatterns) Validate(apiDef *APIDefinition, validationResult *ValidationResult) {
+	for _, pattern := range apiDef.AnalyticsRedaction.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			validationResult.IsValid = false
+			validationResult.AppendError(ErrInvalidRedactionPattern)
+			return
+		}
+	}
+}
@@ -119,3 +119,128 @@ func TestRuleUniqueDataSourceNames_Validate(t *testing.T) {
 	))
 
 }
+
+func TestRuleOpenIDAudiences_Validate(t *testing.T) {
+	ruleSet := ValidationRuleSet{
+		&RuleOpenIDAudiences{},
+	}
+
+	t.Run("should return invalid when a provider has no audience", runValidationTest(
+		&APIDefinition{
+			UseOpenID: true,
+			OpenIDOptions: OpenIDOptions{
+				Providers: []OIDProviderConfig{
+					{Issuer: "https://a.example.com", Audiences: []string{"api"}},
+					{Issuer: "https://b.example.com"},
+				},
+			},
+		},
+		ruleSet,
+		ValidationResult{
+			IsValid: false,
+			Errors: []error{
+				ErrOpenIDNoAudience,
+			},
+		},
+	))
+
+	t.Run("return valid when the browser login client is the audience", runValidationTest(
+		&APIDefinition{
+			UseOpenID: true,
+			OpenIDOptions: OpenIDOptions{
+				Providers: []OIDProviderConfig{
+					{Issuer: "https://a.example.com", ClientIDs: map[string]string{"Y2xpZW50": "policy"}},
+					{Issuer: "https://b.example.com/"},
+				},
+				BrowserLogin: OIDCBrowserLogin{Enabled: true, Issuer: "https://b.example.com", ClientID: "gateway"},
+			},
+		},
+		ruleSet,
+		ValidationResult{
+			IsValid: true,
+			Errors:  nil,
+		},
+	))
+
+	t.Run("return valid when OpenID Connect is disabled", runValidationTest(
+		&APIDefinition{
+			OpenIDOptions: OpenIDOptions{
+				Providers: []OIDProviderConfig{{Issuer: "https://a.example.com"}},
+			},
+		},
+		ruleSet,
+		ValidationResult{
+			IsValid: true,
+			Errors:  nil,
+		},
+	))
+}
+
+func TestRuleCertificateIdentityCAs_Validate(t *testing.T) {
+	ruleSet := ValidationRuleSet{
+		&RuleCertificateIdentityCAs{},
+	}
+
+	t.Run("should return invalid when there are no CA certificates", runValidationTest(
+		&APIDefinition{
+			CertificateIdentity: CertificateIdentity{Enabled: true},
+		},
+		ruleSet,
+		ValidationResult{
+			IsValid: false,
+			Errors: []error{
+				ErrCertificateIdentityNoCA,
+			},
+		},
+	))
+
+	t.Run("return valid when there are CA certificates", runValidationTest(
+		&APIDefinition{
+			CertificateIdentity: CertificateIdentity{Enabled: true, CACertificates: []string{"ca"}},
+		},
+		ruleSet,
+		ValidationResult{
+			IsValid: true,
+			Errors:  nil,
+		},
+	))
+
+	t.Run("return valid when certificate identity is disabled", runValidationTest(
+		&APIDefinition{},
+		ruleSet,
+		ValidationResult{
+			IsValid: true,
+			Errors:  nil,
+		},
+	))
+}
+
+func TestRuleAnalyticsRedactionPatterns_Validate(t *testing.T) {
+	ruleSet := ValidationRuleSet{
+		&RuleAnalyticsRedactionPatterns{},
+	}
+
+	t.Run("should return invalid when a pattern is invalid", runValidationTest(
+		&APIDefinition{
+			AnalyticsRedaction: AnalyticsRedactionConfig{Patterns: []string{`\d{16}`, `(`}},
+		},
+		ruleSet,
+		ValidationResult{
+			IsValid: false,
+			Errors: []error{
+				ErrInvalidRedactionPattern,
+			},
+		},
+	))
+
+	t.Run("return valid when the patterns are valid", runValidationTest(
+		&APIDefinition{
+			AnalyticsRedaction: AnalyticsRedactionConfig{Patterns: []string{`\d{16}`}},
+		},
+		ruleSet,
+		ValidationResult{
+			IsValid: true,
+			Errors:  nil,
+		},
+	))
+}
@@ -16,6 +16,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/TykTechnologies/tyk/storage"
@@ -30,6 +31,7 @@ type CertificateManager struct {
 	storage         storage.Handler
 	logger          *logrus.Entry
 	cache           *cache.Cache
+	secretMu        sync.RWMutex
 	secret          string
 	migrateCertList bool
 }
@@ -405,7 +407,7 @@ func (c *CertificateManager) List(certIDs []string, mode CertificateType) (out [
 			rawCert = []byte(val)
 		}
 
-		cert, err = ParsePEMCertificate(rawCert, c.secret)
+		cert, err = ParsePEMCertificate(rawCert, c.getSecret())
 		if err != nil {
 			c.logger.Error("Error while parsing certificate: ", id, " ", err)
 			c.logger.Debug("Failed certificate: ", string(rawCert))
@@ -538,7 +540,7 @@ func (c *CertificateManager) GetRaw(certID string) (string, error) {
 
 func (c *CertificateManager) Add(certData []byte, orgID string) (string, error) {
 
-	certID, certChainPEM, err := GetCertIDAndChainPEM(certData, c.secret)
+	certID, certChainPEM, err := GetCertIDAndChainPEM(certData, c.getSecret())
 	if err != nil {
 		c.logger.Error(err)
 		return "", err
@@ -605,6 +607,22 @@ func (c *CertificateManager) ValidateRequestCertificate(certIDs []string, r *htt
 	return errors.New("Certificate with SHA256 " + certID + " not allowed")
 }
 
+// SetSecret replaces the secret used to encrypt private keys, e.g. after it
+// was rotated, and drops the certificates decrypted with the previous one.
+func (c *CertificateManager) SetSecret(secret string) {
+	c.secretMu.Lock()
+	c.secret = secret
+	c.secretMu.Unlock()
+
+	c.FlushCache()
+}
+
+func (c *CertificateManager) getSecret() string {
+	c.secretMu.RLock()
+	defer c.secretMu.RUnlock()
+	return c.secret
+}
+
 func (c *CertificateManager) FlushCache() {
 	c.cache.Flush()
 }
@@ -105,8 +105,11 @@ type DBAppConfOptionsConfig struct {
 }
 
 type StorageOptionsConf struct {
-	// This should be set to `redis` (lowercase)
+	// This should be set to `redis` (lowercase), or to `embedded` to keep all the data in an on-disk store instead,
+	// for edge deployments and local development. The embedded store can't be shared by several Gateways.
 	Type string `json:"type"`
+	// The path of the file of the embedded store, `tyk.db` by default.
+	Path string `json:"path"`
 	// The Redis host, by default this is set to `localhost`, but for production this should be set to a cluster.
 	Host string `json:"host"`
 	// The Redis instance port.
@@ -180,6 +183,11 @@ type AnalyticsConfigConfig struct {
 	// This setting can be overridden with an organisation flag, enabed at an API level, or on individual Key level.
 	EnableDetailedRecording bool `json:"enable_detailed_recording"`
 
+	// Redaction rules applied to the detailed recording of all APIs, before records are stored.
+	// The lists of the rules are combined with the rules of the APIs, while the mode, replacement, body size and content types set on an API take precedence.
+	// When a pattern is invalid, the raw requests and responses are dropped from the records.
+	Redaction apidef.AnalyticsRedactionConfig `json:"redaction"`
+
 	// Tyk can store GeoIP information based on MaxMind DB’s to enable GeoIP tracking on inbound request analytics. Set this value to `true` and assign a DB using the `geo_ip_db_path` setting.
 	EnableGeoIP bool `json:"enable_geo_ip"`
 
@@ -207,9 +215,85 @@ type AnalyticsConfigConfig struct {
 	// You can set the interval length on how often the tyk Gateway will purge analytics data. This value is in seconds and defaults to 10 seconds.
 	PurgeInterval float32 `json:"purge_interval"`
 
+	// Sinks the analytics records are written to. When no sinks are set, records are written to Redis for Tyk Pump to process.
+	// Sinks can be combined, for instance to keep writing to Redis while also exporting records to Kafka.
+	Sinks []AnalyticsSinkConfig `json:"sinks"`
+
 	ignoredIPsCompiled map[string]bool
 }
 
+// AnalyticsSinkConfig configures a destination of the analytics records. Each sink buffers records separately, so a slow
+// sink doesn't hold back the others.
+type AnalyticsSinkConfig struct {
+	// Type of the sink: `redis`, `file`, `http` or `kafka`.
+	Type string `json:"type"`
+
+	// Number of records buffered for this sink. Default: 1000.
+	BufferSize int `json:"buffer_size"`
+
+	// Maximum number of records written in one batch. Default: 100.
+	BatchSize int `json:"batch_size"`
+
+	// Interval, in milliseconds, after which a partial batch is written. Default: 1000.
+	FlushInterval int `json:"flush_interval"`
+
+	// Time, in milliseconds, to wait for room in a full buffer before dropping a record. Waiting slows down the
+	// analytics workers, and in turn the requests, when the sink can't keep up. Default: 0, records are dropped immediately.
+	BlockTimeout int `json:"block_timeout"`
+
+	File  FileAnalyticsSinkConfig  `json:"file"`
+	HTTP  HTTPAnalyticsSinkConfig  `json:"http"`
+	Kafka KafkaAnalyticsSinkConfig `json:"kafka"`
+}
+
+// FileAnalyticsSinkConfig configures a sink writing records as JSON lines to a file.
+type FileAnalyticsSinkConfig struct {
+	// Path of the file. Rotated files are renamed with a timestamp suffix.
+	Path string `json:"path"`
+
+	// Size, in megabytes, at which the file is rotated. Default: 100.
+	MaxSizeMB int `json:"max_size_mb"`
+
+	// Number of rotated files to keep. Default: 0, all rotated files are kept.
+	MaxBackups int `json:"max_backups"`
+}
+
+// HTTPAnalyticsSinkConfig configures a sink posting batches of records, as a JSON array, to an HTTP endpoint.
+type HTTPAnalyticsSinkConfig struct {
+	URL string `json:"url"`
+
+	// Headers added to the requests, for instance to authenticate them.
+	Headers map[string]string `json:"headers"`
+
+	// Request timeout in seconds. Default: 10.
+	Timeout int `json:"timeout"`
+
+	// Number of times a batch is retried when the request fails or the endpoint responds with a 5xx status code.
+	MaxRetries int `json:"max_retries"`
+
+	SSLInsecureSkipVerify bool `json:"ssl_insecure_skip_verify"`
+}
+
+// KafkaAnalyticsSinkConfig configures a sink producing records, as JSON, to a Kafka topic. Records are keyed by API ID.
+type KafkaAnalyticsSinkConfig struct {
+	// Brokers used to discover the cluster, as host:port.
+	Brokers []string `json:"brokers"`
+
+	Topic string `json:"topic"`
+
+	ClientID string `json:"client_id"`
+
+	// Number of acknowledgements the partition leader waits for: 1 for the leader only, -1 for all in-sync replicas.
+	// Default: 1.
+	RequiredAcks int `json:"required_acks"`
+
+	// Connection and request timeout in seconds. Default: 10.
+	Timeout int `json:"timeout"`
+
+	UseSSL                bool `json:"use_ssl"`
+	SSLInsecureSkipVerify bool `json:"ssl_insecure_skip_verify"`
+}
+
 type HealthCheckConfig struct {
 	// Setting this value to `true` will enable the health-check endpoint on /Tyk/health.
 	EnableHealthChecks bool `json:"enable_health_checks"`
@@ -464,6 +548,237 @@ type NewRelicConfig struct {
 	LicenseKey string `json:"license_key"`
 }
 
+// AccessLogsConfig configures the access logs, one line per API request.
+type AccessLogsConfig struct {
+	// Log the requests of all APIs. APIs can opt in or out with their `access_log` setting.
+	Enabled bool `json:"enabled"`
+
+	// Format of the log lines: `json` (default), `logfmt` or `template`.
+	Format string `json:"format"`
+
+	// Go text/template rendering a line when the format is `template`. The fields are available by name, for
+	// instance `{{.method}} {{.path}} {{.status}}`.
+	Template string `json:"template"`
+
+	// File the lines are appended to. Defaults to the standard output, `stderr` writes to the standard error.
+	Path string `json:"path"`
+
+	// Fields of the lines, in order. Defaults to all of: timestamp, api_id, api_name, org_id, key, method, host, path,
+	// status, latency_total, latency_upstream, upstream_address, client_ip, user_agent and trace_id.
+	// Keys are hashed, or obfuscated when key hashing is disabled.
+	Fields []string `json:"fields"`
+
+	// Request headers added to the lines as `header.<name>` fields.
+	RequestHeaders []string `json:"request_headers"`
+
+	// Context variables added to the lines as `ctx.<name>` fields. The API must have context variables enabled.
+	ContextVariables []string `json:"context_variables"`
+
+	// Fraction of the requests logged, between 0 and 1. Default: 1, all requests are logged.
+	SampleRate float64 `json:"sample_rate"`
+}
+
+// RealtimeStatsConfig configures the in-memory traffic statistics served on the control API.
+type RealtimeStatsConfig struct {
+	// Keep sliding window statistics per API and per key, served on `/tyk/stats/apis` and streamed on `/tyk/stats/stream`.
+	// They don't depend on analytics being enabled.
+	Enabled bool `json:"enabled"`
+
+	// Length of the sliding window in seconds. Default: 60.
+	Window int `json:"window"`
+
+	// Maximum number of keys tracked per API. Keys idle for a whole window are replaced first. Default: 100.
+	MaxKeys int `json:"max_keys"`
+
+	// Number of paths and keys listed in the API statistics, the ones with the most requests. Default: 10.
+	TopN int `json:"top_n"`
+
+	// Interval in seconds between the events of the statistics stream. Default: 1.
+	StreamInterval int `json:"stream_interval"`
+}
+
+// DebugTracingConfig configures the tracing of live requests through the middleware chain.
+type DebugTracingConfig struct {
+	// Trace the requests carrying a signed `X-Tyk-Debug` header or matching a debug rule set with `/tyk/debug/rules`.
+	// The ID of the trace is returned in the `X-Tyk-Debug-Trace-Id` response header and the trace is served on `/tyk/debug/traces/{traceID}`.
+	Enabled bool `json:"enabled"`
+
+	// Secret signing the `X-Tyk-Debug` header values, which are issued by `/tyk/debug/tokens`. Tracing by header is disabled when not set.
+	Secret string `json:"secret"`
+
+	// Seconds the traces are kept for. Default: 600.
+	TraceTTL int64 `json:"trace_ttl"`
+
+	// Maximum number of bytes of the transformed bodies kept in traces. Default: 4096.
+	MaxBodySize int `json:"max_body_size"`
+}
+
+// FileWatchConfig configures watching the API definition and policy directories in file mode.
+type FileWatchConfig struct {
+	// Watch `app_path` and `policies.policy_path` for changes and reload the APIs and policies when their files change.
+	// A file which can't be parsed or fails validation is reported, and its last good version stays in service.
+	Enabled bool `json:"enabled"`
+
+	// Milliseconds to wait for further changes before reloading. Default: 500.
+	Debounce int64 `json:"debounce"`
+}
+
+// HealthProbesConfig configures the liveness, readiness and startup endpoints.
+type HealthProbesConfig struct {
+	// Serve the liveness, readiness and startup endpoints next to the health check endpoint.
+	// They respond with 503 when one of their probes fails, and report the state of each probe in the details.
+	Enabled bool `json:"enabled"`
+
+	// Name of the liveness endpoint. Default: "live".
+	LivenessEndpointName string `json:"liveness_endpoint_name"`
+
+	// Name of the readiness endpoint. Default: "ready".
+	ReadinessEndpointName string `json:"readiness_endpoint_name"`
+
+	// Name of the startup endpoint. Default: "startup".
+	StartupEndpointName string `json:"startup_endpoint_name"`
+
+	// Milliseconds of Redis latency from which the Redis probe warns. Default: 100.
+	RedisLatencyWarn int64 `json:"redis_latency_warn"`
+
+	// Milliseconds of Redis latency from which the Redis probe fails. Default: 1000.
+	RedisLatencyFail int64 `json:"redis_latency_fail"`
+
+	// Percentage of the analytics buffer in use from which the analytics probe warns. Default: 80.
+	AnalyticsBacklogWarn int `json:"analytics_backlog_warn"`
+
+	// Percentage of the analytics buffer in use from which the analytics probe fails. Default: 100.
+	AnalyticsBacklogFail int `json:"analytics_backlog_fail"`
+
+	// Fail readiness when the plugin bundle of an API can't be fetched, instead of warning.
+	FailOnBundleErrors bool `json:"fail_on_bundle_errors"`
+
+	// Names of the built-in probes to disable: "apis", "redis", "rpc", "bundles" and "analytics".
+	DisabledProbes []string `json:"disabled_probes"`
+}
+
+// ControlAPIAccessConfig configures named credentials for the Gateway API. When `secret` is empty and credentials are
+// configured, only the credentials are accepted.
+type ControlAPIAccessConfig struct {
+	// Credentials accepted by the Gateway API besides the shared `secret`.
+	Credentials []ControlAPICredential `json:"credentials"`
+
+	// Roles which can be granted to the credentials, by name.
+	Roles map[string]ControlAPIRole `json:"roles"`
+}
+
+// ControlAPICredential is a named credential for the Gateway API.
+type ControlAPICredential struct {
+	// Name of the credential, recorded in the audit log.
+	Name string `json:"name"`
+
+	// Secret sent in the `X-Tyk-Authorization` header. Supports KV references, for instance `secrets://ci`.
+	Secret string `json:"secret"`
+
+	// SHA256 fingerprint of the client certificate identifying the credential instead of a secret. Requires
+	// `security.control_api_use_mutual_tls`.
+	Certificate string `json:"certificate"`
+
+	// Names of the roles granted to the credential. A request is allowed when one of them allows it.
+	Roles []string `json:"roles"`
+}
+
+// ControlAPIRole limits what a credential can do with the Gateway API.
+type ControlAPIRole struct {
+	// Resources the role gives access to: `keys`, `apis`, `policies`, `certs`, `oauth`, `cache`, `reload`, `orgs`,
+	// `debug`, `stats`, `audit` and `health`, or `*` for all of them.
+	Resources []string `json:"resources"`
+
+	// Actions allowed on the resources: `read`, `write`, or both. Reloads are writes.
+	Actions []string `json:"actions"`
+
+	// Organisations the role is limited to, all of them when empty. The organisation of a request is taken from the
+	// `org_id` query parameter and request body field, and from the API, policy or key it is for. Requests whose
+	// organisation can't be told, such as listing all APIs, are denied. Listings of APIs and policies only include
+	// those of the organisations of the role.
+	Orgs []string `json:"orgs"`
+}
+
+// KeyIndexConfig configures the secondary index of the keys, used by the paginated key listing of the Gateway API.
+type KeyIndexConfig struct {
+	// Index the keys by organisation, policy, tag, alias and inactive flag when the Gateway stores or deletes them,
+	// so that filtered key listings don't scan the whole key store. The index is built in the background when it
+	// doesn't exist yet, listings scanning the key store until it is. Expired keys are dropped from the index when
+	// listed.
+	Enabled bool `json:"enabled"`
+
+	// How long the index is trusted after being built, in seconds, 3600 by default. It is rebuilt from the key
+	// store afterwards, listings scanning the key store meanwhile, to pick up the keys written by Gateways with the
+	// index disabled or directly to Redis. Those keys are missing from the index listings until then, so enable the
+	// index on all the Gateways sharing the key store.
+	ReconcileInterval int64 `json:"reconcile_interval"`
+}
+
+// DegradedModeConfig configures how the Gateway keeps serving traffic while Redis is unreachable.
+type DegradedModeConfig struct {
+	// Keep serving traffic during Redis outages: keys are served from the local session cache, rate limits are
+	// enforced in memory by each Gateway, and quota increments and analytics records are buffered to disk until Redis
+	// is reachable again. Keys which weren't cached when Redis became unreachable are rejected, so the local session
+	// cache must be enabled. The `DegradedModeEntered` and `DegradedModeLeft` events are fired on the transitions.
+	Enabled bool `json:"enabled"`
+
+	// File quota increments and analytics records are buffered to. Default: "tyk-degraded.db".
+	BufferPath string `json:"buffer_path"`
+}
+
+// AuditLogConfig configures the audit log of the changes made through the Gateway API.
+type AuditLogConfig struct {
+	// Record every change made through the Gateway API: who made it, to which resource, the changed fields and the
+	// outcome. Recent entries are served on `/tyk/audit`.
+	Enabled bool `json:"enabled"`
+
+	// Sink the entries are written to: `file`, `redis` or `webhook`. When not set, entries are only kept in memory.
+	Sink string `json:"sink"`
+
+	// File the entries are appended to as JSON lines, for the `file` sink.
+	Path string `json:"path"`
+
+	// Redis stream the entries are added to, for the `redis` sink. Default: "tyk-audit-log".
+	Stream string `json:"stream"`
+
+	// Approximate maximum length of the Redis stream. Default: 10000.
+	StreamMaxLen int64 `json:"stream_max_len"`
+
+	// URL each entry is posted to as JSON, for the `webhook` sink.
+	WebhookURL string `json:"webhook_url"`
+
+	// Headers added to the webhook requests, for instance to authenticate them.
+	WebhookHeaders map[string]string `json:"webhook_headers"`
+
+	// Timeout of the webhook requests in seconds. Default: 10.
+	WebhookTimeout int `json:"webhook_timeout"`
+
+	// Number of recent entries kept in memory and served on `/tyk/audit`. Default: 1000.
+	RecentEntries int `json:"recent_entries"`
+}
+
+// PrometheusConfig configures the Prometheus metrics endpoint
+type PrometheusConfig struct {
+	// Enable the Prometheus metrics endpoint
+	Enabled bool `json:"enabled"`
+
+	// Address to serve the metrics on, for instance ":9090". If not set, metrics are served on the control API.
+	ListenAddress string `json:"listen_address"`
+
+	// Path of the metrics endpoint. Defaults to `/metrics`.
+	Path string `json:"path"`
+
+	// Labels added to the request metrics, any of `api_id`, `version`, `method` and `status`.
+	// Removing labels reduces the number of series. Defaults to all of them.
+	Labels []string `json:"labels"`
+
+	// Report the status label as its class, for instance `2xx`, instead of the exact code.
+	GroupStatusCodes bool `json:"group_status_codes"`
+
+	// Upper bounds, in seconds, of the latency histogram buckets.
+	Buckets []float64 `json:"buckets"`
+}
+
 type Tracer struct {
 	// The name of the tracer to initialize. For instance appdash, to use appdash tracer
 	Name string `json:"name"`
@@ -540,6 +855,9 @@ type Config struct {
 	// Tyk assumes that you are sensible enough not to expose the management endpoints publicly and to keep this configuration value to yourself.
 	Secret string `json:"secret"`
 
+	// Named credentials for the Gateway API, each limited by roles. The shared `secret` keeps full access.
+	ControlAPIAccess ControlAPIAccessConfig `json:"control_api_access"`
+
 	// The shared secret between the Gateway and the Dashboard to ensure that API Definition downloads, heartbeat and Policy loads are from a valid source.
 	NodeSecret string `json:"node_secret"`
 
@@ -579,9 +897,16 @@ type Config struct {
 	// Allows the listing of hashed API keys
 	EnableHashedKeysListing bool `json:"enable_hashed_keys_listing"`
 
+	// Secondary index of the keys, for filtered key listings
+	KeyIndex KeyIndexConfig `json:"key_index"`
+
 	// Minimum API token length
 	MinTokenLength int `json:"min_token_length"`
 
+	// KeyRotationGracePeriod is the default number of seconds a rotated key stays valid next to its
+	// successor, see `POST /tyk/keys/{keyName}/rotate`. Defaults to 3600.
+	KeyRotationGracePeriod int64 `json:"key_rotation_grace_period"`
+
 	// Path to error and webhook templates. Defaults to the current binary path.
 	TemplatePath string `json:"template_path"`
 
@@ -603,6 +928,13 @@ type Config struct {
 	// See the API section of the Tyk Gateway API for more details.
 	AppPath string `json:"app_path"`
 
+	// Section for configuring watching `app_path` and `policies.policy_path` for changes
+	FileWatch FileWatchConfig `json:"file_watch"`
+
+	// Number of versions kept in the history of every API definition and policy changed through the Gateway API in file mode,
+	// see `GET /tyk/apis/{apiID}/history`. Defaults to 10, set to -1 to keep no history.
+	FileHistorySize int `json:"file_history_size"`
+
 	// If you are a Tyk Pro user, this option will enable polling the Dashboard service for API definitions.
 	// On startup Tyk will attempt to connect and download any relevant application configurations from from your Dashboard instance.
 	// The files are exactly the same as the JSON files on disk with the exception of a BSON ID supplied by the Dashboard service.
@@ -614,6 +946,9 @@ type Config struct {
 	// This section defines your Redis configuration.
 	Storage StorageOptionsConf `json:"storage"`
 
+	// Keep serving traffic when Redis is unreachable.
+	DegradedMode DegradedModeConfig `json:"degraded_mode"`
+
 	// Disable the capability of the Gateway to `autodiscover` the Dashboard through heartbeat messages via Redis.
 	// The goal of zeroconf is auto-discovery, so you do not have to specify the Tyk Dashboard address in your Gateway`tyk.conf` file.
 	// In some specific cases, for example, when the Dashboard is bound to a public domain, not accessible inside an internal network, or similar, `disable_dashboard_zeroconf` can be set to `true`, in favour of directly specifying a Tyk Dashboard address.
@@ -869,6 +1204,24 @@ type Config struct {
 
 	NewRelic NewRelicConfig `json:"newrelic"`
 
+	// Section for configuring the Prometheus metrics endpoint
+	Prometheus PrometheusConfig `json:"prometheus"`
+
+	// Section for configuring the access logs, written for each API request
+	AccessLogs AccessLogsConfig `json:"access_logs"`
+
+	// Section for configuring the real-time traffic statistics of the control API
+	RealtimeStats RealtimeStatsConfig `json:"realtime_stats"`
+
+	// Section for configuring the tracing of live requests for debugging
+	DebugTracing DebugTracingConfig `json:"debug_tracing"`
+
+	// Section for configuring the liveness, readiness and startup probes
+	HealthProbes HealthProbesConfig `json:"health_probes"`
+
+	// Section for configuring the audit log of the Gateway API
+	AuditLog AuditLogConfig `json:"audit_log"`
+
 	// Enable debugging of your Tyk Gateway by exposing profiling information through https://tyk.io/docs/troubleshooting/tyk-gateway/profiling/
 	HTTPProfile bool `json:"enable_http_profiler"`
 
@@ -930,6 +1283,17 @@ type Config struct {
 	KV struct {
 		Consul ConsulConfig `json:"consul"`
 		Vault  VaultConfig  `json:"vault"`
+		File   FileKVConfig `json:"file"`
+		Env    EnvKVConfig  `json:"env"`
+		// WatchInterval is how often, in seconds, resolved KV references are checked for
+		// rotated values. A change reloads the APIs and the affected configuration values.
+		// Disabled when 0.
+		WatchInterval int `json:"watch_interval"`
+		// APIDefinitionStores lists the stores whose references are resolved in the secret
+		// fields of API definitions, such as injected headers and signing secrets, e.g.
+		// ["vault", "file"]. References to other stores are left as they are, except for the
+		// secrets of the OpenID Connect browser login, which are rejected.
+		APIDefinitionStores []string `json:"api_definition_stores"`
 	} `json:"kv"`
 
 	// Secrets are key-value pairs that can be accessed in the dashboard via "secrets://"
@@ -971,6 +1335,19 @@ type TykError struct {
 	Code    int    `json:"code"`
 }
 
+// FileKVConfig configures the "file://" KV store.
+type FileKVConfig struct {
+	// BaseDir is the directory keys are read from, e.g. the mount path of a Kubernetes
+	// secret. Keys are paths relative to it, the store is disabled when it's empty.
+	BaseDir string `json:"base_dir"`
+}
+
+// EnvKVConfig configures the "env://" KV store.
+type EnvKVConfig struct {
+	// Prefix of the environment variables, defaults to TYK_SECRET_.
+	Prefix string `json:"prefix"`
+}
+
 // VaultConfig is used to configure the creation of a client
 // This is a stripped down version of the config structure in vault's API client
 type VaultConfig struct {
@@ -1151,7 +1528,7 @@ func Load(paths []string, conf *Config) error {
 	if err := envconfig.Process(envPrefix, conf); err != nil {
 		return fmt.Errorf("failed to process config env vars: %v", err)
 	}
-	if err := processCustom(envPrefix, conf, loadZipkin, loadJaeger); err != nil {
+	if err := processCustom(envPrefix, conf, loadZipkin, loadJaeger, loadOpenTelemetry); err != nil {
 		return fmt.Errorf("failed to process config custom loader: %v", err)
 	}
 	return nil
@@ -47,6 +47,33 @@ type Sampler struct {
 	Mod uint64 `json:"mod"`
 }
 
+// OpenTelemetryConfig configuration options used to initialize the
+// OpenTelemetry tracer, exporting spans with OTLP.
+type OpenTelemetryConfig struct {
+	// Exporter is the OTLP transport, "grpc" or "http". Defaults to "grpc".
+	Exporter string `json:"exporter"`
+	// Endpoint of the collector, for instance "localhost:4317" for gRPC or
+	// "http://localhost:4318" for HTTP, where "/v1/traces" is added when the
+	// URL has no path.
+	Endpoint string `json:"endpoint"`
+	// Headers sent with every export, for instance for authentication.
+	Headers map[string]string `json:"headers"`
+	// Insecure disables TLS for the gRPC exporter.
+	Insecure bool `json:"insecure"`
+	// Timeout of an export in seconds. Defaults to 10.
+	Timeout int `json:"timeout"`
+	// BatchSize is the maximum number of spans in an export. Defaults to 512.
+	BatchSize int `json:"batch_size"`
+	// MaxQueueSize is the number of spans waiting to be exported above which
+	// spans are dropped. Defaults to 2048.
+	MaxQueueSize int `json:"max_queue_size"`
+	// FlushInterval is the time in milliseconds between exports. Defaults to 5000.
+	FlushInterval int `json:"flush_interval"`
+	// ResourceAttributes are added to the resource of the exported spans,
+	// along with service.name.
+	ResourceAttributes map[string]string `json:"resource_attributes"`
+}
+
 // DecodeJSON marshals src to json and tries to unmarshal the result into
 // dest.
 func DecodeJSON(dest, src interface{}) error {
@@ -97,6 +124,40 @@ func loadZipkin(prefix string, c *Config) error {
 	return nil
 }
 
+// loadOpenTelemetry tries to load OpenTelemetry configuration from environment variables.
+//
+// list of OpenTelemetry configuration env variables
+//
+// TYK_GW_TRACER_OPTIONS_EXPORTER
+// TYK_GW_TRACER_OPTIONS_ENDPOINT
+// TYK_GW_TRACER_OPTIONS_HEADERS
+// TYK_GW_TRACER_OPTIONS_INSECURE
+// TYK_GW_TRACER_OPTIONS_TIMEOUT
+// TYK_GW_TRACER_OPTIONS_BATCHSIZE
+// TYK_GW_TRACER_OPTIONS_MAXQUEUESIZE
+// TYK_GW_TRACER_OPTIONS_FLUSHINTERVAL
+// TYK_GW_TRACER_OPTIONS_RESOURCEATTRIBUTES
+func loadOpenTelemetry(prefix string, c *Config) error {
+	if c.Tracer.Name != "opentelemetry" {
+		return nil
+	}
+	var otel OpenTelemetryConfig
+	if err := DecodeJSON(&otel, c.Tracer.Options); err != nil {
+		return err
+	}
+	qualifyPrefix := prefix + "_TRACER_OPTIONS"
+	err := envconfig.Process(qualifyPrefix, &otel)
+	if err != nil {
+		return err
+	}
+	o := make(map[string]interface{})
+	if err := DecodeJSON(&o, otel); err != nil {
+		return err
+	}
+	c.Tracer.Options = o
+	return nil
+}
+
 // loads jaeger configuration from environment variables.
 //
 // List of jaeger configuration env vars
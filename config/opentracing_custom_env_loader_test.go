@@ -102,3 +102,45 @@ func TestLoadJaeger(t *testing.T) {
 		}
 	})
 }
+
+func TestLoadOpenTelemetry(t *testing.T) {
+	sample := []struct {
+		env   string
+		value string
+	}{
+		{"TYK_GW_TRACER_OPTIONS_EXPORTER", "http"},
+		{"TYK_GW_TRACER_OPTIONS_ENDPOINT", "http://collector:4318"},
+		{"TYK_GW_TRACER_OPTIONS_BATCHSIZE", "100"},
+	}
+
+	t.Run("Loads env vars", func(t *testing.T) {
+		for _, v := range sample {
+			err := os.Setenv(v.env, v.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		defer func() {
+			for _, v := range sample {
+				os.Unsetenv(v.env)
+			}
+		}()
+
+		var conf Config
+		err := Load([]string{"testdata/opentelemetry.json"}, &conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got OpenTelemetryConfig
+		err = DecodeJSON(&got, conf.Tracer.Options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Exporter != "http" || got.Endpoint != "http://collector:4318" || got.BatchSize != 100 {
+			t.Errorf("env vars not loaded, got %#v", got)
+		}
+		if !got.Insecure || got.Headers["x-api-key"] != "secret" {
+			t.Errorf("expected file options to be kept, got %#v", got)
+		}
+	})
+}
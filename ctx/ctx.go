@@ -41,6 +41,10 @@ const (
 	RequestStatus
 	GraphQLRequest
 	GraphQLIsWebSocketUpgrade
+	RequestStartTime
+	DebugTrace
+	UpstreamTiming
+	ControlAPICredential
 )
 
 func setContext(r *http.Request, ctx context.Context) {
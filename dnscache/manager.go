@@ -20,6 +20,22 @@ var (
 
 type DialContextFunc func(ctx context.Context, network, address string) (net.Conn, error)
 
+// LookupInfo describes how the cache resolved the address of a host.
+type LookupInfo struct {
+	Host     string
+	CacheHit bool
+	Duration time.Duration
+	Err      error
+}
+
+type lookupHookKey struct{}
+
+// WithLookupHook returns a context reporting the lookups of the cached dials
+// made with it to fn, as these don't go through the httptrace DNS hooks.
+func WithLookupHook(ctx context.Context, fn func(LookupInfo)) context.Context {
+	return context.WithValue(ctx, lookupHookKey{}, fn)
+}
+
 // IDnsCacheManager is an interface for abstracting interaction with dns cache. Implemented by DnsCacheManager
 type IDnsCacheManager interface {
 	InitDNSCaching(ttl, checkInterval time.Duration)
@@ -98,7 +114,12 @@ func (m *DnsCacheManager) doCachedDial(d *net.Dialer, ctx context.Context, netwo
 		return safeDial(address, "")
 	}
 
+	_, cacheHit := m.cacheStorage.Get(host)
+	start := time.Now()
 	ips, err := m.cacheStorage.FetchItem(host)
+	if hook, ok := ctx.Value(lookupHookKey{}).(func(LookupInfo)); ok {
+		hook(LookupInfo{Host: host, CacheHit: cacheHit, Duration: time.Since(start), Err: err})
+	}
 	if err != nil {
 		logger.WithError(err).WithFields(logrus.Fields{
 			"network": network,
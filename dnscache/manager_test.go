@@ -139,3 +139,35 @@ func TestWrapDialerDialContextFunc(t *testing.T) {
 		})
 	}
 }
+
+func TestWrapDialerLookupHook(t *testing.T) {
+	cached := map[string]bool{}
+	storage := &MockStorage{
+		MockFetchItem: func(key string) ([]string, error) {
+			cached[key] = true
+			return []string{"192.0.2.10"}, nil
+		},
+		MockGet: func(key string) (DnsCacheItem, bool) {
+			return DnsCacheItem{}, cached[key]
+		},
+		MockDelete: func(key string) {},
+	}
+	dnsManager := NewDnsCacheManager(config.PickFirstStrategy)
+	dnsManager.SetCacheStorage(storage)
+
+	var lookups []LookupInfo
+	ctx, cancel := context.WithCancel(WithLookupHook(context.TODO(), func(info LookupInfo) {
+		lookups = append(lookups, info)
+	}))
+	cancel() //Manually disable connection establishment
+
+	dial := dnsManager.WrapDialer(&net.Dialer{Timeout: time.Second})
+	for i := 0; i < 2; i++ {
+		dial(ctx, "tcp", "orig-host.com:80")
+	}
+	dial(ctx, "tcp", "192.0.2.10:80")
+
+	if len(lookups) != 2 || lookups[0].Host != "orig-host.com" || lookups[0].CacheHit || !lookups[1].CacheHit {
+		t.Fatalf("unexpected lookups %+v", lookups)
+	}
+}
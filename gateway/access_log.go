@@ -0,0 +1,326 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/trace"
+)
+
+// Access log formats
+const (
+	accessLogJSON     = "json"
+	accessLogLogfmt   = "logfmt"
+	accessLogTemplate = "template"
+)
+
+// Access log fields
+const (
+	accessLogTimestamp       = "timestamp"
+	accessLogAPIID           = "api_id"
+	accessLogAPIName         = "api_name"
+	accessLogOrgID           = "org_id"
+	accessLogKey             = "key"
+	accessLogMethod          = "method"
+	accessLogHost            = "host"
+	accessLogPath            = "path"
+	accessLogStatus          = "status"
+	accessLogLatencyTotal    = "latency_total"
+	accessLogLatencyUpstream = "latency_upstream"
+	accessLogUpstreamAddress = "upstream_address"
+	accessLogClientIP        = "client_ip"
+	accessLogUserAgent       = "user_agent"
+	accessLogTraceID         = "trace_id"
+)
+
+var defaultAccessLogFields = []string{
+	accessLogTimestamp, accessLogAPIID, accessLogAPIName, accessLogOrgID, accessLogKey, accessLogMethod, accessLogHost,
+	accessLogPath, accessLogStatus, accessLogLatencyTotal, accessLogLatencyUpstream, accessLogUpstreamAddress,
+	accessLogClientIP, accessLogUserAgent, accessLogTraceID,
+}
+
+// accessLogField is a field of an access log line.
+type accessLogField struct {
+	name  string
+	value interface{}
+}
+
+// accessLogger writes one line per API request.
+type accessLogger struct {
+	gw   *Gateway
+	conf config.AccessLogsConfig
+
+	fields   []string
+	template *template.Template
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// setupAccessLog creates the access logger. It is set up even when access
+// logs are disabled globally, as APIs can enable them.
+func (gw *Gateway) setupAccessLog() {
+	gw.accessLog.close()
+	gw.accessLog = nil
+
+	conf := gw.GetConfig().AccessLogs
+
+	l := &accessLogger{gw: gw, conf: conf, fields: conf.Fields}
+	if len(l.fields) == 0 {
+		l.fields = defaultAccessLogFields
+	}
+
+	switch conf.Format {
+	case "", accessLogJSON, accessLogLogfmt:
+	case accessLogTemplate:
+		tmpl, err := template.New("access_log").Option("missingkey=zero").Parse(conf.Template)
+		if err != nil {
+			log.WithError(err).Error("Invalid access log template, access logs are disabled")
+			return
+		}
+		l.template = tmpl
+	default:
+		log.Errorf("Unknown access log format %q, access logs are disabled", conf.Format)
+		return
+	}
+
+	gw.accessLog = l
+}
+
+// enabled reports whether the requests to the API are logged.
+func (l *accessLogger) enabled(spec *APISpec) bool {
+	if l == nil || spec.AccessLog.Disabled {
+		return false
+	}
+	return l.conf.Enabled || spec.AccessLog.Enabled
+}
+
+// writer returns the output of the logs, opening the log file on first use.
+func (l *accessLogger) writer() (io.Writer, error) {
+	if l.w != nil {
+		return l.w, nil
+	}
+
+	switch l.conf.Path {
+	case "", "stdout":
+		l.w = os.Stdout
+	case "stderr":
+		l.w = os.Stderr
+	default:
+		f, err := os.OpenFile(l.conf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		l.w = f
+	}
+	return l.w, nil
+}
+
+// close closes the log file, if any.
+func (l *accessLogger) close() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f, ok := l.w.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+		f.Close()
+	}
+	l.w = nil
+}
+
+// logRequest writes the access log line of a request, if the API has access
+// logs enabled and the request is sampled.
+// Latencies are in milliseconds.
+func (l *accessLogger) logRequest(spec *APISpec, r *http.Request, code int, latency Latency, resp *http.Response) {
+	if !l.enabled(spec) {
+		return
+	}
+	if rate := l.conf.SampleRate; rate > 0 && rate < 1 && rand.Float64() >= rate {
+		return
+	}
+
+	line, err := l.format(l.collect(spec, r, code, latency, resp))
+	if err != nil {
+		log.WithError(err).Error("Failed to format access log")
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, err := l.writer()
+	if err != nil {
+		log.WithError(err).Error("Failed to open access log")
+		return
+	}
+	if _, err := w.Write(line); err != nil {
+		log.WithError(err).Error("Failed to write access log")
+	}
+}
+
+// collect returns the configured fields of a request.
+func (l *accessLogger) collect(spec *APISpec, r *http.Request, code int, latency Latency, resp *http.Response) []accessLogField {
+	fields := make([]accessLogField, 0, len(l.fields)+len(l.conf.RequestHeaders)+len(l.conf.ContextVariables))
+
+	for _, name := range l.fields {
+		var value interface{}
+		switch name {
+		case accessLogTimestamp:
+			value = time.Now().UTC().Format(time.RFC3339Nano)
+		case accessLogAPIID:
+			value = spec.APIID
+		case accessLogAPIName:
+			value = spec.Name
+		case accessLogOrgID:
+			value = spec.OrgID
+		case accessLogKey:
+			value = l.key(r)
+		case accessLogMethod:
+			value = r.Method
+		case accessLogHost:
+			value = r.Host
+		case accessLogPath:
+			value = r.URL.Path
+		case accessLogStatus:
+			value = code
+		case accessLogLatencyTotal:
+			value = latency.Total
+		case accessLogLatencyUpstream:
+			value = latency.Upstream
+		case accessLogUpstreamAddress:
+			if resp != nil && resp.Request != nil && resp.Request.URL != nil {
+				value = resp.Request.URL.Host
+			} else {
+				value = ""
+			}
+		case accessLogClientIP:
+			value = request.RealIP(r)
+		case accessLogUserAgent:
+			value = r.Header.Get(headers.UserAgent)
+		case accessLogTraceID:
+			value = trace.TraceID(r.Context())
+		default:
+			continue
+		}
+		fields = append(fields, accessLogField{name: name, value: value})
+	}
+
+	for _, name := range l.conf.RequestHeaders {
+		fields = append(fields, accessLogField{name: "header." + strings.ToLower(name), value: r.Header.Get(name)})
+	}
+
+	if len(l.conf.ContextVariables) > 0 {
+		data := ctxGetData(r)
+		for _, name := range l.conf.ContextVariables {
+			value, ok := data[name]
+			if !ok {
+				value = ""
+			}
+			fields = append(fields, accessLogField{name: "ctx." + name, value: value})
+		}
+	}
+
+	return fields
+}
+
+// key returns the key of the request, hashed as in the analytics records or
+// obfuscated when key hashing is disabled.
+func (l *accessLogger) key(r *http.Request) string {
+	token := ctxGetAuthToken(r)
+	if token == "" {
+		return ""
+	}
+
+	conf := l.gw.GetConfig()
+	if conf.HashKeys {
+		return storage.HashKey(token, true)
+	}
+	return l.gw.obfuscateKey(token)
+}
+
+func (l *accessLogger) format(fields []accessLogField) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch {
+	case l.template != nil:
+		data := make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			data[f.name] = f.value
+		}
+		if err := l.template.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+
+	case l.conf.Format == accessLogLogfmt:
+		for i, f := range fields {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(f.name)
+			buf.WriteByte('=')
+			buf.WriteString(logfmtValue(f.value))
+		}
+		buf.WriteByte('\n')
+
+	default:
+		buf.WriteByte('{')
+		for i, f := range fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(f.name)
+			value, err := json.Marshal(f.value)
+			if err != nil {
+				value, _ = json.Marshal(fmt.Sprint(f.value))
+			}
+			buf.Write(name)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteString("}\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// logfmtValue formats a value, quoting it when it's empty or contains
+// spaces, quotes, equal signs or control characters.
+func logfmtValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '=' || r == '\\' || r == 0x7f
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func readAccessLog(t *testing.T, path string) (lines []map[string]interface{}) {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid access log line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestAccessLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-access-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.AccessLogs = config.AccessLogsConfig{
+			Enabled:        true,
+			Path:           path,
+			Fields:         []string{accessLogAPIID, accessLogMethod, accessLogPath, accessLogStatus, accessLogKey, accessLogUpstreamAddress},
+			RequestHeaders: []string{"X-Request-Id"},
+		}
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "logged"
+		spec.Proxy.ListenPath = "/logged/"
+	}, func(spec *APISpec) {
+		spec.APIID = "protected"
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/protected/"
+	}, func(spec *APISpec) {
+		spec.APIID = "disabled"
+		spec.AccessLog.Disabled = true
+		spec.Proxy.ListenPath = "/disabled/"
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/logged/a", Headers: map[string]string{"X-Request-Id": "abc"}, Code: http.StatusOK},
+		{Path: "/protected/b", Code: http.StatusUnauthorized},
+		{Path: "/disabled/c", Code: http.StatusOK},
+	}...)
+
+	lines := readAccessLog(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 access log lines, got %v", lines)
+	}
+
+	if lines[0]["api_id"] != "logged" || lines[0]["path"] != "/logged/a" || lines[0]["status"] != float64(http.StatusOK) ||
+		lines[0]["header.x-request-id"] != "abc" || lines[0]["upstream_address"] == "" {
+		t.Errorf("unexpected access log line %v", lines[0])
+	}
+	if lines[1]["api_id"] != "protected" || lines[1]["status"] != float64(http.StatusUnauthorized) || lines[1]["key"] != "" {
+		t.Errorf("unexpected access log line %v", lines[1])
+	}
+}
+
+func TestAccessLogEnabledPerAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-access-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.AccessLogs.Path = path
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "enabled"
+		spec.AccessLog.Enabled = true
+		spec.Proxy.ListenPath = "/enabled/"
+	}, func(spec *APISpec) {
+		spec.APIID = "default"
+		spec.Proxy.ListenPath = "/default/"
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/enabled/", Code: http.StatusOK},
+		{Path: "/default/", Code: http.StatusOK},
+	}...)
+
+	lines := readAccessLog(t, path)
+	if len(lines) != 1 || lines[0]["api_id"] != "enabled" {
+		t.Fatalf("expected a single line for the enabled API, got %v", lines)
+	}
+	for _, field := range defaultAccessLogFields {
+		if _, ok := lines[0][field]; !ok {
+			t.Errorf("expected field %q in %v", field, lines[0])
+		}
+	}
+}
+
+func TestAccessLogFormat(t *testing.T) {
+	fields := []accessLogField{
+		{name: "method", value: "GET"},
+		{name: "status", value: 200},
+		{name: "latency_total", value: int64(12)},
+		{name: "user_agent", value: `curl "7.0"`},
+		{name: "key", value: ""},
+	}
+
+	l := &accessLogger{conf: config.AccessLogsConfig{Format: accessLogLogfmt}}
+	line, err := l.format(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `method=GET status=200 latency_total=12 user_agent="curl \"7.0\"" key=""` + "\n"; string(line) != want {
+		t.Errorf("expected %q, got %q", want, line)
+	}
+
+	l = &accessLogger{}
+	line, err = l.format(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"method":"GET","status":200,"latency_total":12,"user_agent":"curl \"7.0\"","key":""}` + "\n"; string(line) != want {
+		t.Errorf("expected %q, got %q", want, line)
+	}
+
+	gw := &Gateway{}
+	gw.SetConfig(config.Config{AccessLogs: config.AccessLogsConfig{
+		Format:   accessLogTemplate,
+		Template: `{{.method}} {{.status}} {{.latency_total}}ms`,
+	}})
+	gw.setupAccessLog()
+	line, err = gw.accessLog.format(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "GET 200 12ms\n"; string(line) != want {
+		t.Errorf("expected %q, got %q", want, line)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	maxminddb "github.com/oschwald/maxminddb-golang"
 	msgpack "gopkg.in/vmihailenco/msgpack.v2"
 
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/regexp"
 	"github.com/TykTechnologies/tyk/storage"
@@ -41,6 +42,14 @@ func (n *NetworkStats) Flush() NetworkStats {
 type Latency struct {
 	Total    int64
 	Upstream int64
+	// Breakdown of the upstream latency of proxied requests. Time to first
+	// byte is measured from the start of the upstream round trip.
+	DNS         int64
+	Connect     int64
+	TLS         int64
+	FirstByte   int64
+	ConnReused  bool
+	DNSCacheHit bool
 }
 
 // AnalyticsRecord encodes the details of a request
@@ -190,6 +199,8 @@ type RedisAnalyticsHandler struct {
 	Clean                       Purger
 	Gw                          *Gateway `json:"-"`
 	mu                          sync.Mutex
+	sinks                       []*bufferedSink
+	redactor                    *analyticsRedactor
 }
 
 func (r *RedisAnalyticsHandler) Init() {
@@ -210,6 +221,8 @@ func (r *RedisAnalyticsHandler) Init() {
 	log.WithField("workerBufferSize", r.workerBufferSize).Debug("Analytics pool worker buffer size")
 	r.enableMultipleAnalyticsKeys = r.Gw.GetConfig().AnalyticsConfig.EnableMultipleAnalyticsKeys
 	r.recordsChan = make(chan *AnalyticsRecord, recordsBufferSize)
+	r.redactor = newAnalyticsRedactor(r.globalConf.AnalyticsConfig.Redaction, apidef.AnalyticsRedactionConfig{})
+	r.initSinks()
 
 	// start worker pool
 	atomic.SwapUint32(&r.shouldStop, 0)
@@ -219,6 +232,17 @@ func (r *RedisAnalyticsHandler) Init() {
 	}
 }
 
+// redactorFor returns the redaction rules of an API, falling back to the
+// global rules for APIs that are no longer loaded.
+func (r *RedisAnalyticsHandler) redactorFor(apiID string) *analyticsRedactor {
+	if r.Gw != nil {
+		if spec := r.Gw.getApiSpec(apiID); spec != nil {
+			return spec.analyticsRedactor
+		}
+	}
+	return r.redactor
+}
+
 func (r *RedisAnalyticsHandler) Stop() {
 	// flag to stop sending records into channel
 	atomic.SwapUint32(&r.shouldStop, 1)
@@ -230,6 +254,38 @@ func (r *RedisAnalyticsHandler) Stop() {
 
 	// wait for all workers to be done
 	r.poolWg.Wait()
+
+	for _, sink := range r.sinks {
+		sink.close()
+	}
+	r.sinks = nil
+}
+
+// initSinks creates the configured analytics sinks. Sinks which can't be
+// created are skipped.
+func (r *RedisAnalyticsHandler) initSinks() {
+	r.sinks = nil
+	names := map[string]int{}
+	for _, conf := range r.globalConf.AnalyticsConfig.Sinks {
+		name := conf.Type
+		if names[conf.Type]++; names[conf.Type] > 1 {
+			name = fmt.Sprintf("%s-%d", conf.Type, names[conf.Type])
+		}
+
+		sink, err := r.newAnalyticsSink(conf)
+		if err != nil {
+			log.WithError(err).WithField("sink", name).Error("Failed to create analytics sink")
+			continue
+		}
+		r.sinks = append(r.sinks, newBufferedSink(name, sink, conf, r.Gw))
+	}
+}
+
+// bufferUsage returns the number of records waiting to be written and the size of the buffer.
+func (r *RedisAnalyticsHandler) bufferUsage() (records, size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.recordsChan), cap(r.recordsChan)
 }
 
 // RecordHit will store an AnalyticsRecord in Redis
@@ -259,11 +315,7 @@ func (r *RedisAnalyticsHandler) recordWorker() {
 	// read records from channel and process
 	lastSentTs := time.Now()
 	for {
-		analyticKey := analyticsKeyName
-		if r.enableMultipleAnalyticsKeys {
-			suffix := rand.Intn(10)
-			analyticKey = fmt.Sprintf("%v_%v", analyticKey, suffix)
-		}
+		analyticKey := analyticsKey(r.enableMultipleAnalyticsKeys)
 		readyToSend := false
 		select {
 
@@ -280,6 +332,11 @@ func (r *RedisAnalyticsHandler) recordWorker() {
 			// If we are obfuscating API Keys, store the hashed representation (config check handled in hashing function)
 			record.APIKey = storage.HashKey(record.APIKey, r.globalConf.HashKeys)
 
+			// Redact detailed recording before the record leaves the gateway
+			if record.RawRequest != "" || record.RawResponse != "" {
+				r.redactorFor(record.APIID).redactRecord(record)
+			}
+
 			if r.globalConf.SlaveOptions.UseRPC {
 				// Extend tag list to include this data so wecan segment by node if necessary
 				record.Tags = append(record.Tags, "tyk-hybrid-rpc")
@@ -309,6 +366,14 @@ func (r *RedisAnalyticsHandler) recordWorker() {
 				record.RawPath = "/" + record.RawPath
 			}
 
+			// Configured sinks replace the Redis pipeline below
+			if len(r.sinks) > 0 {
+				for _, sink := range r.sinks {
+					sink.write(record)
+				}
+				continue
+			}
+
 			if encoded, err := msgpack.Marshal(record); err != nil {
 				log.WithError(err).Error("Error encoding analytics data")
 			} else {
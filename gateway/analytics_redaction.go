@@ -0,0 +1,329 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/regexp"
+)
+
+const defaultRedactionReplacement = "[REDACTED]"
+
+// analyticsRedactor removes sensitive data from the wire format requests and
+// responses of detailed recording.
+type analyticsRedactor struct {
+	headers      []string
+	jsonPaths    [][]string
+	formFields   map[string]bool
+	patterns     []*regexp.Regexp
+	hash         bool
+	replacement  string
+	maxBodySize  int64
+	contentTypes map[string]bool
+	// dropBodies drops the raw requests and responses, as a rule is invalid
+	dropBodies bool
+}
+
+// newAnalyticsRedactor combines the global and API rules. It returns nil when
+// there is nothing to redact.
+func newAnalyticsRedactor(global, api apidef.AnalyticsRedactionConfig) *analyticsRedactor {
+	a := &analyticsRedactor{
+		hash:        global.Mode == apidef.RedactionHash,
+		replacement: global.Replacement,
+		maxBodySize: global.MaxBodySize,
+	}
+	if api.Mode != "" {
+		a.hash = api.Mode == apidef.RedactionHash
+	}
+	if api.Replacement != "" {
+		a.replacement = api.Replacement
+	}
+	if a.replacement == "" {
+		a.replacement = defaultRedactionReplacement
+	}
+	if api.MaxBodySize > 0 {
+		a.maxBodySize = api.MaxBodySize
+	}
+
+	contentTypes := global.ContentTypes
+	if len(api.ContentTypes) > 0 {
+		contentTypes = api.ContentTypes
+	}
+	if len(contentTypes) > 0 {
+		a.contentTypes = make(map[string]bool, len(contentTypes))
+		for _, contentType := range contentTypes {
+			a.contentTypes[strings.ToLower(contentType)] = true
+		}
+	}
+
+	for _, conf := range []apidef.AnalyticsRedactionConfig{global, api} {
+		for _, name := range conf.Headers {
+			a.headers = append(a.headers, textproto.CanonicalMIMEHeaderKey(name))
+		}
+		for _, path := range conf.JSONPaths {
+			a.jsonPaths = append(a.jsonPaths, strings.Split(path, "."))
+		}
+		for _, field := range conf.FormFields {
+			if a.formFields == nil {
+				a.formFields = make(map[string]bool)
+			}
+			a.formFields[field] = true
+		}
+		for _, pattern := range conf.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				log.WithError(err).Errorf("Invalid analytics redaction pattern %q, raw requests and responses are dropped", pattern)
+				a.dropBodies = true
+				continue
+			}
+			a.patterns = append(a.patterns, re)
+		}
+	}
+
+	if len(a.headers) == 0 && len(a.jsonPaths) == 0 && len(a.formFields) == 0 && len(a.patterns) == 0 &&
+		a.maxBodySize <= 0 && len(a.contentTypes) == 0 && !a.dropBodies {
+		return nil
+	}
+	return a
+}
+
+// redactRecord redacts the raw request and response of a record.
+func (a *analyticsRedactor) redactRecord(record *AnalyticsRecord) {
+	if a == nil {
+		return
+	}
+	if a.dropBodies {
+		record.RawRequest = ""
+		record.RawResponse = ""
+		return
+	}
+	record.RawRequest = a.redactEncoded(record.RawRequest, true)
+	record.RawResponse = a.redactEncoded(record.RawResponse, false)
+}
+
+func (a *analyticsRedactor) redactEncoded(encoded string, isRequest bool) string {
+	if encoded == "" {
+		return encoded
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		log.WithError(err).Debug("Failed to decode detailed recording")
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(a.redact(raw, isRequest))
+}
+
+// redact redacts a request or response in wire format. Chunked bodies are
+// decoded, so the result always has a plain body.
+func (a *analyticsRedactor) redact(raw []byte, isRequest bool) []byte {
+	br := bufio.NewReader(bytes.NewReader(raw))
+	tp := textproto.NewReader(br)
+
+	line, err := tp.ReadLine()
+	if err != nil {
+		return a.redactBody(raw)
+	}
+	mimeHeader, err := tp.ReadMIMEHeader()
+	if err != nil && len(mimeHeader) == 0 {
+		// Not in wire format, only the body rules can apply
+		return a.redactBody(raw)
+	}
+	h := http.Header(mimeHeader)
+	body, _ := ioutil.ReadAll(br)
+
+	if strings.Contains(strings.ToLower(h.Get("Transfer-Encoding")), "chunked") {
+		// Keep what can be decoded from truncated bodies
+		body, _ = ioutil.ReadAll(httputil.NewChunkedReader(bytes.NewReader(body)))
+		h.Del("Transfer-Encoding")
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	if isRequest && len(a.formFields) > 0 {
+		line = a.redactRequestLine(line)
+	}
+
+	for _, name := range a.headers {
+		values := h[name]
+		for i, value := range values {
+			values[i] = a.replace(value)
+		}
+	}
+
+	if len(body) > 0 {
+		body = a.redactTypedBody(h.Get("Content-Type"), body)
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+	h.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// redactRequestLine redacts the form fields of the query string.
+func (a *analyticsRedactor) redactRequestLine(line string) string {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 {
+		return line
+	}
+	i := strings.IndexByte(parts[1], '?')
+	if i < 0 {
+		return line
+	}
+	query, changed := a.redactForm(parts[1][i+1:])
+	if !changed {
+		return line
+	}
+	parts[1] = parts[1][:i+1] + query
+	return strings.Join(parts, " ")
+}
+
+// redactTypedBody applies the content type filters and the rules that depend
+// on the content type before the body rules.
+func (a *analyticsRedactor) redactTypedBody(contentType string, body []byte) []byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	mediaType = strings.ToLower(mediaType)
+
+	if a.contentTypes != nil && !a.contentTypes[mediaType] {
+		return nil
+	}
+
+	switch {
+	case len(a.jsonPaths) > 0 && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")):
+		body = a.redactJSON(body)
+	case len(a.formFields) > 0 && mediaType == "application/x-www-form-urlencoded":
+		if form, changed := a.redactForm(string(body)); changed {
+			body = []byte(form)
+		}
+	}
+
+	return a.redactBody(body)
+}
+
+// redactBody applies the patterns and the size cap.
+func (a *analyticsRedactor) redactBody(body []byte) []byte {
+	for _, re := range a.patterns {
+		body = re.ReplaceAllFunc(body, func(match []byte) []byte {
+			return []byte(a.replace(string(match)))
+		})
+	}
+	if a.maxBodySize > 0 && int64(len(body)) > a.maxBodySize {
+		body = body[:a.maxBodySize]
+	}
+	return body
+}
+
+func (a *analyticsRedactor) redactForm(form string) (string, bool) {
+	values, err := url.ParseQuery(form)
+	if err != nil {
+		return form, false
+	}
+
+	changed := false
+	for name, vals := range values {
+		if !a.formFields[name] {
+			continue
+		}
+		for i, value := range vals {
+			vals[i] = a.replace(value)
+		}
+		changed = true
+	}
+	if !changed {
+		return form, false
+	}
+	return values.Encode(), true
+}
+
+// redactJSON redacts the configured paths, leaving the body untouched when
+// none matches.
+func (a *analyticsRedactor) redactJSON(body []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return body
+	}
+
+	changed := false
+	for _, path := range a.jsonPaths {
+		if a.redactJSONPath(v, path) {
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+func (a *analyticsRedactor) redactJSONPath(v interface{}, path []string) bool {
+	changed := false
+	visit := func(child interface{}, set func(interface{})) {
+		if len(path) == 1 {
+			set(a.replace(jsonValueString(child)))
+			changed = true
+			return
+		}
+		if a.redactJSONPath(child, path[1:]) {
+			changed = true
+		}
+	}
+
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			if path[0] != "*" && path[0] != key {
+				continue
+			}
+			key := key
+			visit(child, func(value interface{}) { node[key] = value })
+		}
+	case []interface{}:
+		for i, child := range node {
+			if path[0] != "*" && path[0] != strconv.Itoa(i) {
+				continue
+			}
+			i := i
+			visit(child, func(value interface{}) { node[i] = value })
+		}
+	}
+	return changed
+}
+
+func jsonValueString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func (a *analyticsRedactor) replace(value string) string {
+	if !a.hash {
+		return a.replacement
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,201 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestAnalyticsRedactor(t *testing.T) {
+	t.Run("no rules", func(t *testing.T) {
+		if a := newAnalyticsRedactor(apidef.AnalyticsRedactionConfig{}, apidef.AnalyticsRedactionConfig{}); a != nil {
+			t.Errorf("expected no redactor, got %+v", a)
+		}
+	})
+
+	t.Run("request", func(t *testing.T) {
+		a := newAnalyticsRedactor(apidef.AnalyticsRedactionConfig{
+			Headers:    []string{"authorization"},
+			FormFields: []string{"token"},
+		}, apidef.AnalyticsRedactionConfig{
+			JSONPaths: []string{"password", "cards.*.number"},
+			Patterns:  []string{`\d{3}-\d{2}-\d{4}`},
+		})
+
+		body := `{"user":"joe","password":"secret","ssn":"123-45-6789","cards":[{"number":"4111111111111111","exp":"12/30"}]}`
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com/login?token=abc&page=1", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer abc")
+		req.Header.Set("Content-Type", "application/json")
+		var wire bytes.Buffer
+		req.Write(&wire)
+
+		redacted, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(a.redact(wire.Bytes(), true))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := redacted.Header.Get("Authorization"); got != defaultRedactionReplacement {
+			t.Errorf("expected redacted authorization header, got %q", got)
+		}
+		if got := redacted.URL.Query(); got.Get("token") != defaultRedactionReplacement || got.Get("page") != "1" {
+			t.Errorf("expected redacted token parameter, got %v", got)
+		}
+
+		var got map[string]interface{}
+		if err := json.NewDecoder(redacted.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		card := got["cards"].([]interface{})[0].(map[string]interface{})
+		if got["user"] != "joe" || got["password"] != defaultRedactionReplacement || got["ssn"] != defaultRedactionReplacement ||
+			card["number"] != defaultRedactionReplacement || card["exp"] != "12/30" {
+			t.Errorf("unexpected redacted body %v", got)
+		}
+	})
+
+	t.Run("hashed form", func(t *testing.T) {
+		a := newAnalyticsRedactor(apidef.AnalyticsRedactionConfig{}, apidef.AnalyticsRedactionConfig{
+			Mode:       apidef.RedactionHash,
+			FormFields: []string{"password"},
+		})
+
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("user=joe&password=secret"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		var wire bytes.Buffer
+		req.Write(&wire)
+
+		redacted, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(a.redact(wire.Bytes(), true))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		redacted.ParseForm()
+		if got := redacted.PostForm.Get("password"); got != a.replace("secret") || !strings.HasPrefix(got, "sha256:") {
+			t.Errorf("expected hashed password, got %q", got)
+		}
+		if got := redacted.PostForm.Get("user"); got != "joe" {
+			t.Errorf("expected user to be kept, got %q", got)
+		}
+	})
+
+	t.Run("response filters", func(t *testing.T) {
+		a := newAnalyticsRedactor(apidef.AnalyticsRedactionConfig{
+			ContentTypes: []string{"application/json"},
+			MaxBodySize:  100,
+		}, apidef.AnalyticsRedactionConfig{
+			MaxBodySize: 5,
+		})
+
+		for contentType, want := range map[string]string{
+			"application/json; charset=utf-8": `{"a":`,
+			"image/png":                       "",
+		} {
+			resp := &http.Response{
+				StatusCode:       http.StatusOK,
+				ProtoMajor:       1,
+				ProtoMinor:       1,
+				Header:           http.Header{"Content-Type": {contentType}},
+				Body:             ioutil.NopCloser(strings.NewReader(`{"a":"b"}`)),
+				ContentLength:    -1,
+				TransferEncoding: []string{"chunked"},
+			}
+			var wire bytes.Buffer
+			resp.Write(&wire)
+
+			redacted, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(a.redact(wire.Bytes(), false))), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(redacted.Body)
+			if string(body) != want || redacted.ContentLength != int64(len(want)) {
+				t.Errorf("expected %s body %q, got %q with length %d", contentType, want, body, redacted.ContentLength)
+			}
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		a := newAnalyticsRedactor(apidef.AnalyticsRedactionConfig{Patterns: []string{`(`}}, apidef.AnalyticsRedactionConfig{})
+
+		record := &AnalyticsRecord{
+			RawRequest:  base64.StdEncoding.EncodeToString([]byte("GET / HTTP/1.1\r\n\r\n")),
+			RawResponse: base64.StdEncoding.EncodeToString([]byte("HTTP/1.1 200 OK\r\n\r\n")),
+		}
+		a.redactRecord(record)
+		if record.RawRequest != "" || record.RawResponse != "" {
+			t.Errorf("expected the raw request and response to be dropped, got %+v", record)
+		}
+	})
+}
+
+func TestAnalyticsRedactionDetailedRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-analytics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "analytics.jsonl")
+
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.AnalyticsConfig.EnableDetailedRecording = true
+		globalConf.AnalyticsConfig.Redaction.Headers = []string{"X-Secret"}
+		globalConf.AnalyticsConfig.Sinks = []config.AnalyticsSinkConfig{{
+			Type:          analyticsSinkFile,
+			FlushInterval: 10,
+			File:          config.FileAnalyticsSinkConfig{Path: path},
+		}}
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "redacted"
+		spec.Proxy.ListenPath = "/redacted/"
+		spec.AnalyticsRedaction.Patterns = []string{"hunter2"}
+	})
+
+	_, _ = ts.Run(t, test.TestCase{
+		Method:  http.MethodPost,
+		Path:    "/redacted/",
+		Data:    "password=hunter2",
+		Headers: map[string]string{"X-Secret": "top"},
+		Code:    http.StatusOK,
+	})
+
+	var record AnalyticsRecord
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if data, err := ioutil.ReadFile(path); err == nil && len(data) > 0 {
+			if err := json.Unmarshal(bytes.SplitN(data, []byte("\n"), 2)[0], &record); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected an analytics record")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for name, encoded := range map[string]string{"request": record.RawRequest, "response": record.RawResponse} {
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(raw, []byte("hunter2")) {
+			t.Errorf("expected the %s password to be redacted, got %q", name, raw)
+		}
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(record.RawRequest)
+	if !bytes.Contains(raw, []byte("X-Secret: "+defaultRedactionReplacement)) {
+		t.Errorf("expected the secret header to be redacted, got %q", raw)
+	}
+}
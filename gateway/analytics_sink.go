@@ -0,0 +1,201 @@
+package gateway
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// Analytics sink types
+const (
+	analyticsSinkRedis = "redis"
+	analyticsSinkFile  = "file"
+	analyticsSinkHTTP  = "http"
+	analyticsSinkKafka = "kafka"
+)
+
+const (
+	defaultSinkBufferSize    = 1000
+	defaultSinkBatchSize     = 100
+	defaultSinkFlushInterval = time.Second
+)
+
+// AnalyticsSink writes batches of analytics records to a destination.
+type AnalyticsSink interface {
+	WriteRecords(records []*AnalyticsRecord) error
+	Close() error
+}
+
+// newAnalyticsSink creates the sink described by conf.
+func (r *RedisAnalyticsHandler) newAnalyticsSink(conf config.AnalyticsSinkConfig) (AnalyticsSink, error) {
+	switch conf.Type {
+	case analyticsSinkRedis:
+		return &redisAnalyticsSink{store: r.Store, multipleKeys: r.enableMultipleAnalyticsKeys}, nil
+	case analyticsSinkFile:
+		return newFileAnalyticsSink(conf.File)
+	case analyticsSinkHTTP:
+		return newHTTPAnalyticsSink(conf.HTTP)
+	case analyticsSinkKafka:
+		return newKafkaAnalyticsSink(conf.Kafka)
+	}
+	return nil, fmt.Errorf("unknown analytics sink type %q", conf.Type)
+}
+
+// bufferedSink queues records for a sink, writing them in batches from its
+// own goroutine. Records which don't fit in the queue are dropped.
+type bufferedSink struct {
+	name string
+	sink AnalyticsSink
+	gw   *Gateway
+
+	records       chan *AnalyticsRecord
+	batchSize     int
+	flushInterval time.Duration
+	blockTimeout  time.Duration
+
+	// dropped counts the records dropped since the last report
+	dropped uint64
+	done    chan struct{}
+}
+
+func newBufferedSink(name string, sink AnalyticsSink, conf config.AnalyticsSinkConfig, gw *Gateway) *bufferedSink {
+	s := &bufferedSink{
+		name:          name,
+		sink:          sink,
+		gw:            gw,
+		batchSize:     conf.BatchSize,
+		flushInterval: time.Duration(conf.FlushInterval) * time.Millisecond,
+		blockTimeout:  time.Duration(conf.BlockTimeout) * time.Millisecond,
+		done:          make(chan struct{}),
+	}
+
+	bufferSize := conf.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultSinkBufferSize
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = defaultSinkBatchSize
+	}
+	if s.flushInterval <= 0 {
+		s.flushInterval = defaultSinkFlushInterval
+	}
+	s.records = make(chan *AnalyticsRecord, bufferSize)
+
+	go s.run()
+
+	return s
+}
+
+// write queues a record, waiting up to the block timeout when the queue is full.
+func (s *bufferedSink) write(record *AnalyticsRecord) {
+	select {
+	case s.records <- record:
+		return
+	default:
+	}
+
+	if s.blockTimeout > 0 {
+		timer := time.NewTimer(s.blockTimeout)
+		defer timer.Stop()
+		select {
+		case s.records <- record:
+			return
+		case <-timer.C:
+		}
+	}
+
+	s.drop(1)
+}
+
+func (s *bufferedSink) drop(n int) {
+	atomic.AddUint64(&s.dropped, uint64(n))
+	s.gw.prometheus.reportAnalyticsDropped(s.name, n)
+}
+
+func (s *bufferedSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*AnalyticsRecord, 0, s.batchSize)
+	flush := func() {
+		if dropped := atomic.SwapUint64(&s.dropped, 0); dropped > 0 {
+			log.WithField("sink", s.name).Warningf("Dropped %d analytics records", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.sink.WriteRecords(batch); err != nil {
+			log.WithError(err).WithField("sink", s.name).Errorf("Failed to write %d analytics records", len(batch))
+			s.drop(len(batch))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case record, ok := <-s.records:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// close writes the queued records and closes the sink. No records must be
+// written after close is called.
+func (s *bufferedSink) close() {
+	close(s.records)
+	<-s.done
+	if err := s.sink.Close(); err != nil {
+		log.WithError(err).WithField("sink", s.name).Error("Failed to close analytics sink")
+	}
+}
+
+// analyticsKey returns the Redis list analytics records are appended to.
+func analyticsKey(multipleKeys bool) string {
+	if multipleKeys {
+		return fmt.Sprintf("%v_%v", analyticsKeyName, rand.Intn(10))
+	}
+	return analyticsKeyName
+}
+
+// redisAnalyticsSink writes msgpack encoded records to Redis, for Tyk Pump
+// to process.
+type redisAnalyticsSink struct {
+	store        storage.AnalyticsHandler
+	multipleKeys bool
+}
+
+func (s *redisAnalyticsSink) WriteRecords(records []*AnalyticsRecord) error {
+	encoded := make([][]byte, 0, len(records))
+	for _, record := range records {
+		b, err := msgpack.Marshal(record)
+		if err != nil {
+			log.WithError(err).Error("Error encoding analytics data")
+			continue
+		}
+		encoded = append(encoded, b)
+	}
+
+	s.store.AppendToSetPipelined(analyticsKey(s.multipleKeys), encoded)
+	return nil
+}
+
+func (s *redisAnalyticsSink) Close() error {
+	return nil
+}
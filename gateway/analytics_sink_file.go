@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+const (
+	defaultAnalyticsFileMaxSizeMB = 100
+	analyticsFileRotationLayout   = "20060102T150405.000000000"
+)
+
+// fileAnalyticsSink appends records as JSON lines to a file, rotating it
+// when it grows over the maximum size.
+type fileAnalyticsSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+func newFileAnalyticsSink(conf config.FileAnalyticsSinkConfig) (*fileAnalyticsSink, error) {
+	if conf.Path == "" {
+		return nil, errors.New("file analytics sink requires a path")
+	}
+
+	s := &fileAnalyticsSink{
+		path:       conf.Path,
+		maxSize:    int64(conf.MaxSizeMB) << 20,
+		maxBackups: conf.MaxBackups,
+	}
+	if s.maxSize <= 0 {
+		s.maxSize = defaultAnalyticsFileMaxSizeMB << 20
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileAnalyticsSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *fileAnalyticsSink) WriteRecords(records []*AnalyticsRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	if s.size > 0 && s.size+int64(buf.Len()) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.f.Write(buf.Bytes())
+	s.size += int64(n)
+	return err
+}
+
+// rotate renames the current file with a timestamp suffix, removing the
+// oldest rotated files over the limit, and opens a new file.
+func (s *fileAnalyticsSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(s.path, s.path+"."+time.Now().UTC().Format(analyticsFileRotationLayout)); err != nil {
+		return err
+	}
+
+	if s.maxBackups > 0 {
+		backups, err := filepath.Glob(s.path + ".*")
+		if err != nil {
+			return err
+		}
+		// The timestamp suffix sorts rotated files from the oldest
+		sort.Strings(backups)
+		for len(backups) > s.maxBackups {
+			if err := os.Remove(backups[0]); err != nil {
+				log.WithError(err).Warning("Failed to remove rotated analytics file")
+			}
+			backups = backups[1:]
+		}
+	}
+
+	return s.open()
+}
+
+func (s *fileAnalyticsSink) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+const (
+	defaultAnalyticsHTTPTimeout = 10 * time.Second
+	analyticsHTTPRetryBackoff   = 100 * time.Millisecond
+)
+
+// httpAnalyticsSink posts batches of records as a JSON array.
+type httpAnalyticsSink struct {
+	url        string
+	headers    map[string]string
+	maxRetries int
+	client     *http.Client
+}
+
+func newHTTPAnalyticsSink(conf config.HTTPAnalyticsSinkConfig) (*httpAnalyticsSink, error) {
+	if conf.URL == "" {
+		return nil, errors.New("http analytics sink requires a url")
+	}
+
+	timeout := time.Duration(conf.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultAnalyticsHTTPTimeout
+	}
+
+	return &httpAnalyticsSink{
+		url:        conf.URL,
+		headers:    conf.Headers,
+		maxRetries: conf.MaxRetries,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: conf.SSLInsecureSkipVerify},
+			},
+		},
+	}, nil
+}
+
+func (s *httpAnalyticsSink) WriteRecords(records []*AnalyticsRecord) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	backoff := analyticsHTTPRetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(body)
+		if err == nil || !retry || attempt >= s.maxRetries {
+			return err
+		}
+
+		log.WithError(err).Debug("Retrying analytics export")
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a batch, returning whether a failed request can be retried.
+func (s *httpAnalyticsSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests,
+			fmt.Errorf("analytics endpoint responded with %s", resp.Status)
+	}
+	return false, nil
+}
+
+func (s *httpAnalyticsSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/kafka"
+)
+
+// kafkaAnalyticsSink produces records as JSON to a Kafka topic, keyed by API
+// ID so the records of an API are kept in order.
+type kafkaAnalyticsSink struct {
+	producer *kafka.Producer
+}
+
+func newKafkaAnalyticsSink(conf config.KafkaAnalyticsSinkConfig) (*kafkaAnalyticsSink, error) {
+	if len(conf.Brokers) == 0 || conf.Topic == "" {
+		return nil, errors.New("kafka analytics sink requires brokers and a topic")
+	}
+
+	pconf := kafka.Config{
+		Brokers:      conf.Brokers,
+		Topic:        conf.Topic,
+		ClientID:     conf.ClientID,
+		RequiredAcks: int16(conf.RequiredAcks),
+		Timeout:      time.Duration(conf.Timeout) * time.Second,
+	}
+	if pconf.RequiredAcks == 0 {
+		pconf.RequiredAcks = 1
+	}
+	if conf.UseSSL {
+		pconf.TLSConfig = &tls.Config{InsecureSkipVerify: conf.SSLInsecureSkipVerify}
+	}
+
+	return &kafkaAnalyticsSink{producer: kafka.NewProducer(pconf)}, nil
+}
+
+func (s *kafkaAnalyticsSink) WriteRecords(records []*AnalyticsRecord) error {
+	msgs := make([]kafka.Message, 0, len(records))
+	for _, record := range records {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		ts := record.TimeStamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		msgs = append(msgs, kafka.Message{Key: []byte(record.APIID), Value: value, Time: ts})
+	}
+
+	return s.producer.Produce(msgs)
+}
+
+func (s *kafkaAnalyticsSink) Close() error {
+	return s.producer.Close()
+}
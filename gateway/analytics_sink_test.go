@@ -0,0 +1,189 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestAnalyticsSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-analytics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "analytics.jsonl")
+
+	var mu sync.Mutex
+	var posted []AnalyticsRecord
+	var failures int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails, to be retried
+		if atomic.AddInt32(&failures, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Authorization") != "secret" {
+			t.Errorf("expected authorization header, got %v", r.Header)
+		}
+
+		var records []AnalyticsRecord
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		posted = append(posted, records...)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.AnalyticsConfig.Sinks = []config.AnalyticsSinkConfig{
+			{
+				Type:          analyticsSinkFile,
+				FlushInterval: 10,
+				File:          config.FileAnalyticsSinkConfig{Path: path},
+			},
+			{
+				Type:          analyticsSinkHTTP,
+				FlushInterval: 10,
+				HTTP: config.HTTPAnalyticsSinkConfig{
+					URL:        collector.URL,
+					Headers:    map[string]string{"Authorization": "secret"},
+					MaxRetries: 2,
+				},
+			},
+		}
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "sinks"
+		spec.Proxy.ListenPath = "/sinks/"
+	})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/sinks/a", Code: http.StatusOK},
+		{Path: "/sinks/b", Code: http.StatusOK},
+	}...)
+
+	readFile := func() (records []AnalyticsRecord) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var record AnalyticsRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Error(err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(posted)
+		mu.Unlock()
+		if n == 2 && len(readFile()) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 records in each sink, got %d posted and %d in file", n, len(readFile()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, record := range append(readFile(), posted...) {
+		if record.APIID != "sinks" || record.ResponseCode != http.StatusOK {
+			t.Errorf("unexpected record %+v", record)
+		}
+	}
+}
+
+func TestFileAnalyticsSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-analytics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "analytics.jsonl")
+
+	sink, err := newFileAnalyticsSink(config.FileAnalyticsSinkConfig{Path: path, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	// Rotate on every write
+	sink.maxSize = 1
+
+	for i := 0; i < 5; i++ {
+		if err := sink.WriteRecords([]*AnalyticsRecord{{APIID: "api"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Errorf("expected 2 rotated files, got %v", backups)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Errorf("expected the current file to hold the last record, got %v %v", info, err)
+	}
+}
+
+type blockingSink struct {
+	release chan struct{}
+	written int32
+}
+
+func (s *blockingSink) WriteRecords(records []*AnalyticsRecord) error {
+	<-s.release
+	atomic.AddInt32(&s.written, int32(len(records)))
+	return nil
+}
+
+func (s *blockingSink) Close() error {
+	return nil
+}
+
+func TestBufferedSinkDrops(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	s := newBufferedSink("blocking", sink, config.AnalyticsSinkConfig{BufferSize: 1, BatchSize: 1}, &Gateway{})
+
+	// The first record is held by the blocked write, the second is buffered
+	s.write(&AnalyticsRecord{})
+	time.Sleep(50 * time.Millisecond)
+	s.write(&AnalyticsRecord{})
+	s.write(&AnalyticsRecord{})
+	s.write(&AnalyticsRecord{})
+
+	if dropped := atomic.LoadUint64(&s.dropped); dropped != 2 {
+		t.Errorf("expected 2 dropped records, got %d", dropped)
+	}
+
+	close(sink.release)
+	s.close()
+
+	if written := atomic.LoadInt32(&sink.written); written != 2 {
+		t.Errorf("expected 2 written records, got %d", written)
+	}
+}
@@ -35,8 +35,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -793,14 +791,16 @@ func (gw *Gateway) handleGetPolicy(polID string) (interface{}, int) {
 	return apiError("Policy not found"), http.StatusNotFound
 }
 
-func (gw *Gateway) handleGetPolicyList() (interface{}, int) {
+func (gw *Gateway) handleGetPolicyList(r *http.Request) (interface{}, int) {
+	cred := ctxGetControlAPICredential(r)
+
 	gw.policiesMu.RLock()
 	defer gw.policiesMu.RUnlock()
-	polIDList := make([]user.Policy, len(gw.policiesByID))
-	c := 0
+	polIDList := make([]user.Policy, 0, len(gw.policiesByID))
 	for _, pol := range gw.policiesByID {
-		polIDList[c] = pol
-		c++
+		if cred.allowsOrg(controlAPIPolicies, controlAPIRead, pol.OrgID) {
+			polIDList = append(polIDList, pol)
+		}
 	}
 	return polIDList, http.StatusOK
 }
@@ -822,25 +822,22 @@ func (gw *Gateway) handleAddOrUpdatePolicy(polID string, r *http.Request) (inter
 		return apiError("Request ID does not match that in policy! For Update operations these must match."), http.StatusBadRequest
 	}
 
-	// Create a filename
-	polFilePath := filepath.Join(gw.GetConfig().Policies.PolicyPath, newPol.ID+".json")
-
 	asByte, err := json.MarshalIndent(newPol, "", "  ")
 	if err != nil {
 		log.Error("Marshalling of policy failed: ", err)
 		return apiError("Marshalling failed"), http.StatusInternalServerError
 	}
 
-	if err := ioutil.WriteFile(polFilePath, asByte, 0644); err != nil {
-		log.Error("Failed to create file! - ", err)
-		return apiError("Failed to create file!"), http.StatusInternalServerError
-	}
-
 	action := "modified"
 	if r.Method == http.MethodPost {
 		action = "added"
 	}
 
+	files := map[string][]byte{newPol.ID + ".json": asByte}
+	if _, err := gw.policyFileStore(afero.NewOsFs()).save(newPol.ID, files, action, r); err != nil {
+		return fileStoreError(err, "Policy")
+	}
+
 	response := apiModifyKeySuccess{
 		Key:    newPol.ID,
 		Status: "ok",
@@ -850,17 +847,13 @@ func (gw *Gateway) handleAddOrUpdatePolicy(polID string, r *http.Request) (inter
 	return response, http.StatusOK
 }
 
-func (gw *Gateway) handleDeletePolicy(polID string) (interface{}, int) {
-	// Generate a filename
-	defFilePath := filepath.Join(gw.GetConfig().Policies.PolicyPath, polID+".json")
-
-	// If it exists, delete it
-	if _, err := os.Stat(defFilePath); err != nil {
-		log.Warningf("Error describing named file: %v ", err)
-		return apiError("Delete failed"), http.StatusInternalServerError
-	}
-
-	if err := os.Remove(defFilePath); err != nil {
+func (gw *Gateway) handleDeletePolicy(polID string, r *http.Request) (interface{}, int) {
+	err := gw.policyFileStore(afero.NewOsFs()).remove(polID, r)
+	switch err {
+	case nil:
+	case errRevisionMismatch:
+		return fileStoreError(err, "Policy")
+	default:
 		log.Warningf("Delete failed: %v", err)
 		return apiError("Delete failed"), http.StatusInternalServerError
 	}
@@ -874,14 +867,16 @@ func (gw *Gateway) handleDeletePolicy(polID string) (interface{}, int) {
 	return response, http.StatusOK
 }
 
-func (gw *Gateway) handleGetAPIList() (interface{}, int) {
+func (gw *Gateway) handleGetAPIList(r *http.Request) (interface{}, int) {
+	cred := ctxGetControlAPICredential(r)
+
 	gw.apisMu.RLock()
 	defer gw.apisMu.RUnlock()
-	apiIDList := make([]*apidef.APIDefinition, len(gw.apisByID))
-	c := 0
+	apiIDList := make([]*apidef.APIDefinition, 0, len(gw.apisByID))
 	for _, apiSpec := range gw.apisByID {
-		apiIDList[c] = apiSpec.APIDefinition
-		c++
+		if cred.allowsOrg(controlAPIAPIs, controlAPIRead, apiSpec.OrgID) {
+			apiIDList = append(apiIDList, apiSpec.definition)
+		}
 	}
 	return apiIDList, http.StatusOK
 }
@@ -891,7 +886,7 @@ func (gw *Gateway) handleGetAPI(apiID string, oasTyped bool) (interface{}, int)
 		if oasTyped {
 			return &spec.OAS, http.StatusOK
 		} else {
-			return spec.APIDefinition, http.StatusOK
+			return spec.definition, http.StatusOK
 		}
 	}
 
@@ -965,16 +960,16 @@ func (gw *Gateway) handleAddOrUpdateApi(apiID string, r *http.Request, fs afero.
 		return apiError(fmt.Sprintf("Validation of API Definition failed. Reason: %s.", reason)), http.StatusBadRequest
 	}
 
-	// api
-	err, errCode := gw.writeToFile(fs, newDef, newDef.APIID)
+	defBytes, err := json.MarshalIndent(newDef, "", "  ")
 	if err != nil {
-		return apiError(err.Error()), errCode
+		log.Error("Marshalling of API Definition failed: ", err)
+		return apiError("marshalling failed"), http.StatusInternalServerError
 	}
 
-	// oas
-	err, errCode = gw.writeToFile(fs, &oasDoc, newDef.APIID+"-oas")
+	oasBytes, err := json.MarshalIndent(&oasDoc, "", "  ")
 	if err != nil {
-		return apiError(err.Error()), errCode
+		log.Error("Marshalling of OAS document failed: ", err)
+		return apiError("marshalling failed"), http.StatusInternalServerError
 	}
 
 	action := "modified"
@@ -982,6 +977,14 @@ func (gw *Gateway) handleAddOrUpdateApi(apiID string, r *http.Request, fs afero.
 		action = "added"
 	}
 
+	files := map[string][]byte{
+		newDef.APIID + ".json":     defBytes,
+		newDef.APIID + "-oas.json": oasBytes,
+	}
+	if _, err := gw.apiFileStore(fs).save(newDef.APIID, files, action, r); err != nil {
+		return fileStoreError(err, "API")
+	}
+
 	response := apiModifyKeySuccess{
 		Key:    newDef.APIID,
 		Status: "ok",
@@ -991,47 +994,17 @@ func (gw *Gateway) handleAddOrUpdateApi(apiID string, r *http.Request, fs afero.
 	return response, http.StatusOK
 }
 
-func (gw *Gateway) writeToFile(fs afero.Fs, newDef interface{}, filename string) (err error, errCode int) {
-	// Create a filename
-	defFilePath := filepath.Join(gw.GetConfig().AppPath, filename+".json")
-
-	log.Infof("App path: %v", gw.GetConfig().AppPath)
-	// If it exists, delete it
-	if _, err := fs.Stat(defFilePath); err == nil {
-		log.Warning("API Definition with this ID already exists, deleting file...")
-		fs.Remove(defFilePath)
-	}
-
-	// unmarshal the object into the file
-	asByte, err := json.MarshalIndent(newDef, "", "  ")
-	if err != nil {
-		log.Error("Marshalling of API Definition failed: ", err)
-		return errors.New("marshalling failed"), http.StatusInternalServerError
-	}
-
-	if err := ioutil.WriteFile(defFilePath, asByte, 0644); err != nil {
-		log.Infof("EL file path: %v", defFilePath)
-		log.Error("Failed to create file! - ", err)
-		return errors.New("file object creation failed, write error"), http.StatusInternalServerError
-	}
-
-	return nil, 0
-}
-
-func (gw *Gateway) handleDeleteAPI(apiID string) (interface{}, int) {
-	// Generate a filename
-	defFilePath := filepath.Join(gw.GetConfig().AppPath, apiID+".json")
-	defOASFilePath := filepath.Join(gw.GetConfig().AppPath, apiID+"-oas.json")
-
-	// If it exists, delete it
-	if _, err := os.Stat(defFilePath); err != nil {
-		log.Warning("File does not exist! ", err)
+func (gw *Gateway) handleDeleteAPI(apiID string, r *http.Request) (interface{}, int) {
+	err := gw.apiFileStore(afero.NewOsFs()).remove(apiID, r)
+	switch err {
+	case nil:
+	case errRevisionMismatch:
+		return fileStoreError(err, "API")
+	default:
+		log.Warning("Delete failed: ", err)
 		return apiError("Delete failed"), http.StatusInternalServerError
 	}
 
-	os.Remove(defFilePath)
-	os.Remove(defOASFilePath)
-
 	response := apiModifyKeySuccess{
 		Key:    apiID,
 		Status: "ok",
@@ -1054,7 +1027,7 @@ func (gw *Gateway) polHandler(w http.ResponseWriter, r *http.Request) {
 			obj, code = gw.handleGetPolicy(polID)
 		} else {
 			log.Debug("Requesting Policy list")
-			obj, code = gw.handleGetPolicyList()
+			obj, code = gw.handleGetPolicyList(r)
 		}
 	case http.MethodPost:
 		log.Debug("Creating new definition file")
@@ -1069,12 +1042,21 @@ func (gw *Gateway) polHandler(w http.ResponseWriter, r *http.Request) {
 	case http.MethodDelete:
 		if polID != "" {
 			log.Debug("Deleting policy for: ", polID)
-			obj, code = gw.handleDeletePolicy(polID)
+			obj, code = gw.handleDeletePolicy(polID, r)
 		} else {
 			obj, code = apiError("Must specify an apiID to delete"), http.StatusBadRequest
 		}
 	}
 
+	if code == http.StatusOK && r.Method != http.MethodDelete {
+		if polID == "" {
+			polID = modifiedKey(obj)
+		}
+		if polID != "" {
+			gw.policyFileStore(afero.NewOsFs()).setRevisionHeader(w, polID)
+		}
+	}
+
 	doJSONWrite(w, code, obj)
 }
 
@@ -1092,7 +1074,7 @@ func (gw *Gateway) apiHandler(w http.ResponseWriter, r *http.Request) {
 			obj, code = gw.handleGetAPI(apiID, oasTyped)
 		} else {
 			log.Debug("Requesting API list")
-			obj, code = gw.handleGetAPIList()
+			obj, code = gw.handleGetAPIList(r)
 		}
 	case "POST":
 		log.Debug("Creating new definition file")
@@ -1107,12 +1089,21 @@ func (gw *Gateway) apiHandler(w http.ResponseWriter, r *http.Request) {
 	case "DELETE":
 		if apiID != "" {
 			log.Debug("Deleting API definition for: ", apiID)
-			obj, code = gw.handleDeleteAPI(apiID)
+			obj, code = gw.handleDeleteAPI(apiID, r)
 		} else {
 			obj, code = apiError("Must specify an apiID to delete"), http.StatusBadRequest
 		}
 	}
 
+	if code == http.StatusOK && r.Method != http.MethodDelete {
+		if apiID == "" {
+			apiID = modifiedKey(obj)
+		}
+		if apiID != "" {
+			gw.apiFileStore(afero.NewOsFs()).setRevisionHeader(w, apiID)
+		}
+	}
+
 	doJSONWrite(w, code, obj)
 }
 
@@ -1153,17 +1144,19 @@ func (gw *Gateway) keyHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		} else {
 			// Return list of keys
-			if gwConfig.HashKeys {
+			if gwConfig.HashKeys && !gwConfig.EnableHashedKeysListing {
 				// get all keys is disabled by default
-				if !gwConfig.EnableHashedKeysListing {
-					doJSONWrite(
-						w,
-						http.StatusNotFound,
-						apiError("Hashed key listing is disabled in config (enable_hashed_keys_listing)"),
-					)
-					return
-				}
+				doJSONWrite(
+					w,
+					http.StatusNotFound,
+					apiError("Hashed key listing is disabled in config (enable_hashed_keys_listing)"),
+				)
+				return
+			}
 
+			if keyListRequested(r.URL.Query()) {
+				obj, code = gw.handleGetKeysPage(r.URL.Query(), gwConfig.HashKeys)
+			} else if gwConfig.HashKeys {
 				// we don't use filter for hashed keys
 				obj, code = gw.handleGetAllKeys("")
 			} else {
@@ -1775,7 +1768,7 @@ func (gw *Gateway) createOauthClient(w http.ResponseWriter, r *http.Request) {
 							&RedisOsinStorageInterface{
 								storageManager,
 								gw.GlobalSessionManager,
-								&storage.RedisCluster{KeyPrefix: prefix, HashKeys: false, RedisController: gw.RedisController},
+								gw.newStore(storage.StoreOptions{KeyPrefix: prefix, HashKeys: false}),
 								apiSpec.OrgID,
 								gw,
 							}),
@@ -2161,7 +2154,7 @@ func (gw *Gateway) getOauthClientDetails(keyName, apiID string) (interface{}, in
 				&RedisOsinStorageInterface{
 					storageManager,
 					gw.GlobalSessionManager,
-					&storage.RedisCluster{KeyPrefix: prefix, HashKeys: false, RedisController: gw.RedisController},
+					gw.newStore(storage.StoreOptions{KeyPrefix: prefix, HashKeys: false}),
 					apiSpec.OrgID,
 					gw,
 				}),
@@ -2363,7 +2356,7 @@ func (gw *Gateway) invalidateCacheHandler(w http.ResponseWriter, r *http.Request
 
 	keyPrefix := "cache-" + apiID
 	matchPattern := keyPrefix + "*"
-	store := storage.RedisCluster{KeyPrefix: keyPrefix, IsCache: true, RedisController: gw.RedisController}
+	store := gw.newStore(storage.StoreOptions{KeyPrefix: keyPrefix, IsCache: true})
 
 	if ok := store.DeleteScanMatch(matchPattern); !ok {
 		err := errors.New("scan/delete failed")
@@ -2818,6 +2811,50 @@ func ctxGetRequestStatus(r *http.Request) (stat RequestStatus) {
 	return
 }
 
+func ctxSetRequestStartTime(r *http.Request, t time.Time) {
+	setCtxValue(r, ctx.RequestStartTime, t)
+}
+
+func ctxGetRequestStartTime(r *http.Request) (t time.Time) {
+	if v := r.Context().Value(ctx.RequestStartTime); v != nil {
+		t = v.(time.Time)
+	}
+	return
+}
+
+func ctxSetDebugTrace(r *http.Request, t *debugTrace) {
+	setCtxValue(r, ctx.DebugTrace, t)
+}
+
+func ctxGetDebugTrace(r *http.Request) *debugTrace {
+	if v := r.Context().Value(ctx.DebugTrace); v != nil {
+		return v.(*debugTrace)
+	}
+	return nil
+}
+
+func ctxSetUpstreamTiming(r *http.Request, t *upstreamTiming) {
+	setCtxValue(r, ctx.UpstreamTiming, t)
+}
+
+func ctxGetUpstreamTiming(r *http.Request) *upstreamTiming {
+	if v := r.Context().Value(ctx.UpstreamTiming); v != nil {
+		return v.(*upstreamTiming)
+	}
+	return nil
+}
+
+func ctxSetControlAPICredential(r *http.Request, c *controlAPICredential) {
+	setCtxValue(r, ctx.ControlAPICredential, c)
+}
+
+func ctxGetControlAPICredential(r *http.Request) *controlAPICredential {
+	if v := r.Context().Value(ctx.ControlAPICredential); v != nil {
+		return v.(*controlAPICredential)
+	}
+	return nil
+}
+
 var createOauthClientSecret = func() string {
 	secret := uuid.NewV4()
 	return base64.StdEncoding.EncodeToString([]byte(secret.String()))
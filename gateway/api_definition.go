@@ -10,7 +10,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -170,10 +169,12 @@ type APISpec struct {
 	sync.RWMutex
 
 	RxPaths                  map[string][]URLSpec
+	urlMatchers              map[*URLSpec]*urlSpecMatcher
 	WhiteListEnabled         map[string]bool
 	target                   *url.URL
 	AuthManager              SessionHandler
 	OAuthManager             *OAuthManager
+	OIDCLoginManager         *OIDCLoginManager
 	OrgSessionManager        SessionHandler
 	EventPaths               map[apidef.TykEvent][]config.TykEventHandler
 	Health                   HealthChecker
@@ -195,6 +196,20 @@ type APISpec struct {
 
 	middlewareChain *ChainObject
 
+	// definition is the definition the spec was made from, before its KV
+	// references are resolved. It's the one returned by the Gateway API.
+	definition *apidef.APIDefinition
+
+	// checksum of the definition the spec was made from, used by reloads
+	// to keep the specs whose definition didn't change.
+	checksum string
+	// router holds the routes of an HTTP API and handler its middleware
+	// chain, both kept across reloads together with the spec.
+	router  *mux.Router
+	handler http.Handler
+
+	analyticsRedactor *analyticsRedactor
+
 	network NetworkStats
 
 	GraphQLExecutor struct {
@@ -249,8 +264,11 @@ func (s *APISpec) validateTCP() error {
 }
 
 func (s *APISpec) validateHTTP() error {
-	// NOOP
-	return nil
+	result := apidef.Validate(s.APIDefinition, apidef.ValidationRuleSet{
+		&apidef.RuleCertificateIdentityCAs{},
+		&apidef.RuleAnalyticsRedactionPatterns{},
+	})
+	return result.FirstError()
 }
 
 // APIDefinitionLoader will load an Api definition from a storage
@@ -262,7 +280,7 @@ type APIDefinitionLoader struct {
 // MakeSpec will generate a flattened URLSpec from and APIDefinitions' VersionInfo data. paths are
 // keyed to the Api version name, which is determined during routing to speed up lookups
 func (a APIDefinitionLoader) MakeSpec(def *apidef.APIDefinition, logger *logrus.Entry) *APISpec {
-	spec := &APISpec{}
+	spec := &APISpec{checksum: definitionChecksum(def)}
 
 	if logger == nil {
 		logger = logrus.NewEntry(log)
@@ -292,6 +310,7 @@ func (a APIDefinitionLoader) MakeSpec(def *apidef.APIDefinition, logger *logrus.
 	}
 
 	spec.APIDefinition = def
+	spec.definition = def
 
 	// We'll push the default HealthChecker:
 	spec.Health = &DefaultHealthChecker{
@@ -307,6 +326,7 @@ func (a APIDefinitionLoader) MakeSpec(def *apidef.APIDefinition, logger *logrus.
 	}
 
 	spec.GlobalConfig = a.Gw.GetConfig()
+	spec.analyticsRedactor = newAnalyticsRedactor(spec.GlobalConfig.AnalyticsConfig.Redaction, def.AnalyticsRedaction)
 
 	// Create and init the virtual Machine
 	if a.Gw.GetConfig().EnableJSVM {
@@ -553,7 +573,7 @@ func (a APIDefinitionLoader) FromDir(dir string) []*APISpec {
 		}
 
 		log.Info("Loading API Specification from ", path)
-		f, err := os.Open(path)
+		f, err := a.Gw.getWatchedFiles().open(path)
 		if err != nil {
 			log.Error("Couldn't open api configuration file: ", err)
 			continue
@@ -562,10 +582,9 @@ func (a APIDefinitionLoader) FromDir(dir string) []*APISpec {
 		def := a.ParseDefinition(f)
 		spec := a.MakeSpec(&def, nil)
 
-		_, _ = f.Seek(0, io.SeekStart)
 		_ = f.Close()
 
-		f, err = os.Open(a.GetOASFilepath(path))
+		f, err = a.Gw.getWatchedFiles().open(a.GetOASFilepath(path))
 		if err == nil {
 			spec.OAS = a.ParseOAS(f)
 			_ = f.Close()
@@ -1097,6 +1116,8 @@ func (a APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef apidef.VersionIn
 	combinedPath = append(combinedPath, validateJSON...)
 	combinedPath = append(combinedPath, internalPaths...)
 
+	apiSpec.addURLSpecMatcher(combinedPath)
+
 	return combinedPath, len(whiteListPaths) > 0
 }
 
@@ -1164,11 +1185,7 @@ func (a *APISpec) getURLStatus(stat URLStatus) RequestStatus {
 // URLAllowedAndIgnored checks if a url is allowed and ignored.
 func (a *APISpec) URLAllowedAndIgnored(r *http.Request, rxPaths []URLSpec, whiteListStatus bool) (RequestStatus, interface{}) {
 	// Check if ignored
-	for i := range rxPaths {
-		if !rxPaths[i].Spec.MatchString(r.URL.Path) {
-			continue
-		}
-
+	for _, i := range a.urlSpecMatches(rxPaths, r.URL.Path, anyURLStatus) {
 		if rxPaths[i].MethodActions == nil {
 			switch rxPaths[i].Status {
 			case WhiteList:
@@ -1293,14 +1310,7 @@ func (a *APISpec) CheckSpecMatchesStatus(r *http.Request, rxPaths []URLSpec, mod
 	}
 
 	// Check if ignored
-	for i := range rxPaths {
-		if mode != rxPaths[i].Status {
-			continue
-		}
-		if !rxPaths[i].Spec.MatchString(matchPath) {
-			continue
-		}
-
+	for _, i := range a.urlSpecMatches(rxPaths, matchPath, mode) {
 		switch rxPaths[i].Status {
 		case Ignored, BlackList, WhiteList:
 			return true, nil
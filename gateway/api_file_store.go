@@ -0,0 +1,490 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+const (
+	defaultFileHistorySize = 10
+
+	// fileHistoryDir is the directory, next to the stored files, which holds their history.
+	fileHistoryDir = ".history"
+)
+
+var (
+	errFileNotFound         = errors.New("not found")
+	errRevisionMismatch     = errors.New("revision doesn't match")
+	errRevisionNotInHistory = errors.New("revision not found in history")
+)
+
+// fileVersion is an entry in the history of an API definition or policy
+// which has been changed through the Gateway API.
+type fileVersion struct {
+	Revision string    `json:"revision"`
+	Action   string    `json:"action"`
+	User     string    `json:"user"`
+	Time     time.Time `json:"time"`
+	// ClaimedUser is the X-Tyk-Actor header of the request, which isn't verified.
+	ClaimedUser string `json:"claimed_user,omitempty"`
+	// Files holds the content of the files of the version by file name,
+	// it is empty when the object has been deleted.
+	Files map[string]json.RawMessage `json:"files,omitempty"`
+}
+
+// fileStore persists API definitions or policies as JSON files. Files are
+// replaced atomically, updates can be made conditional on the current
+// revision and every change is recorded in the history of the object.
+type fileStore struct {
+	gw  *Gateway
+	fs  afero.Fs
+	dir string
+	// names returns the names of the files of an object, the first one
+	// being the one its revision is computed from.
+	names func(id string) []string
+}
+
+func (gw *Gateway) apiFileStore(fs afero.Fs) *fileStore {
+	return &fileStore{
+		gw:  gw,
+		fs:  fs,
+		dir: gw.GetConfig().AppPath,
+		names: func(id string) []string {
+			return []string{id + ".json", id + "-oas.json"}
+		},
+	}
+}
+
+func (gw *Gateway) policyFileStore(fs afero.Fs) *fileStore {
+	return &fileStore{
+		gw:  gw,
+		fs:  fs,
+		dir: gw.GetConfig().Policies.PolicyPath,
+		names: func(id string) []string {
+			return []string{id + ".json"}
+		},
+	}
+}
+
+// fileRevision returns the revision of the content of a file. The JSON is
+// compacted first, so that a version restored from the history, which may
+// be formatted differently, keeps its revision.
+func fileRevision(data []byte) string {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err == nil {
+		data = compacted.Bytes()
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// read returns the content of the main file of the object with the given ID.
+func (s *fileStore) read(id string) ([]byte, bool) {
+	data, err := afero.ReadFile(s.fs, filepath.Join(s.dir, s.names(id)[0]))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// revision returns the current revision of the object with the given ID.
+func (s *fileStore) revision(id string) (string, bool) {
+	data, exists := s.read(id)
+	if !exists {
+		return "", false
+	}
+	return fileRevision(data), true
+}
+
+// save replaces the files of an object and returns its new revision.
+func (s *fileStore) save(id string, files map[string][]byte, action string, r *http.Request) (string, error) {
+	s.gw.fileStoreMu.Lock()
+	defer s.gw.fileStoreMu.Unlock()
+
+	if err := s.checkRevision(id, r); err != nil {
+		return "", err
+	}
+
+	return s.write(id, files, action, r)
+}
+
+// remove deletes the files of an object.
+func (s *fileStore) remove(id string, r *http.Request) error {
+	s.gw.fileStoreMu.Lock()
+	defer s.gw.fileStoreMu.Unlock()
+
+	if _, exists := s.revision(id); !exists {
+		return errFileNotFound
+	}
+
+	if err := s.checkRevision(id, r); err != nil {
+		return err
+	}
+
+	s.seedHistory(id)
+	for _, name := range s.names(id) {
+		if err := s.fs.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	s.record(id, fileVersion{Action: "deleted"}, r)
+	return nil
+}
+
+// rollback restores a version from the history of an object and returns its revision.
+func (s *fileStore) rollback(id, revision string, r *http.Request) (string, error) {
+	s.gw.fileStoreMu.Lock()
+	defer s.gw.fileStoreMu.Unlock()
+
+	if err := s.checkRevision(id, r); err != nil {
+		return "", err
+	}
+
+	history, err := s.history(id)
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		version := history[i]
+		if version.Revision != revision || len(version.Files) == 0 {
+			continue
+		}
+
+		files := make(map[string][]byte, len(version.Files))
+		for name, data := range version.Files {
+			files[name] = data
+		}
+		return s.write(id, files, "rolled back", r)
+	}
+
+	return "", errRevisionNotInHistory
+}
+
+// history returns the recorded versions of an object, the latest one last.
+func (s *fileStore) history(id string) ([]fileVersion, error) {
+	data, err := afero.ReadFile(s.fs, s.historyPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var history []fileVersion
+	err = json.Unmarshal(data, &history)
+	return history, err
+}
+
+// checkRevision compares the revisions in the If-Match header of r with the
+// current revision of an object.
+func (s *fileStore) checkRevision(id string, r *http.Request) error {
+	ifMatch := r.Header.Get(headers.IfMatch)
+	if ifMatch == "" {
+		return nil
+	}
+
+	current, exists := s.revision(id)
+	if ifMatch == "*" {
+		if !exists {
+			return errRevisionMismatch
+		}
+		return nil
+	}
+
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if unquoted, err := strconv.Unquote(tag); err == nil {
+			tag = unquoted
+		}
+		if exists && tag == current {
+			return nil
+		}
+	}
+
+	return errRevisionMismatch
+}
+
+func (s *fileStore) write(id string, files map[string][]byte, action string, r *http.Request) (string, error) {
+	s.seedHistory(id)
+
+	version := fileVersion{Action: action, Files: make(map[string]json.RawMessage)}
+	for _, name := range s.names(id) {
+		path := filepath.Join(s.dir, name)
+		data, ok := files[name]
+		if !ok {
+			if err := s.fs.Remove(path); err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+			continue
+		}
+
+		if err := writeFileAtomic(s.fs, path, data); err != nil {
+			return "", err
+		}
+		version.Files[name] = data
+	}
+
+	version.Revision = fileRevision(files[s.names(id)[0]])
+	s.record(id, version, r)
+	return version.Revision, nil
+}
+
+// seedHistory records the current version of an object which has no
+// history yet, so that the changes made before keeping it can be rolled back.
+func (s *fileStore) seedHistory(id string) {
+	if s.historySize() <= 0 {
+		return
+	}
+
+	if exists, _ := afero.Exists(s.fs, s.historyPath(id)); exists {
+		return
+	}
+
+	version := fileVersion{Action: "imported", Files: make(map[string]json.RawMessage)}
+	for _, name := range s.names(id) {
+		path := filepath.Join(s.dir, name)
+		data, err := afero.ReadFile(s.fs, path)
+		if err != nil || !json.Valid(data) {
+			continue
+		}
+
+		if name == s.names(id)[0] {
+			version.Revision = fileRevision(data)
+			if info, err := s.fs.Stat(path); err == nil {
+				version.Time = info.ModTime()
+			}
+		}
+		version.Files[name] = data
+	}
+
+	if version.Revision != "" {
+		s.appendHistory(id, version)
+	}
+}
+
+// record adds a change made through r to the history of an object.
+func (s *fileStore) record(id string, version fileVersion, r *http.Request) {
+	version.User = requestActor(r)
+	version.ClaimedUser = r.Header.Get(headers.XTykActor)
+	version.Time = time.Now()
+
+	log.WithFields(logrus.Fields{
+		"prefix":   "api",
+		"id":       id,
+		"action":   version.Action,
+		"revision": version.Revision,
+		"user":     version.User,
+		"claimed":  version.ClaimedUser,
+	}).Info("Stored file changed")
+
+	if s.historySize() > 0 {
+		s.appendHistory(id, version)
+	}
+}
+
+func (s *fileStore) appendHistory(id string, version fileVersion) {
+	history, err := s.history(id)
+	if err != nil {
+		log.WithError(err).WithField("id", id).Warning("Couldn't read history, starting a new one")
+	}
+
+	history = append(history, version)
+	if size := s.historySize(); len(history) > size {
+		history = history[len(history)-size:]
+	}
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err == nil {
+		if err = s.fs.MkdirAll(filepath.Dir(s.historyPath(id)), 0755); err == nil {
+			err = writeFileAtomic(s.fs, s.historyPath(id), data)
+		}
+	}
+	if err != nil {
+		log.WithError(err).WithField("id", id).Error("Couldn't write history")
+	}
+}
+
+func (s *fileStore) historyPath(id string) string {
+	return filepath.Join(s.dir, fileHistoryDir, id+".json")
+}
+
+func (s *fileStore) historySize() int {
+	if size := s.gw.GetConfig().FileHistorySize; size != 0 {
+		return size
+	}
+	return defaultFileHistorySize
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it to path, so that readers never see a partially written file.
+func writeFileAtomic(fs afero.Fs, path string, data []byte) error {
+	f, err := afero.TempFile(fs, filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = fs.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		fs.Remove(f.Name())
+	}
+	return err
+}
+
+// requestActor identifies who made a Gateway API request by the named
+// credential it was authenticated with, or else the address the request came
+// from. Client supplied headers aren't trusted.
+func requestActor(r *http.Request) string {
+	if cred := ctxGetControlAPICredential(r); cred != nil {
+		return cred.name
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// setRevisionHeader sets the ETag header to the current revision of an object.
+func (s *fileStore) setRevisionHeader(w http.ResponseWriter, id string) {
+	if revision, exists := s.revision(id); exists {
+		w.Header().Set(headers.ETag, strconv.Quote(revision))
+	}
+}
+
+// fileStoreError returns the Gateway API response for an error of a fileStore.
+func fileStoreError(err error, kind string) (interface{}, int) {
+	switch err {
+	case errFileNotFound:
+		return apiError(kind + " not found"), http.StatusNotFound
+	case errRevisionMismatch:
+		return apiError(kind + " has been modified, its revision doesn't match If-Match"), http.StatusPreconditionFailed
+	case errRevisionNotInHistory:
+		return apiError("Revision not found in the history"), http.StatusNotFound
+	}
+
+	log.WithError(err).Error("Couldn't store file")
+	return apiError("Failed to store file"), http.StatusInternalServerError
+}
+
+func (gw *Gateway) apiHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if gw.GetConfig().UseDBAppConfigs {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Due to enabled use_db_app_configs, please use the Dashboard API"))
+		return
+	}
+
+	obj, code := handleFileHistory(gw.apiFileStore(afero.NewOsFs()), mux.Vars(r)["apiID"])
+	doJSONWrite(w, code, obj)
+}
+
+func (gw *Gateway) apiRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	if gw.GetConfig().UseDBAppConfigs {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Due to enabled use_db_app_configs, please use the Dashboard API"))
+		return
+	}
+
+	store := gw.apiFileStore(afero.NewOsFs())
+	apiID := mux.Vars(r)["apiID"]
+	obj, code := handleFileRollback(store, apiID, "API", r)
+	if code == http.StatusOK {
+		store.setRevisionHeader(w, apiID)
+	}
+	doJSONWrite(w, code, obj)
+}
+
+func (gw *Gateway) policyHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if gw.GetConfig().Policies.PolicySource == "service" {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Due to enabled service policy source, please use the Dashboard API"))
+		return
+	}
+
+	obj, code := handleFileHistory(gw.policyFileStore(afero.NewOsFs()), mux.Vars(r)["polID"])
+	doJSONWrite(w, code, obj)
+}
+
+func (gw *Gateway) policyRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	if gw.GetConfig().Policies.PolicySource == "service" {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Due to enabled service policy source, please use the Dashboard API"))
+		return
+	}
+
+	store := gw.policyFileStore(afero.NewOsFs())
+	polID := mux.Vars(r)["polID"]
+	obj, code := handleFileRollback(store, polID, "Policy", r)
+	if code == http.StatusOK {
+		store.setRevisionHeader(w, polID)
+	}
+	doJSONWrite(w, code, obj)
+}
+
+// handleFileHistory lists the versions in the history of an object, without their content.
+func handleFileHistory(store *fileStore, id string) (interface{}, int) {
+	history, err := store.history(id)
+	if err != nil {
+		return fileStoreError(err, "")
+	}
+
+	versions := make([]fileVersion, len(history))
+	for i, version := range history {
+		version.Files = nil
+		versions[i] = version
+	}
+	return versions, http.StatusOK
+}
+
+// handleFileRollback restores the version of an object given by the revision query parameter.
+func handleFileRollback(store *fileStore, id, kind string, r *http.Request) (interface{}, int) {
+	revision := r.URL.Query().Get("revision")
+	if revision == "" {
+		return apiError("revision should be set to the revision to roll back to"), http.StatusBadRequest
+	}
+
+	if _, err := store.rollback(id, revision, r); err != nil {
+		return fileStoreError(err, kind)
+	}
+
+	return apiModifyKeySuccess{
+		Key:    id,
+		Status: "ok",
+		Action: "rolled back",
+	}, http.StatusOK
+}
+
+// modifiedKey returns the ID of the object changed by a Gateway API call.
+func modifiedKey(obj interface{}) string {
+	if success, ok := obj.(apiModifyKeySuccess); ok {
+		return success.Key
+	}
+	return ""
+}
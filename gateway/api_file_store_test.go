@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+func TestFileStore(t *testing.T) {
+	gw := &Gateway{}
+	gw.SetConfig(config.Config{AppPath: "/apps", FileHistorySize: 3})
+
+	fs := afero.NewMemMapFs()
+	store := gw.apiFileStore(fs)
+
+	request := func(ifMatch string) *http.Request {
+		r := httptest.NewRequest(http.MethodPut, "/tyk/apis/1", nil)
+		r.Header.Set(headers.XTykActor, "admin")
+		if ifMatch != "" {
+			r.Header.Set(headers.IfMatch, ifMatch)
+		}
+		return r
+	}
+	files := func(def string) map[string][]byte {
+		return map[string][]byte{"1.json": []byte(def), "1-oas.json": []byte(`{}`)}
+	}
+
+	// a file created before the history was kept
+	require.NoError(t, afero.WriteFile(fs, "/apps/1.json", []byte(`{"name": "v0"}`), 0644))
+	v0, _ := store.revision("1")
+
+	v1, err := store.save("1", files(`{"name": "v1"}`), "modified", request(strconv.Quote(v0)))
+	require.NoError(t, err)
+	assert.NotEqual(t, v0, v1)
+
+	_, err = store.save("1", files(`{"name": "v2"}`), "modified", request(strconv.Quote(v0)))
+	assert.Equal(t, errRevisionMismatch, err, "stale revision")
+
+	v2, err := store.save("1", files(`{"name": "v2"}`), "modified", request(`"other", W/"`+v1+`"`))
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(fs, "/apps/1.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "v2"}`, string(data))
+
+	history, err := store.history("1")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, "imported", history[0].Action)
+	assert.Equal(t, v0, history[0].Revision)
+	assert.Equal(t, "192.0.2.1", history[2].User, "the header isn't trusted")
+	assert.Equal(t, "admin", history[2].ClaimedUser)
+
+	_, err = store.rollback("1", "unknown", request(""))
+	assert.Equal(t, errRevisionNotInHistory, err)
+
+	restored, err := store.rollback("1", v0, request(""))
+	require.NoError(t, err)
+	assert.Equal(t, v0, restored, "rolled back version keeps its revision")
+	exists, _ := afero.Exists(fs, "/apps/1-oas.json")
+	assert.False(t, exists, "files missing from the version are removed")
+
+	history, _ = store.history("1")
+	require.Len(t, history, 3, "history is trimmed")
+	assert.Equal(t, "rolled back", history[2].Action)
+
+	authenticated := request("")
+	ctxSetControlAPICredential(authenticated, &controlAPICredential{name: "ci"})
+	_, err = store.save("1", files(`{"name": "v3"}`), "modified", authenticated)
+	require.NoError(t, err)
+	history, _ = store.history("1")
+	assert.Equal(t, "ci", history[2].User, "the credential is recorded")
+
+	assert.Equal(t, errRevisionMismatch, store.remove("1", request(strconv.Quote(v2))))
+	require.NoError(t, store.remove("1", request("*")))
+	_, exists = store.revision("1")
+	assert.False(t, exists)
+	assert.Equal(t, errFileNotFound, store.remove("1", request("")))
+
+	history, _ = store.history("1")
+	assert.Equal(t, "deleted", history[len(history)-1].Action)
+
+	paths, _ := afero.Glob(fs, filepath.Join("/apps", "*"))
+	assert.Equal(t, []string{"/apps/" + fileHistoryDir}, paths, "no temporary files are left")
+}
@@ -0,0 +1,550 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	bulkKeyCreate = "create"
+	bulkKeyUpdate = "update"
+	bulkKeyDelete = "delete"
+
+	// bulkKeyBatchSize is the number of keys read and written in one round trip
+	bulkKeyBatchSize = 500
+
+	// maxBulkKeyLineSize is the size of the largest key accepted in a bulk request
+	maxBulkKeyLineSize = 1 << 20
+)
+
+// keyBatcher is implemented by the key stores which can read and write many
+// keys in one round trip.
+type keyBatcher interface {
+	GetRawMultiKey(keys []string) ([]string, error)
+	SetRawKeys(keys, values []string, timeouts []int64) ([]error, error)
+	DeleteRawKeys(keys []string) ([]bool, error)
+}
+
+// handlerKeyBatcher applies batches one key at a time, for the key stores
+// which can't pipeline them.
+type handlerKeyBatcher struct {
+	storage.Handler
+}
+
+func (h handlerKeyBatcher) GetRawMultiKey(keys []string) ([]string, error) {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i], _ = h.GetRawKey(key)
+	}
+	return values, nil
+}
+
+func (h handlerKeyBatcher) SetRawKeys(keys, values []string, timeouts []int64) ([]error, error) {
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = h.SetRawKey(key, values[i], timeouts[i])
+	}
+	return errs, nil
+}
+
+func (h handlerKeyBatcher) DeleteRawKeys(keys []string) ([]bool, error) {
+	deleted := make([]bool, len(keys))
+	for i, key := range keys {
+		deleted[i] = h.DeleteRawKey(key)
+	}
+	return deleted, nil
+}
+
+func (gw *Gateway) keyBatcher() keyBatcher {
+	store := gw.GlobalSessionManager.Store()
+	if batcher, ok := store.(keyBatcher); ok {
+		return batcher
+	}
+	return handlerKeyBatcher{store}
+}
+
+// apiBulkKeyResult is the result of one key of a bulk request.
+type apiBulkKeyResult struct {
+	Line    int    `json:"line"`
+	Key     string `json:"key,omitempty"`
+	KeyHash string `json:"key_hash,omitempty"`
+	Status  string `json:"status"`
+	Action  string `json:"action,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// bulkKeyOptions are the options of a bulk request, shared by all its keys.
+type bulkKeyOptions struct {
+	action        string
+	hashed        bool
+	suppressReset bool
+	orgID         string
+	// cred is the Gateway API credential of the request, checked against the
+	// organisations of each key
+	cred *controlAPICredential
+}
+
+type bulkKeyItem struct {
+	session  *user.SessionState
+	name     string
+	lifetime int64
+	result   apiBulkKeyResult
+}
+
+func (i *bulkKeyItem) fail(message string) {
+	i.result.Status = "error"
+	i.result.Message = message
+}
+
+func (i *bulkKeyItem) failed() bool {
+	return i.result.Status == "error"
+}
+
+// keyBulkHandler creates, updates or deletes the keys of a JSONL stream of
+// sessions, and streams back the result of each of them.
+func (gw *Gateway) keyBulkHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := bulkKeyOptions{
+		action:        query.Get("action"),
+		hashed:        query.Get("hashed") != "",
+		suppressReset: query.Get("suppress_reset") == "1",
+		orgID:         query.Get("org_id"),
+		cred:          ctxGetControlAPICredential(r),
+	}
+
+	switch opts.action {
+	case "":
+		opts.action = bulkKeyCreate
+	case bulkKeyCreate, bulkKeyUpdate, bulkKeyDelete:
+	default:
+		doJSONWrite(w, http.StatusBadRequest, apiError("action must be create, update or delete"))
+		return
+	}
+	if opts.hashed && !gw.GetConfig().HashKeys {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Hashed keys can only be imported when key hashing is enabled"))
+		return
+	}
+
+	batcher := gw.keyBatcher()
+	w.Header().Set(headers.ContentType, headers.ApplicationNDJSON)
+	enc := json.NewEncoder(w)
+	flush := func(items []*bulkKeyItem) {
+		for _, item := range items {
+			enc.Encode(item.result)
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+
+	var applied, failed int
+	batch := make([]*bulkKeyItem, 0, bulkKeyBatchSize)
+	apply := func() {
+		gw.applyKeyBatch(batcher, opts, batch)
+		for _, item := range batch {
+			if item.failed() {
+				failed++
+			} else {
+				applied++
+			}
+		}
+		flush(batch)
+		batch = batch[:0]
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxBulkKeyLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		item := &bulkKeyItem{session: &user.SessionState{}, result: apiBulkKeyResult{Line: line}}
+		if err := json.Unmarshal(data, item.session); err != nil {
+			item.fail("Couldn't decode key: " + err.Error())
+		}
+		batch = append(batch, item)
+
+		if len(batch) == bulkKeyBatchSize {
+			apply()
+		}
+	}
+	apply()
+
+	if err := scanner.Err(); err != nil {
+		item := &bulkKeyItem{result: apiBulkKeyResult{Line: line + 1}}
+		item.fail("Couldn't read request: " + err.Error())
+		flush([]*bulkKeyItem{item})
+		failed++
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":  "api",
+		"action":  opts.action,
+		"applied": applied,
+		"failed":  failed,
+	}).Info("Applied bulk key request.")
+}
+
+// applyKeyBatch applies a batch of a bulk request, reading the current keys
+// and writing the new ones in one round trip each.
+func (gw *Gateway) applyKeyBatch(batcher keyBatcher, opts bulkKeyOptions, batch []*bulkKeyItem) {
+	prefix := gw.GlobalSessionManager.Store().GetKeyPrefix()
+
+	var items []*bulkKeyItem
+	for _, item := range batch {
+		if item.failed() {
+			continue
+		}
+
+		keyID := item.session.KeyID
+		switch {
+		case keyID == "" && opts.action != bulkKeyCreate:
+			item.fail("key_id is required")
+			continue
+		case keyID == "" && opts.hashed:
+			item.fail("key_id is required for hashed keys")
+			continue
+		case keyID == "":
+			keyID = gw.keyGen.GenerateAuthKey(item.session.OrgID)
+		}
+		if opts.orgID != "" && opts.action != bulkKeyDelete && item.session.OrgID != opts.orgID {
+			item.fail("Key doesn't belong to the organisation")
+			continue
+		}
+
+		item.result.Key = keyID
+		item.name = prefix + gw.storedKeyName(keyID, opts.hashed)
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.name
+	}
+	current, err := batcher.GetRawMultiKey(names)
+	if err != nil {
+		for _, item := range items {
+			item.fail("Couldn't read keys")
+		}
+		log.WithError(err).Error("Couldn't read keys of bulk request")
+		return
+	}
+
+	var writes []*bulkKeyItem
+	for i, item := range items {
+		var original *user.SessionState
+		if current[i] != "" {
+			original = &user.SessionState{}
+			if err := json.Unmarshal([]byte(current[i]), original); err != nil {
+				item.fail("Couldn't decode existing key")
+				continue
+			}
+		}
+
+		switch {
+		case opts.action == bulkKeyCreate && original != nil:
+			item.fail("Key already exists")
+			continue
+		case opts.action != bulkKeyCreate && original == nil:
+			item.fail("Key is not found")
+			continue
+		case opts.orgID != "" && original != nil && original.OrgID != opts.orgID:
+			item.fail("Key doesn't belong to the organisation")
+			continue
+		case !gw.bulkKeyAllowed(opts, item.session, original):
+			item.fail("Access to this key is not allowed for this credential")
+			continue
+		}
+
+		if opts.action == bulkKeyDelete {
+			item.session = original
+		} else if err := gw.prepareBulkKey(item, original, opts.suppressReset); err != nil {
+			item.fail(err.Error())
+			continue
+		}
+		writes = append(writes, item)
+	}
+	if len(writes) == 0 {
+		return
+	}
+
+	names = names[:0]
+	var quotaKeys []string
+	for _, item := range writes {
+		names = append(names, item.name)
+		if opts.action == bulkKeyDelete || !opts.suppressReset {
+			quotaKeys = append(quotaKeys, quotaKeyNames(strings.TrimPrefix(item.name, prefix), item.session)...)
+		}
+	}
+
+	if opts.action == bulkKeyDelete {
+		deleted, err := batcher.DeleteRawKeys(names)
+		for i, item := range writes {
+			if err != nil || !deleted[i] {
+				item.fail("Failed to remove the key")
+			}
+		}
+	} else {
+		values := make([]string, len(writes))
+		timeouts := make([]int64, len(writes))
+		for i, item := range writes {
+			data, _ := json.Marshal(item.session)
+			values[i] = string(data)
+			timeouts[i] = item.lifetime
+		}
+		errs, err := batcher.SetRawKeys(names, values, timeouts)
+		for i, item := range writes {
+			if err != nil || errs[i] != nil {
+				item.fail("Could not write key data")
+			}
+		}
+	}
+
+	if len(quotaKeys) > 0 {
+		batcher.DeleteRawKeys(quotaKeys)
+	}
+
+	gw.completeKeyBatch(opts, prefix, writes)
+}
+
+// bulkKeyAllowed reports whether the credential of a bulk request may write a
+// key, given the organisations of the key as stored and, unless it is
+// deleted, as requested: the org check of the Gateway API only sees the
+// first line of the request.
+func (gw *Gateway) bulkKeyAllowed(opts bulkKeyOptions, session, original *user.SessionState) bool {
+	if opts.cred == nil {
+		return true
+	}
+	return opts.cred.allows(controlAPIKeys, controlAPIWrite, func() []string {
+		orgs := gw.keyOrgs(original)
+		if opts.action != bulkKeyDelete {
+			orgs = append(orgs, gw.keyOrgs(session)...)
+		}
+		return orgs
+	})
+}
+
+// prepareBulkKey applies the policies of a key created or updated by a bulk
+// request and checks its access rights, as for a single key.
+func (gw *Gateway) prepareBulkKey(item *bulkKeyItem, original *user.SessionState, suppressReset bool) error {
+	session := item.session
+	session.KeyID = ""
+
+	mw := BaseMiddleware{Gw: gw}
+	if err := mw.ApplyPolicies(session); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if original == nil {
+		session.DateCreated = now
+		for _, polID := range session.PolicyIDs() {
+			gw.policiesMu.RLock()
+			policy, ok := gw.policiesByID[polID]
+			gw.policiesMu.RUnlock()
+			if ok && policy.KeyExpiresIn > 0 {
+				session.Expires = now.Unix() + policy.KeyExpiresIn
+			}
+		}
+	} else {
+		session.DateCreated = original.DateCreated
+		if suppressReset {
+			session.QuotaRenews = original.QuotaRenews
+			session.LastUpdated = original.LastUpdated
+		}
+	}
+	if !suppressReset {
+		session.LastUpdated = strconv.Itoa(int(now.Unix()))
+		session.QuotaRenews = now.Unix() + session.QuotaRenewalRate
+	}
+
+	var specs []*APISpec
+	if len(session.AccessRights) > 0 {
+		resetAPILimits(session.AccessRights)
+		for apiID := range session.AccessRights {
+			spec := gw.getApiSpec(apiID)
+			if spec == nil {
+				return fmt.Errorf("API %s must be active to add keys", apiID)
+			}
+			specs = append(specs, spec)
+		}
+	} else {
+		if !gw.GetConfig().AllowMasterKeys {
+			return errors.New("Master keys not allowed")
+		}
+		gw.apisMu.RLock()
+		for _, spec := range gw.apisByID {
+			specs = append(specs, spec)
+		}
+		gw.apisMu.RUnlock()
+	}
+
+	conf := gw.GetConfig()
+	for _, spec := range specs {
+		if lifetime := session.Lifetime(spec.SessionLifetime, conf.ForceGlobalSessionLifetime, conf.GlobalSessionLifetime); lifetime > item.lifetime {
+			item.lifetime = lifetime
+		}
+	}
+
+	return nil
+}
+
+// completeKeyBatch reports the keys applied by a batch of a bulk request, and
+// flushes them from the session caches of the gateways.
+func (gw *Gateway) completeKeyBatch(opts bulkKeyOptions, prefix string, items []*bulkKeyItem) {
+	hashKeys := gw.GetConfig().HashKeys
+
+	var cacheKeys []string
+	for _, item := range items {
+		if item.failed() {
+			continue
+		}
+
+		stored := strings.TrimPrefix(item.name, prefix)
+		cacheKeys = append(cacheKeys, stored)
+		gw.SessionCache.Delete(stored)
+
+		item.result.Status = "ok"
+		event := EventTokenUpdated
+		switch opts.action {
+		case bulkKeyCreate:
+			item.result.Action = "added"
+			event = EventTokenCreated
+			if hashKeys {
+				item.result.KeyHash = stored
+			}
+			gw.indexKey(stored, true, item.session)
+		case bulkKeyUpdate:
+			item.result.Action = "modified"
+			gw.indexKey(stored, true, item.session)
+		case bulkKeyDelete:
+			item.result.Action = "deleted"
+			event = EventTokenDeleted
+			gw.unindexKey(stored, true)
+		}
+
+		gw.FireSystemEvent(event, EventTokenMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Key " + item.result.Action + " in bulk."},
+			Org:              item.session.OrgID,
+			Key:              item.result.Key,
+		})
+	}
+
+	if len(cacheKeys) > 0 {
+		gw.MainNotifier.Notify(Notification{
+			Command: KeySpaceUpdateNotification,
+			Payload: strings.Join(cacheKeys, ","),
+			Gw:      gw,
+		})
+	}
+}
+
+// quotaKeyNames returns the names of the quota and rate limit counters of the
+// key stored as name, which are reset as for a single key.
+func quotaKeyNames(name string, session *user.SessionState) []string {
+	keys := []string{QuotaKeyPrefix + name, RateLimitKeyPrefix + name + ".BLOCKED"}
+	for _, acl := range session.AccessRights {
+		if acl.AllowanceScope != "" {
+			keys = append(keys, QuotaKeyPrefix+acl.AllowanceScope+"-"+name)
+		}
+	}
+	return keys
+}
+
+// keyExportHandler streams the sessions of the keys of an organisation as
+// JSONL, optionally with the names of the keys hashed for a gateway hashing them.
+func (gw *Gateway) keyExportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	orgID := query.Get("org_id")
+	if orgID == "" {
+		doJSONWrite(w, http.StatusBadRequest, apiError("org_id is required"))
+		return
+	}
+
+	conf := gw.GetConfig()
+	if conf.HashKeys && !conf.EnableHashedKeysListing {
+		doJSONWrite(w, http.StatusNotFound, apiError("Hashed key listing is disabled in config (enable_hashed_keys_listing)"))
+		return
+	}
+	rehash := query.Get("hash_keys") == "true"
+	if rehash && conf.HashKeys {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Keys are already hashed"))
+		return
+	}
+
+	store := gw.GlobalSessionManager.Store()
+	scanner, ok := store.(keyScanner)
+	if !ok {
+		doJSONWrite(w, http.StatusNotImplemented, apiError("Key export isn't supported by the key store"))
+		return
+	}
+
+	w.Header().Set(headers.ContentType, headers.ApplicationNDJSON)
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	count := 0
+	cursor := ""
+	for {
+		names, next, err := scanner.ScanKeys("", cursor, bulkKeyBatchSize)
+		if err != nil {
+			log.WithError(err).Error("Couldn't export keys")
+			return
+		}
+
+		names = sessionKeyNames(names)
+		values, err := scanner.GetRawMultiKey(prefixKeyNames(store.GetKeyPrefix(), names))
+		if err != nil {
+			log.WithError(err).Error("Couldn't export keys")
+			return
+		}
+
+		for i, value := range values {
+			session, ok := keyListSession(value)
+			if !ok || session.OrgID != orgID {
+				continue
+			}
+			session.KeyID = names[i]
+			if rehash {
+				session.KeyID = storage.HashKey(names[i], true)
+			}
+			if err := enc.Encode(session); err != nil {
+				return
+			}
+			count++
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"org_id": orgID,
+		"keys":   count,
+	}).Info("Exported keys.")
+}
@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmylund/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// memKeyStore keeps the raw keys of a key store in memory.
+type memKeyStore struct {
+	storage.Handler
+	keys map[string]string
+}
+
+func (m *memKeyStore) Connect() bool        { return true }
+func (m *memKeyStore) GetKeyPrefix() string { return "apikey-" }
+func (m *memKeyStore) DeleteRawKey(k string) bool {
+	_, ok := m.keys[k]
+	delete(m.keys, k)
+	return ok
+}
+
+func (m *memKeyStore) GetRawKey(k string) (string, error) {
+	if v, ok := m.keys[k]; ok {
+		return v, nil
+	}
+	return "", storage.ErrKeyNotFound
+}
+
+func (m *memKeyStore) SetRawKey(k, v string, _ int64) error {
+	m.keys[k] = v
+	return nil
+}
+
+func TestKeyBulkHandler(t *testing.T) {
+	store := &memKeyStore{keys: map[string]string{}}
+	gw := &Gateway{
+		SessionCache: cache.New(time.Minute, time.Minute),
+		apisByID: map[string]*APISpec{
+			"api1": {APIDefinition: &apidef.APIDefinition{APIID: "api1", OrgID: "org1"}},
+			"api2": {APIDefinition: &apidef.APIDefinition{APIID: "api2", OrgID: "org2"}},
+		},
+		policiesByID: map[string]user.Policy{
+			"pol2": {ID: "pol2", OrgID: "org2"},
+		},
+	}
+	gw.SetConfig(config.Config{})
+	gw.keyGen = DefaultKeyGenerator{Gw: gw}
+	gw.MainNotifier = RedisNotifier{&storage.RedisCluster{RedisController: storage.NewRedisController()}, RedisPubSubChannel, gw}
+	gw.GlobalSessionManager = &DefaultSessionManager{Gw: gw}
+	gw.GlobalSessionManager.Init(store)
+
+	doAs := func(cred *controlAPICredential, query, body string) []apiBulkKeyResult {
+		req := httptest.NewRequest(http.MethodPost, "/keys/bulk"+query, strings.NewReader(body))
+		if cred != nil {
+			ctxSetControlAPICredential(req, cred)
+		}
+		rec := httptest.NewRecorder()
+		gw.keyBulkHandler(rec, req)
+
+		var results []apiBulkKeyResult
+		scanner := bufio.NewScanner(rec.Body)
+		for scanner.Scan() {
+			var result apiBulkKeyResult
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &result))
+			results = append(results, result)
+		}
+		return results
+	}
+	do := func(query, body string) []apiBulkKeyResult {
+		return doAs(nil, query, body)
+	}
+
+	access := `"access_rights": {"api1": {"api_id": "api1"}}`
+	results := do("", strings.Join([]string{
+		`{"key_id": "k1", "org_id": "org1", "rate": 10, ` + access + `}`,
+		``,
+		`{"org_id": "org1", ` + access + `}`,
+		`{"key_id": "k3", "org_id": "org1", "access_rights": {"unknown": {}}}`,
+		`{"key_id": "k4", "org_id": "org1"}`,
+		`not json`,
+	}, "\n"))
+	require.Len(t, results, 5)
+	assert.Equal(t, apiBulkKeyResult{Line: 1, Key: "k1", Status: "ok", Action: "added"}, results[0])
+	assert.Equal(t, "ok", results[1].Status)
+	assert.NotEmpty(t, results[1].Key, "key generated")
+	assert.Equal(t, 4, results[2].Line, "lines are counted from the request")
+	assert.Equal(t, "API unknown must be active to add keys", results[2].Message)
+	assert.Equal(t, "Master keys not allowed", results[3].Message)
+	assert.Equal(t, "error", results[4].Status)
+	assert.Len(t, store.keys, 2)
+
+	results = do("", `{"key_id": "k1", "org_id": "org1", `+access+`}`)
+	assert.Equal(t, "Key already exists", results[0].Message)
+
+	results = do("?action=update&suppress_reset=1&org_id=org1", strings.Join([]string{
+		`{"key_id": "k1", "org_id": "org1", "rate": 20, ` + access + `}`,
+		`{"key_id": "missing", "org_id": "org1", ` + access + `}`,
+		`{"key_id": "k1", "org_id": "org2", ` + access + `}`,
+	}, "\n"))
+	require.Len(t, results, 3)
+	assert.Equal(t, "modified", results[0].Action)
+	assert.Equal(t, "Key is not found", results[1].Message)
+	assert.Equal(t, "Key doesn't belong to the organisation", results[2].Message)
+
+	var session user.SessionState
+	require.NoError(t, json.Unmarshal([]byte(store.keys["apikey-k1"]), &session))
+	assert.Equal(t, float64(20), session.Rate)
+	assert.Empty(t, session.KeyID, "key ID isn't stored")
+
+	results = do("?action=delete", `{"key_id": "k1"}`+"\n"+`{"key_id": "k1"}`)
+	assert.Equal(t, "deleted", results[0].Action)
+	assert.Equal(t, "Failed to remove the key", results[1].Message, "keys of a batch are read before it is applied")
+	assert.Len(t, store.keys, 1)
+
+	org1 := &controlAPICredential{name: "org1", roles: []config.ControlAPIRole{
+		{Resources: []string{"keys"}, Actions: []string{"write"}, Orgs: []string{"org1"}},
+	}}
+	results = do("", `{"key_id": "other", "org_id": "org2", "access_rights": {"api2": {"api_id": "api2"}}}`)
+	require.Equal(t, "ok", results[0].Status)
+	results = doAs(org1, "?org_id=org1", strings.Join([]string{
+		`{"key_id": "o1", "org_id": "org1", ` + access + `}`,
+		`{"key_id": "o2", "org_id": "org1", "access_rights": {"api2": {"api_id": "api2"}}}`,
+		`{"key_id": "o3", "org_id": "org1", "access_rights": {"x": {"api_id": "api2"}}}`,
+		`{"key_id": "o4", "org_id": "org1", "apply_policies": ["pol2"]}`,
+	}, "\n"))
+	require.Len(t, results, 4)
+	assert.Equal(t, "ok", results[0].Status)
+	for _, result := range results[1:] {
+		assert.Equal(t, "Access to this key is not allowed for this credential", result.Message, "line %d", result.Line)
+	}
+	results = doAs(org1, "?action=delete", `{"key_id": "other"}`)
+	assert.Equal(t, "Access to this key is not allowed for this credential", results[0].Message, "stored org is checked")
+	assert.Contains(t, store.keys, "apikey-other")
+
+	req := httptest.NewRequest(http.MethodPost, "/keys/bulk?action=upsert", nil)
+	rec := httptest.NewRecorder()
+	gw.keyBulkHandler(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestQuotaKeyNames(t *testing.T) {
+	session := &user.SessionState{AccessRights: map[string]user.AccessDefinition{
+		"api1": {AllowanceScope: "per-api"},
+		"api2": {},
+	}}
+	assert.ElementsMatch(t, []string{"quota-k1", "rate-limit-k1.BLOCKED", "quota-per-api-k1"}, quotaKeyNames("k1", session))
+}
@@ -0,0 +1,197 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	defaultKeyRotationGracePeriod = 3600
+
+	// keyRotatedToMetaKey is set in the meta data of a rotated key, holding the hash of its successor.
+	keyRotatedToMetaKey = "tyk_key_rotated_to"
+	// keyQuotaOfMetaKey is set in the meta data of a rotated key, holding the name the quota counters of its
+	// successor are stored under, so that both keys use the same quota.
+	keyQuotaOfMetaKey = "tyk_key_quota_of"
+)
+
+// apiRotateKeySuccess is the response of a key rotation, Key being the successor key.
+type apiRotateKeySuccess struct {
+	apiModifyKeySuccess
+	PreviousKeyExpires int64 `json:"previous_key_expires"`
+}
+
+// rotateKeyHandler issues a successor for a key. The successor has the same
+// session, including the remaining quota, while the rotated key stays valid
+// for a grace period, sharing the quota of its successor.
+func (gw *Gateway) rotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := mux.Vars(r)["keyName"]
+	isHashed := r.URL.Query().Get("hashed") != ""
+	orgID := r.URL.Query().Get("org_id")
+
+	gracePeriod := gw.GetConfig().KeyRotationGracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = defaultKeyRotationGracePeriod
+	}
+	if value := r.URL.Query().Get("grace_period"); value != "" {
+		var err error
+		if gracePeriod, err = strconv.ParseInt(value, 10, 64); err != nil || gracePeriod < 0 {
+			doJSONWrite(w, http.StatusBadRequest, apiError("grace_period should be a non-negative number of seconds"))
+			return
+		}
+	}
+
+	obj, code := gw.handleRotateKey(keyName, orgID, gracePeriod, isHashed)
+	doJSONWrite(w, code, obj)
+}
+
+func (gw *Gateway) handleRotateKey(keyName, orgID string, gracePeriod int64, isHashed bool) (interface{}, int) {
+	session, found := gw.GlobalSessionManager.SessionDetail(orgID, keyName, isHashed)
+	if !found {
+		return apiError("Key is not found"), http.StatusNotFound
+	}
+	keyName = session.KeyID
+
+	if session.Certificate != "" || session.BasicAuthData.Password != "" {
+		// These keys are derived from the certificate or user name, so can't be replaced by a random one
+		return apiError("Certificate and basic auth keys can't be rotated"), http.StatusBadRequest
+	}
+
+	if _, rotated := session.MetaData[keyRotatedToMetaKey]; rotated {
+		return apiError("Key has already been rotated"), http.StatusConflict
+	}
+
+	hashKeys := gw.GetConfig().HashKeys
+	newKey := gw.keyGen.GenerateAuthKey(session.OrgID)
+
+	newSession := session.Clone()
+	newSession.KeyID = ""
+	newSession.DateCreated = time.Now()
+
+	oldHash := keyName
+	if !isHashed {
+		oldHash = storage.HashKey(keyName, hashKeys)
+	}
+	newHash := storage.HashKey(newKey, hashKeys)
+	gw.copyQuotaCounters(oldHash, newHash, &newSession)
+
+	if err := gw.doAddOrUpdate(newKey, &newSession, true, false); err != nil {
+		return apiError("Failed to create key, ensure security settings are correct."), http.StatusInternalServerError
+	}
+
+	if gracePeriod == 0 {
+		// No overlap requested, revoke the rotated key right away
+		gw.GlobalSessionManager.RemoveSession(session.OrgID, keyName, isHashed)
+		gw.GlobalSessionManager.ResetQuota(keyName, &session, isHashed)
+		session.Expires = time.Now().Unix()
+	} else if err := gw.expireRotatedKey(keyName, newKey, newHash, &session, gracePeriod, isHashed); err != nil {
+		gw.GlobalSessionManager.RemoveSession(newSession.OrgID, newKey, false)
+		log.WithError(err).Error("Could not update the rotated key")
+		return apiError("Failed to rotate key"), http.StatusInternalServerError
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":      "api",
+		"key":         gw.obfuscateKey(keyName),
+		"new_key":     gw.obfuscateKey(newKey),
+		"expires":     session.Expires,
+		"org_id":      session.OrgID,
+		"user_id":     "system",
+		"user_ip":     "--",
+		"path":        "--",
+		"server_name": "system",
+	}).Info("Key rotated.")
+
+	gw.FireSystemEvent(EventTokenCreated, EventTokenMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Key rotated."},
+		Org:              newSession.OrgID,
+		Key:              newKey,
+	})
+
+	response := apiRotateKeySuccess{
+		apiModifyKeySuccess: apiModifyKeySuccess{
+			Key:    newKey,
+			Status: "ok",
+			Action: "rotated",
+		},
+		PreviousKeyExpires: session.Expires,
+	}
+	if hashKeys {
+		response.KeyHash = storage.HashKey(newKey, hashKeys)
+	}
+
+	return response, http.StatusOK
+}
+
+// expireRotatedKey lets the rotated key expire after the grace period and
+// marks it, so its use can be reported and counted against the quota of
+// newKey, stored as newHash.
+func (gw *Gateway) expireRotatedKey(keyName, newKey, newHash string, session *user.SessionState, gracePeriod int64, isHashed bool) error {
+	expires := time.Now().Unix() + gracePeriod
+	if session.Expires < 1 || session.Expires > expires {
+		session.Expires = expires
+	}
+	if session.MetaData == nil {
+		session.MetaData = map[string]interface{}{}
+	}
+	session.MetaData[keyRotatedToMetaKey] = storage.HashStr(newKey)
+	session.MetaData[keyQuotaOfMetaKey] = newHash
+
+	return gw.GlobalSessionManager.UpdateSession(keyName, session, gracePeriod, isHashed)
+}
+
+// copyQuotaCounters copies the quota counters of a key to its successor, so
+// the remaining quota carries over.
+func (gw *Gateway) copyQuotaCounters(fromHash, toHash string, session *user.SessionState) {
+	store := gw.newStore(storage.StoreOptions{})
+
+	scopes := map[string]bool{"": true}
+	for _, access := range session.AccessRights {
+		if access.AllowanceScope != "" {
+			scopes[access.AllowanceScope+"-"] = true
+		}
+	}
+
+	for scope := range scopes {
+		from := QuotaKeyPrefix + scope + fromHash
+		value, err := store.GetRawKey(from)
+		if err != nil {
+			continue
+		}
+
+		ttl, err := store.GetExp(from)
+		if err != nil || ttl < 0 {
+			ttl = 0
+		}
+
+		if err := store.SetRawKey(QuotaKeyPrefix+scope+toHash, value, ttl); err != nil {
+			log.WithError(err).Warning("Couldn't copy the quota of the rotated key")
+		}
+	}
+}
+
+// reportRotatedKeyUsage fires EventRotatedKeyUsed when a key which has a
+// successor is used during its grace period.
+func (k *KeyExpired) reportRotatedKeyUsage(r *http.Request, session *user.SessionState) {
+	successor, ok := session.MetaData[keyRotatedToMetaKey].(string)
+	if !ok {
+		return
+	}
+
+	k.FireEvent(EventRotatedKeyUsed, EventRotatedKeyMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Attempted access from rotated key.", OriginatingRequest: EncodeRequestToEvent(r)},
+		Path:             r.URL.Path,
+		Origin:           request.RealIP(r),
+		Key:              ctxGetAuthToken(r),
+		SuccessorHash:    successor,
+		Expires:          session.Expires,
+	})
+}
@@ -0,0 +1,135 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestRotateKey(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	spec := ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})[0]
+
+	events := make(chan config.EventMessage, 10)
+	spec.EventPaths = map[apidef.TykEvent][]config.TykEventHandler{
+		EventRotatedKeyUsed: {&testEventHandler{func(em config.EventMessage) { events <- em }}},
+	}
+
+	_, key := ts.CreateSession(func(s *user.SessionState) {
+		s.QuotaMax = 5
+		s.AccessRights = map[string]user.AccessDefinition{spec.APIID: {
+			APIID: spec.APIID, Versions: []string{"v1"},
+		}}
+	})
+	authHeader := func(key string) map[string]string {
+		return map[string]string{"Authorization": key}
+	}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Headers: authHeader(key), Code: http.StatusOK},
+		{Headers: authHeader(key), Code: http.StatusOK},
+	}...)
+
+	rotate := func(key, query string, code int) apiRotateKeySuccess {
+		resp, _ := ts.Run(t, test.TestCase{
+			Method:    http.MethodPost,
+			Path:      "/tyk/keys/" + key + "/rotate" + query,
+			AdminAuth: true,
+			Code:      code,
+		})
+
+		var success apiRotateKeySuccess
+		_ = json.NewDecoder(resp.Body).Decode(&success)
+		return success
+	}
+
+	t.Run("Invalid grace period", func(t *testing.T) {
+		rotate(key, "?grace_period=-1", http.StatusBadRequest)
+	})
+
+	t.Run("Unknown key", func(t *testing.T) {
+		rotate("unknown", "", http.StatusNotFound)
+	})
+
+	success := rotate(key, "?grace_period=60", http.StatusOK)
+	newKey := success.Key
+	assert.NotEqual(t, key, newKey)
+	assert.Equal(t, "rotated", success.Action)
+	assert.InDelta(t, time.Now().Unix()+60, success.PreviousKeyExpires, 2)
+
+	t.Run("Successor keeps the remaining quota", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{
+			Headers:      authHeader(newKey),
+			Code:         http.StatusOK,
+			HeadersMatch: map[string]string{headers.XRateLimitRemaining: "2"},
+		})
+
+		session, found := ts.Gw.GlobalSessionManager.SessionDetail("default", newKey, false)
+		assert.True(t, found)
+		assert.NotContains(t, session.MetaData, keyRotatedToMetaKey)
+	})
+
+	t.Run("Rotated key is valid during the grace period", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{
+			Headers:      authHeader(key),
+			Code:         http.StatusOK,
+			HeadersMatch: map[string]string{headers.XRateLimitRemaining: "1"},
+		})
+
+		select {
+		case em := <-events:
+			meta := em.Meta.(EventRotatedKeyMeta)
+			assert.Equal(t, key, meta.Key)
+			assert.Equal(t, success.PreviousKeyExpires, meta.Expires)
+		case <-time.After(time.Second):
+			t.Error("RotatedKeyUsed event not fired")
+		}
+	})
+
+	t.Run("Keys share the quota", func(t *testing.T) {
+		_, _ = ts.Run(t, []test.TestCase{
+			{Headers: authHeader(newKey), Code: http.StatusOK, HeadersMatch: map[string]string{headers.XRateLimitRemaining: "0"}},
+			{Headers: authHeader(key), Code: http.StatusForbidden},
+			{Headers: authHeader(newKey), Code: http.StatusForbidden},
+		}...)
+		ts.Gw.GlobalSessionManager.ResetQuota(newKey, &user.SessionState{}, false)
+	})
+
+	t.Run("Rotated key can't be rotated again", func(t *testing.T) {
+		rotate(key, "", http.StatusConflict)
+	})
+
+	t.Run("Rotated key expires", func(t *testing.T) {
+		session, found := ts.Gw.GlobalSessionManager.SessionDetail("default", key, false)
+		if !assert.True(t, found) {
+			return
+		}
+		session.Expires = time.Now().Unix() - 1
+		assert.NoError(t, ts.Gw.GlobalSessionManager.UpdateSession(key, &session, 60, false))
+
+		_, _ = ts.Run(t, test.TestCase{Headers: authHeader(key), Code: http.StatusUnauthorized})
+	})
+
+	t.Run("Without grace period", func(t *testing.T) {
+		success := rotate(newKey, "?grace_period=0", http.StatusOK)
+
+		_, _ = ts.Run(t, []test.TestCase{
+			{Headers: authHeader(newKey), Code: http.StatusForbidden},
+			{Headers: authHeader(success.Key), Code: http.StatusOK},
+		}...)
+	})
+}
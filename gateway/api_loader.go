@@ -38,9 +38,9 @@ type ChainObject struct {
 
 func (gw *Gateway) prepareStorage() generalStores {
 	var gs generalStores
-	gs.redisStore = &storage.RedisCluster{KeyPrefix: "apikey-", HashKeys: gw.GetConfig().HashKeys, RedisController: gw.RedisController}
-	gs.redisOrgStore = &storage.RedisCluster{KeyPrefix: "orgkey.", RedisController: gw.RedisController}
-	gs.healthStore = &storage.RedisCluster{KeyPrefix: "apihealth.", RedisController: gw.RedisController}
+	gs.redisStore = gw.newStore(storage.StoreOptions{KeyPrefix: "apikey-", HashKeys: gw.GetConfig().HashKeys})
+	gs.redisOrgStore = gw.newStore(storage.StoreOptions{KeyPrefix: "orgkey."})
+	gs.healthStore = gw.newStore(storage.StoreOptions{KeyPrefix: "apihealth."})
 	gs.rpcAuthStore = &RPCStorageHandler{KeyPrefix: "apikey-", HashKeys: gw.GetConfig().HashKeys, Gw: gw}
 	gs.rpcOrgStore = &RPCStorageHandler{KeyPrefix: "orgkey.", Gw: gw}
 	gw.GlobalSessionManager.Init(gs.redisStore)
@@ -138,6 +138,8 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 		spec.TagHeaders = lowerCaseHeaders
 	}
 
+	gw.replaceSpecSecrets(spec, logger)
+
 	if gw.skipSpecBecauseInvalid(spec, logger) {
 		logger.Warning("Spec not valid, skipped!")
 		chainDef.Skip = true
@@ -220,6 +222,7 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 	if spec.CustomMiddlewareBundle != "" {
 		if err := gw.loadBundle(spec); err != nil {
 			logger.WithError(err).Error("Couldn't load bundle")
+			gw.apiLoadState.bundleFailed(spec.APIID, err)
 		}
 		prefix = gw.getBundleDestPath(spec)
 	}
@@ -258,6 +261,11 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 		logger.Debug("Done loading OAuth Manager")
 	}
 
+	if spec.UseOpenID && spec.OpenIDOptions.BrowserLogin.Enabled {
+		logger.Debug("Loading OpenID Connect browser login")
+		spec.OIDCLoginManager = gw.addOIDCLoginHandlers(spec, subrouter, logger)
+	}
+
 	enableVersionOverrides := false
 	for _, versionData := range spec.VersionData.Versions {
 		if versionData.OverrideTarget != "" && !spec.VersionData.NotVersioned {
@@ -292,7 +300,7 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 	}
 
 	keyPrefix := "cache-" + spec.APIID
-	cacheStore := storage.RedisCluster{KeyPrefix: keyPrefix, IsCache: true, RedisController: gw.RedisController}
+	cacheStore := gw.newStore(storage.StoreOptions{KeyPrefix: keyPrefix, IsCache: true})
 	cacheStore.Connect()
 
 	var chain http.Handler
@@ -356,6 +364,10 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 			logger.Info("Checking security policy: OpenID")
 		}
 
+		if gw.mwAppendEnabled(&authArray, &CertificateIdentityMW{BaseMiddleware: baseMid}) {
+			logger.Info("Checking security policy: Certificate identity")
+		}
+
 		coprocessAuth := mwDriver != apidef.OttoDriver && spec.EnableCoProcessAuth
 		ottoAuth := !coprocessAuth && mwDriver == apidef.OttoDriver && spec.EnableCoProcessAuth
 		gopluginAuth := !coprocessAuth && !ottoAuth && mwDriver == apidef.GoPluginDriver && spec.UseGoPluginAuth
@@ -457,7 +469,7 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 	}
 	//Do not add middlewares after cache middleware.
 	//It will not get executed
-	gw.mwAppendEnabled(&chainArray, &RedisCacheMiddleware{BaseMiddleware: baseMid, CacheStore: &cacheStore})
+	gw.mwAppendEnabled(&chainArray, &RedisCacheMiddleware{BaseMiddleware: baseMid, CacheStore: cacheStore})
 
 	chain = alice.New(chainArray...).Then(&DummyProxyHandler{SH: SuccessHandler{baseMid}, Gw: gw})
 
@@ -486,6 +498,14 @@ func (gw *Gateway) processSpec(spec *APISpec, apisByListen map[string]int,
 		chainDef.ThisHandler = chain
 	}
 
+	if gw.debugTracing != nil {
+		chainDef.ThisHandler = gw.debugTracing.handler(spec, chainDef.ThisHandler)
+	}
+
+	if gw.prometheus != nil || gw.realtimeStats != nil || gw.accessLog.enabled(spec) {
+		chainDef.ThisHandler = trackRequestStart(chainDef.ThisHandler)
+	}
+
 	logger.WithFields(logrus.Fields{
 		"prefix":      "gateway",
 		"user_ip":     "--",
@@ -660,11 +680,27 @@ func (gw *Gateway) loadHTTPService(spec *APISpec, apisByListen map[string]int, g
 		muxer.setRouter(port, spec.Protocol, router, gw.GetConfig())
 	}
 
+	if spec.router == nil {
+		gw.buildHTTPService(spec, apisByListen, gs)
+	}
+
+	// The spec router matches the same way a subrouter of router would,
+	// so it can be mounted into the routers of later reloads as is.
+	router.NewRoute().MatcherFunc(spec.router.Match)
+	return spec.handler
+}
+
+// buildHTTPService processes spec and registers its routes on a router owned
+// by the spec, which is kept for as long as the spec stays loaded.
+func (gw *Gateway) buildHTTPService(spec *APISpec, apisByListen map[string]int, gs *generalStores) {
+	gwConfig := gw.GetConfig()
 	hostname := gwConfig.HostName
 	if gwConfig.EnableCustomDomains && spec.Domain != "" {
 		hostname = spec.Domain
 	}
 
+	spec.router = mux.NewRouter()
+	router := spec.router
 	if hostname != "" {
 		mainLog.Info("API hostname set: ", hostname)
 		router = router.Host(hostname).Subrouter()
@@ -672,8 +708,9 @@ func (gw *Gateway) loadHTTPService(spec *APISpec, apisByListen map[string]int, g
 
 	subrouter := router.PathPrefix(spec.Proxy.ListenPath).Subrouter()
 	chainObj := gw.processSpec(spec, apisByListen, gs, subrouter, logrus.NewEntry(log))
+	spec.handler = chainObj.ThisHandler
 	if chainObj.Skip {
-		return chainObj.ThisHandler
+		return
 	}
 
 	if !chainObj.Open {
@@ -681,7 +718,6 @@ func (gw *Gateway) loadHTTPService(spec *APISpec, apisByListen map[string]int, g
 	}
 
 	subrouter.NewRoute().Handler(chainObj.ThisHandler)
-	return chainObj.ThisHandler
 }
 
 func (gw *Gateway) loadTCPService(spec *APISpec, gs *generalStores, muxer *proxyMux) {
@@ -786,9 +822,12 @@ func (gw *Gateway) loadGraphQLPlayground(spec *APISpec, subrouter *mux.Router) {
 	})
 }
 
-// Create the individual API (app) specs based on live configurations and assign middleware
+// Create the individual API (app) specs based on live configurations and assign middleware.
+// Loaded specs whose definition didn't change are kept instead of being built again.
 func (gw *Gateway) loadApps(specs []*APISpec) {
 	mainLog.Info("Loading API configurations.")
+	loaded := gw.loadedSpecs()
+	gw.apiLoadState.reset()
 
 	tmpSpecRegister := make(map[string]*APISpec)
 	tmpSpecHandles := new(sync.Map)
@@ -820,7 +859,25 @@ func (gw *Gateway) loadApps(specs []*APISpec) {
 
 	gs := gw.prepareStorage()
 	shouldTrace := trace.IsEnabled()
+	// kept maps the specs made for the reload to the loaded ones kept instead
+	kept := make(map[*APISpec]*APISpec)
 	for _, spec := range specs {
+		// resolved before comparing with the loaded specs, whose listen path is resolved
+		if converted, err := gw.kvStore(spec.Proxy.ListenPath); err == nil {
+			spec.Proxy.ListenPath = converted
+		}
+
+		if prev := unchangedSpec(loaded, spec, apisByListen); prev != nil {
+			if spec != prev {
+				// the spec made for the reload holds resources such as circuit breakers
+				spec.Release()
+			}
+			kept[spec] = prev
+			tmpSpecRegister[prev.APIID] = prev
+			tmpSpecHandles.Store(prev.APIID, gw.loadHTTPService(prev, apisByListen, &gs, muxer))
+			continue
+		}
+
 		func() {
 			defer func() {
 				// recover from panic if one occured. Set err to nil otherwise.
@@ -833,10 +890,6 @@ func (gw *Gateway) loadApps(specs []*APISpec) {
 				mainLog.Info("API bind on custom port:", spec.ListenPort)
 			}
 
-			if converted, err := gw.kvStore(spec.Proxy.ListenPath); err == nil {
-				spec.Proxy.ListenPath = converted
-			}
-
 			tmpSpecRegister[spec.APIID] = spec
 
 			switch spec.Protocol {
@@ -858,17 +911,28 @@ func (gw *Gateway) loadApps(specs []*APISpec) {
 	}
 
 	gw.DefaultProxyMux.swap(muxer, gw)
+	fingerprint := gw.specsFingerprint()
 
 	// Swap in the new register
 	gw.apisMu.Lock()
 
-	// release current specs resources before overwriting map
-	for _, curSpec := range gw.apisByID {
-		curSpec.Release()
+	// release resources of the current specs which haven't been kept
+	for id, curSpec := range gw.apisByID {
+		if tmpSpecRegister[id] != curSpec {
+			curSpec.Release()
+		}
 	}
 
 	gw.apisByID = tmpSpecRegister
 	gw.apisHandlesByID = tmpSpecHandles
+	gw.apisFingerprint = fingerprint
+
+	// the specs made for the reload of the kept ones are released
+	for i, spec := range gw.apiSpecs {
+		if prev, ok := kept[spec]; ok {
+			gw.apiSpecs[i] = prev
+		}
+	}
 
 	gw.apisMu.Unlock()
 
@@ -881,6 +945,8 @@ func (gw *Gateway) loadApps(specs []*APISpec) {
 
 	mainLog.Debug("Checker host Done")
 
-	mainLog.Info("Initialised API Definitions")
+	gw.apiLoadState.loaded(len(specs))
+	gw.sloTracker.retain(tmpSpecRegister)
+	mainLog.WithField("unchanged", len(kept)).Info("Initialised API Definitions")
 
 }
@@ -1,18 +1,27 @@
 package gateway
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"path"
 	_ "path"
+	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
 
 	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/user"
 
 	"github.com/TykTechnologies/tyk/test"
 	"github.com/TykTechnologies/tyk/trace"
+	"github.com/TykTechnologies/tyk/trace/opentelemetry"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,6 +61,76 @@ func TestOpenTracing(t *testing.T) {
 	})
 }
 
+func TestOpenTelemetryTracing(t *testing.T) {
+	var mu sync.Mutex
+	var exported []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		exported = append(exported, body...)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	trace.SetInit(trace.Init)
+	trace.SetupTracing(opentelemetry.Name, map[string]interface{}{
+		"exporter":       opentelemetry.ExporterHTTP,
+		"endpoint":       collector.URL,
+		"flush_interval": 10,
+	})
+	defer trace.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Name = "otel"
+		spec.APIID = "otel"
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/otel/"
+	})
+
+	_, key := ts.CreateSession(func(s *user.SessionState) {
+		s.Rate = 100
+		s.Per = 60
+		s.QuotaMax = 100
+		s.QuotaRenewalRate = 3600
+		s.AccessRights = map[string]user.AccessDefinition{"otel": {APIID: "otel"}}
+	})
+
+	_, _ = ts.Run(t, test.TestCase{
+		Path: "/otel/",
+		Headers: map[string]string{
+			"Authorization": key,
+			"traceparent":   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		Code: http.StatusOK,
+		// The upstream receives the trace, with a new parent span
+		BodyMatch:    `"Traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-01"`,
+		BodyNotMatch: `00f067aa0ba902b7`,
+	})
+
+	spans := []string{"otel", "AuthKey", "RateLimitAndQuotaCheck", "upstream GET"}
+	if ts.Gw.RedisController.Embedded() == nil {
+		spans = append(spans, "redis ")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, name := range spans {
+		for {
+			mu.Lock()
+			found := bytes.Contains(exported, []byte(name))
+			mu.Unlock()
+			if found {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("span %q wasn't exported", name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
 func TestInternalAPIUsage(t *testing.T) {
 	g := StartTest(nil)
 	defer g.Close()
@@ -88,6 +167,87 @@ func TestInternalAPIUsage(t *testing.T) {
 	})
 }
 
+func TestLoadAppsKeepsUnchangedSpecs(t *testing.T) {
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.Secrets = map[string]string{"listen_path": "/kv/"}
+	})
+	defer ts.Close()
+
+	build := func(target string) []*APISpec {
+		return BuildAPI(
+			func(spec *APISpec) {
+				spec.APIID = "unchanged"
+				spec.Proxy.ListenPath = "/unchanged/"
+			},
+			func(spec *APISpec) {
+				spec.APIID = "changed"
+				spec.Proxy.ListenPath = "/changed/"
+				spec.Proxy.TargetURL = target
+			},
+			func(spec *APISpec) {
+				spec.APIID = "kv"
+				spec.Proxy.ListenPath = "secrets://listen_path"
+			},
+		)
+	}
+
+	loaded := ts.Gw.LoadAPI(build(TestHttpAny)...)
+	reloaded := ts.Gw.LoadAPI(build(TestHttpAny + "/v2")...)
+
+	assert.Same(t, loaded[0], reloaded[0])
+	assert.NotSame(t, loaded[1], reloaded[1])
+	assert.Same(t, loaded[2], reloaded[2], "the listen paths are compared once resolved")
+
+	ts.Gw.apisMu.RLock()
+	for _, spec := range ts.Gw.apiSpecs {
+		assert.Same(t, ts.Gw.apisByID[spec.APIID], spec, "the specs list holds the kept specs")
+	}
+	ts.Gw.apisMu.RUnlock()
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/unchanged/", Code: http.StatusOK},
+		{Path: "/changed/", Code: http.StatusOK, BodyMatch: `"Url":"/v2/changed/"`},
+		{Path: "/kv/", Code: http.StatusOK},
+	}...)
+
+	t.Run("config change", func(t *testing.T) {
+		conf := ts.Gw.GetConfig()
+		conf.HostName = "localhost"
+		ts.Gw.SetConfig(conf)
+
+		rebuilt := ts.Gw.LoadAPI(build(TestHttpAny + "/v2")...)
+		assert.NotSame(t, reloaded[0], rebuilt[0])
+		assert.NotSame(t, reloaded[1], rebuilt[1])
+		assert.NotSame(t, reloaded[2], rebuilt[2])
+	})
+}
+
+func TestUnchangedSpec(t *testing.T) {
+	newSpec := func(checksum, listenPath string) *APISpec {
+		return &APISpec{
+			APIDefinition: &apidef.APIDefinition{APIID: "api", Proxy: apidef.ProxyConfig{ListenPath: listenPath}},
+			checksum:      checksum,
+		}
+	}
+
+	prev := newSpec("a", "/api/")
+	prev.router = mux.NewRouter()
+	loaded := map[string]*APISpec{"api": prev}
+	apisByListen := map[string]int{"/api/": 1}
+
+	assert.Same(t, prev, unchangedSpec(loaded, newSpec("a", "/api/"), apisByListen))
+	assert.Nil(t, unchangedSpec(loaded, newSpec("b", "/api/"), apisByListen), "changed definition")
+	assert.Nil(t, unchangedSpec(nil, newSpec("a", "/api/"), apisByListen), "nothing loaded")
+	assert.Nil(t, unchangedSpec(loaded, newSpec("a", "/api/"), map[string]int{"/api/": 2}), "listen path collision")
+
+	prev.checksum = ""
+	assert.Nil(t, unchangedSpec(loaded, newSpec("", "/api/"), apisByListen), "unknown checksum")
+
+	prev.checksum = "a"
+	prev.Proxy.ListenPath = "/api/-api"
+	assert.Nil(t, unchangedSpec(loaded, newSpec("a", "/api/"), apisByListen), "renamed listen path")
+}
+
 func TestFuzzyFindAPI(t *testing.T) {
 	ts := StartTest(nil)
 	defer ts.Close()
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// definitionChecksum returns the checksum of an API definition as it was
+// received by the loader, before any processing of the spec.
+func definitionChecksum(def *apidef.APIDefinition) string {
+	data, err := json.Marshal(def)
+	if err != nil {
+		// an empty checksum is never reused
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// specsFingerprint identifies everything outside of the API definitions
+// that the loaded specs were built from: the gateway configuration and the
+// resolved KV references. When it changes, every spec has to be rebuilt.
+func (gw *Gateway) specsFingerprint() string {
+	conf := gw.GetConfig()
+	// the app path only tells where definitions are read from
+	conf.AppPath = ""
+
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return ""
+	}
+
+	h := sha256.New()
+	h.Write(data)
+
+	refs := gw.kvRefs.snapshot()
+	names := make([]string, 0, len(refs))
+	for ref := range refs {
+		names = append(names, ref)
+	}
+	sort.Strings(names)
+	for _, ref := range names {
+		h.Write([]byte(ref))
+		h.Write([]byte{0})
+		h.Write([]byte(refs[ref]))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadedSpecs returns the currently loaded specs which may be kept by the
+// next reload, keyed by API ID. It is empty when the specs were built with
+// a different configuration than the current one. Specs whose bundle failed
+// to load are left out, so that loading the bundle is retried.
+func (gw *Gateway) loadedSpecs() map[string]*APISpec {
+	fingerprint := gw.specsFingerprint()
+
+	gw.apisMu.RLock()
+	defer gw.apisMu.RUnlock()
+
+	if fingerprint == "" || fingerprint != gw.apisFingerprint {
+		return nil
+	}
+
+	loaded := make(map[string]*APISpec, len(gw.apisByID))
+	for id, spec := range gw.apisByID {
+		if gw.apiLoadState.hasBundleFailure(id) {
+			continue
+		}
+		loaded[id] = spec
+	}
+	return loaded
+}
+
+// unchangedSpec returns the loaded spec which spec can be replaced with, or
+// nil if spec has to be built. A loaded spec is kept, together with its
+// middleware chain, routes and in-memory state, when its definition has the
+// same checksum and it doesn't share its listen path with another API.
+func unchangedSpec(loaded map[string]*APISpec, spec *APISpec, apisByListen map[string]int) *APISpec {
+	prev := loaded[spec.APIID]
+	if prev == nil || prev.router == nil || prev.checksum == "" {
+		return nil
+	}
+
+	if prev.checksum != spec.checksum {
+		return nil
+	}
+
+	// the listen path of the loaded spec may have been changed because of a
+	// collision with an API which is gone now
+	if prev.Proxy.ListenPath != spec.Proxy.ListenPath {
+		return nil
+	}
+
+	// listen path collisions are resolved against all the loaded APIs
+	if apisByListen[generateDomainPath(spec.Domain, spec.Proxy.ListenPath)] > 1 {
+		return nil
+	}
+
+	return prev
+}
@@ -79,8 +79,11 @@ const defaultTestPol = `{
 
 func TestPolicyAPI(t *testing.T) {
 	ts := StartTest(nil)
+	// policy changes are kept with their history next to the policy files
+	policyPath, _ := ioutil.TempDir("", "policies")
+	defer os.RemoveAll(policyPath)
 	globalConf := ts.Gw.GetConfig()
-	globalConf.Policies.PolicyPath = "."
+	globalConf.Policies.PolicyPath = policyPath
 	globalConf.Policies.PolicySource = "file"
 	ts.Gw.SetConfig(globalConf)
 
@@ -1473,7 +1476,7 @@ func TestGroupResetHandler(t *testing.T) {
 
 	didSubscribe := make(chan bool)
 	didReload := make(chan bool)
-	cacheStore := storage.RedisCluster{RedisController: ts.Gw.RedisController}
+	cacheStore := ts.Gw.newStore(storage.StoreOptions{})
 	cacheStore.Connect()
 
 	go func() {
@@ -0,0 +1,794 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+	"github.com/spf13/afero"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// Audit log sink types
+const (
+	auditSinkFile    = "file"
+	auditSinkRedis   = "redis"
+	auditSinkWebhook = "webhook"
+)
+
+// Audited resources
+const (
+	auditResourceKey         = "key"
+	auditResourceAPI         = "api"
+	auditResourcePolicy      = "policy"
+	auditResourceCertificate = "certificate"
+	auditResourceOAuthClient = "oauth_client"
+	auditResourceOAuthToken  = "oauth_token"
+	auditResourceOrgKey      = "org_key"
+	auditResourceCache       = "cache"
+	auditResourceDebug       = "debug"
+)
+
+const (
+	defaultAuditStream         = "tyk-audit-log"
+	defaultAuditStreamMaxLen   = 10000
+	defaultAuditRecentEntries  = 1000
+	defaultAuditWebhookTimeout = 10 * time.Second
+	defaultAuditQueryLimit     = 100
+	auditQueueSize             = 1000
+
+	auditRedacted = "<redacted>"
+)
+
+var auditLogger = log.WithField("prefix", "audit")
+
+// auditSensitiveFields are parts of field names whose values are never
+// written to the audit log.
+var auditSensitiveFields = []string{"secret", "password", "private_key", "hmac_string"}
+
+// auditEntry records a change made through the Gateway API.
+type auditEntry struct {
+	ID         string        `json:"id"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Actor      auditActor    `json:"actor"`
+	Action     string        `json:"action"`
+	Resource   string        `json:"resource"`
+	ResourceID string        `json:"resource_id,omitempty"`
+	Method     string        `json:"method"`
+	Path       string        `json:"path"`
+	Status     int           `json:"status"`
+	Outcome    string        `json:"outcome"`
+	Changes    []auditChange `json:"changes,omitempty"`
+}
+
+// auditActor identifies who made a change: the named credential used, if any,
+// and the secret and client certificate. Secrets are only recorded as a
+// fingerprint, so that changes made with the same secret can be told apart
+// from others without revealing it.
+type auditActor struct {
+	Credential  string `json:"credential,omitempty"`
+	Secret      string `json:"secret,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+	CommonName  string `json:"common_name,omitempty"`
+	User        string `json:"user,omitempty"`
+	IP          string `json:"ip"`
+}
+
+// auditChange is a field of a resource changed by a request, sensitive
+// values being redacted.
+type auditChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// auditTarget is the resource changed by a request.
+type auditTarget struct {
+	resource string
+	action   string
+	// id is the ID the resource is looked up with, display the ID recorded
+	// in the entry, which differs for keys and tokens.
+	id      string
+	display string
+	apiID   string
+	hashed  bool
+	// bulk is set for the requests changing many resources, whose changes
+	// are reported by their responses rather than recorded.
+	bulk bool
+}
+
+// auditSink writes audit entries to a destination.
+type auditSink interface {
+	write(entry *auditEntry) error
+	close() error
+}
+
+// auditLog records the changes made through the Gateway API, keeping the
+// recent entries in memory and writing them to a sink from its own goroutine.
+type auditLog struct {
+	gw   *Gateway
+	sink auditSink
+
+	queue chan *auditEntry
+	done  chan struct{}
+	// dropped counts the entries dropped since the last report
+	dropped uint64
+
+	mu     sync.RWMutex
+	recent []*auditEntry
+	next   int
+	full   bool
+	closed bool
+}
+
+// setupAuditLog creates the audit log when it is enabled.
+func (gw *Gateway) setupAuditLog() {
+	gw.auditLog.close()
+	gw.auditLog = nil
+
+	conf := gw.GetConfig().AuditLog
+	if !conf.Enabled {
+		return
+	}
+
+	size := conf.RecentEntries
+	if size <= 0 {
+		size = defaultAuditRecentEntries
+	}
+	a := &auditLog{gw: gw, recent: make([]*auditEntry, size)}
+
+	if conf.Sink != "" {
+		sink, err := gw.newAuditSink(conf)
+		if err != nil {
+			auditLogger.WithError(err).Error("Couldn't create audit log sink, entries are only kept in memory")
+		} else {
+			a.sink = sink
+			a.queue = make(chan *auditEntry, auditQueueSize)
+			a.done = make(chan struct{})
+			go a.run()
+		}
+	}
+
+	gw.auditLog = a
+}
+
+func (gw *Gateway) newAuditSink(conf config.AuditLogConfig) (auditSink, error) {
+	switch conf.Sink {
+	case auditSinkFile:
+		return newFileAuditSink(conf.Path)
+	case auditSinkRedis:
+		s := &redisAuditSink{
+			store:  gw.newStore(storage.StoreOptions{}),
+			stream: conf.Stream,
+			maxLen: conf.StreamMaxLen,
+		}
+		if s.stream == "" {
+			s.stream = defaultAuditStream
+		}
+		if s.maxLen <= 0 {
+			s.maxLen = defaultAuditStreamMaxLen
+		}
+		return s, nil
+	case auditSinkWebhook:
+		return newWebhookAuditSink(conf)
+	}
+	return nil, fmt.Errorf("unknown audit log sink %q", conf.Sink)
+}
+
+// run writes the queued entries to the sink until the log is closed.
+func (a *auditLog) run() {
+	defer close(a.done)
+
+	for entry := range a.queue {
+		if err := a.sink.write(entry); err != nil {
+			auditLogger.WithError(err).WithField("id", entry.ID).Error("Couldn't write audit entry")
+		}
+		if dropped := atomic.SwapUint64(&a.dropped, 0); dropped > 0 {
+			auditLogger.Warningf("Dropped %d audit entries, the sink doesn't keep up", dropped)
+		}
+	}
+}
+
+// close flushes the queued entries and closes the sink.
+func (a *auditLog) close() {
+	if a == nil || a.queue == nil {
+		return
+	}
+
+	a.mu.Lock()
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+	if err := a.sink.close(); err != nil {
+		auditLogger.WithError(err).Warning("Couldn't close audit log sink")
+	}
+}
+
+// add records an entry and queues it for the sink. Entries which don't fit
+// in the queue are dropped from the sink, but are still kept in memory.
+func (a *auditLog) add(entry *auditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.recent[a.next] = entry
+	a.next = (a.next + 1) % len(a.recent)
+	if a.next == 0 {
+		a.full = true
+	}
+
+	if a.queue == nil || a.closed {
+		return
+	}
+	select {
+	case a.queue <- entry:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+}
+
+// entries returns the recent entries matching filter, latest first.
+func (a *auditLog) entries(filter func(*auditEntry) bool, limit int) []*auditEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	count := a.next
+	if a.full {
+		count = len(a.recent)
+	}
+
+	entries := []*auditEntry{}
+	for i := 1; i <= count && len(entries) < limit; i++ {
+		entry := a.recent[(a.next-i+len(a.recent))%len(a.recent)]
+		if filter(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// middleware records the changes made by the requests to the control API.
+func (a *auditLog) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, ok := a.gw.auditTarget(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		before := a.gw.auditSnapshot(target)
+
+		rw := &customResponseWriter{ResponseWriter: w, copyData: target.id == "" && !target.bulk}
+		next.ServeHTTP(rw, r)
+		if rw.statusCodeSent == 0 {
+			rw.statusCodeSent = http.StatusOK
+		}
+
+		if target.id == "" && !target.bulk && rw.statusCodeSent < http.StatusBadRequest {
+			a.gw.auditCreatedID(target, rw.data)
+		}
+		after := a.gw.auditSnapshot(target)
+
+		path := r.URL.Path
+		if target.display != target.id {
+			path = strings.Replace(path, target.id, target.display, -1)
+		}
+
+		outcome := "success"
+		if rw.statusCodeSent >= http.StatusBadRequest {
+			outcome = "failure"
+		}
+
+		a.add(&auditEntry{
+			ID:         uuid.NewV4().String(),
+			Timestamp:  time.Now(),
+			Actor:      auditActorOf(r),
+			Action:     target.action,
+			Resource:   target.resource,
+			ResourceID: target.display,
+			Method:     r.Method,
+			Path:       path,
+			Status:     rw.statusCodeSent,
+			Outcome:    outcome,
+			Changes:    auditDiff(before, after),
+		})
+	})
+}
+
+// auditTarget returns the resource changed by a request to the control API,
+// or false when the request doesn't change anything.
+func (gw *Gateway) auditTarget(r *http.Request) (*auditTarget, bool) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil, false
+	}
+
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil, false
+	}
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return nil, false
+	}
+
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	t := &auditTarget{apiID: query.Get("api_id")}
+
+	switch r.Method {
+	case http.MethodPost:
+		t.action = "create"
+	case http.MethodPut:
+		t.action = "update"
+	case http.MethodDelete:
+		t.action = "delete"
+	}
+
+	segments := strings.Split(strings.Trim(tmpl, "/"), "/")
+	switch last := segments[len(segments)-1]; last {
+	case "rotate", "rollback":
+		t.action = last
+	case "revoke", "revoke_all":
+		t.action = "revoke"
+	}
+
+	switch segments[0] {
+	case "keys":
+		if tmpl == "/keys/preview" {
+			return nil, false
+		}
+		if tmpl == "/keys/bulk" {
+			action := query.Get("action")
+			if action == "" {
+				action = bulkKeyCreate
+			}
+			t.action = "bulk " + action
+			t.bulk = true
+		}
+		t.resource = auditResourceKey
+		t.id = vars["keyName"]
+		t.hashed = query.Get("hashed") != ""
+		if len(segments) > 1 && segments[1] == "policy" {
+			t.action = "update"
+			t.hashed = gw.GetConfig().HashKeys
+		}
+	case "apis":
+		t.resource = auditResourceAPI
+		t.id = vars["apiID"]
+	case "policies":
+		t.resource = auditResourcePolicy
+		t.id = vars["polID"]
+	case "certs":
+		t.resource = auditResourceCertificate
+		t.id = vars["certID"]
+	case "oauth":
+		if len(segments) > 1 && segments[1] == "clients" {
+			t.resource = auditResourceOAuthClient
+			t.id = vars["keyName"]
+			if apiID := vars["apiID"]; apiID != "" {
+				t.apiID = apiID
+			}
+		} else {
+			t.resource = auditResourceOAuthToken
+			t.id = vars["keyName"]
+			t.display = gw.obfuscateKey(t.id)
+		}
+	case "org":
+		t.resource = auditResourceOrgKey
+		t.id = vars["keyName"]
+	case "cache":
+		t.resource = auditResourceCache
+		t.id = vars["apiID"]
+	case "debug":
+		if tmpl == "/debug" {
+			// traces a request without changing anything
+			return nil, false
+		}
+		t.resource = auditResourceDebug
+		t.id = vars["ruleID"]
+	default:
+		t.resource = segments[0]
+	}
+
+	if t.resource == auditResourceKey {
+		t.display = gw.auditKeyID(t.id, t.hashed)
+	} else if t.display == "" {
+		t.display = t.id
+	}
+
+	return t, true
+}
+
+// auditKeyID returns the ID of a key as recorded in the audit log: its hash,
+// or the obfuscated key when key hashing is disabled.
+func (gw *Gateway) auditKeyID(key string, hashed bool) string {
+	if key == "" || hashed {
+		return key
+	}
+	if gw.GetConfig().HashKeys {
+		return storage.HashKey(key, true)
+	}
+	return gw.obfuscateKey(key)
+}
+
+// auditCreatedID sets the ID of a resource created by a request from the
+// response, when it wasn't known from the path.
+func (gw *Gateway) auditCreatedID(t *auditTarget, body []byte) {
+	var created struct {
+		Key      string `json:"key"`
+		KeyHash  string `json:"key_hash"`
+		ID       string `json:"id"`
+		ClientID string `json:"client_id"`
+		APIID    string `json:"api_id"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		return
+	}
+
+	switch t.resource {
+	case auditResourceKey:
+		t.id = created.Key
+		t.display = created.KeyHash
+		if t.display == "" {
+			t.display = gw.auditKeyID(created.Key, false)
+		}
+		return
+	case auditResourceAPI, auditResourcePolicy:
+		t.id = created.Key
+	case auditResourceOAuthClient:
+		t.id = created.ClientID
+		t.apiID = created.APIID
+	default:
+		t.id = created.ID
+	}
+	t.display = t.id
+}
+
+// auditSnapshot returns the current state of the resource changed by a
+// request, or nil when it doesn't exist or can't be compared.
+func (gw *Gateway) auditSnapshot(t *auditTarget) interface{} {
+	if t.id == "" {
+		return nil
+	}
+
+	switch t.resource {
+	case auditResourceKey:
+		orgID := ""
+		if spec := gw.getApiSpec(t.apiID); spec != nil {
+			orgID = spec.OrgID
+		}
+		if session, ok := gw.GlobalSessionManager.SessionDetail(orgID, t.id, t.hashed); ok {
+			return session
+		}
+	case auditResourceAPI:
+		if data, ok := gw.apiFileStore(afero.NewOsFs()).read(t.id); ok {
+			return json.RawMessage(data)
+		}
+	case auditResourcePolicy:
+		if data, ok := gw.policyFileStore(afero.NewOsFs()).read(t.id); ok {
+			return json.RawMessage(data)
+		}
+	case auditResourceCertificate:
+		if gw.CertificateManager == nil {
+			return nil
+		}
+		if found := gw.CertificateManager.List([]string{t.id}, certs.CertificateAny); len(found) == 1 && found[0] != nil {
+			return certs.ExtractCertificateMeta(found[0], t.id)
+		}
+	case auditResourceOAuthClient:
+		spec := gw.getApiSpec(t.apiID)
+		if spec == nil || spec.OAuthManager == nil {
+			return nil
+		}
+		client, err := spec.OAuthManager.OsinServer.Storage.GetExtendedClientNoPrefix(oauthClientStorageID(t.id))
+		if err != nil {
+			return nil
+		}
+		return NewClientRequest{
+			ClientID:          client.GetId(),
+			ClientSecret:      client.GetSecret(),
+			ClientRedirectURI: client.GetRedirectUri(),
+			PolicyID:          client.GetPolicyID(),
+			MetaData:          client.GetUserData(),
+			Description:       client.GetDescription(),
+		}
+	case auditResourceOrgKey:
+		spec := gw.getSpecForOrg(t.id)
+		if spec == nil || spec.OrgSessionManager == nil {
+			return nil
+		}
+		if session, ok := spec.OrgSessionManager.SessionDetail(t.id, t.id, false); ok {
+			return session
+		}
+	}
+
+	return nil
+}
+
+func auditActorOf(r *http.Request) auditActor {
+	actor := auditActor{
+		User: r.Header.Get(headers.XTykActor),
+		IP:   request.RealIP(r),
+	}
+
+	if cred := ctxGetControlAPICredential(r); cred != nil {
+		actor.Credential = cred.name
+	}
+
+	if secret := r.Header.Get(headers.XTykAuthorization); secret != "" {
+		sum := sha256.Sum256([]byte(secret))
+		actor.Secret = hex.EncodeToString(sum[:8])
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert := r.TLS.PeerCertificates[0]
+		actor.Certificate = certs.HexSHA256(cert.Raw)
+		actor.CommonName = cert.Subject.CommonName
+	}
+
+	return actor
+}
+
+// auditDiff returns the fields which differ between two states of a
+// resource. Nested objects are compared field by field, other values as a
+// whole.
+func auditDiff(before, after interface{}) []auditChange {
+	b, a := flattenAuditValue(before), flattenAuditValue(after)
+
+	fields := make([]string, 0, len(b)+len(a))
+	for field := range b {
+		fields = append(fields, field)
+	}
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var changes []auditChange
+	for _, field := range fields {
+		if reflect.DeepEqual(b[field], a[field]) {
+			continue
+		}
+
+		change := auditChange{Field: field, Before: redactAuditValue(b[field]), After: redactAuditValue(a[field])}
+		if auditSensitive(field) {
+			if change.Before != nil {
+				change.Before = auditRedacted
+			}
+			if change.After != nil {
+				change.After = auditRedacted
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// flattenAuditValue returns the leaf values of a resource by dotted field name.
+func flattenAuditValue(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil
+	}
+
+	flat := make(map[string]interface{})
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+			for k, child := range m {
+				if prefix != "" {
+					k = prefix + "." + k
+				}
+				walk(k, child)
+			}
+			return
+		}
+		flat[prefix] = v
+	}
+	walk("", generic)
+
+	return flat
+}
+
+// redactAuditValue replaces the sensitive fields of the objects in v.
+func redactAuditValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			if auditSensitive(k) {
+				redacted[k] = auditRedacted
+				continue
+			}
+			redacted[k] = redactAuditValue(child)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, child := range v {
+			redacted[i] = redactAuditValue(child)
+		}
+		return redacted
+	}
+	return v
+}
+
+// auditSensitive reports whether the values of a field are secret.
+func auditSensitive(field string) bool {
+	if i := strings.LastIndexByte(field, '.'); i >= 0 {
+		field = field[i+1:]
+	}
+	field = strings.ToLower(field)
+
+	for _, sensitive := range auditSensitiveFields {
+		if strings.Contains(field, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditLogHandler serves the recent audit entries, latest first. They can be
+// filtered by resource, resource_id, action and outcome.
+func (gw *Gateway) auditLogHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultAuditQueryLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			doJSONWrite(w, http.StatusBadRequest, apiError("limit should be a positive integer"))
+			return
+		}
+		limit = n
+	}
+
+	matches := func(value, want string) bool {
+		return want == "" || value == want
+	}
+	resource, resourceID, action, outcome := query.Get("resource"), query.Get("resource_id"), query.Get("action"), query.Get("outcome")
+
+	doJSONWrite(w, http.StatusOK, gw.auditLog.entries(func(entry *auditEntry) bool {
+		return matches(entry.Resource, resource) && matches(entry.ResourceID, resourceID) &&
+			matches(entry.Action, action) && matches(entry.Outcome, outcome)
+	}, limit))
+}
+
+// fileAuditSink appends entries as JSON lines to a file.
+type fileAuditSink struct {
+	f *os.File
+}
+
+func newFileAuditSink(path string) (*fileAuditSink, error) {
+	if path == "" {
+		return nil, errors.New("file audit log sink requires a path")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditSink{f: f}, nil
+}
+
+func (s *fileAuditSink) write(entry *auditEntry) error {
+	return json.NewEncoder(s.f).Encode(entry)
+}
+
+func (s *fileAuditSink) close() error {
+	return s.f.Close()
+}
+
+// redisAuditSink adds entries to a Redis stream, as JSON in the entry field.
+type redisAuditSink struct {
+	store  storage.Store
+	stream string
+	maxLen int64
+}
+
+func (s *redisAuditSink) write(entry *auditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.store.AddToStream(s.stream, map[string]interface{}{"entry": string(data)}, s.maxLen)
+}
+
+func (s *redisAuditSink) close() error {
+	return nil
+}
+
+// webhookAuditSink posts each entry as JSON to a URL.
+type webhookAuditSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhookAuditSink(conf config.AuditLogConfig) (*webhookAuditSink, error) {
+	if conf.WebhookURL == "" {
+		return nil, errors.New("webhook audit log sink requires a url")
+	}
+
+	timeout := time.Duration(conf.WebhookTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultAuditWebhookTimeout
+	}
+
+	return &webhookAuditSink{
+		url:     conf.WebhookURL,
+		headers: conf.WebhookHeaders,
+		client:  &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (s *webhookAuditSink) write(entry *auditEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookAuditSink) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
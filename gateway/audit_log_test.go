@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := map[string]interface{}{
+		"rate":            10,
+		"tags":            []string{"a"},
+		"basic_auth_data": map[string]interface{}{"user": "bob", "password": "old"},
+		"oidc":            []interface{}{map[string]interface{}{"client_id": "1", "client_secret": "s"}},
+	}
+	after := map[string]interface{}{
+		"rate":            20,
+		"tags":            []string{"a"},
+		"basic_auth_data": map[string]interface{}{"user": "bob", "password": "new"},
+		"oidc":            []interface{}{map[string]interface{}{"client_id": "2", "client_secret": "s"}},
+		"alias":           "new",
+	}
+
+	redactedOIDC := func(id string) interface{} {
+		return []interface{}{map[string]interface{}{"client_id": id, "client_secret": auditRedacted}}
+	}
+	assert.Equal(t, []auditChange{
+		{Field: "alias", After: "new"},
+		{Field: "basic_auth_data.password", Before: auditRedacted, After: auditRedacted},
+		{Field: "oidc", Before: redactedOIDC("1"), After: redactedOIDC("2")},
+		{Field: "rate", Before: float64(10), After: float64(20)},
+	}, auditDiff(before, after))
+
+	assert.Len(t, auditDiff(nil, after), 6, "created")
+	assert.Empty(t, auditDiff(before, before))
+}
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gw := &Gateway{}
+	gw.SetConfig(config.Config{
+		Policies: config.PoliciesConfig{PolicyPath: dir},
+		AuditLog: config.AuditLogConfig{
+			Enabled:       true,
+			Sink:          auditSinkFile,
+			Path:          filepath.Join(dir, "audit", "audit.log"),
+			RecentEntries: 2,
+		},
+	})
+	gw.setupAuditLog()
+
+	r := mux.NewRouter()
+	r.Use(gw.auditLog.middleware)
+	r.HandleFunc("/policies", func(w http.ResponseWriter, r *http.Request) {
+		ioutil.WriteFile(filepath.Join(dir, "p1.json"), []byte(`{"rate": 10, "hmac_secret": "s"}`), 0644)
+		doJSONWrite(w, http.StatusOK, apiModifyKeySuccess{Key: "p1", Status: "ok", Action: "added"})
+	}).Methods(http.MethodPost)
+	r.HandleFunc("/policies/{polID}", func(w http.ResponseWriter, r *http.Request) {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+	}).Methods(http.MethodPut)
+	r.HandleFunc("/keys/preview", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodPost)
+	r.HandleFunc("/keys/{keyName}", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet)
+
+	do := func(method, path string) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(headers.XTykAuthorization, "secret")
+		req.Header.Set(headers.XTykActor, "ci")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	do(http.MethodPost, "/policies")
+	do(http.MethodPut, "/policies/p1")
+	do(http.MethodPost, "/keys/preview")
+	do(http.MethodGet, "/keys/abc")
+
+	entries := gw.auditLog.entries(func(*auditEntry) bool { return true }, 10)
+	require.Len(t, entries, 2, "only changes are recorded")
+
+	updated, created := entries[0], entries[1]
+	assert.Equal(t, "update", updated.Action)
+	assert.Equal(t, "failure", updated.Outcome)
+	assert.Equal(t, http.StatusBadRequest, updated.Status)
+	assert.Empty(t, updated.Changes)
+
+	assert.Equal(t, auditResourcePolicy, created.Resource)
+	assert.Equal(t, "create", created.Action)
+	assert.Equal(t, "p1", created.ResourceID, "ID of a created resource is taken from the response")
+	assert.Equal(t, "success", created.Outcome)
+	assert.Equal(t, "ci", created.Actor.User)
+	assert.NotEmpty(t, created.Actor.Secret)
+	assert.NotContains(t, created.Actor.Secret, "secret")
+	assert.Equal(t, []auditChange{
+		{Field: "hmac_secret", After: auditRedacted},
+		{Field: "rate", After: float64(10)},
+	}, created.Changes)
+
+	do(http.MethodPut, "/policies/p2")
+	entries = gw.auditLog.entries(func(entry *auditEntry) bool { return entry.Resource == auditResourcePolicy }, 10)
+	require.Len(t, entries, 2, "recent entries are limited")
+	assert.Equal(t, "p2", entries[0].ResourceID)
+
+	gw.setupAuditLog()
+	f, err := os.Open(filepath.Join(dir, "audit", "audit.log"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	var written []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		written = append(written, entry)
+	}
+	assert.Len(t, written, 3, "all entries are written to the sink")
+}
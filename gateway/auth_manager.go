@@ -30,6 +30,8 @@ type DefaultSessionManager struct {
 	store storage.Handler
 	orgID string
 	Gw    *Gateway `json:"-"`
+	// indexKeys keeps the key index up to date with the sessions it updates and removes
+	indexKeys bool
 }
 
 func (b *DefaultSessionManager) Init(store storage.Handler) {
@@ -106,12 +108,15 @@ func (b *DefaultSessionManager) UpdateSession(keyName string, session *user.Sess
 
 	// sync update
 	if hashed {
-		keyName = b.store.GetKeyPrefix() + keyName
-		err = b.store.SetRawKey(keyName, string(v), resetTTLTo)
+		err = b.store.SetRawKey(b.store.GetKeyPrefix()+keyName, string(v), resetTTLTo)
 	} else {
 		err = b.store.SetKey(keyName, string(v), resetTTLTo)
 	}
 
+	if err == nil && b.indexKeys {
+		b.Gw.indexKey(keyName, hashed, session)
+	}
+
 	return err
 }
 
@@ -120,11 +125,20 @@ func (b *DefaultSessionManager) RemoveSession(orgID string, keyName string, hash
 	defer b.clearCacheForKey(keyName, hashed)
 
 	if hashed {
-		return b.store.DeleteRawKey(b.store.GetKeyPrefix() + keyName)
+		removed := b.store.DeleteRawKey(b.store.GetKeyPrefix() + keyName)
+		if removed && b.indexKeys {
+			b.Gw.unindexKey(keyName, true)
+		}
+		return removed
 	} else {
 		// support both old and new key hashing
+		token := b.Gw.generateToken(orgID, keyName)
 		res1 := b.store.DeleteKey(keyName)
-		res2 := b.store.DeleteKey(b.Gw.generateToken(orgID, keyName))
+		res2 := b.store.DeleteKey(token)
+		if b.indexKeys {
+			b.Gw.unindexKey(keyName, false)
+			b.Gw.unindexKey(token, false)
+		}
 		return res1 || res2
 	}
 }
@@ -0,0 +1,344 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// Gateway API resources, as named in the roles
+const (
+	controlAPIKeys     = "keys"
+	controlAPIAPIs     = "apis"
+	controlAPIPolicies = "policies"
+	controlAPIOAuth    = "oauth"
+	controlAPIReload   = "reload"
+	controlAPIOrgs     = "orgs"
+	controlAPIAll      = "*"
+)
+
+// Gateway API actions
+const (
+	controlAPIRead  = "read"
+	controlAPIWrite = "write"
+)
+
+// maxControlAPIBodyPeek is the size up to which request bodies are read to
+// find the organisation of a request, larger bodies having no organisation.
+const maxControlAPIBodyPeek = 1 << 20
+
+// controlAPICredential is a named credential of the Gateway API, with the
+// roles granted to it.
+type controlAPICredential struct {
+	name        string
+	secret      string
+	certificate string
+	roles       []config.ControlAPIRole
+}
+
+// controlAPIAccess holds the named credentials of the Gateway API.
+type controlAPIAccess struct {
+	credentials []*controlAPICredential
+	mutualTLS   bool
+}
+
+func (gw *Gateway) newControlAPIAccess() *controlAPIAccess {
+	conf := gw.GetConfig()
+	a := &controlAPIAccess{mutualTLS: conf.Security.ControlAPIUseMutualTLS}
+
+	for _, c := range conf.ControlAPIAccess.Credentials {
+		if c.Secret == "" && c.Certificate == "" {
+			mainLog.Warningf("Gateway API credential %q has neither a secret nor a certificate, ignoring it", c.Name)
+			continue
+		}
+
+		cred := &controlAPICredential{
+			name:        c.Name,
+			secret:      c.Secret,
+			certificate: strings.ToLower(c.Certificate),
+		}
+		for _, name := range c.Roles {
+			role, ok := conf.ControlAPIAccess.Roles[name]
+			if !ok {
+				mainLog.Warningf("Gateway API credential %q has unknown role %q", c.Name, name)
+				continue
+			}
+			cred.roles = append(cred.roles, role)
+		}
+		a.credentials = append(a.credentials, cred)
+	}
+
+	return a
+}
+
+func (a *controlAPIAccess) empty() bool {
+	return len(a.credentials) == 0
+}
+
+// authenticate returns the credential of a request, identified by its secret
+// or its client certificate, or nil if it has none.
+func (a *controlAPIAccess) authenticate(r *http.Request, secret string) *controlAPICredential {
+	var fingerprint string
+	if a.mutualTLS && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		fingerprint = certs.HexSHA256(r.TLS.PeerCertificates[0].Raw)
+	}
+
+	for _, cred := range a.credentials {
+		if cred.secret != "" && subtle.ConstantTimeCompare([]byte(cred.secret), []byte(secret)) == 1 {
+			return cred
+		}
+		if cred.secret == "" && fingerprint != "" && cred.certificate == fingerprint {
+			return cred
+		}
+	}
+	return nil
+}
+
+// allows reports whether one of the roles of the credential allows an action
+// on a resource of the organisations returned by orgs, which is only called
+// for roles limited to organisations.
+func (c *controlAPICredential) allows(resource, action string, orgs func() []string) bool {
+	var requestOrgs []string
+	resolved := false
+	for _, role := range c.roles {
+		if len(role.Orgs) > 0 && !resolved {
+			requestOrgs, resolved = orgs(), true
+		}
+		if roleAllows(role, resource, action, requestOrgs) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsOrg reports whether the credential allows an action on a resource of
+// org, e.g. to filter listings. Requests made with the shared secret have no
+// credential and are allowed.
+func (c *controlAPICredential) allowsOrg(resource, action, org string) bool {
+	if c == nil {
+		return true
+	}
+	return c.allows(resource, action, func() []string {
+		if org == "" {
+			return nil
+		}
+		return []string{org}
+	})
+}
+
+func roleAllows(role config.ControlAPIRole, resource, action string, orgs []string) bool {
+	if !containsString(role.Resources, resource) && !containsString(role.Resources, controlAPIAll) {
+		return false
+	}
+	if !containsString(role.Actions, action) {
+		return false
+	}
+
+	if len(role.Orgs) == 0 {
+		return true
+	}
+	if len(orgs) == 0 {
+		return false
+	}
+	for _, org := range orgs {
+		if !containsString(role.Orgs, org) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeControlAPI checks the roles of the named credential of a request
+// to the control API against the route it is for. Requests made with the
+// shared secret have full access.
+func (gw *Gateway) authorizeControlAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ctxGetControlAPICredential(r) == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		resource, action := controlAPIRoute(r)
+		gw.requireControlAPIAccess(resource, action, next).ServeHTTP(w, r)
+	})
+}
+
+// requireControlAPIAccess only lets requests through when they are made with
+// the shared secret, or with a credential allowed to do action on resource.
+func (gw *Gateway) requireControlAPIAccess(resource, action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cred := ctxGetControlAPICredential(r)
+		if cred == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		orgs := func() []string {
+			return gw.controlAPIOrgs(r)
+		}
+		if !cred.allows(resource, action, orgs) {
+			mainLog.WithField("credential", cred.name).Warningf("Gateway API access denied: %s %s", action, resource)
+			doJSONWrite(w, http.StatusForbidden, apiError("Access to this resource is not allowed for this credential"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// controlAPIRoute returns the resource and action of a request to the control API.
+func controlAPIRoute(r *http.Request) (resource, action string) {
+	var tmpl string
+	if route := mux.CurrentRoute(r); route != nil {
+		tmpl, _ = route.GetPathTemplate()
+	}
+
+	resource = strings.Split(strings.Trim(tmpl, "/"), "/")[0]
+	if resource == "org" {
+		resource = controlAPIOrgs
+	}
+
+	action = controlAPIWrite
+	switch {
+	case resource == controlAPIReload:
+	case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+		action = controlAPIRead
+	case tmpl == "/keys/preview":
+		action = controlAPIRead
+	}
+
+	return resource, action
+}
+
+// controlAPIOrgs returns the organisations a request to the control API is
+// for: the one set by the org_id query parameter or body field, the ones of
+// the APIs and policies a key or policy in the body grants access to, and the
+// ones of the API, policy, key or organisation in the path.
+func (gw *Gateway) controlAPIOrgs(r *http.Request) []string {
+	var orgs []string
+	add := func(org string) {
+		if org != "" && !containsString(orgs, org) {
+			orgs = append(orgs, org)
+		}
+	}
+
+	add(r.URL.Query().Get("org_id"))
+	if spec := gw.getApiSpec(r.URL.Query().Get("api_id")); spec != nil {
+		add(spec.OrgID)
+	}
+
+	if r.Body != nil && (r.Method == http.MethodPost || r.Method == http.MethodPut) {
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxControlAPIBodyPeek))
+		r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(data), r.Body))
+		if err == nil {
+			var body struct {
+				OrgID        string `json:"org_id"`
+				APIID        string `json:"api_id"`
+				AccessRights map[string]struct {
+					APIID string `json:"api_id"`
+				} `json:"access_rights"`
+				ApplyPolicies []string `json:"apply_policies"`
+				ApplyPolicyID string   `json:"apply_policy_id"`
+			}
+			if json.Unmarshal(data, &body) == nil {
+				add(body.OrgID)
+				apiIDs := []string{body.APIID}
+				for apiID, access := range body.AccessRights {
+					apiIDs = append(apiIDs, apiID, access.APIID)
+				}
+				gw.addGrantedOrgs(add, apiIDs, append(body.ApplyPolicies, body.ApplyPolicyID))
+			}
+		}
+	}
+
+	vars := mux.Vars(r)
+	if spec := gw.getApiSpec(vars["apiID"]); spec != nil {
+		add(spec.OrgID)
+	}
+	if polID := vars["polID"]; polID != "" {
+		gw.policiesMu.RLock()
+		pol, ok := gw.policiesByID[polID]
+		gw.policiesMu.RUnlock()
+		if ok {
+			add(pol.OrgID)
+		}
+	}
+
+	if keyName := vars["keyName"]; keyName != "" {
+		resource, _ := controlAPIRoute(r)
+		switch resource {
+		case controlAPIOrgs:
+			add(keyName)
+		case controlAPIKeys:
+			hashed := r.URL.Query().Get("hashed") != ""
+			if strings.HasPrefix(r.URL.Path, "/keys/policy/") {
+				hashed = gw.GetConfig().HashKeys
+			}
+			if session, ok := gw.GlobalSessionManager.SessionDetail("", keyName, hashed); ok {
+				add(session.OrgID)
+			}
+		}
+	}
+
+	return orgs
+}
+
+// keyOrgs returns the organisation of a key and the ones of the APIs and
+// policies it grants access to.
+func (gw *Gateway) keyOrgs(session *user.SessionState) []string {
+	var orgs []string
+	add := func(org string) {
+		if org != "" && !containsString(orgs, org) {
+			orgs = append(orgs, org)
+		}
+	}
+	if session == nil {
+		return nil
+	}
+
+	add(session.OrgID)
+	var apiIDs []string
+	for apiID, access := range session.AccessRights {
+		apiIDs = append(apiIDs, apiID, access.APIID)
+	}
+	gw.addGrantedOrgs(add, apiIDs, append(session.ApplyPolicies, session.ApplyPolicyID))
+
+	return orgs
+}
+
+// addGrantedOrgs adds the organisations of the loaded APIs and policies of
+// the given IDs, the unknown ones being ignored.
+func (gw *Gateway) addGrantedOrgs(add func(string), apiIDs, polIDs []string) {
+	for _, apiID := range apiIDs {
+		if spec := gw.getApiSpec(apiID); spec != nil {
+			add(spec.OrgID)
+		}
+	}
+
+	gw.policiesMu.RLock()
+	defer gw.policiesMu.RUnlock()
+	for _, polID := range polIDs {
+		if pol, ok := gw.policiesByID[polID]; ok {
+			add(pol.OrgID)
+		}
+	}
+}
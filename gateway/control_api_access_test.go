@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestControlAPIAccess(t *testing.T) {
+	gw := &Gateway{
+		apisByID: map[string]*APISpec{
+			"api1": {APIDefinition: &apidef.APIDefinition{APIID: "api1", OrgID: "org1"}},
+			"api2": {APIDefinition: &apidef.APIDefinition{APIID: "api2", OrgID: "org2"}},
+		},
+		policiesByID: map[string]user.Policy{
+			"pol1": {ID: "pol1", OrgID: "org1"},
+			"pol2": {ID: "pol2", OrgID: "org2"},
+		},
+	}
+	gw.SetConfig(config.Config{
+		Secret: "admin",
+		ControlAPIAccess: config.ControlAPIAccessConfig{
+			Credentials: []config.ControlAPICredential{
+				{Name: "ci", Secret: "ci-secret", Roles: []string{"api-manager"}},
+				{Name: "support", Secret: "support-secret", Roles: []string{"key-reader", "unknown"}},
+				{Name: "org1", Secret: "org1-secret", Roles: []string{"org1-admin"}},
+			},
+			Roles: map[string]config.ControlAPIRole{
+				"api-manager": {Resources: []string{"apis", "reload"}, Actions: []string{"read", "write"}},
+				"key-reader":  {Resources: []string{"keys"}, Actions: []string{"read"}},
+				"org1-admin":  {Resources: []string{"*"}, Actions: []string{"read", "write"}, Orgs: []string{"org1"}},
+			},
+		},
+	})
+
+	r := mux.NewRouter()
+	r.Use(gw.authorizeControlAPI)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/apis", ok).Methods(http.MethodGet, http.MethodPost)
+	r.HandleFunc("/apis/{apiID}", ok).Methods(http.MethodGet, http.MethodPut)
+	r.HandleFunc("/policies/{polID}", ok).Methods(http.MethodGet)
+	r.HandleFunc("/keys", ok).Methods(http.MethodGet)
+	r.HandleFunc("/keys/preview", ok).Methods(http.MethodPost)
+	r.HandleFunc("/keys/create", ok).Methods(http.MethodPost)
+	r.HandleFunc("/reload", ok).Methods(http.MethodGet)
+	handler := gw.checkIsAPIOwner(r)
+
+	tests := []struct {
+		secret, method, path, body string
+		code                       int
+	}{
+		{"", http.MethodGet, "/apis", "", http.StatusForbidden},
+		{"wrong", http.MethodGet, "/apis", "", http.StatusForbidden},
+		{"admin", http.MethodPut, "/apis/api2", "", http.StatusOK},
+
+		{"ci-secret", http.MethodPut, "/apis/api2", "", http.StatusOK},
+		{"ci-secret", http.MethodGet, "/reload", "", http.StatusOK},
+		{"ci-secret", http.MethodGet, "/keys", "", http.StatusForbidden},
+
+		{"support-secret", http.MethodGet, "/keys", "", http.StatusOK},
+		{"support-secret", http.MethodPost, "/keys/preview", "", http.StatusOK},
+		{"support-secret", http.MethodPost, "/keys/create", "{}", http.StatusForbidden},
+		{"support-secret", http.MethodGet, "/reload", "", http.StatusForbidden},
+
+		{"org1-secret", http.MethodGet, "/apis/api1", "", http.StatusOK},
+		{"org1-secret", http.MethodGet, "/apis/api2", "", http.StatusForbidden},
+		{"org1-secret", http.MethodGet, "/apis", "", http.StatusForbidden},
+		{"org1-secret", http.MethodGet, "/policies/pol1", "", http.StatusOK},
+		{"org1-secret", http.MethodGet, "/keys?org_id=org1", "", http.StatusOK},
+		{"org1-secret", http.MethodPost, "/keys/create", `{"org_id": "org1"}`, http.StatusOK},
+		{"org1-secret", http.MethodPost, "/keys/create", `{"org_id": "org2"}`, http.StatusForbidden},
+		{"org1-secret", http.MethodPut, "/apis/api1", `{"api_id": "api1", "org_id": "org2"}`, http.StatusForbidden},
+		{"org1-secret", http.MethodPost, "/keys/create?org_id=org1", `{"org_id": "org2"}`, http.StatusForbidden},
+		{"org1-secret", http.MethodPost, "/keys/create", `{"org_id": "org1", "access_rights": {"api1": {"api_id": "api1"}}}`, http.StatusOK},
+		{"org1-secret", http.MethodPost, "/keys/create", `{"org_id": "org1", "access_rights": {"api2": {"api_id": "api2"}}}`, http.StatusForbidden},
+		{"org1-secret", http.MethodPost, "/keys/create", `{"org_id": "org1", "access_rights": {"x": {"api_id": "api2"}}}`, http.StatusForbidden},
+		{"org1-secret", http.MethodPost, "/keys/create", `{"org_id": "org1", "apply_policies": ["pol2"]}`, http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set(headers.XTykAuthorization, tc.secret)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tc.code, rec.Code, "%s: %s %s %s", tc.secret, tc.method, tc.path, tc.body)
+	}
+}
+
+func TestControlAPIAccessWithoutSharedSecret(t *testing.T) {
+	gw := &Gateway{}
+	gw.SetConfig(config.Config{})
+
+	r := mux.NewRouter()
+	r.HandleFunc("/apis", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet)
+
+	do := func(secret string) int {
+		req := httptest.NewRequest(http.MethodGet, "/apis", nil)
+		req.Header.Set(headers.XTykAuthorization, secret)
+		rec := httptest.NewRecorder()
+		gw.checkIsAPIOwner(r).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do(""), "no secret configured")
+
+	gw.SetConfig(config.Config{ControlAPIAccess: config.ControlAPIAccessConfig{
+		Credentials: []config.ControlAPICredential{{Name: "ci", Secret: "ci-secret", Roles: []string{"all"}}},
+		Roles:       map[string]config.ControlAPIRole{"all": {Resources: []string{"*"}, Actions: []string{"read"}}},
+	}})
+	assert.Equal(t, http.StatusForbidden, do(""), "only credentials are accepted")
+	assert.Equal(t, http.StatusOK, do("ci-secret"))
+}
+
+func TestControlAPIListsByOrg(t *testing.T) {
+	api1 := &apidef.APIDefinition{APIID: "api1", OrgID: "org1"}
+	api2 := &apidef.APIDefinition{APIID: "api2", OrgID: "org2"}
+	gw := &Gateway{
+		apisByID: map[string]*APISpec{
+			"api1": {APIDefinition: api1, definition: api1},
+			"api2": {APIDefinition: api2, definition: api2},
+		},
+		policiesByID: map[string]user.Policy{
+			"pol1": {ID: "pol1", OrgID: "org1"},
+			"pol2": {ID: "pol2", OrgID: "org2"},
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/tyk/apis?org_id=org1", nil)
+	apis, _ := gw.handleGetAPIList(req)
+	assert.Len(t, apis, 2, "the shared secret lists everything")
+
+	ctxSetControlAPICredential(req, &controlAPICredential{name: "org1", roles: []config.ControlAPIRole{
+		{Resources: []string{"*"}, Actions: []string{"read"}, Orgs: []string{"org1"}},
+	}})
+	apis, _ = gw.handleGetAPIList(req)
+	assert.Equal(t, []*apidef.APIDefinition{api1}, apis)
+	policies, _ := gw.handleGetPolicyList(req)
+	assert.Equal(t, []user.Policy{{ID: "pol1", OrgID: "org1"}}, policies)
+}
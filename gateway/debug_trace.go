@@ -0,0 +1,467 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	defaultDebugTraceTTL       = 600
+	defaultDebugMaxBodySize    = 4096
+	defaultDebugRuleTTL        = 300
+	defaultDebugRuleMaxTraces  = 10
+	defaultDebugTokenTTL       = 300
+	debugTraceKeyPrefix        = "debug-trace-"
+	debugDecisionContinue      = "continue"
+	debugDecisionRespond       = "respond"
+	debugDecisionError         = "error"
+	debugTokenSignatureDivider = "."
+)
+
+// DebugTrace is the trace of a live request through the middleware chain.
+type DebugTrace struct {
+	ID          string              `json:"id"`
+	APIID       string              `json:"api_id"`
+	APIName     string              `json:"api_name"`
+	Method      string              `json:"method"`
+	URL         string              `json:"url"`
+	RuleID      string              `json:"rule_id,omitempty"`
+	StartedAt   time.Time           `json:"started_at"`
+	DurationMs  float64             `json:"duration_ms"`
+	Status      int                 `json:"status"`
+	Middlewares []DebugTraceStep    `json:"middlewares"`
+	Upstream    *DebugTraceUpstream `json:"upstream,omitempty"`
+}
+
+// DebugTraceStep is the decision of a middleware and the changes it made to
+// the request.
+type DebugTraceStep struct {
+	Name           string      `json:"name"`
+	Decision       string      `json:"decision"`
+	Code           int         `json:"code,omitempty"`
+	Error          string      `json:"error,omitempty"`
+	DurationMs     float64     `json:"duration_ms"`
+	HeadersSet     http.Header `json:"headers_set,omitempty"`
+	HeadersRemoved []string    `json:"headers_removed,omitempty"`
+	URL            string      `json:"url,omitempty"`
+	BodyChanged    bool        `json:"body_changed,omitempty"`
+	Body           string      `json:"body,omitempty"`
+}
+
+// DebugTraceUpstream is the upstream request of a trace.
+type DebugTraceUpstream struct {
+	URL       string  `json:"url"`
+	Status    int     `json:"status,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// DebugRule traces the requests matching it, until it expires or has traced
+// its maximum number of requests.
+type DebugRule struct {
+	ID          string `json:"id"`
+	APIID       string `json:"api_id"`
+	Method      string `json:"method,omitempty"`
+	PathPrefix  string `json:"path_prefix,omitempty"`
+	HeaderName  string `json:"header_name,omitempty"`
+	HeaderValue string `json:"header_value,omitempty"`
+	TTL         int64  `json:"ttl"`
+	MaxTraces   int    `json:"max_traces"`
+	Expires     int64  `json:"expires"`
+	Traced      int    `json:"traced"`
+}
+
+// debugToken is a signed value of the debug header.
+type debugToken struct {
+	Header  string `json:"header"`
+	Value   string `json:"value"`
+	Expires int64  `json:"expires"`
+}
+
+// debugTrace is a trace being recorded, along with the state of the request
+// after the last middleware.
+type debugTrace struct {
+	mu sync.Mutex
+	DebugTrace
+
+	maxBodySize int
+	headers     http.Header
+	url         string
+	body        []byte
+}
+
+func newDebugTrace(spec *APISpec, r *http.Request, ruleID string, maxBodySize int) *debugTrace {
+	t := &debugTrace{
+		DebugTrace: DebugTrace{
+			ID:          uuid.NewV4().String(),
+			APIID:       spec.APIID,
+			APIName:     spec.Name,
+			Method:      r.Method,
+			URL:         r.URL.String(),
+			RuleID:      ruleID,
+			StartedAt:   time.Now(),
+			Middlewares: []DebugTraceStep{},
+		},
+		maxBodySize: maxBodySize,
+	}
+	t.headers, t.url, t.body = debugRequestState(r)
+	return t
+}
+
+// debugRequestState returns the headers, URL and body of a request. Streamed
+// bodies are not read.
+func debugRequestState(r *http.Request) (http.Header, string, []byte) {
+	var body []byte
+	if r.Body != nil && !(r.ContentLength == -1 && IsGrpcStreaming(r)) {
+		nopCloseRequestBody(r)
+		// The body rewinds once fully read
+		body, _ = ioutil.ReadAll(r.Body)
+	}
+	return r.Header.Clone(), r.URL.String(), body
+}
+
+// addStep records the decision of a middleware and the changes it made since
+// the previous one.
+func (t *debugTrace) addStep(name string, r *http.Request, err error, code int, elapsed time.Duration) {
+	step := DebugTraceStep{
+		Name:       name,
+		Decision:   debugDecisionContinue,
+		DurationMs: float64(elapsed) / float64(time.Millisecond),
+	}
+	switch {
+	case err != nil:
+		step.Decision = debugDecisionError
+		step.Code = code
+		step.Error = err.Error()
+	case code == mwStatusRespond:
+		step.Decision = debugDecisionRespond
+	}
+
+	headers, url, body := debugRequestState(r)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name, values := range headers {
+		if !stringSlicesEqual(t.headers[name], values) {
+			if step.HeadersSet == nil {
+				step.HeadersSet = http.Header{}
+			}
+			step.HeadersSet[name] = values
+		}
+	}
+	for name := range t.headers {
+		if _, ok := headers[name]; !ok {
+			step.HeadersRemoved = append(step.HeadersRemoved, name)
+		}
+	}
+	if url != t.url {
+		step.URL = url
+	}
+	if !bytes.Equal(body, t.body) {
+		step.BodyChanged = true
+		step.Body = string(body)
+		if len(body) > t.maxBodySize {
+			step.Body = string(body[:t.maxBodySize])
+		}
+	}
+
+	t.headers, t.url, t.body = headers, url, body
+	t.Middlewares = append(t.Middlewares, step)
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// setUpstream records the upstream request.
+func (t *debugTrace) setUpstream(r *http.Request, resp *http.Response, err error, latency time.Duration) {
+	upstream := &DebugTraceUpstream{
+		URL:       r.URL.String(),
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+	}
+	if err != nil {
+		upstream.Error = err.Error()
+	} else if resp != nil {
+		upstream.Status = resp.StatusCode
+	}
+
+	t.mu.Lock()
+	t.Upstream = upstream
+	t.mu.Unlock()
+}
+
+// setStatus records the status code of the response.
+func (t *debugTrace) setStatus(code int) {
+	t.mu.Lock()
+	t.Status = code
+	t.mu.Unlock()
+}
+
+// debugTracing traces live requests carrying a signed debug header or
+// matching a debug rule.
+type debugTracing struct {
+	secret      []byte
+	ttl         int64
+	maxBodySize int
+	store       storage.Handler
+
+	mu    sync.Mutex
+	rules map[string]*DebugRule
+}
+
+// setupDebugTracing enables the tracing of live requests.
+func (gw *Gateway) setupDebugTracing() {
+	conf := gw.GetConfig().DebugTracing
+	if !conf.Enabled {
+		gw.debugTracing = nil
+		return
+	}
+
+	d := &debugTracing{
+		secret:      []byte(conf.Secret),
+		ttl:         conf.TraceTTL,
+		maxBodySize: conf.MaxBodySize,
+		store:       gw.newStore(storage.StoreOptions{KeyPrefix: debugTraceKeyPrefix}),
+		rules:       make(map[string]*DebugRule),
+	}
+	if d.ttl <= 0 {
+		d.ttl = defaultDebugTraceTTL
+	}
+	if d.maxBodySize <= 0 {
+		d.maxBodySize = defaultDebugMaxBodySize
+	}
+
+	gw.debugTracing = d
+}
+
+// handler wraps an API handler to trace the selected requests, storing the
+// traces once the responses are sent.
+func (d *debugTracing) handler(spec *APISpec, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ruleID, ok := d.selectRequest(spec, r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The debug header isn't sent upstream
+		r.Header.Del(headers.XTykDebug)
+
+		t := newDebugTrace(spec, r, ruleID, d.maxBodySize)
+		ctxSetDebugTrace(r, t)
+		w.Header().Set(headers.XTykDebugTraceID, t.ID)
+
+		next.ServeHTTP(w, r)
+
+		t.mu.Lock()
+		t.DurationMs = float64(time.Since(t.StartedAt)) / float64(time.Millisecond)
+		data, err := json.Marshal(t.DebugTrace)
+		t.mu.Unlock()
+		if err != nil {
+			log.WithError(err).Error("Failed to encode debug trace")
+			return
+		}
+		if err := d.store.SetKey(t.ID, string(data), d.ttl); err != nil {
+			log.WithError(err).Error("Failed to store debug trace")
+		}
+	})
+}
+
+// selectRequest reports whether a request is traced, returning the ID of the
+// matching rule if any.
+func (d *debugTracing) selectRequest(spec *APISpec, r *http.Request) (string, bool) {
+	if value := r.Header.Get(headers.XTykDebug); value != "" {
+		if d.validToken(value) {
+			return "", true
+		}
+		log.WithField("api_id", spec.APIID).Warning("Invalid debug header")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now().Unix()
+	for id, rule := range d.rules {
+		if rule.Expires <= now || rule.Traced >= rule.MaxTraces {
+			delete(d.rules, id)
+			continue
+		}
+		if rule.matches(spec, r) {
+			rule.Traced++
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func (rule *DebugRule) matches(spec *APISpec, r *http.Request) bool {
+	if rule.APIID != "" && rule.APIID != spec.APIID {
+		return false
+	}
+	if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+		return false
+	}
+	if rule.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+		return false
+	}
+	if rule.HeaderName != "" && r.Header.Get(rule.HeaderName) != rule.HeaderValue {
+		return false
+	}
+	return true
+}
+
+// sign returns the header value valid until expires.
+func (d *debugTracing) sign(expires int64) string {
+	exp := strconv.FormatInt(expires, 10)
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte(exp))
+	return exp + debugTokenSignatureDivider + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *debugTracing) validToken(value string) bool {
+	if len(d.secret) == 0 {
+		return false
+	}
+	i := strings.Index(value, debugTokenSignatureDivider)
+	if i < 0 {
+		return false
+	}
+	expires, err := strconv.ParseInt(value[:i], 10, 64)
+	if err != nil || expires <= time.Now().Unix() {
+		return false
+	}
+	return hmac.Equal([]byte(d.sign(expires)), []byte(value))
+}
+
+func (d *debugTracing) addRule(rule DebugRule) DebugRule {
+	if rule.TTL <= 0 {
+		rule.TTL = defaultDebugRuleTTL
+	}
+	if rule.MaxTraces <= 0 {
+		rule.MaxTraces = defaultDebugRuleMaxTraces
+	}
+	rule.ID = uuid.NewV4().String()
+	rule.Expires = time.Now().Unix() + rule.TTL
+	rule.Traced = 0
+
+	d.mu.Lock()
+	d.rules[rule.ID] = &rule
+	d.mu.Unlock()
+	return rule
+}
+
+func (d *debugTracing) listRules() []DebugRule {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now().Unix()
+	rules := make([]DebugRule, 0, len(d.rules))
+	for id, rule := range d.rules {
+		if rule.Expires <= now || rule.Traced >= rule.MaxTraces {
+			delete(d.rules, id)
+			continue
+		}
+		rules = append(rules, *rule)
+	}
+	return rules
+}
+
+func (d *debugTracing) deleteRule(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.rules[id]; !ok {
+		return false
+	}
+	delete(d.rules, id)
+	return true
+}
+
+// debugRulesHandler lists, adds and deletes the debug rules of the Gateway.
+func (gw *Gateway) debugRulesHandler(w http.ResponseWriter, r *http.Request) {
+	ruleID := mux.Vars(r)["ruleID"]
+
+	switch r.Method {
+	case http.MethodGet:
+		doJSONWrite(w, http.StatusOK, gw.debugTracing.listRules())
+	case http.MethodPost:
+		var rule DebugRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+		if rule.APIID == "" && rule.PathPrefix == "" && rule.HeaderName == "" {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Rule must match an API, a path prefix or a header"))
+			return
+		}
+		doJSONWrite(w, http.StatusOK, gw.debugTracing.addRule(rule))
+	case http.MethodDelete:
+		if !gw.debugTracing.deleteRule(ruleID) {
+			doJSONWrite(w, http.StatusNotFound, apiError("Rule not found"))
+			return
+		}
+		doJSONWrite(w, http.StatusOK, apiOk("deleted"))
+	}
+}
+
+// debugTokenHandler issues a signed debug header value, valid for the number
+// of seconds set by the `ttl` query parameter.
+func (gw *Gateway) debugTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if len(gw.debugTracing.secret) == 0 {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Debug tracing secret is not set"))
+		return
+	}
+
+	ttl := int64(defaultDebugTokenTTL)
+	if value := r.URL.Query().Get("ttl"); value != "" {
+		var err error
+		if ttl, err = strconv.ParseInt(value, 10, 64); err != nil || ttl <= 0 {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Invalid ttl"))
+			return
+		}
+	}
+
+	expires := time.Now().Unix() + ttl
+	doJSONWrite(w, http.StatusOK, debugToken{
+		Header:  headers.XTykDebug,
+		Value:   gw.debugTracing.sign(expires),
+		Expires: expires,
+	})
+}
+
+// debugTraceHandler serves a stored trace.
+func (gw *Gateway) debugTraceHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := gw.debugTracing.store.GetKey(mux.Vars(r)["traceID"])
+	if err != nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("Trace not found"))
+		return
+	}
+
+	w.Header().Set(headers.ContentType, headers.ApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(data))
+}
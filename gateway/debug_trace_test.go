@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestDebugTracingToken(t *testing.T) {
+	d := &debugTracing{secret: []byte("secret")}
+
+	valid := d.sign(time.Now().Unix() + 60)
+	if !d.validToken(valid) {
+		t.Errorf("expected %q to be valid", valid)
+	}
+
+	tampered := valid[:len(valid)-1] + "0"
+	if strings.HasSuffix(valid, "0") {
+		tampered = valid[:len(valid)-1] + "1"
+	}
+
+	for _, value := range []string{
+		d.sign(time.Now().Unix() - 1),
+		tampered,
+		(&debugTracing{secret: []byte("other")}).sign(time.Now().Unix() + 60),
+		"invalid",
+	} {
+		if d.validToken(value) {
+			t.Errorf("expected %q to be invalid", value)
+		}
+	}
+
+	if (&debugTracing{}).validToken(valid) {
+		t.Error("expected tokens to be invalid without a secret")
+	}
+}
+
+func TestDebugTracing(t *testing.T) {
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.DebugTracing.Enabled = true
+		globalConf.DebugTracing.Secret = "debug-secret"
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "traced"
+		spec.Proxy.ListenPath = "/traced/"
+		spec.VersionData.Versions = map[string]apidef.VersionInfo{
+			"v1": {
+				UseExtendedPaths:    true,
+				GlobalHeaders:       map[string]string{"X-Injected": "yes"},
+				GlobalHeadersRemove: []string{"X-Removed"},
+			},
+		}
+	})
+
+	getTrace := func(t *testing.T, resp *http.Response) (trace DebugTrace) {
+		t.Helper()
+
+		id := resp.Header.Get(headers.XTykDebugTraceID)
+		if id == "" {
+			t.Fatal("expected a trace ID")
+		}
+		_, _ = ts.Run(t, test.TestCase{
+			Path: "/tyk/debug/traces/" + id, AdminAuth: true, Code: http.StatusOK,
+			BodyMatchFunc: func(body []byte) bool {
+				return json.Unmarshal(body, &trace) == nil
+			},
+		})
+		return trace
+	}
+
+	t.Run("header", func(t *testing.T) {
+		var token debugToken
+		_, _ = ts.Run(t, test.TestCase{
+			Method: http.MethodPost, Path: "/tyk/debug/tokens?ttl=60", AdminAuth: true, Code: http.StatusOK,
+			BodyMatchFunc: func(body []byte) bool {
+				return json.Unmarshal(body, &token) == nil
+			},
+		})
+
+		resp, _ := ts.Run(t, test.TestCase{
+			Path:         "/traced/path",
+			Headers:      map[string]string{token.Header: token.Value, "X-Removed": "1"},
+			Code:         http.StatusOK,
+			BodyNotMatch: headers.XTykDebug,
+		})
+
+		trace := getTrace(t, resp)
+		if trace.APIID != "traced" || trace.Status != http.StatusOK || trace.Upstream == nil || trace.Upstream.Status != http.StatusOK {
+			t.Errorf("unexpected trace %+v", trace)
+		}
+
+		var transform *DebugTraceStep
+		for i, step := range trace.Middlewares {
+			if step.Decision != debugDecisionContinue {
+				t.Errorf("unexpected decision %+v", step)
+			}
+			if step.HeadersSet.Get("X-Injected") != "" {
+				transform = &trace.Middlewares[i]
+			}
+		}
+		if transform == nil || len(transform.HeadersRemoved) != 1 || transform.HeadersRemoved[0] != "X-Removed" {
+			t.Errorf("expected a step setting and removing headers, got %+v", trace.Middlewares)
+		}
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		resp, _ := ts.Run(t, test.TestCase{
+			Path:    "/traced/path",
+			Headers: map[string]string{headers.XTykDebug: "1.invalid"},
+			Code:    http.StatusOK,
+		})
+		if id := resp.Header.Get(headers.XTykDebugTraceID); id != "" {
+			t.Errorf("expected no trace, got %q", id)
+		}
+	})
+
+	t.Run("rule", func(t *testing.T) {
+		var rule DebugRule
+		_, _ = ts.Run(t, []test.TestCase{
+			{Method: http.MethodPost, Path: "/tyk/debug/rules", Data: DebugRule{}, AdminAuth: true, Code: http.StatusBadRequest},
+			{
+				Method: http.MethodPost, Path: "/tyk/debug/rules", AdminAuth: true, Code: http.StatusOK,
+				Data: DebugRule{APIID: "traced", PathPrefix: "/traced/rule", MaxTraces: 1},
+				BodyMatchFunc: func(body []byte) bool {
+					return json.Unmarshal(body, &rule) == nil
+				},
+			},
+		}...)
+
+		resp, _ := ts.Run(t, test.TestCase{Path: "/traced/rule", Code: http.StatusOK})
+		if trace := getTrace(t, resp); trace.RuleID != rule.ID {
+			t.Errorf("expected the trace of rule %s, got %+v", rule.ID, trace)
+		}
+
+		// The rule is spent after its maximum number of traces
+		_, _ = ts.Run(t, []test.TestCase{
+			{Path: "/traced/rule", Code: http.StatusOK, HeadersMatch: map[string]string{headers.XTykDebugTraceID: ""}},
+			{Path: "/tyk/debug/rules", AdminAuth: true, Code: http.StatusOK, BodyMatch: `^\[\]`},
+			{Method: http.MethodDelete, Path: "/tyk/debug/rules/" + rule.ID, AdminAuth: true, Code: http.StatusNotFound},
+			{Path: "/tyk/debug/traces/unknown", AdminAuth: true, Code: http.StatusNotFound},
+		}...)
+	})
+}
@@ -0,0 +1,285 @@
+package gateway
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pmylund/go-cache"
+
+	"github.com/TykTechnologies/drl"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+var degradedLog = log.WithField("prefix", "degraded-mode")
+
+const (
+	defaultDegradedBufferPath = "tyk-degraded.db"
+
+	// degradedAnalyticsPrefix is the prefix of the buffered analytics lists, followed by the Redis list they're for
+	degradedAnalyticsPrefix = "analytics:"
+
+	// degradedTokenValue is the DRL token value of a Gateway enforcing whole rate limits on its own
+	degradedTokenValue = 100
+)
+
+// degradedMode keeps the Gateway serving traffic while Redis is unreachable. Sessions are served from the local
+// session cache, rate limits are enforced in memory and quota increments and analytics records are buffered to
+// disk, to be written to Redis once it's reachable again.
+type degradedMode struct {
+	gw     *Gateway
+	buffer *storage.EmbeddedStore
+	// store is the Redis store the quotas are written to
+	store storage.Store
+	// drl enforces the rate limits of the Gateway, which can't share them with the other Gateways without Redis
+	drl      *drl.DRL
+	interval time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	// quotas holds the last counts of the quotas read from Redis, the buffered quotas are added to
+	quotas sync.Map
+
+	active int32
+	since  time.Time
+}
+
+// degradedQuota is the count of a quota read from Redis.
+type degradedQuota struct {
+	count int64
+	// renews is when the quota renews as a Unix timestamp, 0 if it never does
+	renews int64
+}
+
+func (gw *Gateway) setupDegradedMode() {
+	if gw.degradedMode != nil {
+		// the buffer must be closed before it's opened again
+		gw.degradedMode.cancel()
+		<-gw.degradedMode.done
+		gw.degradedMode = nil
+	}
+
+	conf := gw.GetConfig()
+	if !conf.DegradedMode.Enabled {
+		return
+	}
+	if conf.SlaveOptions.UseRPC {
+		degradedLog.Warning("Degraded mode isn't available in RPC mode, which has its own emergency mode")
+		return
+	}
+	if conf.LocalSessionCache.DisableCacheSessionState {
+		degradedLog.Warning("The local session cache is disabled, keys will be rejected in degraded mode")
+	}
+
+	path := conf.DegradedMode.BufferPath
+	if path == "" {
+		path = defaultDegradedBufferPath
+	}
+	buffer, err := storage.OpenEmbeddedStore(path)
+	if err != nil {
+		degradedLog.WithError(err).Error("Could not open the degraded mode buffer at ", path)
+		return
+	}
+
+	rateLimiter := &drl.DRL{RequestTokenValue: degradedTokenValue}
+	rateLimiter.SetCurrentTokenValue(degradedTokenValue)
+	ctx, cancel := context.WithCancel(gw.ctx)
+	gw.degradedMode = &degradedMode{
+		gw:       gw,
+		buffer:   buffer,
+		store:    gw.newStore(storage.StoreOptions{KeyPrefix: "apikey-", HashKeys: conf.HashKeys}),
+		drl:      rateLimiter,
+		interval: time.Second,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go gw.degradedMode.watch(ctx)
+}
+
+// isActive reports whether the Gateway is in degraded mode.
+func (d *degradedMode) isActive() bool {
+	return d != nil && atomic.LoadInt32(&d.active) == 1
+}
+
+// watch enters degraded mode when Redis becomes unreachable and leaves it once Redis is reachable again, until ctx
+// is done.
+func (d *degradedMode) watch(ctx context.Context) {
+	defer close(d.done)
+	defer d.buffer.Close()
+
+	if !d.gw.RedisController.WaitConnect(ctx) {
+		return
+	}
+	// write what was left buffered by a previous run
+	d.reconcile()
+
+	tick := time.NewTicker(d.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+
+		connected := d.gw.RedisController.Connected()
+		switch {
+		case !connected && !d.isActive():
+			d.enter()
+		case connected && d.isActive():
+			d.leave()
+		}
+	}
+}
+
+func (d *degradedMode) enter() {
+	d.since = time.Now()
+	atomic.StoreInt32(&d.active, 1)
+
+	// keep the cached sessions for as long as Redis is unreachable
+	for key, item := range d.gw.SessionCache.Items() {
+		d.gw.SessionCache.Set(key, item.Object, cache.NoExpiration)
+	}
+
+	degradedLog.Warning("Redis is unreachable, entering degraded mode")
+	d.gw.FireSystemEvent(EventDegradedModeEntered, EventDegradedModeMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Redis is unreachable, the Gateway entered degraded mode"},
+		Since:            d.since.Unix(),
+	})
+}
+
+func (d *degradedMode) leave() {
+	atomic.StoreInt32(&d.active, 0)
+	d.reconcile()
+
+	for key, item := range d.gw.SessionCache.Items() {
+		if item.Expiration == 0 {
+			d.gw.SessionCache.Set(key, item.Object, cache.DefaultExpiration)
+		}
+	}
+
+	duration := time.Since(d.since)
+	degradedLog.WithField("duration", duration.Round(time.Second)).Info("Redis is reachable again, leaving degraded mode")
+	d.gw.FireSystemEvent(EventDegradedModeLeft, EventDegradedModeMeta{
+		EventMetaDefault: EventMetaDefault{Message: "Redis is reachable again, the Gateway left degraded mode"},
+		Since:            d.since.Unix(),
+		Duration:         int64(duration / time.Second),
+	})
+}
+
+// reconcile writes the buffered quota increments and analytics records to Redis. What can't be written is kept
+// buffered for the next time.
+func (d *degradedMode) reconcile() {
+	keys, err := d.buffer.Keys(QuotaKeyPrefix + "*")
+	if err != nil {
+		degradedLog.WithError(err).Error("Failed to read the buffered quotas")
+	}
+	for _, key := range keys {
+		value, err := d.buffer.Get(key)
+		if err != nil {
+			continue
+		}
+		ttl, _ := d.buffer.TTL(key)
+		d.buffer.Del(key)
+
+		n, _ := strconv.ParseInt(value, 10, 64)
+		if _, err := d.store.IncrementByWithExpire(key, n, int64(ttl/time.Second)); err != nil {
+			degradedLog.WithError(err).Error("Failed to write the buffered quotas")
+			d.bufferQuota(key, n, ttl)
+			return
+		}
+	}
+
+	if d.gw.analytics.Store == nil {
+		return
+	}
+	keys, err = d.buffer.Keys(degradedAnalyticsPrefix + "*")
+	if err != nil {
+		degradedLog.WithError(err).Error("Failed to read the buffered analytics records")
+	}
+	for _, key := range keys {
+		if !d.gw.RedisController.Connected() {
+			return
+		}
+		values, err := d.buffer.LPopAll(key)
+		if err != nil {
+			degradedLog.WithError(err).Error("Failed to read the buffered analytics records")
+			continue
+		}
+		records := make([][]byte, len(values))
+		for i, value := range values {
+			records[i] = []byte(value)
+		}
+		d.gw.analytics.Store.AppendToSetPipelined(strings.TrimPrefix(key, degradedAnalyticsPrefix), records)
+	}
+}
+
+// countQuota records the count of a quota read from Redis.
+func (d *degradedMode) countQuota(key string, count int64, limit *user.APILimit) {
+	if d == nil || count == 0 {
+		return
+	}
+
+	q := degradedQuota{count: count, renews: limit.QuotaRenews}
+	switch {
+	case limit.QuotaRenewalRate <= 0:
+		q.renews = 0
+	case count == 1:
+		q.renews = time.Now().Unix() + limit.QuotaRenewalRate
+	}
+	d.quotas.Store(key, q)
+}
+
+// incrementQuota counts a request against a buffered quota, returning the number of requests made in the quota
+// period, including those counted in Redis before it became unreachable.
+func (d *degradedMode) incrementQuota(key string, limit *user.APILimit) int64 {
+	var count int64
+	if v, ok := d.quotas.Load(key); ok {
+		if q := v.(degradedQuota); q.renews == 0 || time.Now().Unix() < q.renews {
+			count = q.count
+		}
+	}
+	return count + d.bufferQuota(key, 1, time.Duration(limit.QuotaRenewalRate)*time.Second)
+}
+
+// bufferQuota adds n to a buffered quota, which expires after ttl when it's created.
+func (d *degradedMode) bufferQuota(key string, n int64, ttl time.Duration) int64 {
+	count, err := d.buffer.IncrBy(key, n)
+	if err != nil {
+		degradedLog.WithError(err).Error("Failed to buffer a quota increment")
+		return 0
+	}
+	if count == n && ttl > 0 {
+		d.buffer.Expire(key, ttl)
+	}
+	return count
+}
+
+// degradedAnalyticsStore buffers the analytics records to disk while the Gateway is in degraded mode.
+type degradedAnalyticsStore struct {
+	storage.AnalyticsHandler
+	gw *Gateway
+}
+
+func (s *degradedAnalyticsStore) AppendToSetPipelined(key string, values [][]byte) {
+	d := s.gw.degradedMode
+	if !d.isActive() {
+		s.AnalyticsHandler.AppendToSetPipelined(key, values)
+		return
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	records := make([]string, len(values))
+	for i, value := range values {
+		records[i] = string(value)
+	}
+	if _, err := d.buffer.RPush(degradedAnalyticsPrefix+key, records...); err != nil {
+		degradedLog.WithError(err).Error("Failed to buffer analytics records")
+	}
+}
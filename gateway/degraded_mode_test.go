@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestDegradedMode(t *testing.T) {
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.DegradedMode.Enabled = true
+		globalConf.DegradedMode.BufferPath = filepath.Join(t.TempDir(), "degraded.db")
+		globalConf.EnableRedisRollingLimiter = true
+	})
+	defer ts.Close()
+
+	events := make(chan config.EventMessage, 2)
+	conf := ts.Gw.GetConfig()
+	handler := &testEventHandler{cb: func(em config.EventMessage) { events <- em }}
+	conf.SetEventTriggers(map[apidef.TykEvent][]config.TykEventHandler{
+		EventDegradedModeEntered: {handler},
+		EventDegradedModeLeft:    {handler},
+	})
+	ts.Gw.SetConfig(conf)
+
+	api := ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})[0]
+	access := map[string]user.AccessDefinition{api.APIID: {APIID: api.APIID}}
+
+	_, rateLimitedKey := ts.CreateSession(func(s *user.SessionState) {
+		s.AccessRights = access
+		s.Rate = 2
+		s.Per = 60
+	})
+	_, quotaKey := ts.CreateSession(func(s *user.SessionState) {
+		s.AccessRights = access
+		s.QuotaMax = 3
+		s.QuotaRemaining = 3
+		s.QuotaRenewalRate = 3600
+	})
+	rateLimited := map[string]string{headers.Authorization: rateLimitedKey}
+	quota := map[string]string{headers.Authorization: quotaKey}
+
+	// cache the sessions
+	ts.Run(t, []test.TestCase{
+		{Headers: rateLimited, Code: http.StatusOK},
+		{Headers: quota, Code: http.StatusOK},
+		{Headers: quota, Code: http.StatusOK},
+	}...)
+	time.Sleep(recordsBufferFlushInterval + 50*time.Millisecond)
+	ts.Gw.analytics.Store.GetAndDeleteSet(analyticsKeyName)
+
+	ts.Gw.RedisController.DisableRedis(true)
+	assert.Eventually(t, ts.Gw.degradedMode.isActive, 5*time.Second, 10*time.Millisecond)
+	entered := <-events
+	assert.Equal(t, EventDegradedModeEntered, entered.Type)
+
+	ts.Run(t, []test.TestCase{
+		{Headers: rateLimited, Code: http.StatusOK},
+		{Headers: rateLimited, Code: http.StatusOK},
+		{Headers: rateLimited, Code: http.StatusTooManyRequests},
+		{Headers: quota, Code: http.StatusOK},
+		{Headers: quota, Code: http.StatusForbidden},
+		{Headers: map[string]string{headers.Authorization: "unknown"}, Code: http.StatusForbidden},
+	}...)
+
+	time.Sleep(recordsBufferFlushInterval + 50*time.Millisecond)
+	buffered, err := ts.Gw.degradedMode.buffer.LRange(degradedAnalyticsPrefix+analyticsKeyName, 0, -1)
+	require.NoError(t, err)
+	assert.Len(t, buffered, 6, "analytics records are buffered")
+
+	ts.Gw.RedisController.DisableRedis(false)
+	assert.Eventually(t, func() bool { return !ts.Gw.degradedMode.isActive() }, 5*time.Second, 10*time.Millisecond)
+	left := <-events
+	assert.Equal(t, EventDegradedModeLeft, left.Type)
+	assert.Equal(t, entered.Meta.(EventDegradedModeMeta).Since, left.Meta.(EventDegradedModeMeta).Since)
+
+	assert.Len(t, ts.Gw.analytics.Store.GetAndDeleteSet(analyticsKeyName), 6, "buffered records are written to Redis")
+	// the buffered quota increments count in Redis
+	ts.Run(t, test.TestCase{Headers: quota, Code: http.StatusForbidden})
+}
+
+func TestDegradedModeQuota(t *testing.T) {
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.DegradedMode.Enabled = true
+		globalConf.DegradedMode.BufferPath = filepath.Join(t.TempDir(), "degraded.db")
+	})
+	defer ts.Close()
+	d := ts.Gw.degradedMode
+
+	renews := time.Now().Add(time.Hour).Unix()
+	limit := &user.APILimit{QuotaMax: 10, QuotaRenews: renews, QuotaRenewalRate: 60}
+	assert.Equal(t, int64(1), d.incrementQuota("quota-k1", limit))
+	d.countQuota("quota-k1", 6, limit)
+	assert.Equal(t, int64(8), d.incrementQuota("quota-k1", limit), "counted from the count read from Redis")
+	ttl, _ := d.buffer.TTL("quota-k1")
+	assert.Equal(t, time.Minute, ttl)
+
+	limit.QuotaRenews = time.Now().Add(-time.Hour).Unix()
+	d.countQuota("quota-k1", 6, limit)
+	assert.Equal(t, int64(3), d.incrementQuota("quota-k1", limit), "the quota renewed")
+
+	d.reconcile()
+	exists, _ := d.buffer.Exists("quota-k1")
+	assert.False(t, exists)
+	value, err := d.store.GetRawKey("quota-k1")
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+}
@@ -72,7 +72,7 @@ func (w *WebHookHandler) Init(handlerConf interface{}) error {
 		return err
 	}
 
-	w.store = &storage.RedisCluster{KeyPrefix: "webhook.cache.", RedisController: w.Gw.RedisController}
+	w.store = w.Gw.newStore(storage.StoreOptions{KeyPrefix: "webhook.cache."})
 	w.store.Connect()
 
 	// Pre-load template on init
@@ -34,6 +34,11 @@ const (
 	EventTokenCreated         apidef.TykEvent = "TokenCreated"
 	EventTokenUpdated         apidef.TykEvent = "TokenUpdated"
 	EventTokenDeleted         apidef.TykEvent = "TokenDeleted"
+	EventRotatedKeyUsed       apidef.TykEvent = "RotatedKeyUsed"
+	EventSLOFastBurn          apidef.TykEvent = "SLOFastBurn"
+	EventSLOSlowBurn          apidef.TykEvent = "SLOSlowBurn"
+	EventDegradedModeEntered  apidef.TykEvent = "DegradedModeEntered"
+	EventDegradedModeLeft     apidef.TykEvent = "DegradedModeLeft"
 )
 
 // EventMetaDefault is a standard embedded struct to be used with custom event metadata types, gives an interface for
@@ -57,6 +62,17 @@ type EventKeyFailureMeta struct {
 	Key    string
 }
 
+// EventRotatedKeyMeta is the metadata structure for the use of a rotated
+// key during its grace period (EventRotatedKeyUsed).
+type EventRotatedKeyMeta struct {
+	EventMetaDefault
+	Path          string
+	Origin        string
+	Key           string
+	SuccessorHash string
+	Expires       int64
+}
+
 // EventCurcuitBreakerMeta is the event status for a circuit breaker tripping
 type EventCurcuitBreakerMeta struct {
 	EventMetaDefault
@@ -82,6 +98,30 @@ type EventTriggerExceededMeta struct {
 	UsagePercentage int64  `json:"usage_percentage"`
 }
 
+// EventSLOBurnMeta is the metadata structure for the error budget of an SLO
+// objective burning too quickly (EventSLOFastBurn and EventSLOSlowBurn).
+type EventSLOBurnMeta struct {
+	EventMetaDefault
+	APIID         string
+	Objective     string
+	Target        float64
+	LongWindow    int64
+	ShortWindow   int64
+	Threshold     float64
+	LongBurnRate  float64
+	ShortBurnRate float64
+}
+
+// EventDegradedModeMeta is the metadata structure for the Gateway entering and
+// leaving degraded mode (EventDegradedModeEntered and EventDegradedModeLeft).
+type EventDegradedModeMeta struct {
+	EventMetaDefault
+	// Since is when Redis became unreachable, as a Unix timestamp
+	Since int64
+	// Duration is how long the Gateway was in degraded mode, in seconds
+	Duration int64
+}
+
 type EventTokenMeta struct {
 	EventMetaDefault
 	Org string
@@ -0,0 +1,238 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const defaultFileWatchDebounce = 500 * time.Millisecond
+
+var fileWatchLog = log.WithField("prefix", "file-watch")
+
+// watchedFiles keeps the last good version of every watched API definition
+// and policy file. Loaders read a file through open, which serves its last
+// good version while the file on disk is broken.
+type watchedFiles struct {
+	mu       sync.RWMutex
+	dirs     map[string]func(string, []byte) error
+	lastGood map[string][]byte
+	broken   map[string]string
+}
+
+func newWatchedFiles() *watchedFiles {
+	return &watchedFiles{
+		dirs:     make(map[string]func(string, []byte) error),
+		lastGood: make(map[string][]byte),
+		broken:   make(map[string]string),
+	}
+}
+
+// watch adds the JSON files of dir, which are checked with validate.
+func (w *watchedFiles) watch(dir string, validate func(string, []byte) error) {
+	w.mu.Lock()
+	w.dirs[filepath.Clean(dir)] = validate
+	w.mu.Unlock()
+}
+
+// open opens the file at path, or returns its last good version when the
+// file is broken. It is safe to call on a nil *watchedFiles.
+func (w *watchedFiles) open(path string) (io.ReadCloser, error) {
+	if w != nil {
+		w.mu.RLock()
+		reason, broken := w.broken[path]
+		data, good := w.lastGood[path]
+		w.mu.RUnlock()
+
+		if broken {
+			if !good {
+				return nil, fmt.Errorf("%s is broken: %s", path, reason)
+			}
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+
+	return os.Open(path)
+}
+
+// scan reads and validates the files of the watched directories, and
+// reports whether any of them changed since the last scan.
+func (w *watchedFiles) scan() (changed bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for dir, validate := range w.dirs {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		for _, path := range paths {
+			seen[path] = true
+
+			data, err := ioutil.ReadFile(path)
+			if err == nil {
+				err = validate(path, data)
+			}
+
+			if err != nil {
+				if w.broken[path] != err.Error() {
+					fileWatchLog.WithError(err).WithField("file", path).
+						Error("Couldn't load file, keeping its last good version")
+					w.broken[path] = err.Error()
+					changed = true
+				}
+				continue
+			}
+
+			if _, broken := w.broken[path]; broken {
+				fileWatchLog.WithField("file", path).Info("File has been fixed")
+				delete(w.broken, path)
+				changed = true
+			}
+
+			if prev, ok := w.lastGood[path]; !ok || !bytes.Equal(prev, data) {
+				w.lastGood[path] = data
+				changed = true
+			}
+		}
+	}
+
+	for path := range w.lastGood {
+		if !seen[path] {
+			delete(w.lastGood, path)
+			changed = true
+		}
+	}
+	for path := range w.broken {
+		if !seen[path] {
+			delete(w.broken, path)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// validateAPIFile checks an API definition file, or the OAS document which
+// goes with one, before it is loaded.
+func validateAPIFile(path string, data []byte) error {
+	if strings.HasSuffix(path, "-oas.json") {
+		var oas openapi3.Swagger
+		return json.Unmarshal(data, &oas)
+	}
+
+	var def apidef.APIDefinition
+	if err := json.Unmarshal(data, &def); err != nil {
+		return err
+	}
+
+	return (&APISpec{APIDefinition: &def}).Validate()
+}
+
+func validatePolicyFile(_ string, data []byte) error {
+	var pol user.Policy
+	return json.Unmarshal(data, &pol)
+}
+
+// getWatchedFiles returns the watched files, nil when the files aren't watched.
+func (gw *Gateway) getWatchedFiles() *watchedFiles {
+	files, _ := gw.watchedFiles.Load().(*watchedFiles)
+	return files
+}
+
+// startFileWatch starts watching the API definition and policy directories
+// when they are loaded from files.
+func (gw *Gateway) startFileWatch(ctx context.Context) {
+	conf := gw.GetConfig()
+	files := newWatchedFiles()
+	var dirs []string
+
+	if !conf.UseDBAppConfigs && !conf.SlaveOptions.UseRPC && conf.AppPath != "" {
+		files.watch(conf.AppPath, validateAPIFile)
+		dirs = append(dirs, conf.AppPath)
+	}
+
+	switch conf.Policies.PolicySource {
+	case "service", "rpc":
+	default:
+		if conf.Policies.PolicyPath != "" {
+			files.watch(conf.Policies.PolicyPath, validatePolicyFile)
+			dirs = append(dirs, conf.Policies.PolicyPath)
+		}
+	}
+
+	if len(dirs) == 0 {
+		fileWatchLog.Warning("Nothing to watch, APIs and policies aren't loaded from files")
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fileWatchLog.WithError(err).Error("Couldn't start watching files")
+		return
+	}
+
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			fileWatchLog.WithError(err).WithField("dir", dir).Error("Couldn't watch directory")
+		}
+	}
+
+	files.scan()
+	gw.watchedFiles.Store(files)
+
+	debounce := defaultFileWatchDebounce
+	if conf.FileWatch.Debounce > 0 {
+		debounce = time.Duration(conf.FileWatch.Debounce) * time.Millisecond
+	}
+
+	go gw.watchFiles(ctx, watcher, files, debounce)
+}
+
+// watchFiles reloads the APIs and policies once the watched directories
+// haven't changed for the debounce duration. Any change is considered, as
+// Kubernetes updates mounted ConfigMaps by swapping a symlink.
+func (gw *Gateway) watchFiles(ctx context.Context, watcher *fsnotify.Watcher, files *watchedFiles, debounce time.Duration) {
+	defer watcher.Close()
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			fileWatchLog.WithFields(logrus.Fields{
+				"file": event.Name,
+				"op":   event.Op.String(),
+			}).Debug("File changed")
+			settled = time.After(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			fileWatchLog.WithError(err).Error("Error while watching files")
+		case <-settled:
+			settled = nil
+			if files.scan() {
+				fileWatchLog.Info("Files changed, reloading")
+				gw.reloadURLStructure(nil)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "api.json")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := newWatchedFiles()
+	files.watch(dir, validateAPIFile)
+	open := func() string {
+		f, err := files.open(path)
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		data, _ := ioutil.ReadAll(f)
+		return string(data)
+	}
+
+	good := `{"api_id": "1", "proxy": {"listen_path": "/"}}`
+	write(good)
+	assert.True(t, files.scan())
+	assert.False(t, files.scan(), "nothing changed")
+	assert.Equal(t, good, open())
+
+	write(`{"api_id": "1", `)
+	assert.True(t, files.scan())
+	assert.Equal(t, good, open(), "last good version is kept")
+
+	write(`{"api_id": "1", "protocol": "tcp"}`)
+	assert.True(t, files.scan())
+	assert.Equal(t, good, open(), "invalid definition")
+
+	fixed := `{"api_id": "1", "proxy": {"listen_path": "/fixed"}}`
+	write(fixed)
+	assert.True(t, files.scan())
+	assert.Equal(t, fixed, open())
+
+	os.Remove(path)
+	assert.True(t, files.scan())
+	assert.Empty(t, files.lastGood)
+
+	write(`{`)
+	assert.True(t, files.scan())
+	assert.Equal(t, "", open(), "broken without a good version")
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	files := newWatchedFiles()
+	files.watch(dir, validateAPIFile)
+	files.scan()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gw := &Gateway{reloadQueue: make(chan func())}
+	go gw.watchFiles(ctx, watcher, files, 50*time.Millisecond)
+
+	reloaded := func() bool {
+		select {
+		case <-gw.reloadQueue:
+			return true
+		case <-time.After(500 * time.Millisecond):
+			return false
+		}
+	}
+
+	path := filepath.Join(dir, "api.json")
+	for i := 0; i < 3; i++ {
+		ioutil.WriteFile(path, []byte(`{"api_id": "1", "proxy": {"listen_path": "/"}}`), 0644)
+	}
+	assert.True(t, reloaded())
+	assert.False(t, reloaded(), "changes are debounced")
+
+	ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644)
+	assert.False(t, reloaded(), "no watched file changed")
+}
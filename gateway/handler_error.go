@@ -122,6 +122,16 @@ type TemplateExecutor interface {
 // HandleError is the actual error handler and will store the error details in analytics if analytics processing is enabled.
 func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMsg string, errCode int, writeResponse bool) {
 	defer e.Base().UpdateRequestSession(r)
+	e.Gw.prometheus.observeRequest(e.Spec, r, errCode, 0, 0)
+	total := requestLatency(r, 0)
+	e.Gw.realtimeStats.record(e.Spec, r, errCode, total)
+	e.Gw.sloTracker.record(e.Spec, errCode, total)
+	if debugTrace := ctxGetDebugTrace(r); debugTrace != nil {
+		debugTrace.setStatus(errCode)
+	}
+	if e.Gw.accessLog.enabled(e.Spec) {
+		e.Gw.accessLog.logRequest(e.Spec, r, errCode, Latency{Total: int64(total / time.Millisecond)}, nil)
+	}
 	response := &http.Response{}
 
 	if writeResponse {
@@ -115,6 +115,15 @@ func getSessionTags(session *user.SessionState) []string {
 }
 
 func (s *SuccessHandler) RecordHit(r *http.Request, timing Latency, code int, responseCopy *http.Response) {
+	total := requestLatency(r, time.Duration(timing.Total)*time.Millisecond)
+	s.Gw.realtimeStats.record(s.Spec, r, code, total)
+	s.Gw.sloTracker.record(s.Spec, code, total)
+	if debugTrace := ctxGetDebugTrace(r); debugTrace != nil {
+		debugTrace.setStatus(code)
+	}
+	if s.Gw.accessLog.enabled(s.Spec) {
+		s.Gw.accessLog.logRequest(s.Spec, r, code, Latency{Total: int64(total / time.Millisecond), Upstream: timing.Upstream}, responseCopy)
+	}
 
 	if s.Spec.DoNotTrack || ctxGetDoNotTrack(r) {
 		return
@@ -305,17 +314,25 @@ func (s *SuccessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) *http
 
 	addVersionHeader(w, r, s.Spec.GlobalConfig)
 
+	timing := &upstreamTiming{}
+	ctxSetUpstreamTiming(r, timing)
+
 	t1 := time.Now()
 	resp := s.Proxy.ServeHTTP(w, r)
 
-	millisec := DurationToMillisecond(time.Since(t1))
+	elapsed := time.Since(t1)
+	millisec := DurationToMillisecond(elapsed)
 	log.Debug("Upstream request took (ms): ", millisec)
 
 	if resp.Response != nil {
+		s.Gw.prometheus.observeRequest(s.Spec, r, resp.Response.StatusCode, elapsed, resp.UpstreamLatency)
+		s.Gw.prometheus.observeUpstreamTiming(s.Spec, r, resp.Response.StatusCode, timing)
+
 		latency := Latency{
 			Total:    int64(millisec),
 			Upstream: int64(DurationToMillisecond(resp.UpstreamLatency)),
 		}
+		timing.setLatency(&latency)
 		s.RecordHit(r, latency, resp.Response.StatusCode, resp.Response)
 	}
 	log.Debug("Done proxy")
@@ -330,19 +347,27 @@ func (s *SuccessHandler) ServeHTTPWithCache(w http.ResponseWriter, r *http.Reque
 	// Make sure we get the correct target URL
 	s.Spec.SanitizeProxyPaths(r)
 
+	timing := &upstreamTiming{}
+	ctxSetUpstreamTiming(r, timing)
+
 	t1 := time.Now()
 	inRes := s.Proxy.ServeHTTPForCache(w, r)
-	millisec := DurationToMillisecond(time.Since(t1))
+	elapsed := time.Since(t1)
+	millisec := DurationToMillisecond(elapsed)
 
 	addVersionHeader(w, r, s.Spec.GlobalConfig)
 
 	log.Debug("Upstream request took (ms): ", millisec)
 
 	if inRes.Response != nil {
+		s.Gw.prometheus.observeRequest(s.Spec, r, inRes.Response.StatusCode, elapsed, inRes.UpstreamLatency)
+		s.Gw.prometheus.observeUpstreamTiming(s.Spec, r, inRes.Response.StatusCode, timing)
+
 		latency := Latency{
 			Total:    int64(millisec),
 			Upstream: int64(DurationToMillisecond(inRes.UpstreamLatency)),
 		}
+		timing.setLatency(&latency)
 		s.RecordHit(r, latency, inRes.Response.StatusCode, inRes.Response)
 	}
 
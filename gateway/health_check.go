@@ -93,7 +93,7 @@ type SafeHealthCheck struct {
 func (gw *Gateway) gatherHealthChecks() {
 	allInfos := SafeHealthCheck{info: make(map[string]HealthCheckItem, 3)}
 
-	redisStore := storage.RedisCluster{KeyPrefix: "livenesscheck-", RedisController: gw.RedisController}
+	redisStore := gw.newStore(storage.StoreOptions{KeyPrefix: "livenesscheck-"})
 
 	key := "tyk-liveness-probe"
 
@@ -0,0 +1,350 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/rpc"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// HealthProbeKind is the endpoint a health probe is reported on.
+type HealthProbeKind string
+
+const (
+	LivenessProbe  HealthProbeKind = "liveness"
+	ReadinessProbe HealthProbeKind = "readiness"
+	StartupProbe   HealthProbeKind = "startup"
+)
+
+const (
+	defaultLivenessEndpointName  = "live"
+	defaultReadinessEndpointName = "ready"
+	defaultStartupEndpointName   = "startup"
+	defaultRedisLatencyWarn      = 100
+	defaultRedisLatencyFail      = 1000
+	defaultAnalyticsBacklogWarn  = 80
+	defaultAnalyticsBacklogFail  = 100
+
+	healthProbeAPIs      = "apis"
+	healthProbeRedis     = "redis"
+	healthProbeRPC       = "rpc"
+	healthProbeBundles   = "bundles"
+	healthProbeAnalytics = "analytics"
+)
+
+// HealthProbe checks the state of a dependency of the Gateway.
+type HealthProbe interface {
+	// Name identifies the probe in the details of the responses.
+	Name() string
+	// Check returns the current state of the dependency.
+	Check() HealthCheckItem
+}
+
+// HealthProbeFunc adapts a function to a HealthProbe.
+type HealthProbeFunc struct {
+	ProbeName string
+	CheckFunc func() HealthCheckItem
+}
+
+func (p HealthProbeFunc) Name() string {
+	return p.ProbeName
+}
+
+func (p HealthProbeFunc) Check() HealthCheckItem {
+	return p.CheckFunc()
+}
+
+type healthProbes struct {
+	mu     sync.RWMutex
+	probes map[HealthProbeKind][]HealthProbe
+}
+
+// AddHealthProbe adds a probe to the liveness, readiness or startup endpoint.
+func (gw *Gateway) AddHealthProbe(kind HealthProbeKind, probe HealthProbe) {
+	if gw.healthProbes == nil {
+		return
+	}
+	gw.healthProbes.mu.Lock()
+	defer gw.healthProbes.mu.Unlock()
+	gw.healthProbes.probes[kind] = append(gw.healthProbes.probes[kind], probe)
+}
+
+func (gw *Gateway) setupHealthProbes() {
+	conf := gw.GetConfig().HealthProbes
+	if !conf.Enabled {
+		gw.healthProbes = nil
+		return
+	}
+
+	gw.healthProbes = &healthProbes{probes: make(map[HealthProbeKind][]HealthProbe)}
+
+	disabled := make(map[string]bool, len(conf.DisabledProbes))
+	for _, name := range conf.DisabledProbes {
+		disabled[name] = true
+	}
+	add := func(name string, check func() HealthCheckItem, kinds ...HealthProbeKind) {
+		if disabled[name] {
+			return
+		}
+		for _, kind := range kinds {
+			gw.AddHealthProbe(kind, HealthProbeFunc{ProbeName: name, CheckFunc: check})
+		}
+	}
+
+	add(healthProbeAPIs, gw.checkAPIsLoaded, StartupProbe, ReadinessProbe)
+	add(healthProbeRedis, gw.checkRedisLatency, ReadinessProbe)
+	if gw.GetConfig().SlaveOptions.UseRPC {
+		add(healthProbeRPC, gw.checkRPCConnection, ReadinessProbe)
+	}
+	add(healthProbeBundles, gw.checkBundles, ReadinessProbe)
+	if gw.GetConfig().EnableAnalytics {
+		add(healthProbeAnalytics, gw.checkAnalyticsBacklog, ReadinessProbe)
+	}
+}
+
+// run checks all the probes of a kind concurrently.
+func (h *healthProbes) run(kind HealthProbeKind) map[string]HealthCheckItem {
+	h.mu.RLock()
+	probes := h.probes[kind]
+	h.mu.RUnlock()
+
+	items := SafeHealthCheck{info: make(map[string]HealthCheckItem, len(probes))}
+	var wg sync.WaitGroup
+	for _, probe := range probes {
+		wg.Add(1)
+		go func(probe HealthProbe) {
+			defer wg.Done()
+			item := probe.Check()
+			if item.Time == "" {
+				item.Time = time.Now().Format(time.RFC3339)
+			}
+
+			items.mux.Lock()
+			items.info[probe.Name()] = item
+			items.mux.Unlock()
+		}(probe)
+	}
+	wg.Wait()
+
+	return items.info
+}
+
+func (gw *Gateway) healthProbeHandler(kind HealthProbeKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			doJSONWrite(w, http.StatusMethodNotAllowed, apiError(http.StatusText(http.StatusMethodNotAllowed)))
+			return
+		}
+
+		res := HealthCheckResponse{
+			Status:      Pass,
+			Version:     VERSION,
+			Description: "Tyk GW " + string(kind),
+			Details:     gw.healthProbes.run(kind),
+		}
+
+		var degraded []string
+		for name, item := range res.Details {
+			switch item.Status {
+			case Fail:
+				res.Status = Fail
+			case Warn:
+				if res.Status == Pass {
+					res.Status = Warn
+				}
+			default:
+				continue
+			}
+			degraded = append(degraded, name)
+		}
+		if len(degraded) > 0 {
+			sort.Strings(degraded)
+			res.Output = "degraded probes: " + strings.Join(degraded, ", ")
+		}
+
+		code := http.StatusOK
+		if res.Status == Fail {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", headers.ApplicationJSON)
+		if !gw.GetConfig().HideGeneratorHeader {
+			addMascotHeaders(w)
+		}
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+func (gw *Gateway) loadHealthProbeEndpoints(muxer *mux.Router) {
+	if gw.healthProbes == nil {
+		return
+	}
+	conf := gw.GetConfig().HealthProbes
+
+	endpoint := func(name, defaultName string) string {
+		if name == "" {
+			name = defaultName
+		}
+		return "/" + name
+	}
+
+	muxer.HandleFunc(endpoint(conf.LivenessEndpointName, defaultLivenessEndpointName), gw.healthProbeHandler(LivenessProbe))
+	muxer.HandleFunc(endpoint(conf.ReadinessEndpointName, defaultReadinessEndpointName), gw.healthProbeHandler(ReadinessProbe))
+	muxer.HandleFunc(endpoint(conf.StartupEndpointName, defaultStartupEndpointName), gw.healthProbeHandler(StartupProbe))
+}
+
+// apiLoadState records the completion of API loads and the plugin bundles
+// which couldn't be fetched during the last one.
+type apiLoadState struct {
+	mu            sync.RWMutex
+	loadedAt      time.Time
+	loadedAPIs    int
+	bundleFailure map[string]string
+}
+
+func (s *apiLoadState) reset() {
+	s.mu.Lock()
+	s.bundleFailure = nil
+	s.mu.Unlock()
+}
+
+func (s *apiLoadState) bundleFailed(apiID string, err error) {
+	s.mu.Lock()
+	if s.bundleFailure == nil {
+		s.bundleFailure = make(map[string]string)
+	}
+	s.bundleFailure[apiID] = err.Error()
+	s.mu.Unlock()
+}
+
+func (s *apiLoadState) hasBundleFailure(apiID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.bundleFailure[apiID]
+	return ok
+}
+
+func (s *apiLoadState) loaded(count int) {
+	s.mu.Lock()
+	s.loadedAt = time.Now()
+	s.loadedAPIs = count
+	s.mu.Unlock()
+}
+
+func (gw *Gateway) checkAPIsLoaded() HealthCheckItem {
+	gw.apiLoadState.mu.RLock()
+	defer gw.apiLoadState.mu.RUnlock()
+
+	item := HealthCheckItem{Status: Pass, ComponentType: System}
+	if gw.apiLoadState.loadedAt.IsZero() {
+		item.Status = Fail
+		item.Output = "APIs have not been loaded yet"
+		return item
+	}
+	item.Output = fmt.Sprintf("%d APIs loaded at %s", gw.apiLoadState.loadedAPIs, gw.apiLoadState.loadedAt.Format(time.RFC3339))
+	return item
+}
+
+func (gw *Gateway) checkBundles() HealthCheckItem {
+	gw.apiLoadState.mu.RLock()
+	defer gw.apiLoadState.mu.RUnlock()
+
+	item := HealthCheckItem{Status: Pass, ComponentType: string(Component)}
+	if len(gw.apiLoadState.bundleFailure) == 0 {
+		return item
+	}
+
+	failures := make([]string, 0, len(gw.apiLoadState.bundleFailure))
+	for apiID, err := range gw.apiLoadState.bundleFailure {
+		failures = append(failures, apiID+": "+err)
+	}
+	sort.Strings(failures)
+
+	item.Status = Warn
+	if gw.GetConfig().HealthProbes.FailOnBundleErrors {
+		item.Status = Fail
+	}
+	item.Output = "couldn't fetch bundles of APIs " + strings.Join(failures, "; ")
+	return item
+}
+
+func (gw *Gateway) checkRedisLatency() HealthCheckItem {
+	conf := gw.GetConfig().HealthProbes
+	warn, fail := conf.RedisLatencyWarn, conf.RedisLatencyFail
+	if warn <= 0 {
+		warn = defaultRedisLatencyWarn
+	}
+	if fail <= 0 {
+		fail = defaultRedisLatencyFail
+	}
+
+	item := HealthCheckItem{Status: Pass, ComponentType: Datastore}
+	store := gw.newStore(storage.StoreOptions{KeyPrefix: "livenesscheck-"})
+
+	start := time.Now()
+	err := store.SetRawKey("tyk-readiness-probe", "tyk-readiness-probe", 10)
+	latency := int64(time.Since(start) / time.Millisecond)
+
+	switch {
+	case err != nil:
+		item.Status = Fail
+		item.Output = err.Error()
+		return item
+	case latency >= fail:
+		item.Status = Fail
+	case latency >= warn:
+		item.Status = Warn
+	}
+	item.Output = fmt.Sprintf("latency %dms", latency)
+	return item
+}
+
+func (gw *Gateway) checkRPCConnection() HealthCheckItem {
+	item := HealthCheckItem{Status: Pass, ComponentType: System}
+	switch {
+	case rpc.IsEmergencyMode():
+		item.Status = Warn
+		item.Output = "MDCB unreachable, serving from the last backup"
+	case !rpc.IsConnected():
+		item.Status = Fail
+		item.Output = "not connected to MDCB"
+	}
+	return item
+}
+
+func (gw *Gateway) checkAnalyticsBacklog() HealthCheckItem {
+	conf := gw.GetConfig().HealthProbes
+	warn, fail := conf.AnalyticsBacklogWarn, conf.AnalyticsBacklogFail
+	if warn <= 0 {
+		warn = defaultAnalyticsBacklogWarn
+	}
+	if fail <= 0 {
+		fail = defaultAnalyticsBacklogFail
+	}
+
+	item := HealthCheckItem{Status: Pass, ComponentType: string(Component)}
+	records, size := gw.analytics.bufferUsage()
+	if size == 0 {
+		return item
+	}
+
+	usage := records * 100 / size
+	switch {
+	case usage >= fail:
+		item.Status = Fail
+	case usage >= warn:
+		item.Status = Warn
+	}
+	item.Output = fmt.Sprintf("%d of %d buffered records", records, size)
+	return item
+}
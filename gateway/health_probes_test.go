@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestHealthProbes(t *testing.T) {
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.HealthProbes.Enabled = true
+		globalConf.HealthProbes.DisabledProbes = []string{healthProbeAnalytics}
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI()
+
+	decode := func(res *HealthCheckResponse) func([]byte) bool {
+		return func(body []byte) bool {
+			return json.Unmarshal(body, res) == nil
+		}
+	}
+
+	var ready, startup HealthCheckResponse
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/live", Code: http.StatusOK, BodyMatch: `"status":"pass"`},
+		{Path: "/ready", Code: http.StatusOK, BodyMatchFunc: decode(&ready)},
+		{Path: "/startup", Code: http.StatusOK, BodyMatchFunc: decode(&startup)},
+		{Method: http.MethodPost, Path: "/ready", Code: http.StatusMethodNotAllowed},
+	}...)
+
+	if ready.Status != Pass || ready.Details[healthProbeAPIs].Status != Pass || ready.Details[healthProbeRedis].Status != Pass {
+		t.Errorf("unexpected readiness %+v", ready)
+	}
+	if _, ok := ready.Details[healthProbeAnalytics]; ok {
+		t.Error("expected the disabled probe not to run")
+	}
+	if len(startup.Details) != 1 || startup.Details[healthProbeAPIs].Status != Pass {
+		t.Errorf("unexpected startup %+v", startup)
+	}
+
+	t.Run("bundle failure", func(t *testing.T) {
+		ts.Gw.apiLoadState.bundleFailed("api", errors.New("not found"))
+		defer ts.Gw.apiLoadState.reset()
+
+		_, _ = ts.Run(t, test.TestCase{
+			Path: "/ready", Code: http.StatusOK,
+			BodyMatch: `"status":"warn",.*"output":"degraded probes: bundles"`,
+		})
+	})
+
+	t.Run("custom probe", func(t *testing.T) {
+		ts.Gw.AddHealthProbe(LivenessProbe, HealthProbeFunc{
+			ProbeName: "custom",
+			CheckFunc: func() HealthCheckItem {
+				return HealthCheckItem{Status: Fail, Output: "broken"}
+			},
+		})
+
+		_, _ = ts.Run(t, test.TestCase{
+			Path: "/live", Code: http.StatusServiceUnavailable,
+			BodyMatch: `"custom":\{"status":"fail","output":"broken"`,
+		})
+	})
+}
+
+func TestHealthProbesAPIsNotLoaded(t *testing.T) {
+	gw := &Gateway{}
+	if item := gw.checkAPIsLoaded(); item.Status != Fail {
+		t.Errorf("expected the APIs probe to fail before the first load, got %+v", item)
+	}
+
+	gw.apiLoadState.loaded(2)
+	if item := gw.checkAPIsLoaded(); item.Status != Pass {
+		t.Errorf("expected the APIs probe to pass, got %+v", item)
+	}
+}
@@ -221,6 +221,22 @@ func (hc *HostCheckerManager) StopPoller() {
 	hc.checkerMu.Unlock()
 }
 
+// hostCounts returns the number of monitored hosts and how many of them are down.
+func (hc *HostCheckerManager) hostCounts() (hosts, unhealthy int) {
+	hc.checkerMu.Lock()
+	hosts = len(hc.currentHostList)
+	hc.checkerMu.Unlock()
+
+	if hc.unhealthyHostList != nil {
+		hc.unhealthyHostList.Range(func(_, _ interface{}) bool {
+			unhealthy++
+			return true
+		})
+	}
+
+	return hosts, unhealthy
+}
+
 func (hc *HostCheckerManager) getHostKey(report HostHealthReport) string {
 	return PoolerHostSentinelKeyPrefix + report.MetaData[UnHealthyHostMetaDataHostKey]
 }
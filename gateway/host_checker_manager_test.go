@@ -15,7 +15,7 @@ func TestHostCheckerManagerInit(t *testing.T) {
 	defer ts.Close()
 
 	hc := HostCheckerManager{Gw: ts.Gw}
-	redisStorage := &storage.RedisCluster{KeyPrefix: "host-checker-test:", RedisController: ts.Gw.RedisController}
+	redisStorage := ts.Gw.newStore(storage.StoreOptions{KeyPrefix: "host-checker-test:"})
 	hc.Init(redisStorage)
 
 	if hc.Id == "" {
@@ -46,7 +46,7 @@ func TestAmIPolling(t *testing.T) {
 	globalConf.UptimeTests.PollerGroup = groupID
 	ts.Gw.SetConfig(globalConf)
 
-	redisStorage := &storage.RedisCluster{KeyPrefix: "host-checker-test:", RedisController: ts.Gw.RedisController}
+	redisStorage := ts.Gw.newStore(storage.StoreOptions{KeyPrefix: "host-checker-test:"})
 	hc.Init(redisStorage)
 	hc2 := HostCheckerManager{Gw: ts.Gw}
 	hc2.Init(redisStorage)
@@ -75,7 +75,7 @@ func TestAmIPolling(t *testing.T) {
 
 	//Testing if the PollerCacheKey doesn't contains the poller_group by default
 	hc = HostCheckerManager{Gw: ts.Gw}
-	redisStorage = &storage.RedisCluster{KeyPrefix: "host-checker-test:", RedisController: ts.Gw.RedisController}
+	redisStorage = ts.Gw.newStore(storage.StoreOptions{KeyPrefix: "host-checker-test:"})
 	hc.Init(redisStorage)
 	hc.AmIPolling()
 
@@ -110,7 +110,7 @@ func TestCheckActivePollerLoop(t *testing.T) {
 	defer ts.Close()
 
 	hc := &HostCheckerManager{Gw: ts.Gw}
-	redisStorage := &storage.RedisCluster{KeyPrefix: "host-checker-test-1:", RedisController: ts.Gw.RedisController}
+	redisStorage := ts.Gw.newStore(storage.StoreOptions{KeyPrefix: "host-checker-test-1:"})
 	hc.Init(redisStorage)
 
 	go hc.CheckActivePollerLoop(ts.Gw.ctx)
@@ -130,7 +130,7 @@ func TestStartPoller(t *testing.T) {
 	defer ts.Close()
 
 	hc := HostCheckerManager{Gw: ts.Gw}
-	redisStorage := &storage.RedisCluster{KeyPrefix: "host-checker-TestStartPoller:", RedisController: ts.Gw.RedisController}
+	redisStorage := ts.Gw.newStore(storage.StoreOptions{KeyPrefix: "host-checker-TestStartPoller:"})
 	hc.Init(redisStorage)
 
 	hc.StartPoller(ts.Gw.ctx)
@@ -145,7 +145,7 @@ func TestRecordUptimeAnalytics(t *testing.T) {
 	defer ts.Close()
 	hc := &HostCheckerManager{Gw: ts.Gw}
 
-	redisStorage := &storage.RedisCluster{KeyPrefix: "host-checker-test-analytics:", RedisController: ts.Gw.RedisController}
+	redisStorage := ts.Gw.newStore(storage.StoreOptions{KeyPrefix: "host-checker-test-analytics:"})
 	hc.Init(redisStorage)
 
 	spec := &APISpec{}
@@ -16,7 +16,6 @@ import (
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
-	"github.com/TykTechnologies/tyk/storage"
 	proxyproto "github.com/pires/go-proxyproto"
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
@@ -166,8 +165,7 @@ func TestHostChecker(t *testing.T) {
 		t.Error("Should set defaults", ts.Gw.GlobalHostChecker.checker.checkTimeout)
 	}
 
-	redisStore := ts.Gw.GlobalHostChecker.store.(*storage.RedisCluster)
-	if ttl, _ := redisStore.GetKeyTTL(PoolerHostSentinelKeyPrefix + testHttpFailure); int(ttl) != ts.Gw.GlobalHostChecker.checker.checkTimeout*ts.Gw.GlobalHostChecker.checker.sampleTriggerLimit {
+	if ttl, _ := ts.Gw.GlobalHostChecker.store.GetExp(PoolerHostSentinelKeyPrefix + testHttpFailure); int(ttl) != ts.Gw.GlobalHostChecker.checker.checkTimeout*ts.Gw.GlobalHostChecker.checker.sampleTriggerLimit {
 		t.Error("HostDown expiration key should be checkTimeout + 1", ttl)
 	}
 	ts.Gw.GlobalHostChecker.checkerMu.Unlock()
@@ -0,0 +1,274 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+var keyIndexLog = log.WithField("prefix", "key-index")
+
+const (
+	// keyIndexPrefix is the prefix of the Redis keys of the key index
+	keyIndexPrefix = "keyindex-"
+
+	keyIndexAll      = "all"
+	keyIndexInactive = "inactive"
+	keyIndexOrg      = "org:"
+	keyIndexPolicy   = "policy:"
+	keyIndexTag      = "tag:"
+	keyIndexAlias    = "alias:"
+
+	// keyIndexEntry records the sets a key is in, so that it can be removed from them
+	keyIndexEntry = "entry:"
+
+	// keyIndexBuilt marks the index as holding all the keys, it expires after the reconcile interval
+	keyIndexBuilt = "built"
+	// keyIndexBuilding is the lock of the Gateway building the index
+	keyIndexBuilding = keyIndexPrefix + "building"
+
+	keyIndexBuildBatch = 1000
+
+	defaultKeyIndexReconcileInterval = 3600
+	keyIndexCheckInterval            = time.Minute
+)
+
+// keyIndex is a secondary index of the keys, made of sorted sets of key names per organisation, policy, tag,
+// alias and inactive flag. All the members have the same score, so the sets are paged in name order.
+type keyIndex struct {
+	store storage.Store
+	// reconcileInterval is how long the index is trusted after being built, in seconds
+	reconcileInterval int64
+}
+
+// keyScanner is implemented by the key stores which can be listed page by page.
+type keyScanner interface {
+	ScanKeys(filter, cursor string, count int64) ([]string, string, error)
+	GetRawMultiKey(keys []string) ([]string, error)
+}
+
+func (gw *Gateway) setupKeyIndex() {
+	gw.keyIndex = nil
+
+	conf := gw.GetConfig()
+	if !conf.KeyIndex.Enabled {
+		return
+	}
+	if conf.SlaveOptions.UseRPC {
+		keyIndexLog.Warning("The key index isn't available in RPC mode, key listings scan the key store")
+		return
+	}
+
+	interval := conf.KeyIndex.ReconcileInterval
+	if interval <= 0 {
+		interval = defaultKeyIndexReconcileInterval
+	}
+	gw.keyIndex = &keyIndex{
+		store:             gw.newStore(storage.StoreOptions{KeyPrefix: keyIndexPrefix}),
+		reconcileInterval: interval,
+	}
+	go gw.keyIndex.reconcile(gw.ctx, gw.RedisController, gw.GlobalSessionManager.Store())
+}
+
+// ready reports whether the index holds all the keys. It doesn't once the built marker expires, until the index is
+// rebuilt, since keys may have been written by Gateways with the index disabled or directly to the key store.
+func (i *keyIndex) ready() bool {
+	_, err := i.store.GetKey(keyIndexBuilt)
+	return err == nil
+}
+
+// reconcile rebuilds the index from store whenever it isn't ready, until ctx is done. A single Gateway rebuilds it
+// at a time.
+func (i *keyIndex) reconcile(ctx context.Context, rc *storage.RedisController, store storage.Handler) {
+	if !rc.WaitConnect(ctx) {
+		return
+	}
+
+	scanner, ok := store.(keyScanner)
+	if !ok {
+		keyIndexLog.Warning("The key store can't be scanned, the key index isn't built")
+		return
+	}
+
+	ticker := time.NewTicker(keyIndexCheckInterval)
+	defer ticker.Stop()
+	for {
+		if !i.ready() {
+			if locked, err := i.store.IncrementByWithExpire(keyIndexBuilding, 1, i.reconcileInterval); err == nil && locked == 1 {
+				i.build(ctx, scanner, store.GetKeyPrefix())
+				i.store.DeleteRawKey(keyIndexBuilding)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// build indexes the keys of scanner, stored with the given prefix, and marks the index as built.
+func (i *keyIndex) build(ctx context.Context, scanner keyScanner, prefix string) {
+	keyIndexLog.Info("Building the key index")
+	count := 0
+	cursor := ""
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		names, next, err := scanner.ScanKeys("", cursor, keyIndexBuildBatch)
+		if err != nil {
+			keyIndexLog.WithError(err).Error("Couldn't build the key index")
+			return
+		}
+
+		names = sessionKeyNames(names)
+		values, err := scanner.GetRawMultiKey(prefixKeyNames(prefix, names))
+		if err != nil {
+			keyIndexLog.WithError(err).Error("Couldn't build the key index")
+			return
+		}
+
+		for n, value := range values {
+			if session, ok := keyListSession(value); ok {
+				i.update(names[n], session)
+				count++
+			}
+		}
+
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+
+	if err := i.store.SetKey(keyIndexBuilt, "1", i.reconcileInterval); err != nil {
+		keyIndexLog.WithError(err).Error("Couldn't mark the key index as built")
+		return
+	}
+	keyIndexLog.Infof("Built the key index of %d keys", count)
+}
+
+// keyIndexSets returns the sets of the index a key with session belongs to.
+func keyIndexSets(session *user.SessionState) []string {
+	sets := []string{keyIndexAll}
+	add := func(set string) {
+		if !containsString(sets, set) {
+			sets = append(sets, set)
+		}
+	}
+
+	if session.OrgID != "" {
+		add(keyIndexOrg + session.OrgID)
+	}
+	for _, polID := range session.PolicyIDs() {
+		add(keyIndexPolicy + polID)
+	}
+	for _, tag := range session.Tags {
+		add(keyIndexTag + tag)
+	}
+	if session.Alias != "" {
+		add(keyIndexAlias + session.Alias)
+	}
+	if session.IsInactive {
+		add(keyIndexInactive)
+	}
+
+	return sets
+}
+
+// entry returns the sets a key was indexed in.
+func (i *keyIndex) entry(name string) []string {
+	value, err := i.store.GetKey(keyIndexEntry + name)
+	if err != nil {
+		return nil
+	}
+	var sets []string
+	json.Unmarshal([]byte(value), &sets)
+	return sets
+}
+
+// update indexes the key stored as name with session.
+func (i *keyIndex) update(name string, session *user.SessionState) {
+	sets := keyIndexSets(session)
+	indexed := i.entry(name)
+	if reflect.DeepEqual(indexed, sets) {
+		// Most session updates, such as those of the middleware, don't change the sets
+		return
+	}
+	for _, set := range indexed {
+		if !containsString(sets, set) {
+			i.store.RemoveFromSortedSet(set, name)
+		}
+	}
+	for _, set := range sets {
+		i.store.AddToSortedSet(set, name, 0)
+	}
+
+	data, _ := json.Marshal(sets)
+	if err := i.store.SetKey(keyIndexEntry+name, string(data), 0); err != nil {
+		keyIndexLog.WithError(err).Error("Couldn't index key")
+	}
+}
+
+// remove removes the key stored as name from the index.
+func (i *keyIndex) remove(name string) {
+	for _, set := range i.entry(name) {
+		i.store.RemoveFromSortedSet(set, name)
+	}
+	i.store.DeleteKey(keyIndexEntry + name)
+}
+
+// members returns up to count names of the keys of set after the given one.
+func (i *keyIndex) members(set, after string, count int64) ([]string, error) {
+	return i.store.GetSortedSetRangeByLex(set, after, count)
+}
+
+// indexKey updates the key index with a key stored with session.
+func (gw *Gateway) indexKey(keyName string, hashed bool, session *user.SessionState) {
+	if gw.keyIndex == nil {
+		return
+	}
+	gw.keyIndex.update(gw.storedKeyName(keyName, hashed), session)
+}
+
+// unindexKey removes a deleted key from the key index.
+func (gw *Gateway) unindexKey(keyName string, hashed bool) {
+	if gw.keyIndex == nil {
+		return
+	}
+	gw.keyIndex.remove(gw.storedKeyName(keyName, hashed))
+}
+
+// storedKeyName returns the name a key is stored under in the key store.
+func (gw *Gateway) storedKeyName(keyName string, hashed bool) string {
+	if hashed {
+		return keyName
+	}
+	return storage.HashKey(keyName, gw.GetConfig().HashKeys)
+}
+
+// sessionKeyNames filters out the quota and rate limit counters from key names.
+func sessionKeyNames(names []string) []string {
+	keys := names[:0]
+	for _, name := range names {
+		if !strings.HasPrefix(name, QuotaKeyPrefix) && !strings.HasPrefix(name, RateLimitKeyPrefix) {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+func prefixKeyNames(prefix string, names []string) []string {
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = prefix + name
+	}
+	return keys
+}
@@ -0,0 +1,318 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	defaultKeyListLimit = 100
+	maxKeyListLimit     = 1000
+
+	// maxKeyListExamined bounds the number of keys examined for one page, so
+	// that a page of a selective filter can be empty while keys remain.
+	maxKeyListExamined = 10000
+
+	keyListCursorScan  = "scan:"
+	keyListCursorIndex = "index:"
+)
+
+// keyListParams are the query parameters which make GET /tyk/keys return a page of keys.
+var keyListParams = []string{
+	"limit", "cursor", "policy_id", "org_id", "alias", "tag", "expires_after", "expires_before", "inactive",
+}
+
+var errInvalidKeyListCursor = errors.New("Invalid cursor")
+
+type apiKeysPage struct {
+	APIKeys    []string `json:"keys"`
+	NextCursor string   `json:"next_cursor"`
+}
+
+// keyListFilter selects the keys of a listing by their session.
+type keyListFilter struct {
+	prefix        string
+	policyID      string
+	orgID         string
+	alias         string
+	tag           string
+	expiresAfter  int64
+	expiresBefore int64
+	inactive      *bool
+}
+
+// keyListRequested reports whether a key listing asks for a page of keys rather than all of them.
+func keyListRequested(query url.Values) bool {
+	for _, param := range keyListParams {
+		if _, ok := query[param]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func parseKeyListFilter(query url.Values) (keyListFilter, error) {
+	f := keyListFilter{
+		prefix:   query.Get("filter"),
+		policyID: query.Get("policy_id"),
+		orgID:    query.Get("org_id"),
+		alias:    query.Get("alias"),
+		tag:      query.Get("tag"),
+	}
+
+	var err error
+	if v := query.Get("expires_after"); v != "" {
+		if f.expiresAfter, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, errors.New("expires_after must be a Unix timestamp")
+		}
+	}
+	if v := query.Get("expires_before"); v != "" {
+		if f.expiresBefore, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, errors.New("expires_before must be a Unix timestamp")
+		}
+	}
+	if v := query.Get("inactive"); v != "" {
+		inactive, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, errors.New("inactive must be true or false")
+		}
+		f.inactive = &inactive
+	}
+
+	return f, nil
+}
+
+// matches reports whether the key stored as name with session is selected by
+// the filter. Keys which never expire are after any expiry, and before none.
+func (f keyListFilter) matches(name string, session *user.SessionState) bool {
+	switch {
+	case f.prefix != "" && !strings.HasPrefix(name, f.prefix):
+		return false
+	case f.orgID != "" && session.OrgID != f.orgID:
+		return false
+	case f.policyID != "" && !containsString(session.PolicyIDs(), f.policyID):
+		return false
+	case f.alias != "" && session.Alias != f.alias:
+		return false
+	case f.tag != "" && !containsString(session.Tags, f.tag):
+		return false
+	case f.inactive != nil && session.IsInactive != *f.inactive:
+		return false
+	}
+
+	never := session.Expires <= 0
+	if f.expiresAfter != 0 && !never && session.Expires <= f.expiresAfter {
+		return false
+	}
+	if f.expiresBefore != 0 && (never || session.Expires >= f.expiresBefore) {
+		return false
+	}
+
+	return true
+}
+
+// indexSet returns the set of the key index holding the keys selected by the filter.
+func (f keyListFilter) indexSet() string {
+	switch {
+	case f.alias != "":
+		return keyIndexAlias + f.alias
+	case f.policyID != "":
+		return keyIndexPolicy + f.policyID
+	case f.tag != "":
+		return keyIndexTag + f.tag
+	case f.orgID != "":
+		return keyIndexOrg + f.orgID
+	case f.inactive != nil && *f.inactive:
+		return keyIndexInactive
+	}
+	return keyIndexAll
+}
+
+// encodeKeyListCursor makes an opaque cursor of the position of a scan or
+// of the last key name of an index page, which is empty at the end.
+func encodeKeyListCursor(kind, position string) string {
+	if position == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(kind + position))
+}
+
+func decodeKeyListCursor(cursor string) (kind, position string, err error) {
+	if cursor == "" {
+		return "", "", nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", errInvalidKeyListCursor
+	}
+	for _, kind := range []string{keyListCursorScan, keyListCursorIndex} {
+		if position := strings.TrimPrefix(string(data), kind); position != string(data) && position != "" {
+			return kind, position, nil
+		}
+	}
+	return "", "", errInvalidKeyListCursor
+}
+
+// handleGetKeysPage returns a page of the keys selected by the query, read
+// from the key index when it is built, and by scanning the key store otherwise.
+func (gw *Gateway) handleGetKeysPage(query url.Values, hashed bool) (interface{}, int) {
+	filter, err := parseKeyListFilter(query)
+	if err != nil {
+		return apiError(err.Error()), http.StatusBadRequest
+	}
+	if hashed {
+		// as for the full listing, names of hashed keys aren't filtered
+		filter.prefix = ""
+	}
+
+	limit := defaultKeyListLimit
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			return apiError("limit must be a positive number"), http.StatusBadRequest
+		}
+		if limit > maxKeyListLimit {
+			limit = maxKeyListLimit
+		}
+	}
+
+	kind, position, err := decodeKeyListCursor(query.Get("cursor"))
+	if err != nil {
+		return apiError(err.Error()), http.StatusBadRequest
+	}
+
+	store := gw.GlobalSessionManager.Store()
+	scanner, ok := store.(keyScanner)
+	if !ok {
+		return apiError("Key listing pages aren't supported by the key store"), http.StatusNotImplemented
+	}
+
+	useIndex := gw.keyIndex != nil && gw.keyIndex.ready()
+	if kind == keyListCursorIndex && !useIndex {
+		return apiError(errInvalidKeyListCursor.Error()), http.StatusBadRequest
+	}
+	if kind == keyListCursorScan {
+		useIndex = false
+	}
+
+	page := apiKeysPage{APIKeys: []string{}}
+	if useIndex {
+		page.APIKeys, position, err = gw.indexedKeysPage(scanner, store.GetKeyPrefix(), filter, position, limit)
+		page.NextCursor = encodeKeyListCursor(keyListCursorIndex, position)
+	} else {
+		page.APIKeys, position, err = scannedKeysPage(scanner, store.GetKeyPrefix(), filter, position, limit)
+		page.NextCursor = encodeKeyListCursor(keyListCursorScan, position)
+	}
+
+	if err == storage.ErrInvalidCursor {
+		return apiError(errInvalidKeyListCursor.Error()), http.StatusBadRequest
+	}
+	if err != nil {
+		log.WithError(err).Error("Couldn't list keys")
+		return apiError("Couldn't list keys"), http.StatusInternalServerError
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"status": "ok",
+		"keys":   len(page.APIKeys),
+	}).Info("Retrieved key list page.")
+
+	return page, http.StatusOK
+}
+
+// scannedKeysPage scans the key store from cursor until it finds limit keys
+// selected by the filter, a page possibly holding a few more.
+func scannedKeysPage(scanner keyScanner, prefix string, filter keyListFilter, cursor string, limit int) ([]string, string, error) {
+	keys := []string{}
+	for examined := 0; examined < maxKeyListExamined; examined += limit {
+		names, next, err := scanner.ScanKeys(filter.prefix, cursor, int64(limit))
+		if err != nil {
+			return nil, "", err
+		}
+
+		names = sessionKeyNames(names)
+		if len(names) > 0 {
+			values, err := scanner.GetRawMultiKey(prefixKeyNames(prefix, names))
+			if err != nil {
+				return nil, "", err
+			}
+			for i, value := range values {
+				if session, ok := keyListSession(value); ok && filter.matches(names[i], session) {
+					keys = append(keys, names[i])
+				}
+			}
+		}
+
+		if cursor = next; cursor == "" || len(keys) >= limit {
+			break
+		}
+	}
+
+	return keys, cursor, nil
+}
+
+// indexedKeysPage returns up to limit keys selected by the filter after the
+// given key name in the key index. Keys found gone are removed from the index.
+func (gw *Gateway) indexedKeysPage(scanner keyScanner, prefix string, filter keyListFilter, after string, limit int) ([]string, string, error) {
+	set := filter.indexSet()
+	keys := []string{}
+	for examined := 0; examined < maxKeyListExamined; {
+		names, err := gw.keyIndex.members(set, after, int64(limit))
+		if err != nil {
+			return nil, "", err
+		}
+		if len(names) == 0 {
+			return keys, "", nil
+		}
+		examined += len(names)
+
+		values, err := scanner.GetRawMultiKey(prefixKeyNames(prefix, names))
+		if err != nil {
+			return nil, "", err
+		}
+		for i, value := range values {
+			after = names[i]
+			if value == "" {
+				gw.keyIndex.remove(names[i])
+				continue
+			}
+			if session, ok := keyListSession(value); ok && filter.matches(names[i], session) {
+				keys = append(keys, names[i])
+			}
+			if len(keys) == limit {
+				if i == len(names)-1 && len(names) < limit {
+					return keys, "", nil
+				}
+				return keys, after, nil
+			}
+		}
+
+		if len(names) < limit {
+			return keys, "", nil
+		}
+	}
+
+	return keys, after, nil
+}
+
+func keyListSession(value string) (*user.SessionState, bool) {
+	if value == "" {
+		return nil, false
+	}
+	session := &user.SessionState{}
+	if err := json.Unmarshal([]byte(value), session); err != nil {
+		return nil, false
+	}
+	return session, true
+}
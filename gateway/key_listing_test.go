@@ -0,0 +1,184 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// memKeyScanner scans a sorted map of keys two at a time.
+type memKeyScanner struct {
+	prefix string
+	keys   map[string]string
+}
+
+func (m *memKeyScanner) ScanKeys(filter, cursor string, count int64) ([]string, string, error) {
+	var names []string
+	for name := range m.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pos, _ := strconv.Atoi(cursor)
+	end := pos + 2
+	if end >= len(names) {
+		return names[pos:], "", nil
+	}
+	return names[pos:end], strconv.Itoa(end), nil
+}
+
+func (m *memKeyScanner) GetRawMultiKey(keys []string) ([]string, error) {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = m.keys[key[len(m.prefix):]]
+	}
+	return values, nil
+}
+
+func TestKeyListFilter(t *testing.T) {
+	query := url.Values{"limit": {"10"}}
+	assert.True(t, keyListRequested(query))
+	assert.False(t, keyListRequested(url.Values{"filter": {"org1"}}), "legacy listing")
+
+	_, err := parseKeyListFilter(url.Values{"expires_after": {"tomorrow"}})
+	assert.Error(t, err)
+	_, err = parseKeyListFilter(url.Values{"inactive": {"maybe"}})
+	assert.Error(t, err)
+
+	session := &user.SessionState{
+		OrgID:         "org1",
+		ApplyPolicies: []string{"pol1"},
+		Tags:          []string{"team-a"},
+		Alias:         "alice",
+		Expires:       1000,
+	}
+
+	tests := []struct {
+		query   string
+		matches bool
+	}{
+		{"", true},
+		{"filter=org1", true},
+		{"filter=org2", false},
+		{"org_id=org1&policy_id=pol1", true},
+		{"policy_id=pol2", false},
+		{"tag=team-a&alias=alice", true},
+		{"tag=team-b", false},
+		{"alias=bob", false},
+		{"inactive=false", true},
+		{"inactive=true", false},
+		{"expires_after=999&expires_before=1001", true},
+		{"expires_after=1000", false},
+		{"expires_before=1000", false},
+	}
+	for _, tc := range tests {
+		values, _ := url.ParseQuery(tc.query)
+		f, err := parseKeyListFilter(values)
+		require.NoError(t, err)
+		assert.Equal(t, tc.matches, f.matches("org1key", session), tc.query)
+	}
+
+	never := &user.SessionState{}
+	f, _ := parseKeyListFilter(url.Values{"expires_after": {"1000"}})
+	assert.True(t, f.matches("key", never), "keys which never expire are after any expiry")
+	f, _ = parseKeyListFilter(url.Values{"expires_before": {"1000"}})
+	assert.False(t, f.matches("key", never), "keys which never expire are before none")
+
+	f, _ = parseKeyListFilter(url.Values{"org_id": {"org1"}, "tag": {"team-a"}})
+	assert.Equal(t, keyIndexTag+"team-a", f.indexSet())
+	f, _ = parseKeyListFilter(url.Values{"inactive": {"false"}})
+	assert.Equal(t, keyIndexAll, f.indexSet())
+}
+
+func TestKeyListCursor(t *testing.T) {
+	cursor := encodeKeyListCursor(keyListCursorIndex, "org1key")
+	kind, position, err := decodeKeyListCursor(cursor)
+	require.NoError(t, err)
+	assert.Equal(t, keyListCursorIndex, kind)
+	assert.Equal(t, "org1key", position)
+
+	assert.Empty(t, encodeKeyListCursor(keyListCursorScan, ""), "no cursor at the end")
+
+	_, _, err = decodeKeyListCursor("not a cursor")
+	assert.Equal(t, errInvalidKeyListCursor, err)
+	_, _, err = decodeKeyListCursor(encodeKeyListCursor("other:", "1"))
+	assert.Equal(t, errInvalidKeyListCursor, err)
+}
+
+func TestKeyIndexSets(t *testing.T) {
+	session := &user.SessionState{
+		OrgID:         "org1",
+		ApplyPolicies: []string{"pol1", "pol1"},
+		Tags:          []string{"a", "b"},
+		IsInactive:    true,
+	}
+	assert.Equal(t, []string{
+		keyIndexAll, "org:org1", "policy:pol1", "tag:a", "tag:b", keyIndexInactive,
+	}, keyIndexSets(session))
+}
+
+func TestScannedKeysPage(t *testing.T) {
+	session := func(org string) string {
+		data, _ := json.Marshal(user.SessionState{OrgID: org})
+		return string(data)
+	}
+	scanner := &memKeyScanner{prefix: "apikey-", keys: map[string]string{
+		"k1":          session("org1"),
+		"k2":          session("org2"),
+		"k3":          session("org1"),
+		"k4":          session("org1"),
+		"k5":          "not a session",
+		"quota-k1":    "10",
+		"rate-limit-": "1",
+	}}
+	filter := keyListFilter{orgID: "org1"}
+
+	keys, cursor, err := scannedKeysPage(scanner, "apikey-", filter, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k1", "k3", "k4"}, keys, "pages end with the batch which fills them")
+	require.NotEmpty(t, cursor)
+
+	keys, cursor, err = scannedKeysPage(scanner, "apikey-", filter, cursor, 2)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Empty(t, cursor)
+}
+
+func TestKeyIndexSessionManager(t *testing.T) {
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.KeyIndex.Enabled = true
+	})
+	defer ts.Close()
+
+	index := ts.Gw.keyIndex
+	require.NotNil(t, index)
+	require.Eventually(t, index.ready, 5*time.Second, 10*time.Millisecond, "the index is built at startup")
+
+	keyName := ts.Gw.generateToken("org1", "")
+	stored := ts.Gw.storedKeyName(keyName, false)
+	session := user.SessionState{OrgID: "org1", Tags: []string{"middleware"}}
+
+	// Sessions created by the auth middleware, such as those of JWTs, are stored through the session manager
+	require.NoError(t, ts.Gw.GlobalSessionManager.UpdateSession(keyName, &session, 0, false))
+	members, err := index.members(keyIndexTag+"middleware", "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{stored}, members)
+
+	assert.True(t, ts.Gw.GlobalSessionManager.RemoveSession("org1", keyName, false))
+	members, err = index.members(keyIndexTag+"middleware", "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, members)
+
+	// Once the built marker expires, listings scan the key store until the index is rebuilt
+	index.store.DeleteKey(keyIndexBuilt)
+	assert.False(t, index.ready())
+}
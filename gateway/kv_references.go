@@ -0,0 +1,233 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+var kvSchemes = []string{"secrets://", "env://", "file://", "consul://", "vault://"}
+
+// isKVReference reports whether value refers to a KV store instead of being a literal value.
+func isKVReference(value string) bool {
+	for _, scheme := range kvSchemes {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// kvReferences tracks the KV references resolved by the gateway and their
+// last values, so that rotated values can be detected.
+type kvReferences struct {
+	mu        sync.Mutex
+	refs      map[string]string
+	rawConfig config.Config
+}
+
+func (k *kvReferences) track(ref, value string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.refs == nil {
+		k.refs = make(map[string]string)
+	}
+	k.refs[ref] = value
+}
+
+func (k *kvReferences) snapshot() map[string]string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	refs := make(map[string]string, len(k.refs))
+	for ref, value := range k.refs {
+		refs[ref] = value
+	}
+	return refs
+}
+
+func (k *kvReferences) setRawConfig(conf config.Config) {
+	k.mu.Lock()
+	k.rawConfig = conf
+	k.mu.Unlock()
+}
+
+func (k *kvReferences) getRawConfig() config.Config {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.rawConfig
+}
+
+// watchKVReferences periodically checks the resolved KV references for rotated values.
+func (gw *Gateway) watchKVReferences(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if gw.checkKVReferences() {
+				gw.reloadURLStructure(nil)
+			}
+		}
+	}
+}
+
+// checkKVReferences resolves all tracked references again. When a value has
+// changed the configuration values are updated and true is returned, so the
+// caller can reload the APIs, which resolves their references again.
+func (gw *Gateway) checkKVReferences() bool {
+	changed := false
+	for ref, old := range gw.kvRefs.snapshot() {
+		value, err := gw.resolveKV(ref)
+		if err != nil {
+			mainLog.WithError(err).WithField("reference", ref).Warning("Couldn't refresh KV value, keeping the current one")
+			continue
+		}
+
+		if value != old {
+			mainLog.WithField("reference", ref).Info("KV value has been rotated")
+			gw.kvRefs.track(ref, value)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false
+	}
+
+	conf := gw.GetConfig()
+	if err := gw.resolveConfigSecrets(&conf, gw.kvRefs.getRawConfig()); err != nil {
+		mainLog.WithError(err).Error("Couldn't apply rotated configuration values")
+		return true
+	}
+	gw.SetConfig(conf)
+
+	if gw.CertificateManager != nil {
+		gw.CertificateManager.SetSecret(gw.certificateSecret())
+	}
+
+	return true
+}
+
+// kvStoreAllowed reports whether the store of the reference is one of stores.
+func kvStoreAllowed(ref string, stores []string) bool {
+	for _, store := range stores {
+		if strings.HasPrefix(ref, store+"://") {
+			return true
+		}
+	}
+	return false
+}
+
+// errKVStoreNotAllowed is returned when an API definition refers to a KV store
+// which isn't allowed by kv.api_definition_stores.
+var errKVStoreNotAllowed = errors.New("the store isn't allowed in API definitions")
+
+// checkDefinitionSecret fails if value refers to a KV store which isn't
+// allowed in API definitions.
+func (gw *Gateway) checkDefinitionSecret(value string) error {
+	if isKVReference(value) && !kvStoreAllowed(value, gw.GetConfig().KV.APIDefinitionStores) {
+		return errKVStoreNotAllowed
+	}
+	return nil
+}
+
+// resolveDefinitionSecret resolves value if it refers to a KV store, as for
+// the other values of API definitions: only the stores allowed by
+// kv.api_definition_stores are resolved.
+func (gw *Gateway) resolveDefinitionSecret(value string) (string, error) {
+	if err := gw.checkDefinitionSecret(value); err != nil {
+		return "", err
+	}
+	return gw.kvStore(value)
+}
+
+// replaceSpecSecrets resolves the KV references in the API definition fields
+// which are likely to hold secrets, such as injected upstream auth headers.
+// Only the stores allowed by kv.api_definition_stores are resolved. The values
+// are resolved into a copy of the definition, the one the spec was loaded from
+// is left as it is, so that the Gateway API doesn't return the secrets.
+func (gw *Gateway) replaceSpecSecrets(spec *APISpec, logger *logrus.Entry) {
+	resolve := func(value string) string {
+		resolved, err := gw.resolveDefinitionSecret(value)
+		if err == errKVStoreNotAllowed {
+			logger.Warningf("%q isn't resolved, its store isn't allowed in API definitions", value)
+			return value
+		}
+		if err != nil {
+			logger.WithError(err).Errorf("Couldn't resolve %q", value)
+			return value
+		}
+		return resolved
+	}
+
+	resolveMap := func(m map[string]string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		resolved := make(map[string]string, len(m))
+		for k, v := range m {
+			resolved[k] = resolve(v)
+		}
+		return resolved
+	}
+
+	resolveHeaders := func(metas []apidef.HeaderInjectionMeta) []apidef.HeaderInjectionMeta {
+		if metas == nil {
+			return nil
+		}
+		resolved := make([]apidef.HeaderInjectionMeta, len(metas))
+		for i, meta := range metas {
+			meta.AddHeaders = resolveMap(meta.AddHeaders)
+			resolved[i] = meta
+		}
+		return resolved
+	}
+
+	def := *spec.APIDefinition
+
+	if spec.VersionData.Versions != nil {
+		def.VersionData.Versions = make(map[string]apidef.VersionInfo, len(spec.VersionData.Versions))
+		for name, version := range spec.VersionData.Versions {
+			version.GlobalHeaders = resolveMap(version.GlobalHeaders)
+			version.GlobalResponseHeaders = resolveMap(version.GlobalResponseHeaders)
+			version.ExtendedPaths.TransformHeader = resolveHeaders(version.ExtendedPaths.TransformHeader)
+			version.ExtendedPaths.TransformResponseHeader = resolveHeaders(version.ExtendedPaths.TransformResponseHeader)
+			def.VersionData.Versions[name] = version
+		}
+	}
+
+	if spec.AuthConfigs != nil {
+		def.AuthConfigs = make(map[string]apidef.AuthConfig, len(spec.AuthConfigs))
+		for name, authConfig := range spec.AuthConfigs {
+			authConfig.Signature.Secret = resolve(authConfig.Signature.Secret)
+			def.AuthConfigs[name] = authConfig
+		}
+	}
+
+	def.RequestSigning.Secret = resolve(def.RequestSigning.Secret)
+	def.JWTSource = resolve(def.JWTSource)
+
+	if spec.ConfigData != nil {
+		def.ConfigData = make(map[string]interface{}, len(spec.ConfigData))
+		for k, v := range spec.ConfigData {
+			if s, ok := v.(string); ok {
+				v = resolve(s)
+			}
+			def.ConfigData[k] = v
+		}
+	}
+
+	spec.APIDefinition = &def
+}
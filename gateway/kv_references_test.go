@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestKVReferences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeSecret := func(name, value string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSecret("upstream-token", "token-1")
+	writeSecret("node-secret", "node-1")
+
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.KV.File.BaseDir = dir
+		globalConf.KV.APIDefinitionStores = []string{"file"}
+		globalConf.NodeSecret = "file://node-secret"
+	})
+	defer ts.Close()
+
+	// The test gateway sets its config after the setup, resolve it as on start up
+	ts.Gw.afterConfSetup()
+	assert.Equal(t, "node-1", ts.Gw.GetConfig().NodeSecret)
+
+	loadAPI := func() {
+		ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "kv-references"
+			spec.Proxy.ListenPath = "/"
+			spec.VersionData.Versions = map[string]apidef.VersionInfo{
+				"v1": {
+					GlobalHeaders: map[string]string{
+						"X-Upstream-Token": "file://upstream-token",
+						"X-Static":         "file",
+						"X-Env":            "env://upstream-token",
+					},
+				},
+			}
+		})
+	}
+	loadAPI()
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/", Code: 200, BodyMatch: `"X-Upstream-Token":"token-1"`},
+		{Path: "/", Code: 200, BodyMatch: `"X-Static":"file"`},
+		{Path: "/", Code: 200, BodyMatch: `"X-Env":"env://upstream-token"`},
+		{Path: "/tyk/apis/kv-references", AdminAuth: true, Code: 200, BodyMatch: `"X-Upstream-Token":"file://upstream-token"`},
+		{Path: "/tyk/apis/kv-references", AdminAuth: true, Code: 200, BodyNotMatch: `token-1`},
+	}...)
+
+	t.Run("Unchanged values", func(t *testing.T) {
+		assert.False(t, ts.Gw.checkKVReferences())
+	})
+
+	t.Run("Rotated values", func(t *testing.T) {
+		writeSecret("upstream-token", "token-2")
+		writeSecret("node-secret", "node-2")
+
+		assert.True(t, ts.Gw.checkKVReferences())
+		assert.Equal(t, "node-2", ts.Gw.GetConfig().NodeSecret)
+
+		loadAPI()
+		_, _ = ts.Run(t, test.TestCase{Path: "/", Code: 200, BodyMatch: `"X-Upstream-Token":"token-2"`})
+	})
+
+	t.Run("Missing values keep the current one", func(t *testing.T) {
+		os.Remove(filepath.Join(dir, "node-secret"))
+
+		assert.False(t, ts.Gw.checkKVReferences())
+		assert.Equal(t, "node-2", ts.Gw.GetConfig().NodeSecret)
+	})
+}
+
+func TestIsKVReference(t *testing.T) {
+	assert.True(t, isKVReference("file://secret"))
+	assert.True(t, isKVReference("env://secret"))
+	assert.True(t, isKVReference("vault://path.key"))
+	assert.False(t, isKVReference("secret"))
+	assert.False(t, isKVReference("https://example.com"))
+}
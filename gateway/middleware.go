@@ -136,6 +136,9 @@ func (gw *Gateway) createMiddleware(actualMW TykMiddleware) func(http.Handler) h
 			}
 
 			err, errCode := mw.ProcessRequest(w, r, mwConf)
+			if debugTrace := ctxGetDebugTrace(r); debugTrace != nil {
+				debugTrace.addStep(mw.Name(), r, err, errCode, time.Since(startTime))
+			}
 			if err != nil {
 				// GoPluginMiddleware are expected to send response in case of error
 				// but we still want to record error
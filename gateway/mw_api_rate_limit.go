@@ -56,6 +56,7 @@ func (k *RateLimitForAPI) handleRateLimitFailure(r *http.Request, token string)
 
 	// Report in health check
 	reportHealthValue(k.Spec, Throttle, "-1")
+	k.Gw.prometheus.reportRateLimited(k.Spec, r)
 
 	return errors.New("API Rate limit exceeded"), http.StatusTooManyRequests
 }
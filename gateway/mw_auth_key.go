@@ -239,6 +239,10 @@ func stripBearer(token string) string {
 
 // TODO: move this method to base middleware?
 func AuthFailed(m TykMiddleware, r *http.Request, token string) {
+	if gw := m.Base().Gw; gw != nil {
+		gw.prometheus.reportAuthFailure(m.Base().Spec, r)
+	}
+
 	m.Base().FireEvent(EventAuthFailure, EventKeyFailureMeta{
 		EventMetaDefault: EventMetaDefault{Message: "Auth Failure", OriginatingRequest: EncodeRequestToEvent(r)},
 		Path:             r.URL.Path,
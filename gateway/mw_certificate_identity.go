@@ -0,0 +1,289 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/regexp"
+)
+
+// Certificate identity sources
+const (
+	certIdentityCN     = "cn"
+	certIdentityDNS    = "dns"
+	certIdentityURI    = "uri"
+	certIdentitySPIFFE = "spiffe"
+	certIdentityEmail  = "email"
+)
+
+type certIdentityRule struct {
+	apidef.CertificateIdentityRule
+	pattern *regexp.Regexp
+}
+
+// CertificateIdentityMW authenticates requests by a client certificate issued by
+// a trusted CA, mapping the certificate identity to a policy.
+type CertificateIdentityMW struct {
+	BaseMiddleware
+	rules []certIdentityRule
+
+	crlMu      sync.Mutex
+	crl        *pkix.CertificateList
+	crlModTime time.Time
+}
+
+func (k *CertificateIdentityMW) Name() string {
+	return "CertificateIdentityMW"
+}
+
+func (k *CertificateIdentityMW) EnabledForSpec() bool {
+	return k.Spec.CertificateIdentity.Enabled
+}
+
+func (k *CertificateIdentityMW) Init() {
+	k.rules = nil
+	for _, rule := range k.Spec.CertificateIdentity.Rules {
+		expr := rule.Pattern
+		if expr == "" {
+			expr = ".*"
+		}
+		// the whole identity should match, so that a pattern doesn't match identities embedding the expected one
+		pattern, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			k.Logger().WithError(err).Errorf("Skipping certificate identity rule with invalid pattern %q", rule.Pattern)
+			continue
+		}
+
+		switch rule.Source {
+		case certIdentityCN, certIdentityDNS, certIdentityURI, certIdentitySPIFFE, certIdentityEmail:
+		default:
+			k.Logger().Errorf("Skipping certificate identity rule with unknown source %q", rule.Source)
+			continue
+		}
+
+		k.rules = append(k.rules, certIdentityRule{CertificateIdentityRule: rule, pattern: pattern})
+	}
+}
+
+// certificateIdentities returns the identities of the certificate for the given source.
+func certificateIdentities(cert *x509.Certificate, source string) []string {
+	switch source {
+	case certIdentityCN:
+		if cert.Subject.CommonName != "" {
+			return []string{cert.Subject.CommonName}
+		}
+	case certIdentityDNS:
+		return cert.DNSNames
+	case certIdentityEmail:
+		return cert.EmailAddresses
+	case certIdentityURI, certIdentitySPIFFE:
+		var uris []string
+		for _, uri := range cert.URIs {
+			if source == certIdentitySPIFFE && uri.Scheme != "spiffe" {
+				continue
+			}
+			uris = append(uris, uri.String())
+		}
+		return uris
+	}
+
+	return nil
+}
+
+// identity returns the first identity of the certificate matching a rule, along with the rule.
+func (k *CertificateIdentityMW) identity(cert *x509.Certificate) (string, *certIdentityRule) {
+	for i := range k.rules {
+		rule := &k.rules[i]
+		for _, identity := range certificateIdentities(cert, rule.Source) {
+			if rule.pattern.MatchString(identity) {
+				return identity, rule
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// verify checks the client certificate chain against the trusted CAs.
+func (k *CertificateIdentityMW) verify(r *http.Request) ([][]*x509.Certificate, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, errors.New("client certificate is required")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	return r.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         k.Gw.CertificateManager.CertPool(k.Spec.CertificateIdentity.CACertificates),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+// loadCRL returns the revocation list, reading it again when the file was modified.
+func (k *CertificateIdentityMW) loadCRL() (*pkix.CertificateList, error) {
+	path := k.Spec.CertificateIdentity.CRLFile
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	k.crlMu.Lock()
+	defer k.crlMu.Unlock()
+
+	if k.crl != nil && info.ModTime().Equal(k.crlModTime) {
+		return k.crl, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	crl, err := x509.ParseCRL(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if crl.HasExpired(time.Now()) {
+		k.Logger().WithField("path", path).Warning("Certificate revocation list is past its next update")
+	}
+
+	k.crl, k.crlModTime = crl, info.ModTime()
+	return crl, nil
+}
+
+// checkRevocation rejects certificates in the chain revoked by the revocation list of their issuer.
+func (k *CertificateIdentityMW) checkRevocation(chain []*x509.Certificate) error {
+	if k.Spec.CertificateIdentity.CRLFile == "" {
+		return nil
+	}
+
+	crl, err := k.loadCRL()
+	if err != nil {
+		return fmt.Errorf("couldn't load revocation list: %v", err)
+	}
+
+	crlIssuer, err := asn1.Marshal(crl.TBSCertList.Issuer)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		if !bytes.Equal(cert.RawIssuer, crlIssuer) {
+			continue
+		}
+
+		if err := issuer.CheckCRLSignature(crl); err != nil {
+			return fmt.Errorf("invalid revocation list signature: %v", err)
+		}
+
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return errors.New("certificate has been revoked")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (k *CertificateIdentityMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	if ctxGetRequestStatus(r) == StatusOkAndIgnore {
+		return nil, http.StatusOK
+	}
+
+	logger := k.Logger()
+
+	chains, err := k.verify(r)
+	if err != nil {
+		logger.WithError(err).Warning("Client certificate invalid")
+		k.reportLoginFailure("[NOT GENERATED]", r)
+		return errors.New("Client certificate is not valid"), http.StatusUnauthorized
+	}
+
+	revoked := false
+	for _, chain := range chains {
+		if err := k.checkRevocation(chain); err != nil {
+			logger.WithError(err).Warning("Client certificate rejected")
+			revoked = true
+			break
+		}
+	}
+	if revoked {
+		k.reportLoginFailure("[NOT GENERATED]", r)
+		return errors.New("Client certificate is not valid"), http.StatusUnauthorized
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	identity, rule := k.identity(cert)
+	if rule == nil {
+		logger.WithField("subject", cert.Subject.String()).Warning("No certificate identity rule matched")
+		k.reportLoginFailure("[NOT GENERATED]", r)
+		return errors.New("Certificate not allowed"), http.StatusForbidden
+	}
+
+	keyID := fmt.Sprintf("%x", md5.Sum([]byte(rule.Source+":"+identity)))
+	sessionID := k.Gw.generateToken(k.Spec.OrgID, keyID)
+
+	session, exists := k.CheckSessionAndIdentityForValidKey(sessionID, r)
+	if !exists {
+		logger.Debug("Key does not exist, creating")
+
+		newSession, err := k.Gw.generateSessionFromPolicy(rule.PolicyID, k.Spec.OrgID, true)
+		if err != nil {
+			k.reportLoginFailure(sessionID, r)
+			logger.WithError(err).Error("Could not find a valid policy to apply to this certificate!")
+			return errors.New("Key not authorized: no matching policy"), http.StatusForbidden
+		}
+
+		session = newSession.Clone()
+		session.OrgID = k.Spec.OrgID
+		session.MetaData = map[string]interface{}{
+			"certificate_identity":        identity,
+			"certificate_identity_source": rule.Source,
+		}
+		session.Alias = identity
+		session.KeyID = sessionID
+	}
+
+	session.SetPolicies(rule.PolicyID)
+	if err := k.ApplyPolicies(&session); err != nil {
+		logger.WithError(err).Error("Could not apply policy to certificate session")
+		return errors.New("Key not authorized: could not apply new policy"), http.StatusForbidden
+	}
+
+	switch k.Spec.BaseIdentityProvidedBy {
+	case apidef.CertIdentity, apidef.UnsetAuth:
+		ctxSetSession(r, &session, true, k.Gw.GetConfig().HashKeys)
+	}
+
+	return nil, http.StatusOK
+}
+
+func (k *CertificateIdentityMW) reportLoginFailure(tykId string, r *http.Request) {
+	k.Logger().WithFields(logrus.Fields{
+		"key": k.Gw.obfuscateKey(tykId),
+	}).Warning("Attempted access with invalid client certificate.")
+
+	AuthFailed(k, r, tykId)
+
+	reportHealthValue(k.Spec, KeyFailure, "1")
+}
@@ -0,0 +1,228 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a client certificate signed by the CA.
+func (ca *testCA) issue(t *testing.T, serial int64, template *x509.Certificate) tls.Certificate {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template.SerialNumber = big.NewInt(serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (ca *testCA) crl(t *testing.T, serials ...int64) []byte {
+	var revoked []pkix.RevokedCertificate
+	for _, serial := range serials {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(int64(len(serials))),
+		ThisUpdate:          time.Now(),
+		NextUpdate:          time.Now().Add(time.Hour),
+		RevokedCertificates: revoked,
+	}, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	_, _, combinedPEM, _ := certs.GenServerCertificate()
+	serverCertID, _, _ := certs.GetCertIDAndChainPEM(combinedPEM, "")
+
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.HttpServerOptions.UseSSL = true
+		globalConf.HttpServerOptions.SSLCertificates = []string{serverCertID}
+	})
+	defer ts.Close()
+
+	serverCertID, _ = ts.Gw.CertificateManager.Add(combinedPEM, "")
+	defer ts.Gw.CertificateManager.Delete(serverCertID, "")
+	ts.ReloadGatewayProxy()
+
+	ca := newTestCA(t, "Test CA")
+	caID, err := ts.Gw.CertificateManager.Add(ca.pem, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Gw.CertificateManager.Delete(caID, "")
+
+	dir, err := ioutil.TempDir("", "tyk-crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	crlFile := filepath.Join(dir, "ca.crl")
+	if err := ioutil.WriteFile(crlFile, ca.crl(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	spiffePolicy := ts.CreatePolicy()
+	cnPolicy := ts.CreatePolicy()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+		spec.CertificateIdentity = apidef.CertificateIdentity{
+			Enabled:        true,
+			CACertificates: []string{caID},
+			CRLFile:        crlFile,
+			Rules: []apidef.CertificateIdentityRule{
+				{Source: "spiffe", Pattern: `spiffe://example\.org/ns/prod/.*`, PolicyID: spiffePolicy},
+				{Source: "cn", Pattern: `svc-.*`, PolicyID: cnPolicy},
+				{Source: "dns", Pattern: `api\.example\.org`, PolicyID: cnPolicy},
+			},
+		}
+	})
+
+	spiffeURI, _ := url.Parse("spiffe://example.org/ns/prod/sa/billing")
+	spiffeCert := ca.issue(t, 10, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}, URIs: []*url.URL{spiffeURI}})
+	cnCert := ca.issue(t, 11, &x509.Certificate{Subject: pkix.Name{CommonName: "svc-orders"}})
+	unmatchedCert := ca.issue(t, 12, &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}})
+	dnsCert := ca.issue(t, 13, &x509.Certificate{Subject: pkix.Name{CommonName: "api"}, DNSNames: []string{"api.example.org"}})
+	prefixedCert := ca.issue(t, 14, &x509.Certificate{Subject: pkix.Name{CommonName: "api"}, DNSNames: []string{"evil-api.example.org"}})
+	suffixedCert := ca.issue(t, 15, &x509.Certificate{Subject: pkix.Name{CommonName: "api"}, DNSNames: []string{"api.example.org.evil.com"}})
+	_, _, _, selfSigned := certs.GenCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "svc-rogue"}}, false)
+
+	t.Run("No certificate", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Client: GetTLSClient(nil, nil), Code: http.StatusUnauthorized})
+	})
+
+	t.Run("Untrusted certificate", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Client: GetTLSClient(&selfSigned, nil), Code: http.StatusUnauthorized})
+	})
+
+	t.Run("SPIFFE identity", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Client: GetTLSClient(&spiffeCert, nil), Code: http.StatusOK})
+	})
+
+	t.Run("Subject CN identity", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Client: GetTLSClient(&cnCert, nil), Code: http.StatusOK})
+	})
+
+	t.Run("No matching rule", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Client: GetTLSClient(&unmatchedCert, nil), Code: http.StatusForbidden})
+	})
+
+	t.Run("Patterns match whole identities", func(t *testing.T) {
+		_, _ = ts.Run(t, []test.TestCase{
+			{Client: GetTLSClient(&dnsCert, nil), Code: http.StatusOK},
+			{Client: GetTLSClient(&prefixedCert, nil), Code: http.StatusForbidden},
+			{Client: GetTLSClient(&suffixedCert, nil), Code: http.StatusForbidden},
+		}...)
+	})
+
+	t.Run("Revoked certificate", func(t *testing.T) {
+		// Ensure the modification time differs, so the list is read again
+		modTime := time.Now().Add(time.Minute)
+		if err := ioutil.WriteFile(crlFile, ca.crl(t, 11), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Chtimes(crlFile, modTime, modTime)
+
+		_, _ = ts.Run(t, []test.TestCase{
+			{Client: GetTLSClient(&cnCert, nil), Code: http.StatusUnauthorized},
+			{Client: GetTLSClient(&spiffeCert, nil), Code: http.StatusOK},
+		}...)
+	})
+
+	t.Run("Revocation list of another CA", func(t *testing.T) {
+		other := newTestCA(t, "Test CA")
+		modTime := time.Now().Add(2 * time.Minute)
+		if err := ioutil.WriteFile(crlFile, other.crl(t), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Chtimes(crlFile, modTime, modTime)
+
+		// Same issuer name, but not signed by the trusted CA
+		_, _ = ts.Run(t, test.TestCase{Client: GetTLSClient(&spiffeCert, nil), Code: http.StatusUnauthorized})
+	})
+
+	t.Run("No CA certificates", func(t *testing.T) {
+		specs := ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "no-ca"
+			spec.UseKeylessAccess = false
+			spec.Proxy.ListenPath = "/"
+			spec.CertificateIdentity = apidef.CertificateIdentity{Enabled: true}
+		})
+		assert.Nil(t, specs[0], "the definition is rejected when it's loaded")
+	})
+}
+
+func TestCertificateIdentities(t *testing.T) {
+	spiffeURI, _ := url.Parse("spiffe://example.org/sa/web")
+	httpsURI, _ := url.Parse("https://example.org/web")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "web"},
+		DNSNames:       []string{"web.example.org"},
+		EmailAddresses: []string{"web@example.org"},
+		URIs:           []*url.URL{spiffeURI, httpsURI},
+	}
+
+	assert.Equal(t, []string{"web"}, certificateIdentities(cert, "cn"))
+	assert.Equal(t, []string{"web.example.org"}, certificateIdentities(cert, "dns"))
+	assert.Equal(t, []string{"web@example.org"}, certificateIdentities(cert, "email"))
+	assert.Equal(t, []string{"spiffe://example.org/sa/web", "https://example.org/web"}, certificateIdentities(cert, "uri"))
+	assert.Equal(t, []string{"spiffe://example.org/sa/web"}, certificateIdentities(cert, "spiffe"))
+	assert.Empty(t, certificateIdentities(&x509.Certificate{}, "cn"))
+}
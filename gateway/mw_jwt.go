@@ -621,7 +621,7 @@ func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token)
 					&RedisOsinStorageInterface{
 						storageManager,
 						k.Gw.GlobalSessionManager,
-						&storage.RedisCluster{KeyPrefix: prefix, HashKeys: false, RedisController: k.Gw.RedisController},
+						k.Gw.newStore(storage.StoreOptions{KeyPrefix: prefix, HashKeys: false}),
 						k.Spec.OrgID,
 						k.Gw,
 					}),
@@ -46,6 +46,7 @@ func (k *KeyExpired) ProcessRequest(w http.ResponseWriter, r *http.Request, _ in
 	}
 
 	if !k.Spec.AuthManager.KeyExpired(session) {
+		k.reportRotatedKeyUsage(r, session)
 		return nil, http.StatusOK
 	}
 	logger.Info("Attempted access from expired key.")
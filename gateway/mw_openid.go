@@ -6,23 +6,21 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"sync"
+	"strings"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/sirupsen/logrus"
 
-	"github.com/TykTechnologies/openid2go/openid"
 	"github.com/TykTechnologies/tyk/apidef"
-	"github.com/TykTechnologies/tyk/user"
 )
 
 const OIDPREFIX = "openid"
 
+const defaultOIDCNonceHeader = "X-Tyk-OIDC-Nonce"
+
 type OpenIDMW struct {
 	BaseMiddleware
-	providerConfiguration     *openid.Configuration
-	provider_client_policymap map[string]map[string]string
-	lock                      sync.RWMutex
+	providers map[string]*oidcProvider
 }
 
 func (k *OpenIDMW) Name() string {
@@ -34,65 +32,93 @@ func (k *OpenIDMW) EnabledForSpec() bool {
 }
 
 func (k *OpenIDMW) Init() {
-	k.provider_client_policymap = make(map[string]map[string]string)
-	// Create an OpenID Configuration and store
-	var err error
-	k.providerConfiguration, err = openid.NewConfiguration(openid.ProvidersGetter(k.getProviders),
-		openid.ErrorHandler(k.dummyErrorHandler))
+	k.providers = make(map[string]*oidcProvider, len(k.Spec.OpenIDOptions.Providers))
+	client := k.Gw.newOIDCHTTPClient()
+
+	browserLogin := k.Spec.OpenIDOptions.BrowserLogin
+	for i, conf := range k.Spec.OpenIDOptions.Providers {
+		k.Logger().Debug("Setting up Issuer: ", conf.Issuer)
+		if aud := browserLogin.Audience(i, conf.Issuer); aud != "" {
+			// ID tokens obtained through the browser login are issued to the gateway's own client
+			conf.Audiences = append([]string{aud}, conf.Audiences...)
+		}
+		if len(conf.ClientIDs) == 0 && len(conf.Audiences) == 0 {
+			k.Logger().Error("No client IDs or audiences configured for issuer ", conf.Issuer, ", its tokens will be rejected")
+		}
+		k.providers[strings.TrimSuffix(conf.Issuer, "/")] = newOIDCProvider(conf, client)
+	}
+}
 
+// decodeOIDCClientID decodes the base64 client IDs used as keys of OIDProviderConfig.ClientIDs.
+func decodeOIDCClientID(encoded string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		k.Logger().WithError(err).Error("OpenID configuration error")
+		return "", err
 	}
+	return string(decoded), nil
 }
 
-func (k *OpenIDMW) getProviders() ([]openid.Provider, error) {
-	providers := []openid.Provider{}
-	k.Logger().Debug("Setting up providers: ", k.Spec.OpenIDOptions.Providers)
-	for _, provider := range k.Spec.OpenIDOptions.Providers {
-		iss := provider.Issuer
-		k.Logger().Debug("Setting up Issuer: ", iss)
-		providerClientArray := make([]string, len(provider.ClientIDs))
-
-		i := 0
-		for clientID, policyID := range provider.ClientIDs {
-			clID, _ := base64.StdEncoding.DecodeString(clientID)
-			clientID := string(clID)
-
-			k.lock.Lock()
-			if k.provider_client_policymap[iss] == nil {
-				k.provider_client_policymap[iss] = map[string]string{clientID: policyID}
-			} else {
-				k.provider_client_policymap[iss][clientID] = policyID
-			}
-			k.lock.Unlock()
+func (k *OpenIDMW) getAuthType() string {
+	return oidcType
+}
 
-			k.Logger().Debug("--> Setting up client: ", clientID, " with policy: ", policyID)
-			providerClientArray[i] = clientID
-			i++
-		}
+// provider returns the configured provider matching the unverified "iss" claim of the token.
+func (k *OpenIDMW) provider(rawToken string) (*oidcProvider, error) {
+	token, _, err := new(jwt.Parser).ParseUnverified(rawToken, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
 
-		p, err := openid.NewProvider(iss, providerClientArray)
+	iss, _ := token.Claims.(jwt.MapClaims)["iss"].(string)
+	if iss == "" {
+		return nil, errors.New("no issuer found")
+	}
 
-		if err != nil {
-			k.Logger().WithError(err).WithFields(logrus.Fields{
-				"provider": iss,
-			}).Error("Failed to create provider")
-		} else {
-			providers = append(providers, p)
-		}
+	provider, ok := k.providers[strings.TrimSuffix(iss, "/")]
+	if !ok {
+		return nil, fmt.Errorf("issuer %q is not configured", iss)
 	}
 
-	return providers, nil
+	return provider, nil
 }
 
-// We don't want any of the error handling, we use our own
-func (k *OpenIDMW) dummyErrorHandler(e error, w http.ResponseWriter, r *http.Request) bool {
-	k.Logger().WithError(e).Warning("JWT Invalid")
-	return true
+// validateNonce checks the "nonce" claim of a bearer token against the nonce header. The ID tokens of browser
+// sessions are checked against the nonce of their login instead, loginNonce is nil for bearer tokens.
+func (k *OpenIDMW) validateNonce(r *http.Request, claims jwt.MapClaims, loginNonce *string) error {
+	if loginNonce != nil {
+		// OpenID Connect Core 12.2: refreshed ID tokens may omit the nonce, if present it's the one of the login
+		if nonce, ok := claims["nonce"]; ok && nonce != *loginNonce {
+			return errors.New("nonce mismatch")
+		}
+		return nil
+	}
+
+	if !k.Spec.OpenIDOptions.ValidateNonce {
+		return nil
+	}
+
+	headerName := k.Spec.OpenIDOptions.NonceHeaderName
+	if headerName == "" {
+		headerName = defaultOIDCNonceHeader
+	}
+
+	nonce, _ := claims["nonce"].(string)
+	if nonce == "" || nonce != r.Header.Get(headerName) {
+		return errors.New("nonce mismatch")
+	}
+
+	return nil
 }
 
-func (k *OpenIDMW) getAuthType() string {
-	return oidcType
+func (k *OpenIDMW) forwardClaims(r *http.Request, claims jwt.MapClaims) {
+	for claimName, headerName := range k.Spec.OpenIDOptions.ForwardClaims {
+		value := nestedMapLookup(claims, strings.Split(claimName, ".")...)
+		if value == nil {
+			r.Header.Del(headerName)
+			continue
+		}
+		r.Header.Set(headerName, oidcClaimHeaderValue(value))
+	}
 }
 
 func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
@@ -100,73 +126,93 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ inte
 		return nil, http.StatusOK
 	}
 
-	k.providerConfiguration.IDTokenGetter = func(r *http.Request) (token string, err error) {
-		token, _ = k.getAuthToken(k.getAuthType(), r)
-		return openid.CheckAndSplitHeader(token)
-	}
-
 	logger := k.Logger()
-	// 1. Validate the JWT
-	ouser, token, halt := openid.AuthenticateOIDWithUser(k.providerConfiguration, w, r)
 
-	// 2. Generate the internal representation for the key
-	if halt {
-		// Fire Authfailed Event
+	// 1. Validate the JWT against the discovered provider keys
+	rawToken, _ := k.getAuthToken(k.getAuthType(), r)
+	rawToken = strings.TrimSpace(stripBearer(rawToken))
+	var loginNonce *string
+	if rawToken == "" && k.Spec.OIDCLoginManager != nil {
+		// No bearer token, fall back to the browser session cookie
+		loginManager := k.Spec.OIDCLoginManager
+		var err error
+		var nonce string
+		if rawToken, nonce, err = loginManager.IDToken(r); err != nil {
+			logger.WithError(err).Debug("No valid browser session")
+			if r.Method == http.MethodGet {
+				if err := loginManager.Login(w, r); err != nil {
+					logger.WithError(err).Error("Couldn't start OpenID Connect login")
+					return errors.New("Login unavailable"), http.StatusInternalServerError
+				}
+				return nil, mwStatusRespond
+			}
+		}
+		loginNonce = &nonce
+		stripCookies(r, loginManager.conf.CookieName, loginManager.stateCookieName())
+	}
+	if rawToken == "" {
 		k.reportLoginFailure("[JWT]", r)
 		return errors.New("Key not authorised"), http.StatusUnauthorized
 	}
 
-	// 3. Create or set the session to match
-	iss, found := token.Claims.(jwt.MapClaims)["iss"]
-	clients, cfound := token.Claims.(jwt.MapClaims)["aud"]
+	provider, err := k.provider(rawToken)
+	if err != nil {
+		logger.WithError(err).Warning("JWT Invalid")
+		k.reportLoginFailure("[JWT]", r)
+		return errors.New("Key not authorised"), http.StatusUnauthorized
+	}
 
-	if !found && !cfound {
-		logger.Error("No issuer or audiences found!")
-		k.reportLoginFailure("[NOT GENERATED]", r)
+	token, err := provider.Verify(rawToken)
+	if err != nil {
+		logger.WithError(err).WithField("provider", provider.Issuer).Warning("JWT Invalid")
+		k.reportLoginFailure("[JWT]", r)
 		return errors.New("Key not authorised"), http.StatusUnauthorized
 	}
 
-	// decide if we use policy ID from provider client settings or list of policies from scope-policy mapping
-	useScope := len(k.Spec.Scopes.OIDC.ScopeToPolicy) != 0
+	claims := token.Claims.(jwt.MapClaims)
+	if err := k.validateNonce(r, claims, loginNonce); err != nil {
+		logger.WithError(err).Warning("JWT Invalid")
+		k.reportLoginFailure("[JWT]", r)
+		return errors.New("Key not authorised"), http.StatusUnauthorized
+	}
 
-	k.lock.RLock()
-	clientSet, foundIssuer := k.provider_client_policymap[iss.(string)]
-	k.lock.RUnlock()
-	if !foundIssuer {
-		logger.Error("No issuer or audiences found!")
+	subject, _ := claims[SUB].(string)
+	if subject == "" {
+		logger.Error("No subject found!")
 		k.reportLoginFailure("[NOT GENERATED]", r)
 		return errors.New("Key not authorised"), http.StatusUnauthorized
 	}
 
-	policyID := ""
-	clientID := ""
-	switch v := clients.(type) {
-	case string:
-		k.lock.RLock()
-		policyID = clientSet[v]
-		k.lock.RUnlock()
-		clientID = v
-	case []interface{}:
-		for _, audVal := range v {
-			k.lock.RLock()
-			policy, foundPolicy := clientSet[audVal.(string)]
-			k.lock.RUnlock()
-			if foundPolicy {
-				clientID = audVal.(string)
-				policyID = policy
-				break
-			}
+	// 2. Collect the policies from client, claim and scope mappings
+	clientID, clientPolicyID := provider.ClientID(claims)
+
+	var policiesToApply []string
+	if clientPolicyID != "" {
+		policiesToApply = append(policiesToApply, clientPolicyID)
+	}
+	policiesToApply = append(policiesToApply, provider.ClaimPolicies(claims)...)
+
+	if len(k.Spec.Scopes.OIDC.ScopeToPolicy) != 0 {
+		scopeClaimName := k.Spec.Scopes.OIDC.ScopeClaimName
+		if scopeClaimName == "" {
+			scopeClaimName = "scope"
+		}
+
+		if scope := getScopeFromClaim(claims, scopeClaimName); scope != nil {
+			// add all policies matched from scope-policy mapping
+			policiesToApply = append(policiesToApply, mapScopeToPolicies(k.Spec.Scopes.OIDC.ScopeToPolicy, scope)...)
 		}
 	}
 
-	if !useScope && policyID == "" {
+	policiesToApply = uniqueStrings(policiesToApply)
+	if len(policiesToApply) == 0 {
 		logger.Error("No matching policy found!")
 		k.reportLoginFailure("[NOT GENERATED]", r)
 		return errors.New("Key not authorised"), http.StatusUnauthorized
 	}
 
-	data := []byte(ouser.ID)
-	keyID := fmt.Sprintf("%x", md5.Sum(data))
+	// 3. Generate the internal representation for the key
+	keyID := fmt.Sprintf("%x", md5.Sum([]byte(subject)))
 	sessionID := k.Gw.generateToken(k.Spec.OrgID, keyID)
 
 	if k.Spec.OpenIDOptions.SegregateByClient {
@@ -177,49 +223,30 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ inte
 
 	logger.Debug("Generated Session ID: ", sessionID)
 
-	var policiesToApply []string
-	if !useScope {
-		policiesToApply = append(policiesToApply, policyID)
-	} else {
-		scopeClaimName := k.Spec.Scopes.OIDC.ScopeClaimName
-		if scopeClaimName == "" {
-			scopeClaimName = "scope"
-		}
-
-		if scope := getScopeFromClaim(token.Claims.(jwt.MapClaims), scopeClaimName); scope != nil {
-			// add all policies matched from scope-policy mapping
-			policiesToApply = mapScopeToPolicies(k.Spec.Scopes.OIDC.ScopeToPolicy, scope)
-		}
-	}
-
+	// 4. Create or set the session to match
 	session, exists := k.CheckSessionAndIdentityForValidKey(sessionID, r)
 	sessionID = session.KeyID
 	if !exists {
 		// Create it
 		logger.Debug("Key does not exist, creating")
-		session = user.SessionState{}
-
-		if !useScope {
-			// We need a base policy as a template, either get it from the token itself OR a proxy client ID within Tyk
-			newSession, err := k.Gw.generateSessionFromPolicy(policyID,
-				k.Spec.OrgID,
-				true)
-
-			if err != nil {
-				k.reportLoginFailure(sessionID, r)
-				logger.Error("Could not find a valid policy to apply to this token!")
-				return errors.New("Key not authorized: no matching policy"), http.StatusForbidden
-			}
 
-			session = newSession.Clone()
+		// We need a base policy as a template
+		newSession, err := k.Gw.generateSessionFromPolicy(policiesToApply[0],
+			k.Spec.OrgID,
+			true)
+
+		if err != nil {
+			k.reportLoginFailure(sessionID, r)
+			logger.Error("Could not find a valid policy to apply to this token!")
+			return errors.New("Key not authorized: no matching policy"), http.StatusForbidden
 		}
 
+		session = newSession.Clone()
 		session.OrgID = k.Spec.OrgID
 		session.MetaData = map[string]interface{}{"TykJWTSessionID": sessionID, "ClientID": clientID}
-		session.Alias = clientID + ":" + ouser.ID
+		session.Alias = clientID + ":" + subject
 		session.KeyID = sessionID
 
-		// Update the session in the session manager in case it gets called again
 		logger.Debug("Policy applied to key")
 	}
 	// apply new policy to session if any and update session
@@ -229,12 +256,13 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ inte
 		return errors.New("Key not authorized: could not apply new policy"), http.StatusForbidden
 	}
 
-	// 4. Set session state on context, we will need it later
+	// 5. Set session state on context, we will need it later
 	switch k.Spec.BaseIdentityProvidedBy {
 	case apidef.OIDCUser, apidef.UnsetAuth:
 		ctxSetSession(r, &session, true, k.Gw.GetConfig().HashKeys)
 	}
 	ctxSetJWTContextVars(k.Spec, r, token)
+	k.forwardClaims(r, claims)
 
 	return nil, http.StatusOK
 }
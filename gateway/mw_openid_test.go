@@ -0,0 +1,157 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func createOIDCToken(claims jwt.MapClaims) string {
+	return CreateJWKToken(func(t *jwt.Token) {
+		t.Header[KID] = "12345"
+		t.Claims.(jwt.MapClaims)["iss"] = TestHttpAny
+		t.Claims.(jwt.MapClaims)[SUB] = "user"
+		t.Claims.(jwt.MapClaims)["exp"] = time.Now().Add(time.Hour).Unix()
+		for k, v := range claims {
+			t.Claims.(jwt.MapClaims)[k] = v
+		}
+	})
+}
+
+func TestOpenIDDiscovery(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	clientPolicy := ts.CreatePolicy()
+	groupPolicy := ts.CreatePolicy()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.UseOpenID = true
+		spec.Proxy.ListenPath = "/"
+		spec.OpenIDOptions = apidef.OpenIDOptions{
+			Providers: []apidef.OIDProviderConfig{{
+				Issuer: TestHttpAny,
+				ClientIDs: map[string]string{
+					base64.StdEncoding.EncodeToString([]byte("web-app")): clientPolicy,
+				},
+				Audiences: []string{"api"},
+				ClaimPolicies: []apidef.OIDClaimPolicyRule{
+					{Claim: "realm_access.roles", Value: "admin", PolicyID: groupPolicy},
+				},
+			}},
+			ForwardClaims: map[string]string{"email": "X-User-Email", "groups": "X-User-Groups"},
+		}
+	})
+
+	authHeader := func(token string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + token}
+	}
+
+	t.Run("Client ID audience", func(t *testing.T) {
+		token := createOIDCToken(jwt.MapClaims{"aud": "web-app"})
+		_, _ = ts.Run(t, test.TestCase{Headers: authHeader(token), Code: http.StatusOK})
+	})
+
+	t.Run("Unknown audience", func(t *testing.T) {
+		token := createOIDCToken(jwt.MapClaims{"aud": "other-app"})
+		_, _ = ts.Run(t, test.TestCase{Headers: authHeader(token), Code: http.StatusUnauthorized})
+	})
+
+	t.Run("Unknown issuer", func(t *testing.T) {
+		token := createOIDCToken(jwt.MapClaims{"aud": "web-app", "iss": "https://unknown.example.com"})
+		_, _ = ts.Run(t, test.TestCase{Headers: authHeader(token), Code: http.StatusUnauthorized})
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		token := createOIDCToken(jwt.MapClaims{"aud": "web-app", "exp": time.Now().Add(-time.Hour).Unix()})
+		_, _ = ts.Run(t, test.TestCase{Headers: authHeader(token), Code: http.StatusUnauthorized})
+	})
+
+	t.Run("Multiple audiences require azp", func(t *testing.T) {
+		token := createOIDCToken(jwt.MapClaims{"aud": []string{"web-app", "api"}})
+		_, _ = ts.Run(t, test.TestCase{Headers: authHeader(token), Code: http.StatusUnauthorized})
+
+		token = createOIDCToken(jwt.MapClaims{"aud": []string{"web-app", "api"}, "azp": "web-app"})
+		_, _ = ts.Run(t, test.TestCase{Headers: authHeader(token), Code: http.StatusOK})
+
+		token = createOIDCToken(jwt.MapClaims{"aud": []string{"web-app", "api"}, "azp": "rogue"})
+		_, _ = ts.Run(t, test.TestCase{Headers: authHeader(token), Code: http.StatusUnauthorized})
+	})
+
+	t.Run("Claim policy rule", func(t *testing.T) {
+		token := createOIDCToken(jwt.MapClaims{"aud": "api", SUB: "admin-user"})
+		_, _ = ts.Run(t, test.TestCase{Headers: authHeader(token), Code: http.StatusUnauthorized})
+
+		token = createOIDCToken(jwt.MapClaims{
+			"aud":          "api",
+			SUB:            "admin-user",
+			"realm_access": map[string]interface{}{"roles": []string{"viewer", "admin"}},
+		})
+		_, _ = ts.Run(t, test.TestCase{Headers: authHeader(token), Code: http.StatusOK})
+	})
+
+	t.Run("Forwarded claims", func(t *testing.T) {
+		token := createOIDCToken(jwt.MapClaims{
+			"aud":    "web-app",
+			"email":  "user@example.com",
+			"groups": []string{"dev", "ops"},
+		})
+		_, _ = ts.Run(t, test.TestCase{
+			Headers:   authHeader(token),
+			Code:      http.StatusOK,
+			BodyMatch: `"X-User-Email":"user@example.com"`,
+		}, test.TestCase{
+			Headers:   authHeader(token),
+			Code:      http.StatusOK,
+			BodyMatch: `"X-User-Groups":"dev,ops"`,
+		})
+	})
+}
+
+func TestOpenIDNonce(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	pID := ts.CreatePolicy()
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.UseOpenID = true
+		spec.Proxy.ListenPath = "/"
+		spec.OpenIDOptions = apidef.OpenIDOptions{
+			Providers: []apidef.OIDProviderConfig{{
+				Issuer:    TestHttpAny,
+				ClientIDs: map[string]string{base64.StdEncoding.EncodeToString([]byte("web-app")): pID},
+			}},
+			ValidateNonce: true,
+		}
+	})
+
+	token := createOIDCToken(jwt.MapClaims{"aud": "web-app", "nonce": "n-0S6_WzA2Mj"})
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Headers: map[string]string{"Authorization": token}, Code: http.StatusUnauthorized},
+		{Headers: map[string]string{"Authorization": token, defaultOIDCNonceHeader: "other"}, Code: http.StatusUnauthorized},
+		{Headers: map[string]string{"Authorization": token, defaultOIDCNonceHeader: "n-0S6_WzA2Mj"}, Code: http.StatusOK},
+	}...)
+}
+
+func TestOIDCClaimHelpers(t *testing.T) {
+	assert.True(t, oidcClaimContains("admin", "admin"))
+	assert.True(t, oidcClaimContains([]interface{}{"dev", "admin"}, "admin"))
+	assert.True(t, oidcClaimContains(true, "true"))
+	assert.False(t, oidcClaimContains([]interface{}{"dev"}, "admin"))
+	assert.False(t, oidcClaimContains(nil, "admin"))
+
+	assert.Equal(t, "a,b", oidcClaimHeaderValue([]interface{}{"a", "b"}))
+	assert.Equal(t, "42", oidcClaimHeaderValue(float64(42)))
+	assert.Equal(t, "1.5", oidcClaimHeaderValue(1.5))
+	assert.Equal(t, `{"k":"v"}`, oidcClaimHeaderValue(map[string]interface{}{"k": "v"}))
+}
@@ -37,6 +37,7 @@ func (k *RateLimitAndQuotaCheck) handleRateLimitFailure(r *http.Request, token s
 
 	// Report in health check
 	reportHealthValue(k.Spec, Throttle, "-1")
+	k.Gw.prometheus.reportRateLimited(k.Spec, r)
 
 	return errors.New("Rate limit exceeded"), http.StatusTooManyRequests
 }
@@ -54,6 +55,7 @@ func (k *RateLimitAndQuotaCheck) handleQuotaFailure(r *http.Request, token strin
 
 	// Report in health check
 	reportHealthValue(k.Spec, QuotaViolation, "-1")
+	k.Gw.prometheus.reportQuotaExceeded(k.Spec, r)
 
 	return errors.New("Quota exceeded"), http.StatusForbidden
 }
@@ -203,6 +203,8 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		token = request.RealIP(r)
 	}
 
+	store := storage.WithContext(m.CacheStore, r.Context())
+
 	var errCreatingChecksum bool
 	var retBlob string
 	key, err := m.CreateCheckSum(r, token, cacheKeyRegex, m.getCacheKeyFromHeaders(r))
@@ -211,7 +213,7 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		errCreatingChecksum = true
 	} else {
 		v, sfErr, _ := m.singleFlight.Do(key, func() (interface{}, error) {
-			return m.CacheStore.GetKey(key)
+			return store.GetKey(key)
 		})
 		retBlob = v.(string)
 		err = sfErr
@@ -305,7 +307,7 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 			ts := m.getTimeTTL(cacheTTL)
 			toStore := m.encodePayload(wireFormatReq.String(), ts)
 			go func() {
-				err := m.CacheStore.SetKey(key, toStore, cacheTTL)
+				err := store.SetKey(key, toStore, cacheTTL)
 				if err != nil {
 					log.WithError(err).Error("could not save key in cache store")
 				}
@@ -318,12 +320,12 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 	cachedData, timestamp, err := m.decodePayload(retBlob)
 	if err != nil {
 		// Tere was an issue with this cache entry - lets remove it:
-		m.CacheStore.DeleteKey(key)
+		store.DeleteKey(key)
 		return nil, http.StatusOK
 	}
 
 	if m.isTimeStampExpired(timestamp) || len(cachedData) == 0 {
-		m.CacheStore.DeleteKey(key)
+		store.DeleteKey(key)
 		return nil, http.StatusOK
 	}
 
@@ -365,6 +367,9 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		m.Proxy.CopyResponse(w, newRes.Body, 0)
 	}
 
+	m.Gw.prometheus.reportCacheHit(m.Spec, r)
+	m.Gw.prometheus.observeRequest(m.Spec, r, newRes.StatusCode, 0, 0)
+
 	// Record analytics
 	if !m.Spec.DoNotTrack {
 		m.sh.RecordHit(r, Latency{}, newRes.StatusCode, newRes)
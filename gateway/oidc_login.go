@@ -0,0 +1,578 @@
+package gateway
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	oidcCallbackPath = "/oidc/callback"
+	oidcLogoutPath   = "/oidc/logout"
+
+	defaultOIDCSessionCookie   = "tyk_oidc_session"
+	oidcStateCookieSuffix      = "_state"
+	defaultOIDCSessionLifetime = 24 * 60 * 60
+	oidcStateLifetime          = 10 * time.Minute
+	// oidcRefreshSkew refreshes ID tokens shortly before they expire, so
+	// they don't expire while the request is in flight.
+	oidcRefreshSkew = 30 * time.Second
+)
+
+var errOIDCSessionNotFound = errors.New("browser session not found")
+
+// oidcLoginState is kept in a short lived cookie between the authorization
+// redirect and the callback.
+type oidcLoginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	ReturnTo string `json:"return_to"`
+	Expires  int64  `json:"expires"`
+}
+
+// oidcBrowserSession is stored server side, the cookie only carries its ID.
+type oidcBrowserSession struct {
+	IDToken      string `json:"id_token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Expires      int64  `json:"expires"`
+	// Nonce is the nonce sent in the authorization request of the login.
+	Nonce string `json:"nonce"`
+	// SessionExpires is when the browser session ends, refreshing the tokens doesn't extend it.
+	SessionExpires int64 `json:"session_expires"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error"`
+	ErrorDesc    string `json:"error_description"`
+}
+
+// OIDCLoginManager implements the OpenID Connect authorization code flow for
+// browsers: it redirects unauthenticated users to the provider, handles the
+// callback and keeps the resulting tokens in a server side session that is
+// referenced by an encrypted cookie.
+type OIDCLoginManager struct {
+	Spec *APISpec
+	Gw   *Gateway
+
+	conf     apidef.OIDCBrowserLogin
+	provider *oidcProvider
+	store    storage.Handler
+	aead     cipher.AEAD
+}
+
+func (gw *Gateway) newOIDCLoginManager(spec *APISpec) (*OIDCLoginManager, error) {
+	conf := spec.OpenIDOptions.BrowserLogin
+
+	if conf.ClientID == "" {
+		return nil, errors.New("browser login requires a client_id")
+	}
+
+	var providerConf *apidef.OIDProviderConfig
+	for i, p := range spec.OpenIDOptions.Providers {
+		if conf.Issuer == "" || strings.TrimSuffix(p.Issuer, "/") == strings.TrimSuffix(conf.Issuer, "/") {
+			providerConf = &spec.OpenIDOptions.Providers[i]
+			break
+		}
+	}
+	if providerConf == nil {
+		return nil, fmt.Errorf("browser login issuer %q is not a configured provider", conf.Issuer)
+	}
+
+	secret, err := gw.resolveDefinitionSecret(conf.CookieSecret)
+	if err != nil {
+		return nil, fmt.Errorf("cookie_secret: %v", err)
+	}
+	// the client secret is resolved for each token request, so that it can be rotated
+	if err := gw.checkDefinitionSecret(conf.ClientSecret); err != nil {
+		return nil, fmt.Errorf("client_secret: %v", err)
+	}
+	if secret == "" {
+		return nil, errors.New("browser login requires a cookie_secret")
+	}
+
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.CookieName == "" {
+		conf.CookieName = defaultOIDCSessionCookie
+	}
+	if conf.SessionLifetime <= 0 {
+		conf.SessionLifetime = defaultOIDCSessionLifetime
+	}
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = []string{"openid", "profile", "email"}
+	}
+
+	// Tokens obtained by the gateway itself are always issued to its own client.
+	pConf := *providerConf
+	pConf.Audiences = append([]string{conf.ClientID}, pConf.Audiences...)
+	pConf.AuthorizedParties = nil
+
+	store := gw.newStore(storage.StoreOptions{KeyPrefix: "oidc-session-" + spec.APIID + "-"})
+	store.Connect()
+
+	return &OIDCLoginManager{
+		Spec:     spec,
+		Gw:       gw,
+		conf:     conf,
+		provider: newOIDCProvider(pConf, gw.newOIDCHTTPClient()),
+		store:    store,
+		aead:     aead,
+	}, nil
+}
+
+func (gw *Gateway) addOIDCLoginHandlers(spec *APISpec, muxer *mux.Router, logger *logrus.Entry) *OIDCLoginManager {
+	m, err := gw.newOIDCLoginManager(spec)
+	if err != nil {
+		logger.WithError(err).Error("Couldn't set up OpenID Connect browser login")
+		return nil
+	}
+
+	muxer.HandleFunc(oidcCallbackPath, allowMethods(m.HandleCallback, http.MethodGet))
+	// POST only, so that other sites can't log users out with a link or an image
+	muxer.HandleFunc(oidcLogoutPath, allowMethods(m.HandleLogout, http.MethodPost))
+
+	return m
+}
+
+// seal encrypts and authenticates v, binding it to the cookie name.
+func (m *OIDCLoginManager) seal(name string, v interface{}) (string, error) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := m.aead.Seal(nonce, nonce, plain, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (m *OIDCLoginManager) open(name, value string, v interface{}) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+
+	if len(sealed) < m.aead.NonceSize() {
+		return errors.New("cookie too short")
+	}
+
+	nonce, ciphertext := sealed[:m.aead.NonceSize()], sealed[m.aead.NonceSize():]
+	plain, err := m.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(plain, v)
+}
+
+func (m *OIDCLoginManager) setCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     m.cookiePath(),
+		Domain:   m.conf.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   requestScheme(r) == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (m *OIDCLoginManager) cookiePath() string {
+	if m.Spec.Proxy.ListenPath == "" {
+		return "/"
+	}
+	return m.Spec.Proxy.ListenPath
+}
+
+func (m *OIDCLoginManager) stateCookieName() string {
+	return m.conf.CookieName + oidcStateCookieSuffix
+}
+
+func (m *OIDCLoginManager) redirectURL(r *http.Request) string {
+	if m.conf.RedirectURL != "" {
+		return m.conf.RedirectURL
+	}
+
+	u := url.URL{
+		Scheme: requestScheme(r),
+		Host:   r.Host,
+		Path:   path.Join(m.Spec.Proxy.ListenPath, oidcCallbackPath),
+	}
+	return u.String()
+}
+
+// requestScheme returns the scheme the client used to reach the gateway.
+func requestScheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return strings.ToLower(proto)
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Login redirects the browser to the provider's authorization endpoint.
+func (m *OIDCLoginManager) Login(w http.ResponseWriter, r *http.Request) error {
+	doc, err := m.provider.Discovery()
+	if err != nil {
+		return err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	cookie, err := m.seal(m.stateCookieName(), oidcLoginState{
+		State:    state,
+		Nonce:    nonce,
+		ReturnTo: r.URL.RequestURI(),
+		Expires:  time.Now().Add(oidcStateLifetime).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	m.setCookie(w, r, m.stateCookieName(), cookie, int(oidcStateLifetime.Seconds()))
+
+	authURL, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return err
+	}
+
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", m.conf.ClientID)
+	q.Set("redirect_uri", m.redirectURL(r))
+	q.Set("scope", strings.Join(m.conf.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	authURL.RawQuery = q.Encode()
+
+	http.Redirect(w, r, authURL.String(), http.StatusFound)
+	return nil
+}
+
+// HandleCallback completes the login by exchanging the authorization code.
+func (m *OIDCLoginManager) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(logrus.Fields{"prefix": "oidc", "api_id": m.Spec.APIID})
+
+	if errCode := r.URL.Query().Get("error"); errCode != "" {
+		logger.WithField("error", errCode).Warning("Provider rejected the login")
+		doJSONWrite(w, http.StatusUnauthorized, apiError("Login failed: "+errCode))
+		return
+	}
+
+	stateCookie, err := r.Cookie(m.stateCookieName())
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Login state not found"))
+		return
+	}
+	m.setCookie(w, r, m.stateCookieName(), "", -1)
+
+	var state oidcLoginState
+	if err := m.open(m.stateCookieName(), stateCookie.Value, &state); err != nil ||
+		state.State != r.URL.Query().Get("state") || time.Now().Unix() > state.Expires {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Invalid login state"))
+		return
+	}
+
+	tokens, err := m.exchange(url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {r.URL.Query().Get("code")},
+		"redirect_uri": {m.redirectURL(r)},
+	})
+	if err != nil {
+		logger.WithError(err).Error("Authorization code exchange failed")
+		doJSONWrite(w, http.StatusUnauthorized, apiError("Login failed"))
+		return
+	}
+
+	token, err := m.provider.Verify(tokens.IDToken)
+	if err != nil {
+		logger.WithError(err).Warning("Provider returned an invalid ID token")
+		doJSONWrite(w, http.StatusUnauthorized, apiError("Login failed"))
+		return
+	}
+
+	if nonce, _ := token.Claims.(jwt.MapClaims)["nonce"].(string); nonce != state.Nonce {
+		logger.Warning("ID token nonce mismatch")
+		doJSONWrite(w, http.StatusUnauthorized, apiError("Login failed"))
+		return
+	}
+
+	sessionID, err := randomToken()
+	if err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Login failed"))
+		return
+	}
+
+	session := m.newBrowserSession(tokens, token, state.Nonce)
+	session.SessionExpires = time.Now().Unix() + m.conf.SessionLifetime
+	if err := m.saveSession(sessionID, session); err != nil {
+		logger.WithError(err).Error("Couldn't store browser session")
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Login failed"))
+		return
+	}
+
+	cookie, err := m.seal(m.conf.CookieName, sessionID)
+	if err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Login failed"))
+		return
+	}
+	m.setCookie(w, r, m.conf.CookieName, cookie, int(m.conf.SessionLifetime))
+
+	returnTo := state.ReturnTo
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+		returnTo = m.cookiePath()
+	}
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// HandleLogout removes the browser session and ends the provider session if supported.
+func (m *OIDCLoginManager) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	var idToken string
+	if sessionID, err := m.sessionID(r); err == nil {
+		if session, err := m.loadSession(sessionID); err == nil {
+			idToken = session.IDToken
+		}
+		m.store.DeleteKey(sessionID)
+	}
+	m.setCookie(w, r, m.conf.CookieName, "", -1)
+
+	target := m.conf.PostLogoutRedirectURL
+	if doc, err := m.provider.Discovery(); err == nil && doc.EndSessionEndpoint != "" {
+		if u, err := url.Parse(doc.EndSessionEndpoint); err == nil {
+			q := u.Query()
+			if idToken != "" {
+				q.Set("id_token_hint", idToken)
+			}
+			if target != "" {
+				q.Set("post_logout_redirect_uri", target)
+			}
+			u.RawQuery = q.Encode()
+			target = u.String()
+		}
+	}
+
+	if target == "" {
+		target = m.cookiePath()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// IDToken returns a valid ID token for the browser session of the request,
+// refreshing it if needed, and the nonce of the login it was issued for. It
+// returns an empty token if there is no usable session.
+func (m *OIDCLoginManager) IDToken(r *http.Request) (idToken, nonce string, err error) {
+	sessionID, err := m.sessionID(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	session, err := m.loadSession(sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if time.Now().Add(oidcRefreshSkew).Unix() < session.Expires {
+		return session.IDToken, session.Nonce, nil
+	}
+
+	if session.RefreshToken == "" {
+		m.store.DeleteKey(sessionID)
+		return "", "", errors.New("browser session expired")
+	}
+
+	tokens, err := m.exchange(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {session.RefreshToken},
+	})
+	if err != nil {
+		m.store.DeleteKey(sessionID)
+		return "", "", err
+	}
+
+	if tokens.IDToken == "" {
+		// The ID token is optional on refresh, keep the previous identity.
+		tokens.IDToken = session.IDToken
+	}
+	if tokens.RefreshToken == "" {
+		tokens.RefreshToken = session.RefreshToken
+	}
+
+	token, err := m.provider.Verify(tokens.IDToken)
+	if err != nil {
+		m.store.DeleteKey(sessionID)
+		return "", "", err
+	}
+
+	refreshed := m.newBrowserSession(tokens, token, session.Nonce)
+	refreshed.SessionExpires = session.SessionExpires
+	if err := m.saveSession(sessionID, refreshed); err != nil {
+		return "", "", err
+	}
+
+	return tokens.IDToken, session.Nonce, nil
+}
+
+func (m *OIDCLoginManager) newBrowserSession(tokens *oidcTokenResponse, idToken *jwt.Token, nonce string) oidcBrowserSession {
+	session := oidcBrowserSession{
+		IDToken:      tokens.IDToken,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Nonce:        nonce,
+	}
+
+	if exp, ok := idToken.Claims.(jwt.MapClaims)["exp"].(float64); ok {
+		session.Expires = int64(exp)
+	}
+
+	return session
+}
+
+func (m *OIDCLoginManager) sessionID(r *http.Request) (string, error) {
+	cookie, err := r.Cookie(m.conf.CookieName)
+	if err != nil {
+		return "", errOIDCSessionNotFound
+	}
+
+	var sessionID string
+	if err := m.open(m.conf.CookieName, cookie.Value, &sessionID); err != nil {
+		return "", err
+	}
+
+	return sessionID, nil
+}
+
+func (m *OIDCLoginManager) loadSession(sessionID string) (*oidcBrowserSession, error) {
+	raw, err := m.store.GetKey(sessionID)
+	if err != nil {
+		return nil, errOIDCSessionNotFound
+	}
+
+	session := &oidcBrowserSession{}
+	if err := json.Unmarshal([]byte(raw), session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// saveSession stores session until it ends.
+func (m *OIDCLoginManager) saveSession(sessionID string, session oidcBrowserSession) error {
+	ttl := session.SessionExpires - time.Now().Unix()
+	if ttl <= 0 {
+		m.store.DeleteKey(sessionID)
+		return errors.New("browser session expired")
+	}
+
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return m.store.SetKey(sessionID, string(raw), ttl)
+}
+
+// exchange calls the token endpoint, authenticating with client_secret_basic.
+func (m *OIDCLoginManager) exchange(form url.Values) (*oidcTokenResponse, error) {
+	doc, err := m.provider.Discovery()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	clientSecret, err := m.Gw.resolveDefinitionSecret(m.conf.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(url.QueryEscape(m.conf.ClientID), url.QueryEscape(clientSecret))
+
+	resp, err := m.provider.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tokens := &oidcTokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(tokens); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDesc)
+	}
+
+	if tokens.IDToken == "" && form.Get("grant_type") == "authorization_code" {
+		return nil, errors.New("token endpoint returned no id_token")
+	}
+
+	return tokens, nil
+}
+
+// stripCookies removes the named cookies from the request so they don't reach the upstream.
+func stripCookies(r *http.Request, names ...string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if !containsString(names, c.Name) {
+			r.AddCookie(c)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+// testOIDCProvider is a minimal OpenID provider supporting the authorization code and refresh token grants.
+type testOIDCProvider struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	nonces    map[string]string
+	tokenTTL  time.Duration
+	refreshes int32
+}
+
+func newTestOIDCProvider() *testOIDCProvider {
+	p := &testOIDCProvider{nonces: map[string]string{}, tokenTTL: time.Hour}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidcDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"end_session_endpoint":   p.URL + "/logout",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, jwkTestJson)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "gateway" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		r.ParseForm()
+		p.mu.Lock()
+		nonce := p.nonces[r.Form.Get("code")]
+		ttl := p.tokenTTL
+		p.mu.Unlock()
+
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			if nonce == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+		case "refresh_token":
+			atomic.AddInt32(&p.refreshes, 1)
+		}
+
+		idToken := CreateJWKToken(func(t *jwt.Token) {
+			t.Header[KID] = "12345"
+			t.Claims.(jwt.MapClaims)["iss"] = p.URL
+			t.Claims.(jwt.MapClaims)["aud"] = "gateway"
+			t.Claims.(jwt.MapClaims)[SUB] = "browser-user"
+			t.Claims.(jwt.MapClaims)["exp"] = time.Now().Add(ttl).Unix()
+			if nonce != "" {
+				t.Claims.(jwt.MapClaims)["nonce"] = nonce
+			}
+		})
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"id_token":      idToken,
+			"refresh_token": "refresh",
+			"expires_in":    int64(ttl.Seconds()),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+
+	return p
+}
+
+// authorize simulates the user logging in at the provider, returning the code.
+func (p *testOIDCProvider) authorize(t *testing.T, location string) (code, state string) {
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, p.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "gateway", u.Query().Get("client_id"))
+	assert.Equal(t, "code", u.Query().Get("response_type"))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code = "code-" + u.Query().Get("state")[:8]
+	p.nonces[code] = u.Query().Get("nonce")
+
+	return code, u.Query().Get("state")
+}
+
+func responseCookie(resp *http.Response, name string) *http.Cookie {
+	for _, c := range resp.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestOpenIDBrowserLogin(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	idp := newTestOIDCProvider()
+	defer idp.Close()
+
+	pID := ts.CreatePolicy()
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.UseOpenID = true
+		spec.Proxy.ListenPath = "/"
+		spec.OpenIDOptions = apidef.OpenIDOptions{
+			Providers: []apidef.OIDProviderConfig{{
+				Issuer:    idp.URL,
+				ClientIDs: map[string]string{base64.StdEncoding.EncodeToString([]byte("gateway")): pID},
+			}},
+			// browser sessions are checked against the nonce of their login, not the header
+			ValidateNonce: true,
+			BrowserLogin: apidef.OIDCBrowserLogin{
+				Enabled:      true,
+				ClientID:     "gateway",
+				ClientSecret: "secret",
+				CookieSecret: "cookie-secret",
+			},
+		}
+	})
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// Unauthenticated requests start the login
+	resp, _ := ts.Run(t, test.TestCase{Path: "/app?x=1", Client: noRedirect, Code: http.StatusFound})
+	stateCookie := responseCookie(resp, defaultOIDCSessionCookie+oidcStateCookieSuffix)
+	if !assert.NotNil(t, stateCookie) {
+		return
+	}
+	code, state := idp.authorize(t, resp.Header.Get("Location"))
+
+	t.Run("Non GET requests are rejected", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/app", Client: noRedirect, Code: http.StatusUnauthorized})
+	})
+
+	t.Run("Callback with wrong state", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{
+			Path:    oidcCallbackPath + "?code=" + code + "&state=forged",
+			Cookies: []*http.Cookie{stateCookie},
+			Client:  noRedirect,
+			Code:    http.StatusBadRequest,
+		})
+	})
+
+	resp, _ = ts.Run(t, test.TestCase{
+		Path:         oidcCallbackPath + "?code=" + code + "&state=" + state,
+		Cookies:      []*http.Cookie{stateCookie},
+		Client:       noRedirect,
+		Code:         http.StatusFound,
+		HeadersMatch: map[string]string{"Location": "/app?x=1"},
+	})
+	sessionCookie := responseCookie(resp, defaultOIDCSessionCookie)
+	if !assert.NotNil(t, sessionCookie) {
+		return
+	}
+	assert.True(t, sessionCookie.HttpOnly)
+
+	t.Run("Session cookie authenticates", func(t *testing.T) {
+		// neither the session nor the state cookie reach the upstream
+		_, _ = ts.Run(t, test.TestCase{
+			Path:         "/app",
+			Cookies:      []*http.Cookie{sessionCookie, stateCookie},
+			Client:       noRedirect,
+			Code:         http.StatusOK,
+			BodyNotMatch: defaultOIDCSessionCookie,
+		})
+	})
+
+	t.Run("Tampered cookie is rejected", func(t *testing.T) {
+		tampered := *sessionCookie
+		tampered.Value = "x" + tampered.Value[1:]
+		_, _ = ts.Run(t, test.TestCase{Path: "/app", Cookies: []*http.Cookie{&tampered}, Client: noRedirect, Code: http.StatusFound})
+	})
+
+	t.Run("Session of another login is rejected", func(t *testing.T) {
+		spec := ts.Gw.getApiSpec(ts.Gw.apiSpecs[0].APIID)
+		sessionID, err := spec.OIDCLoginManager.sessionID(&http.Request{Header: http.Header{"Cookie": {sessionCookie.String()}}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		session, err := spec.OIDCLoginManager.loadSession(sessionID)
+		if !assert.NoError(t, err) {
+			return
+		}
+		nonce := session.Nonce
+		session.Nonce = "other"
+		assert.NoError(t, spec.OIDCLoginManager.saveSession(sessionID, *session))
+		_, _ = ts.Run(t, test.TestCase{Path: "/app", Cookies: []*http.Cookie{sessionCookie}, Client: noRedirect, Code: http.StatusUnauthorized})
+
+		session.Nonce = nonce
+		assert.NoError(t, spec.OIDCLoginManager.saveSession(sessionID, *session))
+	})
+
+	t.Run("Tokens are refreshed", func(t *testing.T) {
+		spec := ts.Gw.getApiSpec(ts.Gw.apiSpecs[0].APIID)
+		sessionID, err := spec.OIDCLoginManager.sessionID(&http.Request{Header: http.Header{"Cookie": {sessionCookie.String()}}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		session, err := spec.OIDCLoginManager.loadSession(sessionID)
+		if !assert.NoError(t, err) {
+			return
+		}
+		session.Expires = time.Now().Unix()
+		session.SessionExpires = time.Now().Unix() + 100
+		assert.NoError(t, spec.OIDCLoginManager.saveSession(sessionID, *session))
+
+		_, _ = ts.Run(t, test.TestCase{Path: "/app", Cookies: []*http.Cookie{sessionCookie}, Client: noRedirect, Code: http.StatusOK})
+		assert.Equal(t, int32(1), atomic.LoadInt32(&idp.refreshes))
+
+		refreshed, err := spec.OIDCLoginManager.loadSession(sessionID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, session.SessionExpires, refreshed.SessionExpires, "refreshes keep the session end")
+		}
+		ttl, _ := spec.OIDCLoginManager.store.GetExp(sessionID)
+		assert.True(t, ttl > 0 && ttl <= 100, "refreshes keep the session end")
+
+		_, _ = ts.Run(t, test.TestCase{Path: "/app", Cookies: []*http.Cookie{sessionCookie}, Client: noRedirect, Code: http.StatusOK})
+		assert.Equal(t, int32(1), atomic.LoadInt32(&idp.refreshes))
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		_, _ = ts.Run(t, test.TestCase{Path: oidcLogoutPath, Cookies: []*http.Cookie{sessionCookie}, Client: noRedirect, Code: http.StatusMethodNotAllowed})
+
+		resp, _ := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: oidcLogoutPath, Cookies: []*http.Cookie{sessionCookie}, Client: noRedirect, Code: http.StatusFound})
+		assert.Contains(t, resp.Header.Get("Location"), idp.URL+"/logout?id_token_hint=")
+
+		_, _ = ts.Run(t, test.TestCase{Path: "/app", Cookies: []*http.Cookie{sessionCookie}, Client: noRedirect, Code: http.StatusFound})
+	})
+}
+
+func TestOIDCLoginSecretStores(t *testing.T) {
+	gw := &Gateway{}
+	newManager := func(stores []string, clientSecret string) error {
+		conf := config.Config{Secrets: map[string]string{"cookie": "cookie-secret", "client": "secret"}}
+		conf.KV.APIDefinitionStores = stores
+		gw.SetConfig(conf)
+
+		spec := &APISpec{APIDefinition: &apidef.APIDefinition{
+			APIID: "oidc",
+			OpenIDOptions: apidef.OpenIDOptions{
+				Providers: []apidef.OIDProviderConfig{{Issuer: "https://idp.example.com"}},
+				BrowserLogin: apidef.OIDCBrowserLogin{
+					Enabled:      true,
+					ClientID:     "gateway",
+					ClientSecret: clientSecret,
+					CookieSecret: "secrets://cookie",
+				},
+			},
+		}}
+		_, err := gw.newOIDCLoginManager(spec)
+		return err
+	}
+
+	assert.Error(t, newManager(nil, "secret"), "cookie secret store isn't allowed")
+	assert.Error(t, newManager([]string{"secrets"}, "env://TYK_CLIENT_SECRET"), "client secret store isn't allowed")
+	assert.NoError(t, newManager([]string{"secrets"}, "secrets://client"))
+
+	_, err := gw.resolveDefinitionSecret("env://TYK_CLIENT_SECRET")
+	assert.Equal(t, errKVStoreNotAllowed, err, "token requests don't resolve other stores")
+}
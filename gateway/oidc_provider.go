@@ -0,0 +1,408 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const (
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+
+	// oidcDiscoveryTTL is how long a discovery document and its key set are
+	// trusted before they are fetched again.
+	oidcDiscoveryTTL = 10 * time.Minute
+	// oidcKeyRefreshInterval limits how often an unknown "kid" may trigger
+	// a key set refetch, so that garbage tokens can't hammer the IdP.
+	oidcKeyRefreshInterval = 30 * time.Second
+)
+
+var (
+	errOIDCUnknownKey   = errors.New("no matching key found in provider key set")
+	errOIDCIssuer       = errors.New("issuer mismatch")
+	errOIDCAudience     = errors.New("token audience not accepted")
+	errOIDCAuthzParty   = errors.New("token authorized party not accepted")
+	errOIDCSigningAlgo  = errors.New("unexpected signing method")
+	errOIDCNoDiscovered = errors.New("provider discovery document has no jwks_uri")
+)
+
+// oidcDiscoveryDocument is the subset of the OpenID Provider Metadata we use.
+type oidcDiscoveryDocument struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	EndSessionEndpoint    string   `json:"end_session_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// oidcProvider validates ID tokens issued by a single OpenID provider, using
+// the keys advertised in its discovery document.
+type oidcProvider struct {
+	Issuer       string
+	DiscoveryURL string
+
+	// clients maps decoded client IDs to policy IDs.
+	clients           map[string]string
+	audiences         map[string]bool
+	authorizedParties map[string]bool
+	claimPolicies     []apidef.OIDClaimPolicyRule
+
+	client *http.Client
+
+	mu            sync.RWMutex
+	doc           *oidcDiscoveryDocument
+	keys          *jose.JSONWebKeySet
+	fetchedAt     time.Time
+	keysCheckedAt time.Time
+}
+
+func newOIDCProvider(conf apidef.OIDProviderConfig, client *http.Client) *oidcProvider {
+	p := &oidcProvider{
+		Issuer:            conf.Issuer,
+		DiscoveryURL:      conf.DiscoveryURL,
+		clients:           make(map[string]string, len(conf.ClientIDs)),
+		audiences:         make(map[string]bool),
+		authorizedParties: make(map[string]bool),
+		claimPolicies:     conf.ClaimPolicies,
+		client:            client,
+	}
+
+	if p.DiscoveryURL == "" {
+		p.DiscoveryURL = strings.TrimSuffix(conf.Issuer, "/") + oidcDiscoveryPath
+	}
+
+	for encodedID, policyID := range conf.ClientIDs {
+		clientID := encodedID
+		if decoded, err := decodeOIDCClientID(encodedID); err == nil {
+			clientID = decoded
+		}
+		p.clients[clientID] = policyID
+		p.audiences[clientID] = true
+	}
+
+	for _, aud := range conf.Audiences {
+		p.audiences[aud] = true
+	}
+
+	for _, azp := range conf.AuthorizedParties {
+		p.authorizedParties[azp] = true
+	}
+
+	return p
+}
+
+// newOIDCHTTPClient returns the client used to talk to OpenID providers.
+func (gw *Gateway) newOIDCHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: gw.GetConfig().JWTSSLInsecureSkipVerify},
+		},
+	}
+}
+
+// Discovery returns the provider metadata, fetching it if it is missing or stale.
+func (p *oidcProvider) Discovery() (*oidcDiscoveryDocument, error) {
+	p.mu.RLock()
+	doc, fetchedAt := p.doc, p.fetchedAt
+	p.mu.RUnlock()
+
+	if doc != nil && time.Since(fetchedAt) < oidcDiscoveryTTL {
+		return doc, nil
+	}
+
+	if err := p.refresh(); err != nil {
+		if doc != nil {
+			// Keep serving the last good document if the IdP is unavailable.
+			log.WithError(err).WithField("issuer", p.Issuer).Warning("Failed to refresh OpenID discovery document, using cached copy")
+			return doc, nil
+		}
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.doc, nil
+}
+
+func (p *oidcProvider) refresh() error {
+	doc := &oidcDiscoveryDocument{}
+	if err := p.getJSON(p.DiscoveryURL, doc); err != nil {
+		return fmt.Errorf("fetching discovery document: %v", err)
+	}
+
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return fmt.Errorf("discovery document issuer %q does not match configured issuer %q", doc.Issuer, p.Issuer)
+	}
+
+	if doc.JWKSURI == "" {
+		return errOIDCNoDiscovered
+	}
+
+	keys := &jose.JSONWebKeySet{}
+	if err := p.getJSON(doc.JWKSURI, keys); err != nil {
+		return fmt.Errorf("fetching key set: %v", err)
+	}
+
+	p.mu.Lock()
+	p.doc = doc
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	p.keysCheckedAt = p.fetchedAt
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *oidcProvider) getJSON(url string, v interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// key looks up a verification key by id. An unknown id triggers a key set
+// refetch, at most once per oidcKeyRefreshInterval, to follow key rotation.
+func (p *oidcProvider) key(kid string) (interface{}, error) {
+	if _, err := p.Discovery(); err != nil {
+		return nil, err
+	}
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+
+	p.mu.RLock()
+	checkedAt := p.keysCheckedAt
+	p.mu.RUnlock()
+
+	if time.Since(checkedAt) < oidcKeyRefreshInterval {
+		return nil, errOIDCUnknownKey
+	}
+
+	p.mu.Lock()
+	p.keysCheckedAt = time.Now()
+	p.mu.Unlock()
+
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+
+	return nil, errOIDCUnknownKey
+}
+
+func (p *oidcProvider) lookupKey(kid string) interface{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.keys == nil {
+		return nil
+	}
+
+	if kid == "" {
+		// Providers with a single signing key are allowed to omit "kid".
+		for _, k := range p.keys.Keys {
+			if k.Use == "" || k.Use == "sig" {
+				return k.Key
+			}
+		}
+		return nil
+	}
+
+	if keys := p.keys.Key(kid); len(keys) > 0 {
+		return keys[0].Key
+	}
+
+	return nil
+}
+
+// Verify checks the token signature and the standard ID token claims: iss,
+// exp/iat/nbf, aud and azp.
+func (p *oidcProvider) Verify(rawToken string) (*jwt.Token, error) {
+	token, err := jwt.Parse(rawToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodRSAPSS:
+		default:
+			return nil, errOIDCSigningAlgo
+		}
+
+		kid, _ := token.Header[KID].(string)
+		return p.key(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return nil, errOIDCIssuer
+	}
+
+	if err := p.verifyAudience(claims); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (p *oidcProvider) verifyAudience(claims jwt.MapClaims) error {
+	auds := oidcAudiences(claims)
+	if len(auds) == 0 {
+		return errOIDCAudience
+	}
+
+	accepted := false
+	for _, aud := range auds {
+		if p.audiences[aud] {
+			accepted = true
+			break
+		}
+	}
+	if !accepted {
+		return errOIDCAudience
+	}
+
+	azp, hasAzp := claims["azp"].(string)
+	if !hasAzp {
+		// OpenID Connect Core 3.1.3.7: azp is required with multiple audiences.
+		if len(auds) > 1 && (len(p.authorizedParties) > 0 || len(p.audiences) > 0) {
+			return errOIDCAuthzParty
+		}
+		return nil
+	}
+
+	switch {
+	case len(p.authorizedParties) > 0:
+		if !p.authorizedParties[azp] {
+			return errOIDCAuthzParty
+		}
+	case len(p.audiences) > 0:
+		if !p.audiences[azp] {
+			return errOIDCAuthzParty
+		}
+	}
+
+	return nil
+}
+
+// ClientID returns the client the token was issued to, and the policy
+// configured for it, preferring azp over aud.
+func (p *oidcProvider) ClientID(claims jwt.MapClaims) (clientID, policyID string) {
+	if azp, ok := claims["azp"].(string); ok {
+		if policyID, found := p.clients[azp]; found {
+			return azp, policyID
+		}
+	}
+
+	auds := oidcAudiences(claims)
+	for _, aud := range auds {
+		if policyID, found := p.clients[aud]; found {
+			return aud, policyID
+		}
+	}
+
+	if azp, ok := claims["azp"].(string); ok {
+		return azp, ""
+	}
+
+	if len(auds) > 0 {
+		return auds[0], ""
+	}
+
+	return "", ""
+}
+
+// ClaimPolicies returns the policies of all claim rules matching the token.
+func (p *oidcProvider) ClaimPolicies(claims jwt.MapClaims) []string {
+	var policies []string
+	for _, rule := range p.claimPolicies {
+		value := nestedMapLookup(claims, strings.Split(rule.Claim, ".")...)
+		if oidcClaimContains(value, rule.Value) {
+			policies = append(policies, rule.PolicyID)
+		}
+	}
+	return policies
+}
+
+func oidcAudiences(claims jwt.MapClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		auds := make([]string, 0, len(aud))
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+		return auds
+	}
+	return nil
+}
+
+func oidcClaimContains(claim interface{}, value string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == value
+	case bool, float64:
+		return fmt.Sprint(v) == value
+	case []interface{}:
+		for _, item := range v {
+			if oidcClaimContains(item, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// oidcClaimHeaderValue renders a claim so it can be sent as a header value.
+func oidcClaimHeaderValue(claim interface{}) string {
+	switch v := claim.(type) {
+	case string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, oidcClaimHeaderValue(item))
+		}
+		return strings.Join(values, ",")
+	case map[string]interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	case float64:
+		return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%f", v), "0"), ".")
+	}
+	return fmt.Sprint(claim)
+}
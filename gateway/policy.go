@@ -78,12 +78,16 @@ func LoadPoliciesFromFile(filePath string) map[string]user.Policy {
 }
 
 func LoadPoliciesFromDir(dir string) map[string]user.Policy {
+	return loadPoliciesFromDir(dir, nil)
+}
+
+func loadPoliciesFromDir(dir string, files *watchedFiles) map[string]user.Policy {
 	policies := make(map[string]user.Policy)
 	// Grab json files from directory
 	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
 	for _, path := range paths {
 		log.Info("Loading policy from dir ", path)
-		f, err := os.Open(path)
+		f, err := files.open(path)
 		if err != nil {
 			log.Error("Couldn't open policy file from dir: ", err)
 			continue
@@ -0,0 +1,266 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TykTechnologies/tyk/metrics"
+)
+
+// Labels of the request metrics
+const (
+	metricLabelAPIID   = "api_id"
+	metricLabelVersion = "version"
+	metricLabelMethod  = "method"
+	metricLabelStatus  = "status"
+
+	defaultMetricsPath = "/metrics"
+)
+
+var defaultMetricLabels = []string{metricLabelAPIID, metricLabelVersion, metricLabelMethod, metricLabelStatus}
+
+// prometheusMetrics holds the metrics exposed on the Prometheus endpoint.
+type prometheusMetrics struct {
+	registry *metrics.Registry
+
+	labels           []string
+	groupStatusCodes bool
+
+	requestDuration  *metrics.HistogramVec
+	upstreamDuration *metrics.HistogramVec
+	upstreamPhases   *metrics.HistogramVec
+	upstreamConns    *metrics.CounterVec
+	authFailures     *metrics.CounterVec
+	rateLimited      *metrics.CounterVec
+	quotaExceeded    *metrics.CounterVec
+	cacheHits        *metrics.CounterVec
+	analyticsDropped *metrics.CounterVec
+}
+
+// setupPrometheus creates the metrics when the Prometheus endpoint is
+// enabled, starting its own listener if an address is set.
+func (gw *Gateway) setupPrometheus() {
+	conf := gw.GetConfig().Prometheus
+	if !conf.Enabled {
+		return
+	}
+
+	m := &prometheusMetrics{
+		registry:         metrics.NewRegistry(),
+		groupStatusCodes: conf.GroupStatusCodes,
+	}
+
+	labels := conf.Labels
+	if len(labels) == 0 {
+		labels = defaultMetricLabels
+	}
+	for _, label := range labels {
+		switch label {
+		case metricLabelAPIID, metricLabelVersion, metricLabelMethod, metricLabelStatus:
+			m.labels = append(m.labels, label)
+		default:
+			mainLog.Warningf("Ignoring unknown Prometheus metric label %q", label)
+		}
+	}
+
+	// Rejections happen before the response status is known
+	var rejectionLabels []string
+	for _, label := range m.labels {
+		if label != metricLabelStatus {
+			rejectionLabels = append(rejectionLabels, label)
+		}
+	}
+
+	m.requestDuration = metrics.NewHistogramVec("tyk_http_request_duration_seconds",
+		"Total time taken by the gateway to respond to API requests.", conf.Buckets, m.labels...)
+	m.upstreamDuration = metrics.NewHistogramVec("tyk_http_upstream_duration_seconds",
+		"Time taken by the upstream to respond to proxied API requests.", conf.Buckets, m.labels...)
+	m.upstreamPhases = metrics.NewHistogramVec("tyk_http_upstream_phase_duration_seconds",
+		"Time taken by the DNS lookup, connect, TLS handshake and first byte phases of upstream round trips.",
+		conf.Buckets, append([]string{"phase"}, m.labels...)...)
+	m.upstreamConns = metrics.NewCounterVec("tyk_http_upstream_connections_total",
+		"Number of upstream round trips by whether their connection was reused.", append([]string{"reused"}, m.labels...)...)
+	m.authFailures = metrics.NewCounterVec("tyk_auth_failures_total",
+		"Number of requests with failed authentication.", rejectionLabels...)
+	m.rateLimited = metrics.NewCounterVec("tyk_rate_limit_rejections_total",
+		"Number of requests rejected by a rate limit.", rejectionLabels...)
+	m.quotaExceeded = metrics.NewCounterVec("tyk_quota_rejections_total",
+		"Number of requests rejected by an exceeded quota.", rejectionLabels...)
+	m.cacheHits = metrics.NewCounterVec("tyk_cache_hits_total",
+		"Number of requests served from the cache.", rejectionLabels...)
+	m.analyticsDropped = metrics.NewCounterVec("tyk_analytics_dropped_records_total",
+		"Number of analytics records dropped by a sink.", "sink")
+
+	m.registry.MustRegister(
+		m.requestDuration, m.upstreamDuration, m.upstreamPhases, m.upstreamConns, m.authFailures, m.rateLimited, m.quotaExceeded, m.cacheHits, m.analyticsDropped,
+		metrics.NewGaugeFunc("tyk_analytics_buffer_records", "Number of analytics records waiting to be written.", func() float64 {
+			records, _ := gw.analytics.bufferUsage()
+			return float64(records)
+		}),
+		metrics.NewGaugeFunc("tyk_analytics_buffer_size", "Size of the analytics records buffer.", func() float64 {
+			_, size := gw.analytics.bufferUsage()
+			return float64(size)
+		}),
+		metrics.NewGaugeFunc("tyk_drl_peers", "Number of gateways sharing the distributed rate limiter.", func() float64 {
+			if gw.DRLManager == nil || gw.DRLManager.Servers == nil {
+				return 0
+			}
+			return float64(gw.DRLManager.Servers.Count())
+		}),
+		metrics.NewGaugeFunc("tyk_host_checker_hosts", "Number of hosts monitored by the uptime checker.", func() float64 {
+			hosts, _ := gw.GlobalHostChecker.hostCounts()
+			return float64(hosts)
+		}),
+		metrics.NewGaugeFunc("tyk_host_checker_unhealthy_hosts", "Number of monitored hosts which are down.", func() float64 {
+			_, unhealthy := gw.GlobalHostChecker.hostCounts()
+			return float64(unhealthy)
+		}),
+		metrics.NewGaugeFunc("tyk_apis_loaded", "Number of APIs loaded by the gateway.", func() float64 {
+			gw.apisMu.RLock()
+			defer gw.apisMu.RUnlock()
+			return float64(len(gw.apiSpecs))
+		}),
+	)
+
+	gw.prometheus = m
+
+	if conf.ListenAddress == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(gw.prometheusPath(), m.registry)
+	server := &http.Server{Addr: conf.ListenAddress, Handler: mux}
+
+	go func() {
+		mainLog.Info("Serving Prometheus metrics on: ", conf.ListenAddress)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			mainLog.WithError(err).Error("Prometheus metrics listener stopped")
+		}
+	}()
+
+	go func() {
+		<-gw.ctx.Done()
+		server.Close()
+	}()
+}
+
+func (gw *Gateway) prometheusPath() string {
+	if path := gw.GetConfig().Prometheus.Path; path != "" {
+		return path
+	}
+	return defaultMetricsPath
+}
+
+// trackRequestStart wraps an API handler to record when requests start, so
+// the latency of error responses can be measured.
+func trackRequestStart(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxSetRequestStartTime(r, time.Now())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// labelValues returns the values of the configured labels for a request.
+func (m *prometheusMetrics) labelValues(spec *APISpec, r *http.Request, code int, withStatus bool) []string {
+	values := make([]string, 0, len(m.labels))
+	for _, label := range m.labels {
+		switch label {
+		case metricLabelAPIID:
+			values = append(values, spec.APIID)
+		case metricLabelVersion:
+			version := spec.getVersionFromRequest(r)
+			if version == "" {
+				version = "Non Versioned"
+			}
+			values = append(values, version)
+		case metricLabelMethod:
+			values = append(values, r.Method)
+		case metricLabelStatus:
+			if !withStatus {
+				continue
+			}
+			status := strconv.Itoa(code)
+			if m.groupStatusCodes {
+				status = status[:1] + "xx"
+			}
+			values = append(values, status)
+		}
+	}
+
+	return values
+}
+
+// requestLatency returns the time elapsed since the request started, or fallback if the start wasn't recorded.
+func requestLatency(r *http.Request, fallback time.Duration) time.Duration {
+	if start := ctxGetRequestStartTime(r); !start.IsZero() {
+		return time.Since(start)
+	}
+	return fallback
+}
+
+// observeRequest records the latencies of a response. Upstream latency is
+// only recorded for proxied requests, when it is positive.
+func (m *prometheusMetrics) observeRequest(spec *APISpec, r *http.Request, code int, total, upstream time.Duration) {
+	if m == nil {
+		return
+	}
+
+	values := m.labelValues(spec, r, code, true)
+	m.requestDuration.Observe(requestLatency(r, total).Seconds(), values...)
+	if upstream > 0 {
+		m.upstreamDuration.Observe(upstream.Seconds(), values...)
+	}
+}
+
+// observeUpstreamTiming records the phases of the upstream round trip of a
+// proxied request.
+func (m *prometheusMetrics) observeUpstreamTiming(spec *APISpec, r *http.Request, code int, timing *upstreamTiming) {
+	if m == nil {
+		return
+	}
+
+	values := m.labelValues(spec, r, code, true)
+	for phase, d := range timing.phases() {
+		m.upstreamPhases.Observe(d.Seconds(), append([]string{phase}, values...)...)
+	}
+	if reused, ok := timing.connReused(); ok {
+		m.upstreamConns.Inc(append([]string{strconv.FormatBool(reused)}, values...)...)
+	}
+}
+
+func (m *prometheusMetrics) reportAuthFailure(spec *APISpec, r *http.Request) {
+	if m == nil {
+		return
+	}
+	m.authFailures.Inc(m.labelValues(spec, r, 0, false)...)
+}
+
+func (m *prometheusMetrics) reportRateLimited(spec *APISpec, r *http.Request) {
+	if m == nil {
+		return
+	}
+	m.rateLimited.Inc(m.labelValues(spec, r, 0, false)...)
+}
+
+func (m *prometheusMetrics) reportQuotaExceeded(spec *APISpec, r *http.Request) {
+	if m == nil {
+		return
+	}
+	m.quotaExceeded.Inc(m.labelValues(spec, r, 0, false)...)
+}
+
+func (m *prometheusMetrics) reportCacheHit(spec *APISpec, r *http.Request) {
+	if m == nil {
+		return
+	}
+	m.cacheHits.Inc(m.labelValues(spec, r, 0, false)...)
+}
+
+func (m *prometheusMetrics) reportAnalyticsDropped(sink string, n int) {
+	if m == nil {
+		return
+	}
+	m.analyticsDropped.Add(float64(n), sink)
+}
@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.Prometheus.Enabled = true
+		globalConf.Prometheus.Labels = []string{"api_id", "method", "status"}
+		globalConf.Prometheus.GroupStatusCodes = true
+	})
+	defer ts.Close()
+
+	ts.Gw.DRLManager.SetCurrentTokenValue(1)
+	ts.Gw.DRLManager.RequestTokenValue = 1
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "keyed"
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/keyed/"
+	}, func(spec *APISpec) {
+		spec.APIID = "cached"
+		spec.UseKeylessAccess = true
+		spec.Proxy.ListenPath = "/cached/"
+		spec.CacheOptions = apidef.CacheOptions{
+			CacheTimeout:         120,
+			EnableCache:          true,
+			CacheAllSafeRequests: true,
+		}
+	})
+
+	_, key := ts.CreateSession(func(s *user.SessionState) {
+		s.Rate = 1
+		s.Per = 60
+		s.AccessRights = map[string]user.AccessDefinition{"keyed": {APIID: "keyed"}}
+	})
+	authHeaders := map[string]string{"Authorization": key}
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/keyed/", Code: http.StatusUnauthorized},
+		{Path: "/keyed/", Headers: map[string]string{"Authorization": "invalid"}, Code: http.StatusForbidden},
+		{Path: "/keyed/", Headers: authHeaders, Code: http.StatusOK},
+		{Path: "/keyed/", Headers: authHeaders, Code: http.StatusTooManyRequests},
+		{Path: "/cached/", Code: http.StatusOK, Delay: 10 * time.Millisecond},
+		{Path: "/cached/", Code: http.StatusOK, HeadersMatch: map[string]string{"x-tyk-cached-response": "1"}},
+	}...)
+
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/metrics", ControlRequest: true, Code: http.StatusOK, BodyMatch: `tyk_http_request_duration_seconds_count{api_id="keyed",method="GET",status="4xx"} 3`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_http_request_duration_seconds_count{api_id="keyed",method="GET",status="2xx"} 1`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_http_upstream_duration_seconds_count{api_id="keyed",method="GET",status="2xx"} 1`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_http_upstream_phase_duration_seconds_count{phase="first_byte",api_id="keyed",method="GET",status="2xx"} 1`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_http_upstream_connections_total{reused="(true|false)",api_id="keyed",method="GET",status="2xx"} 1`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_http_request_duration_seconds_count{api_id="cached",method="GET",status="2xx"} 2`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_auth_failures_total{api_id="keyed",method="GET"} 1`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_rate_limit_rejections_total{api_id="keyed",method="GET"} 1`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_cache_hits_total{api_id="cached",method="GET"} 1`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_apis_loaded 2`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_analytics_buffer_size \d+`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_host_checker_unhealthy_hosts 0`},
+		{Path: "/metrics", ControlRequest: true, BodyMatch: `tyk_drl_peers \d+`},
+	}...)
+}
+
+func TestPrometheusMetricsDisabled(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	_, _ = ts.Run(t, test.TestCase{Path: "/metrics", ControlRequest: true, Code: http.StatusNotFound})
+}
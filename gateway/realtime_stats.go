@@ -0,0 +1,445 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	defaultRealtimeStatsWindow   = 60
+	defaultRealtimeStatsMaxKeys  = 100
+	defaultRealtimeStatsTopN     = 10
+	defaultRealtimeStatsInterval = 1
+)
+
+// realtimeLatencyBounds are the upper bounds, in milliseconds, of the latency
+// histogram the percentiles are estimated from. The last bucket is unbounded.
+var realtimeLatencyBounds = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 30000, 60000}
+
+// RealtimeStats are the statistics of an API or key over the sliding window.
+type RealtimeStats struct {
+	APIID     string        `json:"api_id"`
+	Key       string        `json:"key,omitempty"`
+	Window    int           `json:"window"`
+	Requests  uint64        `json:"requests"`
+	Errors    uint64        `json:"errors"`
+	RPS       float64       `json:"rps"`
+	ErrorRate float64       `json:"error_rate"`
+	Latency   LatencyStats  `json:"latency"`
+	TopPaths  []CountByName `json:"top_paths,omitempty"`
+	TopKeys   []CountByName `json:"top_keys,omitempty"`
+}
+
+// LatencyStats are latency percentiles in milliseconds, estimated from a
+// histogram.
+type LatencyStats struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+// CountByName is the number of requests of a path or key.
+type CountByName struct {
+	Name     string `json:"name"`
+	Requests uint64 `json:"requests"`
+}
+
+// statsBucket holds the requests of one second.
+type statsBucket struct {
+	second   int64
+	requests uint64
+	errors   uint64
+	latency  []uint64
+	paths    map[string]uint64
+}
+
+// statsWindow is a ring of one second buckets.
+type statsWindow struct {
+	buckets    []statsBucket
+	trackPaths bool
+	lastSeen   int64
+}
+
+func newStatsWindow(size int, trackPaths bool) *statsWindow {
+	w := &statsWindow{buckets: make([]statsBucket, size), trackPaths: trackPaths}
+	for i := range w.buckets {
+		w.buckets[i].latency = make([]uint64, len(realtimeLatencyBounds)+1)
+	}
+	return w
+}
+
+func (w *statsWindow) add(now int64, isError bool, latency float64, path string) {
+	b := &w.buckets[now%int64(len(w.buckets))]
+	if b.second != now {
+		b.second = now
+		b.requests = 0
+		b.errors = 0
+		for i := range b.latency {
+			b.latency[i] = 0
+		}
+		b.paths = nil
+	}
+
+	b.requests++
+	if isError {
+		b.errors++
+	}
+	b.latency[sort.SearchFloat64s(realtimeLatencyBounds, latency)]++
+	if w.trackPaths {
+		if b.paths == nil {
+			b.paths = make(map[string]uint64)
+		}
+		b.paths[path]++
+	}
+	w.lastSeen = now
+}
+
+// stats sums the buckets within the window, listing the top paths.
+func (w *statsWindow) stats(now int64, topN int) RealtimeStats {
+	size := int64(len(w.buckets))
+	s := RealtimeStats{Window: len(w.buckets)}
+	latency := make([]uint64, len(realtimeLatencyBounds)+1)
+	var paths map[string]uint64
+
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.second <= now-size || b.second > now {
+			continue
+		}
+		s.Requests += b.requests
+		s.Errors += b.errors
+		for i, n := range b.latency {
+			latency[i] += n
+		}
+		for path, n := range b.paths {
+			if paths == nil {
+				paths = make(map[string]uint64)
+			}
+			paths[path] += n
+		}
+	}
+
+	if s.Requests > 0 {
+		s.RPS = float64(s.Requests) / float64(size)
+		s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+		s.Latency = LatencyStats{
+			P50: latencyPercentile(latency, s.Requests, 0.5),
+			P95: latencyPercentile(latency, s.Requests, 0.95),
+			P99: latencyPercentile(latency, s.Requests, 0.99),
+		}
+	}
+	s.TopPaths = topCounts(paths, topN)
+
+	return s
+}
+
+// latencyPercentile interpolates a percentile within the histogram bucket it
+// falls in. Percentiles in the unbounded bucket report its lower bound.
+func latencyPercentile(histogram []uint64, total uint64, q float64) float64 {
+	rank := q * float64(total)
+	var cumulative uint64
+	for i, n := range histogram {
+		if n == 0 || float64(cumulative+n) < rank {
+			cumulative += n
+			continue
+		}
+		if i == len(realtimeLatencyBounds) {
+			return realtimeLatencyBounds[i-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = realtimeLatencyBounds[i-1]
+		}
+		return lower + (realtimeLatencyBounds[i]-lower)*(rank-float64(cumulative))/float64(n)
+	}
+	return 0
+}
+
+func topCounts(counts map[string]uint64, n int) []CountByName {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	top := make([]CountByName, 0, len(counts))
+	for name, requests := range counts {
+		top = append(top, CountByName{Name: name, Requests: requests})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Requests != top[j].Requests {
+			return top[i].Requests > top[j].Requests
+		}
+		return top[i].Name < top[j].Name
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// apiStats holds the windows of an API and of its keys.
+type apiStats struct {
+	mu     sync.Mutex
+	window *statsWindow
+	keys   map[string]*statsWindow
+}
+
+// realtimeStats keeps sliding window statistics of the traffic per API and
+// per key in memory.
+type realtimeStats struct {
+	window   int
+	maxKeys  int
+	topN     int
+	interval time.Duration
+	hashKeys bool
+	now      func() time.Time
+
+	mu   sync.RWMutex
+	apis map[string]*apiStats
+}
+
+// setupRealtimeStats creates the statistics when they are enabled.
+func (gw *Gateway) setupRealtimeStats() {
+	conf := gw.GetConfig().RealtimeStats
+	if !conf.Enabled {
+		gw.realtimeStats = nil
+		return
+	}
+
+	s := &realtimeStats{
+		window:   conf.Window,
+		maxKeys:  conf.MaxKeys,
+		topN:     conf.TopN,
+		interval: time.Duration(conf.StreamInterval) * time.Second,
+		hashKeys: gw.GetConfig().HashKeys,
+		now:      time.Now,
+		apis:     make(map[string]*apiStats),
+	}
+	if s.window <= 0 {
+		s.window = defaultRealtimeStatsWindow
+	}
+	if s.maxKeys <= 0 {
+		s.maxKeys = defaultRealtimeStatsMaxKeys
+	}
+	if s.topN <= 0 {
+		s.topN = defaultRealtimeStatsTopN
+	}
+	if s.interval <= 0 {
+		s.interval = defaultRealtimeStatsInterval * time.Second
+	}
+
+	gw.realtimeStats = s
+}
+
+// record adds a request to the statistics of its API and key. Responses with
+// a status code of 400 or more count as errors.
+func (s *realtimeStats) record(spec *APISpec, r *http.Request, code int, latency time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.mu.RLock()
+	api := s.apis[spec.APIID]
+	s.mu.RUnlock()
+	if api == nil {
+		s.mu.Lock()
+		if api = s.apis[spec.APIID]; api == nil {
+			api = &apiStats{window: newStatsWindow(s.window, true), keys: make(map[string]*statsWindow)}
+			s.apis[spec.APIID] = api
+		}
+		s.mu.Unlock()
+	}
+
+	now := s.now().Unix()
+	isError := code >= http.StatusBadRequest
+	ms := float64(latency) / float64(time.Millisecond)
+	path := r.URL.Path
+	if p := ctxGetTrackedPath(r); p != "" {
+		path = p
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.window.add(now, isError, ms, path)
+
+	token := ctxGetAuthToken(r)
+	if token == "" {
+		return
+	}
+	key := storage.HashKey(token, s.hashKeys)
+	w := api.keys[key]
+	if w == nil {
+		if len(api.keys) >= s.maxKeys && !api.evictIdleKey(now-int64(s.window)) {
+			return
+		}
+		w = newStatsWindow(s.window, false)
+		api.keys[key] = w
+	}
+	w.add(now, isError, ms, "")
+}
+
+// evictIdleKey removes a key without requests since the given second.
+func (a *apiStats) evictIdleKey(since int64) bool {
+	for key, w := range a.keys {
+		if w.lastSeen <= since {
+			delete(a.keys, key)
+			return true
+		}
+	}
+	return false
+}
+
+// apiStats returns the statistics of an API, with its top paths and keys.
+func (s *realtimeStats) apiStats(apiID string) (RealtimeStats, bool) {
+	s.mu.RLock()
+	api := s.apis[apiID]
+	s.mu.RUnlock()
+	if api == nil {
+		return RealtimeStats{APIID: apiID, Window: s.window}, false
+	}
+
+	now := s.now().Unix()
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	stats := api.window.stats(now, s.topN)
+	stats.APIID = apiID
+
+	keys := make(map[string]uint64, len(api.keys))
+	for key, w := range api.keys {
+		if n := w.stats(now, 0).Requests; n > 0 {
+			keys[key] = n
+		}
+	}
+	stats.TopKeys = topCounts(keys, s.topN)
+
+	return stats, true
+}
+
+// keyStats returns the statistics of a key, given as is or in hashed form.
+func (s *realtimeStats) keyStats(apiID, key string) (RealtimeStats, bool) {
+	s.mu.RLock()
+	api := s.apis[apiID]
+	s.mu.RUnlock()
+	if api == nil {
+		return RealtimeStats{}, false
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	w := api.keys[key]
+	if w == nil {
+		key = storage.HashKey(key, s.hashKeys)
+		if w = api.keys[key]; w == nil {
+			return RealtimeStats{}, false
+		}
+	}
+
+	stats := w.stats(s.now().Unix(), 0)
+	stats.APIID = apiID
+	stats.Key = key
+	return stats, true
+}
+
+// allStats returns the statistics of the APIs with traffic, sorted by API ID.
+func (s *realtimeStats) allStats() []RealtimeStats {
+	s.mu.RLock()
+	ids := make([]string, 0, len(s.apis))
+	for id := range s.apis {
+		ids = append(ids, id)
+	}
+	s.mu.RUnlock()
+	sort.Strings(ids)
+
+	all := make([]RealtimeStats, 0, len(ids))
+	for _, id := range ids {
+		if stats, ok := s.apiStats(id); ok {
+			all = append(all, stats)
+		}
+	}
+	return all
+}
+
+// realtimeStatsHandler serves the statistics of all APIs, of an API or of a
+// key.
+func (gw *Gateway) realtimeStatsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	apiID, key := vars["apiID"], vars["keyName"]
+
+	switch {
+	case apiID == "":
+		doJSONWrite(w, http.StatusOK, gw.realtimeStats.allStats())
+	case key != "":
+		stats, ok := gw.realtimeStats.keyStats(apiID, key)
+		if !ok {
+			doJSONWrite(w, http.StatusNotFound, apiError("Key has no recent traffic"))
+			return
+		}
+		doJSONWrite(w, http.StatusOK, stats)
+	default:
+		stats, ok := gw.realtimeStats.apiStats(apiID)
+		if !ok && gw.getApiSpec(apiID) == nil {
+			doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+			return
+		}
+		doJSONWrite(w, http.StatusOK, stats)
+	}
+}
+
+// realtimeStatsStreamHandler streams the statistics as server-sent events,
+// for all APIs or for the API set by the `api_id` query parameter.
+func (gw *Gateway) realtimeStatsStreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Streaming is not supported"))
+		return
+	}
+
+	apiID := r.URL.Query().Get("api_id")
+	if apiID != "" && gw.getApiSpec(apiID) == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(gw.realtimeStats.interval)
+	defer ticker.Stop()
+
+	for {
+		var data interface{}
+		if apiID != "" {
+			data, _ = gw.realtimeStats.apiStats(apiID)
+		} else {
+			data = gw.realtimeStats.allStats()
+		}
+
+		event, err := json.Marshal(data)
+		if err != nil {
+			log.WithError(err).Error("Failed to encode real-time statistics")
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: stats\ndata: %s\n\n", event); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
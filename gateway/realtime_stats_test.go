@@ -0,0 +1,157 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestRealtimeStatsWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := &realtimeStats{window: 10, maxKeys: 1, topN: 1, now: func() time.Time { return now }, apis: make(map[string]*apiStats)}
+	spec := &APISpec{APIDefinition: &apidef.APIDefinition{APIID: "api"}}
+
+	record := func(path string, code int, latency time.Duration, key string) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			ctxSetSession(r, &user.SessionState{KeyID: key}, false, false)
+		}
+		s.record(spec, r, code, latency)
+	}
+
+	for i := 0; i < 90; i++ {
+		record("/a", http.StatusOK, 3*time.Millisecond, "key1")
+	}
+	for i := 0; i < 10; i++ {
+		record("/b", http.StatusInternalServerError, 300*time.Millisecond, "key2")
+	}
+
+	stats, ok := s.apiStats("api")
+	if !ok {
+		t.Fatal("expected API statistics")
+	}
+	if stats.Requests != 100 || stats.Errors != 10 || stats.RPS != 10 || stats.ErrorRate != 0.1 {
+		t.Errorf("unexpected statistics %+v", stats)
+	}
+	if stats.Latency.P50 <= 2 || stats.Latency.P50 > 5 || stats.Latency.P99 <= 200 || stats.Latency.P99 > 500 {
+		t.Errorf("unexpected latency percentiles %+v", stats.Latency)
+	}
+	if len(stats.TopPaths) != 1 || stats.TopPaths[0] != (CountByName{Name: "/a", Requests: 90}) {
+		t.Errorf("unexpected top paths %+v", stats.TopPaths)
+	}
+
+	// key2 isn't tracked as key1 isn't idle yet
+	if keyStats, ok := s.keyStats("api", "key1"); !ok || keyStats.Requests != 90 {
+		t.Errorf("unexpected key statistics %+v", keyStats)
+	}
+	if _, ok := s.keyStats("api", "key2"); ok {
+		t.Error("expected keys over the limit not to be tracked")
+	}
+
+	// Once idle for a window, key1 makes room for key2
+	now = now.Add(10 * time.Second)
+	if stats, _ := s.apiStats("api"); stats.Requests != 0 || stats.TopPaths != nil {
+		t.Errorf("expected the window to have slid, got %+v", stats)
+	}
+	record("/b", http.StatusOK, time.Millisecond, "key2")
+	if _, ok := s.keyStats("api", "key2"); !ok {
+		t.Error("expected the idle key to be replaced")
+	}
+}
+
+func TestRealtimeStatsAPI(t *testing.T) {
+	ts := StartTest(func(globalConf *config.Config) {
+		globalConf.RealtimeStats.Enabled = true
+	})
+	defer ts.Close()
+
+	ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "stats"
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/stats/"
+	})
+
+	_, key := ts.CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{"stats": {APIID: "stats"}}
+	})
+	authHeaders := map[string]string{headers.Authorization: key}
+
+	decode := func(v interface{}) func([]byte) bool {
+		return func(body []byte) bool {
+			if err := json.Unmarshal(body, v); err != nil {
+				t.Error(err)
+				return false
+			}
+			return true
+		}
+	}
+
+	var apiStats RealtimeStats
+	var keyStats RealtimeStats
+	var all []RealtimeStats
+	_, _ = ts.Run(t, []test.TestCase{
+		{Path: "/stats/a", Headers: authHeaders, Code: http.StatusOK},
+		{Path: "/stats/a", Headers: authHeaders, Code: http.StatusOK},
+		{Path: "/stats/b", Code: http.StatusUnauthorized},
+		{Path: "/tyk/stats/apis/stats", AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: decode(&apiStats)},
+		{Path: "/tyk/stats/apis/stats/keys/" + key, AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: decode(&keyStats)},
+		{Path: "/tyk/stats/apis", AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: decode(&all)},
+		{Path: "/tyk/stats/apis/unknown", AdminAuth: true, Code: http.StatusNotFound},
+		{Path: "/tyk/stats/apis/stats/keys/unknown", AdminAuth: true, Code: http.StatusNotFound},
+	}...)
+
+	if apiStats.Requests != 3 || apiStats.Errors != 1 || len(apiStats.TopPaths) != 2 || len(apiStats.TopKeys) != 1 {
+		t.Errorf("unexpected API statistics %+v", apiStats)
+	}
+	if keyStats.Requests != 2 || keyStats.Errors != 0 {
+		t.Errorf("unexpected key statistics %+v", keyStats)
+	}
+	if len(all) != 1 || all[0].APIID != "stats" {
+		t.Errorf("unexpected statistics of all APIs %+v", all)
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/tyk/stats/stream?api_id=stats", nil)
+		req.Header.Set(headers.XTykAuthorization, ts.Gw.GetConfig().Secret)
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if ct := resp.Header.Get(headers.ContentType); ct != "text/event-stream" {
+			t.Fatalf("expected an event stream, got %q", ct)
+		}
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var stats RealtimeStats
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &stats); err != nil {
+				t.Fatal(err)
+			}
+			if stats.APIID != "stats" || stats.Requests != 3 {
+				t.Errorf("unexpected streamed statistics %+v", stats)
+			}
+			return
+		}
+		t.Fatalf("expected an event, got %v", scanner.Err())
+	})
+}
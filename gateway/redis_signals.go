@@ -52,7 +52,7 @@ func (n *Notification) Sign() {
 }
 
 func (gw *Gateway) startPubSubLoop() {
-	cacheStore := storage.RedisCluster{RedisController: gw.RedisController}
+	cacheStore := gw.newStore(storage.StoreOptions{})
 	cacheStore.Connect()
 	// On message, synchronise
 	for {
@@ -199,7 +199,7 @@ func isPayloadSignatureValid(notification Notification) bool {
 
 // RedisNotifier will use redis pub/sub channels to send notifications
 type RedisNotifier struct {
-	store   *storage.RedisCluster
+	store   storage.Store
 	channel string
 	*Gateway
 }
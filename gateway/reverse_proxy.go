@@ -778,12 +778,71 @@ func (rt *TykRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 		return handleInMemoryLoop(handler, r)
 	}
 
+	if timing := ctxGetUpstreamTiming(r); timing != nil {
+		r = r.WithContext(timing.withTrace(r.Context()))
+	}
+
+	debugTrace := ctxGetDebugTrace(r)
+	if debugTrace == nil {
+		if trace.IsEnabled() {
+			return rt.tracedRoundTrip(r)
+		}
+		return rt.roundTrip(r)
+	}
+
+	start := time.Now()
+	var resp *http.Response
+	var err error
+	if trace.IsEnabled() {
+		resp, err = rt.tracedRoundTrip(r)
+	} else {
+		resp, err = rt.roundTrip(r)
+	}
+	debugTrace.setUpstream(r, resp, err, time.Since(start))
+	return resp, err
+}
+
+func (rt *TykRoundTripper) roundTrip(r *http.Request) (*http.Response, error) {
 	if rt.h2ctransport != nil {
 		return rt.h2ctransport.RoundTrip(r)
 	}
 	return rt.transport.RoundTrip(r)
 }
 
+// tracedRoundTrip records the upstream round trip in a client span, which
+// becomes the parent span propagated to the upstream.
+func (rt *TykRoundTripper) tracedRoundTrip(r *http.Request) (*http.Response, error) {
+	span, ctx := trace.Span(r.Context(), "upstream "+r.Method)
+	defer span.Finish()
+	ext.SpanKindRPCClient.Set(span)
+	ext.HTTPMethod.Set(span, r.Method)
+	ext.HTTPUrl.Set(span, r.URL.String())
+
+	r = r.WithContext(ctx)
+	trace.InjectFromContext(ctx, span, r.Header)
+
+	resp, err := rt.roundTrip(r)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("event", "error", "message", err.Error())
+		return nil, err
+	}
+
+	ext.HTTPStatusCode.Set(span, uint16(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		ext.Error.Set(span, true)
+	}
+	if timing := ctxGetUpstreamTiming(r); timing != nil {
+		for phase, d := range timing.phases() {
+			span.SetTag("upstream."+phase+"_ms", DurationToMillisecond(d))
+		}
+		if reused, ok := timing.connReused(); ok {
+			span.SetTag("upstream.conn_reused", reused)
+		}
+	}
+	return resp, nil
+}
+
 const (
 	inMemNetworkName = "in-mem-network"
 	inMemNetworkType = "memu"
@@ -1272,6 +1331,7 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	// We should at least copy the status code in
 	inres.StatusCode = res.StatusCode
 	inres.ContentLength = res.ContentLength
+	inres.Request = res.Request
 	p.HandleResponse(rw, res, ses)
 	return ProxyResponse{UpstreamLatency: upstreamLatency, Response: inres}
 }
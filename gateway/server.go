@@ -96,6 +96,16 @@ type Gateway struct {
 	reloadMu   sync.Mutex
 
 	analytics            RedisAnalyticsHandler
+	prometheus           *prometheusMetrics
+	accessLog            *accessLogger
+	realtimeStats        *realtimeStats
+	debugTracing         *debugTracing
+	healthProbes         *healthProbes
+	auditLog             *auditLog
+	keyIndex             *keyIndex
+	sloTracker           *sloTracker
+	degradedMode         *degradedMode
+	apiLoadState         apiLoadState
 	GlobalEventsJSVM     JSVM
 	MainNotifier         RedisNotifier
 	DefaultOrgStore      DefaultSessionManager
@@ -130,6 +140,8 @@ type Gateway struct {
 	apiSpecs        []*APISpec
 	apisByID        map[string]*APISpec
 	apisHandlesByID *sync.Map
+	// apisFingerprint is the specsFingerprint the loaded specs were built with.
+	apisFingerprint string
 
 	policiesMu   sync.RWMutex
 	policiesByID map[string]user.Policy
@@ -138,6 +150,13 @@ type Gateway struct {
 
 	consulKVStore kv.Store
 	vaultKVStore  kv.Store
+	kvRefs        kvReferences
+
+	// watchedFiles holds the *watchedFiles once the API definition and policy files
+	// are watched. It's set while the APIs may be reloading, see getWatchedFiles.
+	watchedFiles atomic.Value
+	// fileStoreMu serialises the changes of API definition and policy files.
+	fileStoreMu sync.Mutex
 
 	LE_MANAGER  letsencrypt.Manager
 	LE_FIRSTRUN bool
@@ -199,7 +218,7 @@ func NewGateway(config config.Config, ctx context.Context, cancelFn context.Canc
 
 	gw.analytics = RedisAnalyticsHandler{Gw: &gw}
 	gw.SetConfig(config)
-	sessionManager := DefaultSessionManager{Gw: &gw}
+	sessionManager := DefaultSessionManager{Gw: &gw, indexKeys: true}
 	gw.GlobalSessionManager = SessionHandler(&sessionManager)
 	gw.DefaultQuotaStore = DefaultSessionManager{Gw: &gw}
 	gw.SessionLimiter = SessionLimiter{Gw: &gw}
@@ -300,7 +319,7 @@ func (gw *Gateway) setupGlobals() {
 			time.Duration(gwConfig.DnsCache.CheckInterval)*time.Second)
 	}
 
-	if gwConfig.EnableAnalytics && gwConfig.Storage.Type != "redis" {
+	if gwConfig.EnableAnalytics && gwConfig.Storage.Type != "redis" && gwConfig.Storage.Type != "embedded" {
 		mainLog.Fatal("Analytics requires Redis Storage backend, please enable Redis in the tyk.conf file.")
 	}
 
@@ -310,16 +329,18 @@ func (gw *Gateway) setupGlobals() {
 			mainLog.Warn("Running Uptime checks in a management node.")
 		}
 
-		healthCheckStore := storage.RedisCluster{KeyPrefix: "host-checker:", IsAnalytics: true, RedisController: gw.RedisController}
-		gw.InitHostCheckManager(gw.ctx, &healthCheckStore)
+		healthCheckStore := gw.newStore(storage.StoreOptions{KeyPrefix: "host-checker:", IsAnalytics: true})
+		gw.InitHostCheckManager(gw.ctx, healthCheckStore)
 	}
 
 	gw.initHealthCheck(gw.ctx)
 
-	redisStore := storage.RedisCluster{KeyPrefix: "apikey-", HashKeys: gwConfig.HashKeys, RedisController: gw.RedisController}
-	gw.GlobalSessionManager.Init(&redisStore)
+	redisStore := gw.newStore(storage.StoreOptions{KeyPrefix: "apikey-", HashKeys: gwConfig.HashKeys})
+	gw.GlobalSessionManager.Init(redisStore)
+	gw.setupKeyIndex()
+	gw.setupDegradedMode()
 
-	versionStore := storage.RedisCluster{KeyPrefix: "version-check-", RedisController: gw.RedisController}
+	versionStore := gw.newStore(storage.StoreOptions{KeyPrefix: "version-check-"})
 	versionStore.Connect()
 	err := versionStore.SetKey("gateway", VERSION, 0)
 	if err != nil {
@@ -332,20 +353,23 @@ func (gw *Gateway) setupGlobals() {
 		gw.SetConfig(Conf)
 		mainLog.Debug("Setting up analytics DB connection")
 
-		analyticsStore := storage.RedisCluster{KeyPrefix: "analytics-", IsAnalytics: true, RedisController: gw.RedisController}
-		gw.analytics.Store = &analyticsStore
+		analyticsStore := gw.newStore(storage.StoreOptions{KeyPrefix: "analytics-", IsAnalytics: true})
+		gw.analytics.Store = analyticsStore
+		if gwConfig.DegradedMode.Enabled {
+			gw.analytics.Store = &degradedAnalyticsStore{AnalyticsHandler: analyticsStore, gw: gw}
+		}
 		gw.analytics.Init()
 
-		store := storage.RedisCluster{KeyPrefix: "analytics-", IsAnalytics: true, RedisController: gw.RedisController}
-		redisPurger := RedisPurger{Store: &store, Gw: gw}
+		store := gw.newStore(storage.StoreOptions{KeyPrefix: "analytics-", IsAnalytics: true})
+		redisPurger := RedisPurger{Store: store, Gw: gw}
 		go redisPurger.PurgeLoop(gw.ctx)
 
 		if gw.GetConfig().AnalyticsConfig.Type == "rpc" {
 			mainLog.Debug("Using RPC cache purge")
 
-			store := storage.RedisCluster{KeyPrefix: "analytics-", IsAnalytics: true, RedisController: gw.RedisController}
+			store := gw.newStore(storage.StoreOptions{KeyPrefix: "analytics-", IsAnalytics: true})
 			purger := rpc.Purger{
-				Store: &store,
+				Store: store,
 			}
 			purger.Connect()
 			go purger.PurgeLoop(gw.ctx, time.Duration(gw.GetConfig().AnalyticsConfig.PurgeInterval))
@@ -362,7 +386,7 @@ func (gw *Gateway) setupGlobals() {
 
 	// Get the notifier ready
 	mainLog.Debug("Notifier will not work in hybrid mode")
-	mainNotifierStore := &storage.RedisCluster{RedisController: gw.RedisController}
+	mainNotifierStore := gw.newStore(storage.StoreOptions{})
 	mainNotifierStore.Connect()
 	gw.MainNotifier = RedisNotifier{mainNotifierStore, RedisPubSubChannel, gw}
 
@@ -381,12 +405,9 @@ func (gw *Gateway) setupGlobals() {
 		gw.SetConfig(conf)
 	}
 
-	certificateSecret := gw.GetConfig().Secret
-	if gw.GetConfig().Security.PrivateCertificateEncodingSecret != "" {
-		certificateSecret = gw.GetConfig().Security.PrivateCertificateEncodingSecret
-	}
+	certificateSecret := gw.certificateSecret()
 
-	storeCert := &storage.RedisCluster{KeyPrefix: "cert-", HashKeys: false, RedisController: gw.RedisController}
+	storeCert := gw.newStore(storage.StoreOptions{KeyPrefix: "cert-", HashKeys: false})
 	gw.CertificateManager = certs.NewCertificateManager(storeCert, certificateSecret, log, !gw.GetConfig().Cloud)
 	if gw.GetConfig().SlaveOptions.UseRPC {
 		rpcStore := &RPCStorageHandler{
@@ -500,7 +521,7 @@ func (gw *Gateway) syncPolicies() (count int, err error) {
 	default:
 		//if policy path defined we want to allow use of the REST API
 		if gw.GetConfig().Policies.PolicyPath != "" {
-			pols = LoadPoliciesFromDir(gw.GetConfig().Policies.PolicyPath)
+			pols = loadPoliciesFromDir(gw.GetConfig().Policies.PolicyPath, gw.getWatchedFiles())
 
 		} else if gw.GetConfig().Policies.PolicyRecordName == "" {
 			// old way of doing things before REST Api added
@@ -572,6 +593,11 @@ func (gw *Gateway) loadControlAPIEndpoints(muxer *mux.Router) {
 	}
 
 	muxer.HandleFunc("/"+gw.GetConfig().HealthCheckEndpointName, gw.liveCheckHandler)
+	gw.loadHealthProbeEndpoints(muxer)
+
+	if gw.prometheus != nil && gw.GetConfig().Prometheus.ListenAddress == "" {
+		muxer.Handle(gw.prometheusPath(), gw.prometheus.registry)
+	}
 
 	r := mux.NewRouter()
 	muxer.PathPrefix("/tyk/").Handler(http.StripPrefix("/tyk",
@@ -589,6 +615,10 @@ func (gw *Gateway) loadControlAPIEndpoints(muxer *mux.Router) {
 	}
 
 	r.MethodNotAllowedHandler = MethodNotAllowedHandler{}
+	if gw.auditLog != nil {
+		r.Use(gw.auditLog.middleware)
+	}
+	r.Use(gw.authorizeControlAPI)
 
 	mainLog.Info("Initialising Tyk REST API Endpoints")
 
@@ -603,9 +633,13 @@ func (gw *Gateway) loadControlAPIEndpoints(muxer *mux.Router) {
 		r.HandleFunc("/keys/create", gw.createKeyHandler).Methods("POST")
 		r.HandleFunc("/apis", gw.apiHandler).Methods("GET", "POST", "PUT", "DELETE")
 		r.HandleFunc("/apis/{apiID}", gw.apiHandler).Methods("GET", "POST", "PUT", "DELETE")
+		r.HandleFunc("/apis/{apiID}/history", gw.apiHistoryHandler).Methods("GET")
+		r.HandleFunc("/apis/{apiID}/rollback", gw.apiRollbackHandler).Methods("POST")
 		r.HandleFunc("/health", gw.healthCheckhandler).Methods("GET")
 		r.HandleFunc("/policies", gw.polHandler).Methods("GET", "POST", "PUT", "DELETE")
 		r.HandleFunc("/policies/{polID}", gw.polHandler).Methods("GET", "POST", "PUT", "DELETE")
+		r.HandleFunc("/policies/{polID}/history", gw.policyHistoryHandler).Methods("GET")
+		r.HandleFunc("/policies/{polID}/rollback", gw.policyRollbackHandler).Methods("POST")
 		r.HandleFunc("/oauth/clients/create", gw.createOauthClient).Methods("POST")
 		r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}", gw.oAuthClientHandler).Methods("PUT")
 		r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}/rotate", gw.rotateOauthClientHandler).Methods("PUT")
@@ -619,10 +653,28 @@ func (gw *Gateway) loadControlAPIEndpoints(muxer *mux.Router) {
 	}
 
 	r.HandleFunc("/debug", gw.traceHandler).Methods("POST")
+	if gw.debugTracing != nil {
+		r.HandleFunc("/debug/rules", gw.debugRulesHandler).Methods("GET", "POST")
+		r.HandleFunc("/debug/rules/{ruleID}", gw.debugRulesHandler).Methods("DELETE")
+		r.HandleFunc("/debug/tokens", gw.debugTokenHandler).Methods("POST")
+		r.HandleFunc("/debug/traces/{traceID}", gw.debugTraceHandler).Methods("GET")
+	}
+	if gw.realtimeStats != nil {
+		r.HandleFunc("/stats/apis", gw.realtimeStatsHandler).Methods("GET")
+		r.HandleFunc("/stats/apis/{apiID}", gw.realtimeStatsHandler).Methods("GET")
+		r.HandleFunc("/stats/apis/{apiID}/keys/{keyName}", gw.realtimeStatsHandler).Methods("GET")
+		r.HandleFunc("/stats/stream", gw.realtimeStatsStreamHandler).Methods("GET")
+	}
+	if gw.auditLog != nil {
+		r.HandleFunc("/audit", gw.auditLogHandler).Methods("GET")
+	}
 	r.HandleFunc("/cache/{apiID}", gw.invalidateCacheHandler).Methods("DELETE")
 	r.HandleFunc("/keys", gw.keyHandler).Methods("POST", "PUT", "GET", "DELETE")
 	r.HandleFunc("/keys/preview", gw.previewKeyHandler).Methods("POST")
+	r.HandleFunc("/keys/bulk", gw.keyBulkHandler).Methods("POST")
+	r.HandleFunc("/keys/export", gw.keyExportHandler).Methods("GET")
 	r.HandleFunc("/keys/{keyName:[^/]*}", gw.keyHandler).Methods("POST", "PUT", "GET", "DELETE")
+	r.HandleFunc("/keys/{keyName}/rotate", gw.rotateKeyHandler).Methods("POST")
 	r.HandleFunc("/certs", gw.certHandler).Methods("POST", "GET")
 	r.HandleFunc("/certs/{certID:[^/]*}", gw.certHandler).Methods("POST", "GET", "DELETE")
 	r.HandleFunc("/oauth/clients/{apiID}", gw.oAuthClientHandler).Methods("GET", "DELETE")
@@ -636,17 +688,31 @@ func (gw *Gateway) loadControlAPIEndpoints(muxer *mux.Router) {
 // correct security credentials - this is a shared secret between the
 // client and the owner and is set in the tyk.conf file. This should
 // never be made public!
+//
+// Named credentials from control_api_access are accepted too, they are set in
+// the request context so that the routes can check their roles.
 func (gw *Gateway) checkIsAPIOwner(next http.Handler) http.Handler {
 	secret := gw.GetConfig().Secret
+	access := gw.newControlAPIAccess()
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tykAuthKey := r.Header.Get(headers.XTykAuthorization)
-		if tykAuthKey != secret {
+		if secret != "" || access.empty() {
+			if tykAuthKey == secret {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		cred := access.authenticate(r, tykAuthKey)
+		if cred == nil {
 			// Error
 			mainLog.Warning("Attempted administrative access with invalid or missing key!")
 
 			doJSONWrite(w, http.StatusForbidden, apiError("Attempted administrative access with invalid or missing key!"))
 			return
 		}
+
+		ctxSetControlAPICredential(r, cred)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -683,7 +749,7 @@ func (gw *Gateway) addOAuthHandlers(spec *APISpec, muxer *mux.Router) *OAuthMana
 	osinStorage := &RedisOsinStorageInterface{
 		storageManager,
 		gw.GlobalSessionManager,
-		&storage.RedisCluster{KeyPrefix: prefix, HashKeys: false, RedisController: gw.RedisController},
+		gw.newStore(storage.StoreOptions{KeyPrefix: prefix, HashKeys: false}),
 		spec.OrgID,
 		gw,
 	}
@@ -693,7 +759,8 @@ func (gw *Gateway) addOAuthHandlers(spec *APISpec, muxer *mux.Router) *OAuthMana
 	oauthManager := OAuthManager{spec, osinServer, gw}
 	oauthHandlers := OAuthHandlers{oauthManager}
 
-	muxer.Handle(apiAuthorizePath, gw.checkIsAPIOwner(allowMethods(oauthHandlers.HandleGenerateAuthCodeData, "POST")))
+	muxer.Handle(apiAuthorizePath, gw.checkIsAPIOwner(gw.requireControlAPIAccess(controlAPIOAuth, controlAPIWrite,
+		allowMethods(oauthHandlers.HandleGenerateAuthCodeData, "POST"))))
 	muxer.HandleFunc(clientAuthPath, allowMethods(oauthHandlers.HandleAuthorizePassthrough, "GET", "POST"))
 	muxer.HandleFunc(clientAccessPath, addSecureAndCacheHeaders(allowMethods(oauthHandlers.HandleAccessRequest, "GET", "POST")))
 	muxer.HandleFunc(revokeToken, oauthHandlers.HandleRevokeToken)
@@ -968,8 +1035,8 @@ func (gw *Gateway) reloadQueueLoop(cb ...func()) {
 }
 
 // reloadURLStructure will queue an API reload. The reload will
-// eventually create a new muxer, reload all the app configs for an
-// instance and then replace the DefaultServeMux with the new one. This
+// eventually create a new muxer, reload the app configs which changed for
+// an instance and then replace the DefaultServeMux with the new one. This
 // enables a reconfiguration to take place without stopping any requests
 // from being handled.
 //
@@ -1125,7 +1192,11 @@ func (gw *Gateway) initialiseSystem() error {
 		}
 	}
 
-	if gwConfig.Storage.Type != "redis" {
+	switch gwConfig.Storage.Type {
+	case "redis":
+	case "embedded":
+		mainLog.Warning("Using the embedded store, which can't be shared with other Gateways or read by Tyk Pump.")
+	default:
 		mainLog.Fatal("Redis connection details not set, please ensure that the storage type is set to Redis and that the connection parameters are correct.")
 	}
 
@@ -1188,6 +1259,13 @@ func (gw *Gateway) initialiseSystem() error {
 	gw.SetConfig(gwConfig)
 	gw.getHostDetails(gw.GetConfig().PIDFileLocation)
 	gw.setupInstrumentation()
+	gw.setupPrometheus()
+	gw.setupAccessLog()
+	gw.setupRealtimeStats()
+	gw.setupDebugTracing()
+	gw.setupHealthProbes()
+	gw.setupAuditLog()
+	gw.sloTracker = newSLOTracker()
 
 	if gw.GetConfig().HttpServerOptions.UseLE_SSL {
 		go gw.StartPeriodicStateBackup(&gw.LE_MANAGER)
@@ -1241,57 +1319,92 @@ func (gw *Gateway) afterConfSetup() {
 		conf.HealthCheckEndpointName = "hello"
 	}
 
+	// Keep the unresolved values, so they can be resolved again when rotated
+	gw.kvRefs.setRawConfig(conf)
+	if err := gw.resolveConfigSecrets(&conf, conf); err != nil {
+		log.Fatal(err)
+	}
+
+	gw.SetConfig(conf)
+}
+
+// resolveConfigSecrets sets the configuration values which support KV
+// references in conf to their resolved values from raw.
+func (gw *Gateway) resolveConfigSecrets(conf *config.Config, raw config.Config) error {
 	var err error
 
-	conf.Secret, err = gw.kvStore(conf.Secret)
+	conf.Secret, err = gw.kvStore(raw.Secret)
 	if err != nil {
-		log.Fatalf("could not retrieve the secret key.. %v", err)
+		return fmt.Errorf("could not retrieve the secret key.. %v", err)
 	}
 
-	conf.NodeSecret, err = gw.kvStore(conf.NodeSecret)
+	if creds := raw.ControlAPIAccess.Credentials; len(creds) > 0 {
+		conf.ControlAPIAccess.Credentials = make([]config.ControlAPICredential, len(creds))
+		for i, cred := range creds {
+			cred.Secret, err = gw.kvStore(cred.Secret)
+			if err != nil {
+				return fmt.Errorf("could not retrieve the secret of Gateway API credential %s.. %v", cred.Name, err)
+			}
+			conf.ControlAPIAccess.Credentials[i] = cred
+		}
+	}
+
+	conf.NodeSecret, err = gw.kvStore(raw.NodeSecret)
 	if err != nil {
-		log.Fatalf("could not retrieve the NodeSecret key.. %v", err)
+		return fmt.Errorf("could not retrieve the NodeSecret key.. %v", err)
 	}
 
-	conf.Storage.Password, err = gw.kvStore(conf.Storage.Password)
+	conf.Storage.Password, err = gw.kvStore(raw.Storage.Password)
 	if err != nil {
-		log.Fatalf("Could not retrieve redis password... %v", err)
+		return fmt.Errorf("Could not retrieve redis password... %v", err)
 	}
 
-	conf.CacheStorage.Password, err = gw.kvStore(conf.CacheStorage.Password)
+	conf.CacheStorage.Password, err = gw.kvStore(raw.CacheStorage.Password)
 	if err != nil {
-		log.Fatalf("Could not retrieve cache storage password... %v", err)
+		return fmt.Errorf("Could not retrieve cache storage password... %v", err)
 	}
 
-	conf.Security.PrivateCertificateEncodingSecret, err = gw.kvStore(conf.Security.PrivateCertificateEncodingSecret)
+	conf.Security.PrivateCertificateEncodingSecret, err = gw.kvStore(raw.Security.PrivateCertificateEncodingSecret)
 	if err != nil {
-		log.Fatalf("Could not retrieve the private certificate encoding secret... %v", err)
+		return fmt.Errorf("Could not retrieve the private certificate encoding secret... %v", err)
 	}
 
-	if conf.UseDBAppConfigs {
-		conf.DBAppConfOptions.ConnectionString, err = gw.kvStore(conf.DBAppConfOptions.ConnectionString)
+	if raw.UseDBAppConfigs {
+		conf.DBAppConfOptions.ConnectionString, err = gw.kvStore(raw.DBAppConfOptions.ConnectionString)
 		if err != nil {
-			log.Fatalf("Could not fetch dashboard connection string.. %v", err)
+			return fmt.Errorf("Could not fetch dashboard connection string.. %v", err)
 		}
 	}
 
-	if conf.Policies.PolicySource == "service" {
-		conf.Policies.PolicyConnectionString, err = gw.kvStore(conf.Policies.PolicyConnectionString)
+	if raw.Policies.PolicySource == "service" {
+		conf.Policies.PolicyConnectionString, err = gw.kvStore(raw.Policies.PolicyConnectionString)
 		if err != nil {
-			log.Fatalf("Could not fetch policy connection string... %v", err)
+			return fmt.Errorf("Could not fetch policy connection string... %v", err)
 		}
 	}
 
-	gw.SetConfig(conf)
+	return nil
 }
 
+// kvStore resolves value if it is a KV reference, e.g. "vault://path.key",
+// and returns it unchanged otherwise. Resolved references are tracked so
+// that rotated values can be detected.
 func (gw *Gateway) kvStore(value string) (string, error) {
+	val, err := gw.resolveKV(value)
+	if err == nil && isKVReference(value) {
+		gw.kvRefs.track(value, val)
+	}
+
+	return val, err
+}
+
+func (gw *Gateway) resolveKV(value string) (string, error) {
 
 	if strings.HasPrefix(value, "secrets://") {
 		key := strings.TrimPrefix(value, "secrets://")
 		log.Debugf("Retrieving %s from secret store in config", key)
-		val, ok := gw.GetConfig().Secrets[key]
-		if !ok {
+		val, err := kv.Map(gw.GetConfig().Secrets).Get(key)
+		if err != nil {
 			return "", fmt.Errorf("secrets does not exist in config.. %s not found", key)
 		}
 
@@ -1301,7 +1414,21 @@ func (gw *Gateway) kvStore(value string) (string, error) {
 	if strings.HasPrefix(value, "env://") {
 		key := strings.TrimPrefix(value, "env://")
 		log.Debugf("Retrieving %s from environment", key)
-		return os.Getenv(fmt.Sprintf("TYK_SECRET_%s", strings.ToUpper(key))), nil
+		store, _ := kv.NewEnv(gw.GetConfig().KV.Env)
+		val, err := store.Get(key)
+		if err == kv.ErrKeyNotFound {
+			// Unset variables resolve to an empty value
+			return "", nil
+		}
+
+		return val, err
+	}
+
+	if strings.HasPrefix(value, "file://") {
+		key := strings.TrimPrefix(value, "file://")
+		log.Debugf("Retrieving %s from file", key)
+		store, _ := kv.NewFile(gw.GetConfig().KV.File)
+		return store.Get(key)
 	}
 
 	if strings.HasPrefix(value, "consul://") {
@@ -1332,6 +1459,14 @@ func (gw *Gateway) kvStore(value string) (string, error) {
 	return value, nil
 }
 
+// certificateSecret returns the secret used to encrypt certificate private keys.
+func (gw *Gateway) certificateSecret() string {
+	if secret := gw.GetConfig().Security.PrivateCertificateEncodingSecret; secret != "" {
+		return secret
+	}
+	return gw.GetConfig().Secret
+}
+
 func (gw *Gateway) setUpVault() error {
 	if gw.vaultKVStore != nil {
 		return nil
@@ -1372,8 +1507,13 @@ func (gw *Gateway) getHostDetails(file string) {
 	}
 }
 
+// newStore returns a store of the configured storage type, Redis or the embedded store
+func (gw *Gateway) newStore(opts storage.StoreOptions) storage.Store {
+	return storage.NewStore(gw.GetConfig().Storage.Type, gw.RedisController, opts)
+}
+
 func (gw *Gateway) getGlobalMDCBStorageHandler(keyPrefix string, hashKeys bool) storage.Handler {
-	localStorage := &storage.RedisCluster{KeyPrefix: keyPrefix, HashKeys: hashKeys, RedisController: gw.RedisController}
+	localStorage := gw.newStore(storage.StoreOptions{KeyPrefix: keyPrefix, HashKeys: hashKeys})
 	logger := logrus.New().WithFields(logrus.Fields{"prefix": "mdcb-storage-handler"})
 
 	if gw.GetConfig().SlaveOptions.UseRPC {
@@ -1398,7 +1538,7 @@ func (gw *Gateway) getGlobalStorageHandler(keyPrefix string, hashKeys bool) stor
 			Gw:        gw,
 		}
 	}
-	return &storage.RedisCluster{KeyPrefix: keyPrefix, HashKeys: hashKeys, RedisController: gw.RedisController}
+	return gw.newStore(storage.StoreOptions{KeyPrefix: keyPrefix, HashKeys: hashKeys})
 }
 
 func Start() {
@@ -1513,6 +1653,7 @@ func Start() {
 	if gwConfig.EnableAnalytics && gw.analytics.Store == nil {
 		gw.analytics.Stop()
 	}
+	gw.accessLog.close()
 
 	// write pprof profiles
 	writeProfiles()
@@ -1587,6 +1728,14 @@ func (gw *Gateway) start() {
 	// interval counts from the start of one reload to the next.
 	go gw.reloadLoop(time.Tick(time.Second))
 	go gw.reloadQueueLoop()
+
+	if interval := gw.GetConfig().KV.WatchInterval; interval > 0 {
+		go gw.watchKVReferences(gw.ctx, time.Duration(interval)*time.Second)
+	}
+
+	if gw.GetConfig().FileWatch.Enabled {
+		gw.startFileWatch(gw.ctx)
+	}
 }
 
 func dashboardServiceInit(gw *Gateway) {
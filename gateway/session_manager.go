@@ -135,14 +135,19 @@ func (l *SessionLimiter) limitDRL(currentSession *user.SessionState, key string,
 		l.bucketStore = memorycache.New()
 	}
 
+	drlManager := l.Gw.DRLManager
+	if l.Gw.degradedMode.isActive() {
+		drlManager = l.Gw.degradedMode.drl
+	}
+
 	bucketKey := key + ":" + rateScope + currentSession.LastUpdated
 	currRate := apiLimit.Rate
 	per := apiLimit.Per
 
 	// DRL will always overflow with more servers on low rates
-	rate := uint(currRate * float64(l.Gw.DRLManager.RequestTokenValue))
-	if rate < uint(l.Gw.DRLManager.CurrentTokenValue()) {
-		rate = uint(l.Gw.DRLManager.CurrentTokenValue())
+	rate := uint(currRate * float64(drlManager.RequestTokenValue))
+	if rate < uint(drlManager.CurrentTokenValue()) {
+		rate = uint(drlManager.CurrentTokenValue())
 	}
 	userBucket, err := l.bucketStore.Create(bucketKey, rate, time.Duration(per)*time.Second)
 	if err != nil {
@@ -156,7 +161,7 @@ func (l *SessionLimiter) limitDRL(currentSession *user.SessionState, key string,
 			return true
 		}
 	} else {
-		_, errF := userBucket.Add(uint(l.Gw.DRLManager.CurrentTokenValue()))
+		_, errF := userBucket.Add(uint(drlManager.CurrentTokenValue()))
 		if errF != nil {
 			return true
 		}
@@ -191,13 +196,20 @@ func (l *SessionLimiter) ForwardMessage(r *http.Request, currentSession *user.Se
 	if l.Gw == nil {
 		panic("viene nulo")
 	}
+	store = storage.WithContext(store, r.Context())
+
 	// If rate is -1 or 0, it means unlimited and no need for rate limiting.
 	if enableRL && accessDef.Limit.Rate > 0 {
 		rateScope := ""
 		if allowanceScope != "" {
 			rateScope = allowanceScope + "-"
 		}
-		if globalConf.EnableSentinelRateLimiter {
+		if l.Gw.degradedMode.isActive() {
+			// Redis is unreachable, the Gateway enforces the rate limit on its own
+			if l.limitDRL(currentSession, key, rateScope, &accessDef.Limit, dryRun) {
+				return sessionFailRateLimit
+			}
+		} else if globalConf.EnableSentinelRateLimiter {
 			if l.limitSentinel(currentSession, key, rateScope, store, globalConf, &accessDef.Limit, dryRun) {
 				return sessionFailRateLimit
 			}
@@ -263,6 +275,11 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 		key = storage.HashStr(currentSession.KeyID)
 	}
 
+	// rotated keys use the quota of their successor
+	if successor, ok := currentSession.MetaData[keyQuotaOfMetaKey].(string); ok && successor != "" {
+		key = successor
+	}
+
 	rawKey := QuotaKeyPrefix + quotaScope + key
 	quotaRenewalRate := limit.QuotaRenewalRate
 	quotaRenews := limit.QuotaRenews
@@ -271,7 +288,14 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 	log.Debug("[QUOTA] Quota limiter key is: ", rawKey)
 	log.Debug("Renewing with TTL: ", quotaRenewalRate)
 	// INCR the key (If it equals 1 - set EXPIRE)
-	qInt := store.IncrememntWithExpire(rawKey, quotaRenewalRate)
+	degraded := l.Gw.degradedMode.isActive()
+	var qInt int64
+	if degraded {
+		qInt = l.Gw.degradedMode.incrementQuota(rawKey, limit)
+	} else {
+		qInt = store.IncrememntWithExpire(rawKey, quotaRenewalRate)
+		l.Gw.degradedMode.countQuota(rawKey, qInt, limit)
+	}
 	// if the returned val is >= quota: block
 	if qInt-1 >= quotaMax {
 		renewalDate := time.Unix(quotaRenews, 0)
@@ -279,7 +303,8 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 		log.Debug("As epoch: ", quotaRenews)
 		log.Debug("Session: ", currentSession)
 		log.Debug("Now:", time.Now())
-		if time.Now().After(renewalDate) {
+		// buffered quotas expire at the end of their period in degraded mode
+		if time.Now().After(renewalDate) && !degraded {
 			//for renew quota = never, once we get the quota max we must not allow using it again
 
 			if quotaRenewalRate <= 0 {
@@ -0,0 +1,212 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// sloBucketSeconds is the granularity of the SLO windows.
+const sloBucketSeconds = 10
+
+// Default burn rate alerts, as recommended by the Google SRE workbook for a
+// 30 days error budget.
+var (
+	defaultSLOFastBurn = apidef.SLOBurnRateAlert{LongWindow: 3600, ShortWindow: 300, BurnRate: 14.4}
+	defaultSLOSlowBurn = apidef.SLOBurnRateAlert{LongWindow: 21600, ShortWindow: 1800, BurnRate: 6}
+)
+
+// sloTracker evaluates the SLO objectives of the APIs, keeping their state
+// across reloads for as long as their objectives don't change.
+type sloTracker struct {
+	mu   sync.Mutex
+	now  func() time.Time
+	apis map[string]*apiSLOs
+}
+
+type apiSLOs struct {
+	objectives []apidef.SLOObjective
+	states     []*sloState
+}
+
+// sloState counts the good and bad requests of an objective in buckets of
+// sloBucketSeconds, over its longest window.
+type sloState struct {
+	objective apidef.SLOObjective
+	alerts    []*sloAlert
+	buckets   []sloBucket
+	current   int64
+}
+
+type sloBucket struct {
+	index int64
+	total uint64
+	bad   uint64
+}
+
+type sloAlert struct {
+	event  apidef.TykEvent
+	conf   apidef.SLOBurnRateAlert
+	firing bool
+}
+
+func newSLOTracker() *sloTracker {
+	return &sloTracker{now: time.Now, apis: make(map[string]*apiSLOs)}
+}
+
+func newSLOState(objective apidef.SLOObjective) (*sloState, error) {
+	switch {
+	case objective.Type != apidef.SLOAvailability && objective.Type != apidef.SLOLatency:
+		return nil, fmt.Errorf("unknown type %q", objective.Type)
+	case objective.Target <= 0 || objective.Target >= 100:
+		return nil, fmt.Errorf("target %v isn't between 0 and 100", objective.Target)
+	case objective.Type == apidef.SLOLatency && objective.LatencyThreshold <= 0:
+		return nil, fmt.Errorf("no latency threshold")
+	}
+
+	s := &sloState{objective: objective, alerts: []*sloAlert{
+		{event: EventSLOFastBurn, conf: sloAlertConfig(objective.FastBurn, defaultSLOFastBurn)},
+		{event: EventSLOSlowBurn, conf: sloAlertConfig(objective.SlowBurn, defaultSLOSlowBurn)},
+	}}
+	var window int64
+	for _, alert := range s.alerts {
+		if alert.conf.LongWindow > window {
+			window = alert.conf.LongWindow
+		}
+	}
+	s.buckets = make([]sloBucket, window/sloBucketSeconds+1)
+
+	return s, nil
+}
+
+func sloAlertConfig(conf, defaults apidef.SLOBurnRateAlert) apidef.SLOBurnRateAlert {
+	if conf.LongWindow <= 0 {
+		conf.LongWindow = defaults.LongWindow
+	}
+	if conf.ShortWindow <= 0 {
+		conf.ShortWindow = defaults.ShortWindow
+	}
+	if conf.BurnRate <= 0 {
+		conf.BurnRate = defaults.BurnRate
+	}
+	return conf
+}
+
+// record counts a request towards the objectives of its API. The burn rates
+// are evaluated each time a bucket is completed.
+func (t *sloTracker) record(spec *APISpec, code int, latency time.Duration) {
+	if t == nil || len(spec.SLOs) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	api := t.apis[spec.APIID]
+	if api == nil || !reflect.DeepEqual(api.objectives, spec.SLOs) {
+		api = &apiSLOs{objectives: spec.SLOs}
+		for _, objective := range spec.SLOs {
+			state, err := newSLOState(objective)
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"prefix": "slo",
+					"api_id": spec.APIID,
+				}).WithError(err).Errorf("Ignoring SLO objective %q", objective.Name)
+				continue
+			}
+			api.states = append(api.states, state)
+		}
+		t.apis[spec.APIID] = api
+	}
+
+	index := t.now().Unix() / sloBucketSeconds
+	for _, s := range api.states {
+		if s.current != 0 && s.current != index {
+			s.evaluate(spec)
+		}
+		s.add(index, s.isBad(code, latency))
+	}
+}
+
+// retain forgets the objectives of the APIs which are no longer loaded.
+func (t *sloTracker) retain(specs map[string]*APISpec) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for apiID := range t.apis {
+		if _, ok := specs[apiID]; !ok {
+			delete(t.apis, apiID)
+		}
+	}
+}
+
+func (s *sloState) isBad(code int, latency time.Duration) bool {
+	if s.objective.Type == apidef.SLOLatency {
+		return latency > time.Duration(s.objective.LatencyThreshold)*time.Millisecond
+	}
+	return code >= http.StatusInternalServerError
+}
+
+func (s *sloState) add(index int64, bad bool) {
+	b := &s.buckets[index%int64(len(s.buckets))]
+	if b.index != index {
+		*b = sloBucket{index: index}
+	}
+	b.total++
+	if bad {
+		b.bad++
+	}
+	s.current = index
+}
+
+// burnRate returns how many times faster than sustainable the error budget
+// burnt over the last seconds.
+func (s *sloState) burnRate(seconds int64) float64 {
+	var total, bad uint64
+	from := s.current - seconds/sloBucketSeconds
+	for _, b := range s.buckets {
+		if b.index > from && b.index <= s.current {
+			total += b.total
+			bad += b.bad
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(bad) / float64(total) / (1 - s.objective.Target/100)
+}
+
+// evaluate fires the burn rate events of the alerts whose long and short
+// windows both exceed their burn rate. An alert fires again only after it
+// has resolved.
+func (s *sloState) evaluate(spec *APISpec) {
+	for _, alert := range s.alerts {
+		long, short := s.burnRate(alert.conf.LongWindow), s.burnRate(alert.conf.ShortWindow)
+		burning := long >= alert.conf.BurnRate && short >= alert.conf.BurnRate
+		if burning && !alert.firing {
+			spec.FireEvent(alert.event, EventSLOBurnMeta{
+				EventMetaDefault: EventMetaDefault{
+					Message: fmt.Sprintf("Error budget of SLO %q burning %.1f times faster than sustainable", s.objective.Name, long),
+				},
+				APIID:         spec.APIID,
+				Objective:     s.objective.Name,
+				Target:        s.objective.Target,
+				LongWindow:    alert.conf.LongWindow,
+				ShortWindow:   alert.conf.ShortWindow,
+				Threshold:     alert.conf.BurnRate,
+				LongBurnRate:  long,
+				ShortBurnRate: short,
+			})
+		}
+		alert.firing = burning
+	}
+}
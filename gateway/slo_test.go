@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestSLOTracker(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	tracker := &sloTracker{now: func() time.Time { return now }, apis: make(map[string]*apiSLOs)}
+
+	events := make(chan config.EventMessage, 10)
+	handler := &testEventHandler{func(em config.EventMessage) { events <- em }}
+	spec := &APISpec{
+		APIDefinition: &apidef.APIDefinition{APIID: "api", SLOs: []apidef.SLOObjective{
+			{Name: "availability", Type: apidef.SLOAvailability, Target: 99},
+			{Name: "latency", Type: apidef.SLOLatency, Target: 95, LatencyThreshold: 300},
+			{Name: "invalid", Type: apidef.SLOLatency, Target: 95},
+		}},
+		EventPaths: map[apidef.TykEvent][]config.TykEventHandler{
+			EventSLOFastBurn: {handler},
+			EventSLOSlowBurn: {handler},
+		},
+	}
+
+	expectEvents := func(t *testing.T, want ...apidef.TykEvent) {
+		t.Helper()
+		for _, event := range want {
+			select {
+			case em := <-events:
+				if em.Type != event {
+					t.Errorf("expected event %s, got %s", event, em.Type)
+				}
+				if meta := em.Meta.(EventSLOBurnMeta); meta.APIID != "api" || meta.Objective != "availability" || meta.LongBurnRate < meta.Threshold {
+					t.Errorf("unexpected event metadata %+v", meta)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("expected event %s", event)
+			}
+		}
+		select {
+		case em := <-events:
+			t.Errorf("unexpected event %+v", em)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// A healthy hour with a 0.5% error rate, burning at half the sustainable rate
+	for i := 0; i < 360; i++ {
+		for j := 0; j < 200; j++ {
+			code := http.StatusOK
+			if j == 0 {
+				code = http.StatusBadGateway
+			}
+			tracker.record(spec, code, 10*time.Millisecond)
+		}
+		now = now.Add(sloBucketSeconds * time.Second)
+	}
+	expectEvents(t)
+
+	if states := tracker.apis["api"].states; len(states) != 2 {
+		t.Fatalf("expected the invalid objective to be ignored, got %d objectives", len(states))
+	}
+
+	// A total outage burns at 100 times the sustainable rate, but needs to
+	// last long enough for the long windows to reach the burn rates. The slow
+	// burn fires first as its lower burn rate outweighs its longer window.
+	outage := func(buckets int) {
+		for i := 0; i < buckets; i++ {
+			for j := 0; j < 200; j++ {
+				tracker.record(spec, http.StatusServiceUnavailable, 10*time.Millisecond)
+			}
+			now = now.Add(sloBucketSeconds * time.Second)
+		}
+	}
+	outage(1)
+	expectEvents(t)
+	outage(25)
+	expectEvents(t, EventSLOSlowBurn)
+	outage(30)
+	expectEvents(t, EventSLOFastBurn)
+
+	// Alerts only fire again once resolved
+	outage(10)
+	expectEvents(t)
+
+	t.Run("changed objectives", func(t *testing.T) {
+		spec.SLOs = spec.SLOs[:1:1]
+		tracker.record(spec, http.StatusOK, 0)
+		if state := tracker.apis["api"].states[0]; state.burnRate(3600) != 0 {
+			t.Errorf("expected the state of changed objectives to be reset, got a burn rate of %v", state.burnRate(3600))
+		}
+
+		tracker.retain(map[string]*APISpec{})
+		if len(tracker.apis) != 0 {
+			t.Error("expected the objectives of unloaded APIs to be forgotten")
+		}
+	})
+}
@@ -237,6 +237,10 @@ func (s *Test) ResetTestConfig() {
 }
 
 func (s *Test) emptyRedis() error {
+	if store := s.Gw.RedisController.Embedded(); store != nil {
+		return store.FlushAll()
+	}
+
 	ctx := context.Background()
 	//addr := config.Global().Storage.Host + ":" + strconv.Itoa(config.Global().Storage.Port)
 	gwConfig := s.Gw.GetConfig()
@@ -424,6 +428,7 @@ const (
 	testSubgraphReviews       = TestHttpAny + handlerSubgraphReviews
 	testHttpJWK               = TestHttpAny + "/jwk.json"
 	testHttpJWKLegacy         = TestHttpAny + "/jwk-legacy.json"
+	testHttpOIDCDiscovery     = TestHttpAny + "/.well-known/openid-configuration"
 	testHttpBundles           = TestHttpAny + "/bundles/"
 	testReloadGroup           = TestHttpAny + "/groupReload"
 
@@ -514,6 +519,14 @@ func (s *Test) testHttpHandler() *mux.Router {
 	r.HandleFunc("/jwk-legacy.json", func(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, jwkTestJsonLegacy)
 	})
+	r.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 TestHttpAny,
+			"authorization_endpoint": TestHttpAny + "/authorize",
+			"token_endpoint":         TestHttpAny + "/token",
+			"jwks_uri":               testHttpJWK,
+		})
+	})
 
 	r.HandleFunc("/compressed", func(w http.ResponseWriter, r *http.Request) {
 		response := "This is a compressed response"
@@ -904,7 +917,8 @@ func (gw *Gateway) CreateDefinitionFromString(defStr string) *APISpec {
 func (gw *Gateway) LoadSampleAPI(def string) (spec *APISpec) {
 	spec = gw.CreateDefinitionFromString(def)
 	gw.loadApps([]*APISpec{spec})
-	return
+	// an unchanged spec which is already loaded is kept instead
+	return gw.getApiSpec(spec.APIID)
 }
 
 func firstVals(vals map[string][]string) map[string]string {
@@ -1030,6 +1044,11 @@ func (s *Test) BootstrapGw(ctx context.Context, cancelFn context.CancelFunc, gen
 	if err != nil {
 		panic(err)
 	}
+	// TYK_TEST_STORAGE=embedded runs the tests against the embedded store rather than Redis
+	if os.Getenv("TYK_TEST_STORAGE") == "embedded" {
+		gwConfig.Storage.Type = "embedded"
+		gwConfig.Storage.Path = filepath.Join(gwConfig.AppPath, "tyk.db")
+	}
 	gwConfig.EnableAnalytics = true
 	gwConfig.AnalyticsConfig.EnableGeoIP = true
 
@@ -1188,6 +1207,7 @@ func (s *Test) Close() {
 
 	s.gwMu.Lock()
 	s.Gw.analytics.Stop()
+	s.Gw.accessLog.close()
 	s.Gw.GlobalHostChecker.StopPoller()
 	s.gwMu.Unlock()
 	os.RemoveAll(s.Gw.GetConfig().AppPath)
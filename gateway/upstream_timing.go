@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/dnscache"
+)
+
+// upstreamTiming is the breakdown of the upstream latency of a request,
+// collected by tracing its round trip.
+type upstreamTiming struct {
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+
+	dns         time.Duration
+	connect     time.Duration
+	tls         time.Duration
+	firstByte   time.Duration
+	gotConn     bool
+	reused      bool
+	dnsCacheHit bool
+}
+
+// withTrace returns a context tracing the round trips made with it. Lookups
+// of the DNS cache are traced too, as they bypass the resolver.
+func (t *upstreamTiming) withTrace(ctx context.Context) context.Context {
+	t.start = time.Now()
+
+	ctx = dnscache.WithLookupHook(ctx, func(info dnscache.LookupInfo) {
+		t.mu.Lock()
+		t.dns = info.Duration
+		t.dnsCacheHit = info.CacheHit
+		t.mu.Unlock()
+	})
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.dns = time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			if err == nil {
+				t.connect = time.Since(t.connectStart)
+			}
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.tls = time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = true
+			// A connection dialed for the request may be beaten by an idle one
+			if t.reused = info.Reused; t.reused {
+				t.dns, t.connect, t.tls, t.dnsCacheHit = 0, 0, 0, false
+			}
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.firstByte = time.Since(t.start)
+			t.mu.Unlock()
+		},
+	})
+}
+
+// setLatency adds the breakdown to the latency of an analytics record.
+func (t *upstreamTiming) setLatency(l *Latency) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l.DNS = int64(DurationToMillisecond(t.dns))
+	l.Connect = int64(DurationToMillisecond(t.connect))
+	l.TLS = int64(DurationToMillisecond(t.tls))
+	l.FirstByte = int64(DurationToMillisecond(t.firstByte))
+	l.ConnReused = t.reused
+	l.DNSCacheHit = t.dnsCacheHit
+}
+
+// connReused returns whether the round trip reused an idle connection, and
+// whether it got a connection at all.
+func (t *upstreamTiming) connReused() (reused, gotConn bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.reused, t.gotConn
+}
+
+// phases returns the duration of the phases of the round trip which happened.
+func (t *upstreamTiming) phases() map[string]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	phases := make(map[string]time.Duration, 4)
+	for name, d := range map[string]time.Duration{
+		"dns":        t.dns,
+		"connect":    t.connect,
+		"tls":        t.tls,
+		"first_byte": t.firstByte,
+	} {
+		if d > 0 {
+			phases[name] = d
+		}
+	}
+	return phases
+}
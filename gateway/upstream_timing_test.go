@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpstreamTiming(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+	client := upstream.Client()
+
+	roundTrip := func() *upstreamTiming {
+		timing := &upstreamTiming{}
+		req, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+		resp, err := client.Do(req.WithContext(timing.withTrace(req.Context())))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return timing
+	}
+
+	timing := roundTrip()
+	if reused, ok := timing.connReused(); !ok || reused {
+		t.Errorf("expected a new connection, got reused %v", reused)
+	}
+	phases := timing.phases()
+	for _, phase := range []string{"connect", "tls", "first_byte"} {
+		if _, ok := phases[phase]; !ok {
+			t.Errorf("expected the %s phase, got %v", phase, phases)
+		}
+	}
+
+	timing = roundTrip()
+	if reused, _ := timing.connReused(); !reused {
+		t.Error("expected the connection to be reused")
+	}
+	var latency Latency
+	timing.setLatency(&latency)
+	if !latency.ConnReused || latency.Connect != 0 || latency.TLS != 0 {
+		t.Errorf("expected no connection phases, got %+v", latency)
+	}
+	if _, ok := timing.phases()["first_byte"]; !ok {
+		t.Error("expected the first byte phase")
+	}
+}
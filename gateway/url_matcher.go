@@ -0,0 +1,278 @@
+package gateway
+
+import (
+	"sort"
+	"strings"
+)
+
+// paramRegex is the expression path parameters such as `{id}` are compiled to.
+const paramRegex = `([^/]*)`
+
+// anyURLStatus matches the URLSpecs of all statuses.
+const anyURLStatus URLStatus = 0
+
+// urlSpecMatcher finds the URLSpecs of an API version matching a path in one
+// pass, instead of matching their regular expressions one by one. The
+// patterns made of literal segments and parameters are indexed in radix
+// trees, other patterns fall back to their regular expressions.
+//
+// Like the regular expressions, which aren't anchored, a pattern matches a
+// path when it matches any part of it.
+type urlSpecMatcher struct {
+	specs []URLSpec
+
+	tree     *radixNode
+	foldTree *radixNode
+	// foldSpecs are the case insensitive specs of foldTree, which are
+	// matched with their regular expressions for non-ASCII paths.
+	foldSpecs []int
+	fallback  []int
+}
+
+// radixNode is a node of a radix tree of URL patterns. Its literal children
+// have distinct first bytes, and its param child matches any segment part.
+type radixNode struct {
+	prefix   string
+	children []*radixNode
+	param    *radixNode
+	specs    []int
+}
+
+type patternToken struct {
+	literal string
+	param   bool
+}
+
+func newURLSpecMatcher(specs []URLSpec) *urlSpecMatcher {
+	m := &urlSpecMatcher{specs: specs, tree: &radixNode{}, foldTree: &radixNode{}}
+	for i := range specs {
+		if specs[i].Spec == nil {
+			m.fallback = append(m.fallback, i)
+			continue
+		}
+
+		tokens, fold, ok := parsePattern(specs[i].Spec.String())
+		switch {
+		case !ok:
+			m.fallback = append(m.fallback, i)
+		case fold:
+			m.foldTree.insert(tokens, i)
+			m.foldSpecs = append(m.foldSpecs, i)
+		default:
+			m.tree.insert(tokens, i)
+		}
+	}
+	return m
+}
+
+// parsePattern splits a regular expression made of literals and parameters
+// starting with a slash, as generated from the paths of the API definitions.
+func parsePattern(expr string) (tokens []patternToken, fold bool, ok bool) {
+	if strings.HasPrefix(expr, "(?i)") {
+		expr = expr[len("(?i)"):]
+		fold = true
+	}
+	if !strings.HasPrefix(expr, "/") {
+		return nil, false, false
+	}
+
+	var literal strings.Builder
+	for i := 0; i < len(expr); {
+		if strings.HasPrefix(expr[i:], paramRegex) {
+			if literal.Len() > 0 {
+				tokens = append(tokens, patternToken{literal: literal.String()})
+				literal.Reset()
+			}
+			tokens = append(tokens, patternToken{param: true})
+			i += len(paramRegex)
+			continue
+		}
+
+		c := expr[i]
+		if strings.IndexByte(`\.+*?()|[]{}^$`, c) >= 0 || (fold && c >= 0x80) {
+			return nil, false, false
+		}
+		if fold {
+			c = toLowerASCII(c)
+		}
+		literal.WriteByte(c)
+		i++
+	}
+	if literal.Len() > 0 {
+		tokens = append(tokens, patternToken{literal: literal.String()})
+	}
+	return tokens, fold, true
+}
+
+func (n *radixNode) insert(tokens []patternToken, spec int) {
+	if len(tokens) == 0 {
+		n.specs = append(n.specs, spec)
+		return
+	}
+
+	if tokens[0].param {
+		if n.param == nil {
+			n.param = &radixNode{}
+		}
+		n.param.insert(tokens[1:], spec)
+		return
+	}
+
+	literal := tokens[0].literal
+	for _, child := range n.children {
+		if child.prefix[0] != literal[0] {
+			continue
+		}
+
+		common := 1
+		for common < len(child.prefix) && common < len(literal) && child.prefix[common] == literal[common] {
+			common++
+		}
+		if common < len(child.prefix) {
+			*child = radixNode{
+				prefix:   child.prefix[:common],
+				children: []*radixNode{{prefix: child.prefix[common:], children: child.children, param: child.param, specs: child.specs}},
+			}
+		}
+		if common == len(literal) {
+			child.insert(tokens[1:], spec)
+			return
+		}
+
+		rest := append([]patternToken{{literal: literal[common:]}}, tokens[1:]...)
+		child.insert(rest, spec)
+		return
+	}
+
+	child := &radixNode{prefix: literal}
+	n.children = append(n.children, child)
+	child.insert(tokens[1:], spec)
+}
+
+// walk adds the specs of the patterns matching path from i to matches.
+func (n *radixNode) walk(path string, i int, fold bool, matches []int) []int {
+	matches = append(matches, n.specs...)
+
+	if i < len(path) {
+		for _, child := range n.children {
+			if hasPrefixFold(path[i:], child.prefix, fold) {
+				matches = child.walk(path, i+len(child.prefix), fold, matches)
+				break
+			}
+		}
+	}
+
+	if n.param != nil {
+		// Parameters match any part of a segment, including an empty one
+		for j := i; ; j++ {
+			matches = n.param.walk(path, j, fold, matches)
+			if j == len(path) || path[j] == '/' {
+				break
+			}
+		}
+	}
+
+	return matches
+}
+
+// match returns the indexes of the URLSpecs of a status matching a path, in
+// their order of precedence.
+func (m *urlSpecMatcher) match(path string, status URLStatus) []int {
+	var matches []int
+	ascii := isASCII(path)
+	for i := 0; i < len(path); i++ {
+		if path[i] != '/' {
+			continue
+		}
+		matches = m.tree.walk(path, i, false, matches)
+		if ascii {
+			matches = m.foldTree.walk(path, i, true, matches)
+		}
+	}
+
+	fallback := m.fallback
+	if !ascii {
+		// Unicode case folding can match non-ASCII characters to ASCII ones
+		fallback = append(m.foldSpecs[:len(m.foldSpecs):len(m.foldSpecs)], fallback...)
+	}
+	for _, i := range fallback {
+		if (status == anyURLStatus || m.specs[i].Status == status) && m.specs[i].Spec.MatchString(path) {
+			matches = append(matches, i)
+		}
+	}
+
+	sort.Ints(matches)
+	n := 0
+	for _, i := range matches {
+		if n > 0 && matches[n-1] == i {
+			continue
+		}
+		if status != anyURLStatus && m.specs[i].Status != status {
+			continue
+		}
+		matches[n] = i
+		n++
+	}
+	return matches[:n]
+}
+
+// urlSpecMatches returns the indexes of the URLSpecs of a status matching a
+// path, in order, using the matcher of the URLSpecs when they have one.
+func (a *APISpec) urlSpecMatches(rxPaths []URLSpec, path string, status URLStatus) []int {
+	if len(rxPaths) == 0 {
+		return nil
+	}
+	if m := a.urlMatchers[&rxPaths[0]]; m != nil && len(m.specs) == len(rxPaths) {
+		return m.match(path, status)
+	}
+
+	var matches []int
+	for i := range rxPaths {
+		if (status == anyURLStatus || rxPaths[i].Status == status) && rxPaths[i].Spec.MatchString(path) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// addURLSpecMatcher indexes the URLSpecs of an API version.
+func (a *APISpec) addURLSpecMatcher(rxPaths []URLSpec) {
+	if len(rxPaths) == 0 {
+		return
+	}
+	if a.urlMatchers == nil {
+		a.urlMatchers = make(map[*URLSpec]*urlSpecMatcher)
+	}
+	a.urlMatchers[&rxPaths[0]] = newURLSpecMatcher(rxPaths)
+}
+
+func hasPrefixFold(s, prefix string, fold bool) bool {
+	if !fold {
+		return strings.HasPrefix(s, prefix)
+	}
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		if toLowerASCII(s[i]) != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func toLowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func compileURLSpecs(paths []string, ignoreCase bool) []URLSpec {
+	var specs []URLSpec
+	for i, path := range paths {
+		spec := URLSpec{IgnoreCase: ignoreCase && i%2 == 0}
+		APIDefinitionLoader{}.generateRegex(path, &spec, URLStatus(i%int(GoPlugin))+1, config.Config{})
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+func TestURLSpecMatcher(t *testing.T) {
+	specs := compileURLSpecs([]string{
+		"/users",
+		"/users/{id}",
+		"/users/{id}/orders",
+		"/users/{id}/orders/{order}",
+		"/users/me",
+		"/use",
+		"/{version}/users",
+		"/a/{x}{y}/b",
+		"/files/{name}.json",
+		"users/{id}",
+		"/(admin|root)/.*",
+		"/Café",
+		"/",
+		"",
+	}, true)
+
+	m := newURLSpecMatcher(specs)
+	if len(m.fallback) != 4 || len(m.foldSpecs) != 5 {
+		t.Errorf("unexpected fallback %v and case insensitive specs %v", m.fallback, m.foldSpecs)
+	}
+
+	for _, path := range []string{
+		"/",
+		"",
+		"/users",
+		"/USERS/1",
+		"/users/1/orders/2",
+		"/users/me/orders",
+		"/v1/users/1",
+		"/users//orders",
+		"/a/b/b",
+		"/a//b",
+		"/a/x/y/b",
+		"/files/report.json",
+		"/files/report-json",
+		"/admin/panel",
+		"/café",
+		"/CAFÉ",
+		"/uſers",
+		"/\xffusers",
+		"/x/users-legacy",
+	} {
+		var want []int
+		for i := range specs {
+			if specs[i].Spec.MatchString(path) {
+				want = append(want, i)
+			}
+		}
+		if got := m.match(path, anyURLStatus); !reflect.DeepEqual(got, want) && len(got)+len(want) > 0 {
+			t.Errorf("%q: expected matches %v, got %v", path, want, got)
+		}
+
+		for status := Ignored; status <= GoPlugin; status++ {
+			var want []int
+			for i := range specs {
+				if specs[i].Status == status && specs[i].Spec.MatchString(path) {
+					want = append(want, i)
+				}
+			}
+			if got := m.match(path, status); !reflect.DeepEqual(got, want) && len(got)+len(want) > 0 {
+				t.Errorf("%q with status %d: expected matches %v, got %v", path, status, want, got)
+			}
+		}
+	}
+}
+
+func TestURLSpecMatcherPrecedence(t *testing.T) {
+	ts := StartTest(nil)
+	defer ts.Close()
+
+	spec := ts.Gw.BuildAndLoadAPI(func(spec *APISpec) {
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.Ignored = []apidef.EndPointMeta{{Path: "/users/{id}/public", Method: http.MethodGet}}
+			v.ExtendedPaths.BlackList = []apidef.EndPointMeta{{Path: "/users/{id}", Method: http.MethodGet}}
+		})
+	})[0]
+
+	if len(spec.urlMatchers) != 1 {
+		t.Fatalf("expected a matcher, got %d", len(spec.urlMatchers))
+	}
+
+	for path, want := range map[string]RequestStatus{
+		"/users/1/public": StatusOkAndIgnore,
+		"/users/1":        EndPointNotAllowed,
+		"/orders":         StatusOk,
+	} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if got, _ := spec.URLAllowedAndIgnored(r, spec.RxPaths["v1"], false); got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+}
+
+func benchmarkURLSpecs(n int) []URLSpec {
+	paths := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		paths = append(paths, fmt.Sprintf("/resource%d/{id}/items/{item}", i))
+	}
+	return compileURLSpecs(paths, false)
+}
+
+func BenchmarkURLSpecMatcher(b *testing.B) {
+	specs := benchmarkURLSpecs(500)
+	spec := &APISpec{}
+	spec.addURLSpecMatcher(specs)
+	path := "/resource250/123/items/456"
+
+	b.Run("linear", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := range specs {
+				specs[j].Spec.MatchString(path)
+			}
+		}
+	})
+
+	b.Run("radix", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			spec.urlSpecMatches(specs, path, anyURLStatus)
+		}
+	})
+}
@@ -46,6 +46,20 @@ func contains(s []string, i string) bool {
 	return false
 }
 
+// uniqueStrings removes duplicates from the given slice, keeping the first occurrence of each item.
+func uniqueStrings(s []string) []string {
+	seen := make(map[string]bool, len(s))
+	out := s[:0]
+	for _, item := range s {
+		if seen[item] {
+			continue
+		}
+		seen[item] = true
+		out = append(out, item)
+	}
+	return out
+}
+
 // greaterThanFloat64 checks whether first float64 value is bigger than second float64 value.
 // -1 means infinite and the biggest value.
 func greaterThanFloat64(first, second float64) bool {
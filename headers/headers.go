@@ -14,13 +14,16 @@ const (
 	Expires                 = "Expires"
 	Connection              = "Connection"
 	WWWAuthenticate         = "WWW-Authenticate"
+	ETag                    = "ETag"
+	IfMatch                 = "If-Match"
 )
 
 const (
-	TykHookshot     = "Tyk-Hookshot"
-	ApplicationJSON = "application/json"
-	ApplicationXML  = "application/xml"
-	TextXML         = "text/xml"
+	TykHookshot       = "Tyk-Hookshot"
+	ApplicationJSON   = "application/json"
+	ApplicationNDJSON = "application/x-ndjson"
+	ApplicationXML    = "application/xml"
+	TextXML           = "text/xml"
 )
 
 const (
@@ -39,6 +42,9 @@ const (
 	XTykHostname        = "x-tyk-hostname"
 	XGenerator          = "X-Generator"
 	XTykAuthorization   = "X-Tyk-Authorization"
+	XTykDebug           = "X-Tyk-Debug"
+	XTykDebugTraceID    = "X-Tyk-Debug-Trace-Id"
+	XTykActor           = "X-Tyk-Actor"
 )
 
 // upgrade and websocket
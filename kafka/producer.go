@@ -0,0 +1,296 @@
+// Package kafka implements a minimal Kafka producer, writing uncompressed
+// record batches to the leaders of a topic's partitions.
+package kafka
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultClientID = "tyk"
+	defaultTimeout  = 10 * time.Second
+)
+
+// ErrNoBrokers is returned when none of the brokers can be reached.
+var ErrNoBrokers = errors.New("kafka: no brokers available")
+
+// Config configures a Producer.
+type Config struct {
+	// Brokers used to discover the cluster, as host:port.
+	Brokers []string
+	Topic   string
+
+	ClientID string
+	// RequiredAcks is the number of acknowledgements the leader waits for
+	// before responding: 0 for none, 1 for the leader and -1 for all replicas.
+	RequiredAcks int16
+	// Timeout of the connections and requests.
+	Timeout time.Duration
+	// TLSConfig enables TLS when set.
+	TLSConfig *tls.Config
+}
+
+// Message is a record produced to the topic. Messages with the same key are
+// written to the same partition.
+type Message struct {
+	Key   []byte
+	Value []byte
+	Time  time.Time
+}
+
+// Producer writes messages to a topic. It is safe for concurrent use.
+type Producer struct {
+	conf Config
+
+	mu    sync.Mutex
+	meta  *metadata
+	conns map[string]*conn
+	next  int
+}
+
+// NewProducer returns a Producer for the topic. Brokers are contacted on
+// the first call to Produce.
+func NewProducer(conf Config) *Producer {
+	if conf.ClientID == "" {
+		conf.ClientID = defaultClientID
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = defaultTimeout
+	}
+	return &Producer{conf: conf, conns: map[string]*conn{}}
+}
+
+// Produce writes the messages, retrying once with refreshed metadata when
+// partition leaders have changed.
+func (p *Producer) Produce(msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := p.produce(msgs)
+	if err == nil {
+		return nil
+	}
+
+	// Leaders may have moved or connections dropped, try again from scratch
+	p.meta = nil
+	p.closeConns()
+	return p.produce(msgs)
+}
+
+func (p *Producer) produce(msgs []Message) error {
+	if p.meta == nil {
+		meta, err := p.fetchMetadata()
+		if err != nil {
+			return err
+		}
+		p.meta = meta
+	}
+
+	// Group the messages by leader and partition
+	byLeader := map[int32]map[int32][]Message{}
+	for _, msg := range msgs {
+		part := p.partition(msg.Key)
+		if byLeader[part.leader] == nil {
+			byLeader[part.leader] = map[int32][]Message{}
+		}
+		byLeader[part.leader][part.id] = append(byLeader[part.leader][part.id], msg)
+	}
+
+	for leader, partitions := range byLeader {
+		br, ok := p.meta.brokers[leader]
+		if !ok {
+			return ErrLeaderNotAvailable
+		}
+		c, err := p.conn(net.JoinHostPort(br.host, strconv.Itoa(int(br.port))))
+		if err != nil {
+			return err
+		}
+
+		batches := make(map[int32][]byte, len(partitions))
+		for id, partMsgs := range partitions {
+			batches[id] = encodeRecordBatch(partMsgs)
+		}
+		req := encodeProduceRequest(p.conf.Topic, p.conf.RequiredAcks, p.conf.Timeout, batches)
+
+		if p.conf.RequiredAcks == 0 {
+			if err := c.send(apiKeyProduce, produceVersion, req); err != nil {
+				return err
+			}
+			continue
+		}
+
+		resp, err := c.request(apiKeyProduce, produceVersion, req)
+		if err != nil {
+			return err
+		}
+		errs, err := decodeProduceResponse(resp)
+		if err != nil {
+			return err
+		}
+		for _, errCode := range errs {
+			if errCode != 0 {
+				return errCode
+			}
+		}
+	}
+
+	return nil
+}
+
+// partition returns the partition of a key, distributing messages without
+// a key across partitions.
+func (p *Producer) partition(key []byte) partition {
+	parts := p.meta.partitions
+	if key == nil {
+		p.next++
+		return parts[p.next%len(parts)]
+	}
+
+	h := fnv.New32a()
+	h.Write(key)
+	return parts[h.Sum32()%uint32(len(parts))]
+}
+
+// fetchMetadata asks the brokers in turn for the topic's partitions.
+func (p *Producer) fetchMetadata() (*metadata, error) {
+	err := ErrNoBrokers
+	for _, addr := range p.conf.Brokers {
+		var c *conn
+		if c, err = p.conn(addr); err != nil {
+			continue
+		}
+
+		var resp []byte
+		if resp, err = c.request(apiKeyMetadata, metadataVersion, encodeMetadataRequest(p.conf.Topic)); err != nil {
+			p.closeConn(addr)
+			continue
+		}
+
+		var meta *metadata
+		if meta, err = decodeMetadataResponse(resp, p.conf.Topic); err != nil {
+			continue
+		}
+		if meta.err != 0 {
+			return nil, meta.err
+		}
+		if len(meta.partitions) == 0 {
+			return nil, ErrLeaderNotAvailable
+		}
+		for _, part := range meta.partitions {
+			if part.err != 0 && part.err.retriable() {
+				return nil, part.err
+			}
+		}
+		return meta, nil
+	}
+
+	return nil, err
+}
+
+func (p *Producer) conn(addr string) (*conn, error) {
+	if c, ok := p.conns[addr]; ok {
+		return c, nil
+	}
+
+	dialer := &net.Dialer{Timeout: p.conf.Timeout}
+	var nc net.Conn
+	var err error
+	if p.conf.TLSConfig != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", addr, p.conf.TLSConfig)
+	} else {
+		nc, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{Conn: nc, r: bufio.NewReader(nc), clientID: p.conf.ClientID, timeout: p.conf.Timeout}
+	p.conns[addr] = c
+	return c, nil
+}
+
+func (p *Producer) closeConn(addr string) {
+	if c, ok := p.conns[addr]; ok {
+		c.Close()
+		delete(p.conns, addr)
+	}
+}
+
+func (p *Producer) closeConns() {
+	for addr := range p.conns {
+		p.closeConn(addr)
+	}
+}
+
+// Close closes the connections to the brokers.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeConns()
+	return nil
+}
+
+// conn is a connection to a broker, used for one request at a time.
+type conn struct {
+	net.Conn
+	r             *bufio.Reader
+	clientID      string
+	timeout       time.Duration
+	correlationID int32
+}
+
+// send writes a request with a v1 request header.
+func (c *conn) send(apiKey, version int16, body []byte) error {
+	c.correlationID++
+
+	var e encoder
+	e.int32(0) // size, set below
+	e.int16(apiKey)
+	e.int16(version)
+	e.int32(c.correlationID)
+	e.string(c.clientID)
+	e.b = append(e.b, body...)
+	binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+
+	c.SetDeadline(time.Now().Add(c.timeout))
+	_, err := c.Write(e.b)
+	return err
+}
+
+// request sends a request and returns the body of its response.
+func (c *conn) request(apiKey, version int16, body []byte) ([]byte, error) {
+	if err := c.send(apiKey, version, body); err != nil {
+		return nil, err
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+	size := int32(binary.BigEndian.Uint32(header[:4]))
+	if size < 4 {
+		return nil, errMalformedResponse
+	}
+	if id := int32(binary.BigEndian.Uint32(header[4:])); id != c.correlationID {
+		return nil, errMalformedResponse
+	}
+
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
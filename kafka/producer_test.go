@@ -0,0 +1,299 @@
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker is a single broker cluster holding the messages it receives.
+type testBroker struct {
+	t          *testing.T
+	l          net.Listener
+	topic      string
+	partitions int32
+
+	mu       sync.Mutex
+	messages map[int32][]Message
+	acks     []int16
+}
+
+func newTestBroker(t *testing.T, topic string, partitions int32) *testBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &testBroker{t: t, l: l, topic: topic, partitions: partitions, messages: map[int32][]Message{}}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(c)
+		}
+	}()
+	return b
+}
+
+func (b *testBroker) addr() string {
+	return b.l.Addr().String()
+}
+
+func (b *testBroker) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(r, req); err != nil {
+			return
+		}
+
+		d := &decoder{b: req}
+		apiKey, version, correlationID := d.int16(), d.int16(), d.int32()
+		d.string() // client id
+
+		var resp encoder
+		resp.int32(correlationID)
+		switch apiKey {
+		case apiKeyMetadata:
+			if version != metadataVersion {
+				b.t.Errorf("unexpected metadata version %d", version)
+			}
+			b.metadata(&resp)
+		case apiKeyProduce:
+			if version != produceVersion {
+				b.t.Errorf("unexpected produce version %d", version)
+			}
+			if !b.produce(d, &resp) {
+				continue
+			}
+		default:
+			b.t.Errorf("unexpected api key %d", apiKey)
+			return
+		}
+
+		var out encoder
+		out.bytes(resp.b)
+		if _, err := c.Write(out.b); err != nil {
+			return
+		}
+	}
+}
+
+func (b *testBroker) metadata(resp *encoder) {
+	host, port, _ := net.SplitHostPort(b.addr())
+	portNum, _ := strconv.Atoi(port)
+
+	resp.int32(1)
+	resp.int32(7) // node id
+	resp.string(host)
+	resp.int32(int32(portNum))
+	resp.nullableString(nil)
+	resp.int32(7) // controller
+
+	resp.int32(1)
+	resp.int16(0)
+	resp.string(b.topic)
+	resp.int8(0)
+	resp.int32(b.partitions)
+	for i := int32(0); i < b.partitions; i++ {
+		resp.int16(0)
+		resp.int32(i)
+		resp.int32(7)
+		resp.int32(1)
+		resp.int32(7)
+		resp.int32(1)
+		resp.int32(7)
+	}
+}
+
+// produce stores the messages of a produce request, returning whether a
+// response is expected.
+func (b *testBroker) produce(d *decoder, resp *encoder) bool {
+	d.string() // transactional id
+	acks := d.int16()
+	d.int32() // timeout
+
+	b.mu.Lock()
+	b.acks = append(b.acks, acks)
+	b.mu.Unlock()
+
+	resp.int32(1)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		resp.string(d.string())
+		pn := d.arrayLen()
+		resp.int32(int32(pn))
+		for j := 0; j < pn; j++ {
+			id := d.int32()
+			batch := d.next(int(d.int32()))
+			msgs := b.decodeBatch(batch)
+
+			b.mu.Lock()
+			b.messages[id] = append(b.messages[id], msgs...)
+			b.mu.Unlock()
+
+			resp.int32(id)
+			resp.int16(0)
+			resp.int64(0)
+			resp.int64(-1)
+		}
+	}
+	resp.int32(0)
+
+	return acks != 0
+}
+
+func (b *testBroker) decodeBatch(batch []byte) []Message {
+	d := &decoder{b: batch}
+	d.int64() // base offset
+	if length := d.int32(); int(length) != len(d.b) {
+		b.t.Errorf("unexpected batch length %d", length)
+	}
+	d.int32() // leader epoch
+	if magic := d.int8(); magic != recordBatchMagic {
+		b.t.Errorf("unexpected magic %d", magic)
+	}
+	if crc := uint32(d.int32()); crc != crc32.Checksum(d.b, crc32c) {
+		b.t.Error("invalid batch CRC")
+	}
+	d.int16() // attributes
+	d.int32() // last offset delta
+	first := d.int64()
+	d.int64() // max timestamp
+	d.int64() // producer id
+	d.int16() // producer epoch
+	d.int32() // base sequence
+	count := d.int32()
+
+	varint := func() int64 {
+		v, n := binary.Varint(d.b)
+		d.b = d.b[n:]
+		return v
+	}
+	varbytes := func() []byte {
+		n := varint()
+		if n < 0 {
+			return nil
+		}
+		return d.next(int(n))
+	}
+
+	var msgs []Message
+	for i := int32(0); i < count; i++ {
+		varint() // length
+		d.int8() // attributes
+		ts := first + varint()
+		varint() // offset delta
+		key := varbytes()
+		value := varbytes()
+		varint() // headers
+		msgs = append(msgs, Message{Key: key, Value: value, Time: time.Unix(0, ts*int64(time.Millisecond))})
+	}
+	if d.err != nil {
+		b.t.Error(d.err)
+	}
+	return msgs
+}
+
+func TestProducer(t *testing.T) {
+	b := newTestBroker(t, "analytics", 3)
+	defer b.l.Close()
+
+	p := NewProducer(Config{Brokers: []string{"127.0.0.1:1", b.addr()}, Topic: "analytics", RequiredAcks: 1})
+	defer p.Close()
+
+	now := time.Now().Truncate(time.Millisecond)
+	msgs := []Message{
+		{Key: []byte("a"), Value: []byte("1"), Time: now},
+		{Key: []byte("b"), Value: []byte("2"), Time: now.Add(time.Second)},
+		{Key: []byte("a"), Value: []byte("3"), Time: now.Add(2 * time.Second)},
+	}
+	if err := p.Produce(msgs); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Produce(msgs[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	total := 0
+	for id, partMsgs := range b.messages {
+		total += len(partMsgs)
+		for _, msg := range partMsgs {
+			if want := p.partition(msg.Key).id; want != id {
+				t.Errorf("message %s written to partition %d, expected %d", msg.Value, id, want)
+			}
+		}
+	}
+	if total != 4 {
+		t.Fatalf("expected 4 messages, got %d", total)
+	}
+
+	// Messages with the same key keep their order
+	a := b.messages[p.partition([]byte("a")).id]
+	var values string
+	for _, msg := range a {
+		if string(msg.Key) == "a" {
+			values += string(msg.Value)
+		}
+	}
+	if values != "131" {
+		t.Errorf("unexpected messages for key a: %s", values)
+	}
+	if !a[0].Time.Equal(now) {
+		t.Errorf("expected timestamp %v, got %v", now, a[0].Time)
+	}
+}
+
+func TestProducerNoAcks(t *testing.T) {
+	b := newTestBroker(t, "analytics", 1)
+	defer b.l.Close()
+
+	p := NewProducer(Config{Brokers: []string{b.addr()}, Topic: "analytics"})
+	defer p.Close()
+
+	if err := p.Produce([]Message{{Value: []byte("1"), Time: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b.mu.Lock()
+		n := len(b.messages[0])
+		b.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("message wasn't received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProducerUnknownTopic(t *testing.T) {
+	b := newTestBroker(t, "analytics", 1)
+	defer b.l.Close()
+
+	p := NewProducer(Config{Brokers: []string{b.addr()}, Topic: "missing"})
+	defer p.Close()
+
+	if err := p.Produce([]Message{{Value: []byte("1"), Time: time.Now()}}); err != ErrUnknownTopicOrPartition {
+		t.Errorf("expected ErrUnknownTopicOrPartition, got %v", err)
+	}
+}
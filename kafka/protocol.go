@@ -0,0 +1,340 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// API keys and versions of the requests used by the producer
+const (
+	apiKeyProduce  = 0
+	apiKeyMetadata = 3
+
+	produceVersion  = 3
+	metadataVersion = 1
+
+	recordBatchMagic = 2
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+var errMalformedResponse = errors.New("kafka: malformed response")
+
+// Error is an error code returned by a broker.
+type Error int16
+
+// Error codes handled by the producer
+const (
+	ErrUnknownTopicOrPartition Error = 3
+	ErrLeaderNotAvailable      Error = 5
+	ErrNotLeaderForPartition   Error = 6
+)
+
+func (e Error) Error() string {
+	switch e {
+	case ErrUnknownTopicOrPartition:
+		return "kafka: unknown topic or partition"
+	case ErrLeaderNotAvailable:
+		return "kafka: leader not available"
+	case ErrNotLeaderForPartition:
+		return "kafka: not leader for partition"
+	}
+	return fmt.Sprintf("kafka: broker error %d", int16(e))
+}
+
+// retriable reports whether the error is resolved by refreshing metadata.
+func (e Error) retriable() bool {
+	return e == ErrUnknownTopicOrPartition || e == ErrLeaderNotAvailable || e == ErrNotLeaderForPartition
+}
+
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.b = append(e.b, byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(v))
+	e.b = append(e.b, b[:]...)
+}
+
+func (e *encoder) int32(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	e.b = append(e.b, b[:]...)
+}
+
+func (e *encoder) int64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	e.b = append(e.b, b[:]...)
+}
+
+func (e *encoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	e.b = append(e.b, b[:n]...)
+}
+
+func (e *encoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) nullableString(v *string) {
+	if v == nil {
+		e.int16(-1)
+		return
+	}
+	e.string(*v)
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	e.b = append(e.b, v...)
+}
+
+// varbytes encodes bytes with a varint length, as used by records.
+func (e *encoder) varbytes(v []byte) {
+	if v == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(v)))
+	e.b = append(e.b, v...)
+}
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errMalformedResponse
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+// arrayLen returns the length of an array, which is 0 for null arrays.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.b) {
+		d.err = errMalformedResponse
+		return 0
+	}
+	return int(n)
+}
+
+type broker struct {
+	id   int32
+	host string
+	port int32
+}
+
+type partition struct {
+	id     int32
+	leader int32
+	err    Error
+}
+
+type metadata struct {
+	brokers    map[int32]broker
+	partitions []partition
+	err        Error
+}
+
+func encodeMetadataRequest(topic string) []byte {
+	var e encoder
+	e.int32(1)
+	e.string(topic)
+	return e.b
+}
+
+func decodeMetadataResponse(b []byte, topic string) (*metadata, error) {
+	d := &decoder{b: b}
+	m := &metadata{brokers: map[int32]broker{}}
+
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		br := broker{id: d.int32(), host: d.string(), port: d.int32()}
+		d.string() // rack
+		m.brokers[br.id] = br
+	}
+	d.int32() // controller id
+
+	found := false
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		errCode := Error(d.int16())
+		name := d.string()
+		d.int8() // is internal
+
+		var partitions []partition
+		for j, pn := 0, d.arrayLen(); j < pn; j++ {
+			p := partition{err: Error(d.int16()), id: d.int32(), leader: d.int32()}
+			for k, rn := 0, d.arrayLen(); k < rn; k++ {
+				d.int32() // replica
+			}
+			for k, rn := 0, d.arrayLen(); k < rn; k++ {
+				d.int32() // in-sync replica
+			}
+			partitions = append(partitions, p)
+		}
+
+		if name == topic {
+			found = true
+			m.err = errCode
+			m.partitions = partitions
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !found {
+		m.err = ErrUnknownTopicOrPartition
+	}
+	return m, nil
+}
+
+// encodeRecordBatch encodes messages as an uncompressed record batch.
+func encodeRecordBatch(msgs []Message) []byte {
+	first, last := msgs[0].Time, msgs[0].Time
+	for _, msg := range msgs {
+		if msg.Time.Before(first) {
+			first = msg.Time
+		}
+		if msg.Time.After(last) {
+			last = msg.Time
+		}
+	}
+
+	var records encoder
+	for i, msg := range msgs {
+		var r encoder
+		r.int8(0) // attributes
+		r.varint(millis(msg.Time) - millis(first))
+		r.varint(int64(i))
+		r.varbytes(msg.Key)
+		r.varbytes(msg.Value)
+		r.varint(0) // headers
+
+		records.varint(int64(len(r.b)))
+		records.b = append(records.b, r.b...)
+	}
+
+	// The CRC covers the batch from the attributes to the end
+	var body encoder
+	body.int16(0) // attributes
+	body.int32(int32(len(msgs) - 1))
+	body.int64(millis(first))
+	body.int64(millis(last))
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(msgs)))
+	body.b = append(body.b, records.b...)
+
+	var batch encoder
+	batch.int64(0) // base offset
+	batch.int32(int32(4 + 1 + 4 + len(body.b)))
+	batch.int32(-1) // partition leader epoch
+	batch.int8(recordBatchMagic)
+	batch.int32(int32(crc32.Checksum(body.b, crc32c)))
+	batch.b = append(batch.b, body.b...)
+
+	return batch.b
+}
+
+func encodeProduceRequest(topic string, acks int16, timeout time.Duration, batches map[int32][]byte) []byte {
+	var e encoder
+	e.nullableString(nil) // transactional id
+	e.int16(acks)
+	e.int32(int32(timeout.Milliseconds()))
+
+	e.int32(1)
+	e.string(topic)
+	e.int32(int32(len(batches)))
+	for id, batch := range batches {
+		e.int32(id)
+		e.bytes(batch)
+	}
+
+	return e.b
+}
+
+// decodeProduceResponse returns the error of each partition.
+func decodeProduceResponse(b []byte) (map[int32]Error, error) {
+	d := &decoder{b: b}
+	errs := map[int32]Error{}
+
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		d.string() // topic
+		for j, pn := 0, d.arrayLen(); j < pn; j++ {
+			id := d.int32()
+			errs[id] = Error(d.int16())
+			d.int64() // base offset
+			d.int64() // log append time
+		}
+	}
+	d.int32() // throttle time
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return errs, nil
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
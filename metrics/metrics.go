@@ -0,0 +1,361 @@
+// Package metrics implements counters, histograms and gauges exposed in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metric is a metric family which can be written by a Registry.
+type Metric interface {
+	// Name returns the name of the metric family.
+	Name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families and writes them in the text exposition format.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics []Metric
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// MustRegister adds metrics to the registry, panicking on a duplicate name.
+func (r *Registry) MustRegister(metrics ...Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, metric := range metrics {
+		for _, existing := range r.metrics {
+			if existing.Name() == metric.Name() {
+				panic(fmt.Sprintf("metric %q is already registered", metric.Name()))
+			}
+		}
+		r.metrics = append(r.metrics, metric)
+	}
+}
+
+// WriteTo writes all metric families, ordered by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	metrics := make([]Metric, len(r.metrics))
+	copy(metrics, r.metrics)
+	r.mu.RUnlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name() < metrics[j].Name()
+	})
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, metric := range metrics {
+		metric.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP writes the metrics as the response.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// vec holds the series of a metric family, keyed by label values.
+type vec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.RWMutex
+	series map[string][]string
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{name: name, help: help, labels: labels, series: map[string][]string{}}
+}
+
+func (v *vec) Name() string {
+	return v.name
+}
+
+// key returns the key of the series with the given label values, adding it
+// when it doesn't exist yet.
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %q expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	_, ok := v.series[key]
+	v.mu.RUnlock()
+	if !ok {
+		v.mu.Lock()
+		if _, ok := v.series[key]; !ok {
+			v.series[key] = append([]string(nil), values...)
+		}
+		v.mu.Unlock()
+	}
+
+	return key
+}
+
+// sortedKeys returns the series keys ordered by label values.
+func (v *vec) sortedKeys() []string {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec) writeHeader(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, typ)
+}
+
+// labelPairs formats the labels of a series, with an optional extra label.
+func (v *vec) labelPairs(key string, extraName, extraValue string) string {
+	v.mu.RLock()
+	values := v.series[key]
+	v.mu.RUnlock()
+
+	var pairs []string
+	for i, label := range v.labels {
+		pairs = append(pairs, label+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+escapeLabelValue(extraValue)+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a family of counters partitioned by labels.
+type CounterVec struct {
+	vec
+	values sync.Map // map[string]*float64Value
+}
+
+// NewCounterVec returns a counter family with the given label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{vec: newVec(name, help, labels)}
+}
+
+// Inc increments the counter with the given label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta, which must not be negative, to the counter with the given label values.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %q can't decrease", c.name))
+	}
+
+	key := c.key(values)
+	value, _ := c.values.LoadOrStore(key, &float64Value{})
+	value.(*float64Value).add(delta)
+}
+
+// Value returns the value of the counter with the given label values.
+func (c *CounterVec) Value(values ...string) float64 {
+	value, ok := c.values.Load(strings.Join(values, "\xff"))
+	if !ok {
+		return 0
+	}
+	return value.(*float64Value).get()
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w, "counter")
+	for _, key := range c.sortedKeys() {
+		value, ok := c.values.Load(key)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(key, "", ""), formatFloat(value.(*float64Value).get()))
+	}
+}
+
+// HistogramVec is a family of histograms partitioned by labels.
+type HistogramVec struct {
+	vec
+	buckets []float64
+	values  sync.Map // map[string]*histogram
+}
+
+type histogram struct {
+	mu      sync.Mutex
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// NewHistogramVec returns a histogram family with the given upper bounds of
+// buckets and label names. DefBuckets are used when buckets is empty.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &HistogramVec{vec: newVec(name, help, labels), buckets: buckets}
+}
+
+// Observe adds an observation to the histogram with the given label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := h.key(values)
+	value, _ := h.values.LoadOrStore(key, &histogram{buckets: make([]uint64, len(h.buckets))})
+	hist := value.(*histogram)
+
+	hist.mu.Lock()
+	defer hist.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hist.buckets[i]++
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+// Count returns the number of observations of the histogram with the given label values.
+func (h *HistogramVec) Count(values ...string) uint64 {
+	value, ok := h.values.Load(strings.Join(values, "\xff"))
+	if !ok {
+		return 0
+	}
+
+	hist := value.(*histogram)
+	hist.mu.Lock()
+	defer hist.mu.Unlock()
+	return hist.count
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w, "histogram")
+	for _, key := range h.sortedKeys() {
+		value, ok := h.values.Load(key)
+		if !ok {
+			continue
+		}
+
+		hist := value.(*histogram)
+		hist.mu.Lock()
+		buckets := append([]uint64(nil), hist.buckets...)
+		count, sum := hist.count, hist.sum
+		hist.mu.Unlock()
+
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", formatFloat(upper)), buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(key, "", ""), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(key, "", ""), count)
+	}
+}
+
+// GaugeFunc is a gauge whose value is read when the metrics are written.
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewGaugeFunc returns a gauge reporting the value returned by fn.
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, fn: fn}
+}
+
+func (g *GaugeFunc) Name() string {
+	return g.name
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", g.name, escapeHelp(g.help))
+	fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
+
+type float64Value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (f *float64Value) add(delta float64) {
+	f.mu.Lock()
+	f.v += delta
+	f.mu.Unlock()
+}
+
+func (f *float64Value) get() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.v
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelReplacer.Replace(s)
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	requests := NewHistogramVec("test_request_duration_seconds", "Request duration.", []float64{0.5, 0.1}, "api", "status")
+	failures := NewCounterVec("test_failures_total", "Failures.", "api")
+	apis := NewGaugeFunc("test_apis", "Loaded APIs.", func() float64 { return 3 })
+
+	registry := NewRegistry()
+	registry.MustRegister(requests, failures, apis)
+
+	requests.Observe(0.05, "a", "200")
+	requests.Observe(0.2, "a", "200")
+	requests.Observe(1, "b\"\n", "500")
+	failures.Inc("a")
+	failures.Add(2, "a")
+
+	assert.Equal(t, uint64(2), requests.Count("a", "200"))
+	assert.Equal(t, float64(3), failures.Value("a"))
+
+	var buf bytes.Buffer
+	_, err := registry.WriteTo(&buf)
+	assert.NoError(t, err)
+
+	expected := `# HELP test_apis Loaded APIs.
+# TYPE test_apis gauge
+test_apis 3
+# HELP test_failures_total Failures.
+# TYPE test_failures_total counter
+test_failures_total{api="a"} 3
+# HELP test_request_duration_seconds Request duration.
+# TYPE test_request_duration_seconds histogram
+test_request_duration_seconds_bucket{api="a",status="200",le="0.1"} 1
+test_request_duration_seconds_bucket{api="a",status="200",le="0.5"} 2
+test_request_duration_seconds_bucket{api="a",status="200",le="+Inf"} 2
+test_request_duration_seconds_sum{api="a",status="200"} 0.25
+test_request_duration_seconds_count{api="a",status="200"} 2
+test_request_duration_seconds_bucket{api="b\"\n",status="500",le="0.1"} 0
+test_request_duration_seconds_bucket{api="b\"\n",status="500",le="0.5"} 0
+test_request_duration_seconds_bucket{api="b\"\n",status="500",le="+Inf"} 1
+test_request_duration_seconds_sum{api="b\"\n",status="500"} 1
+test_request_duration_seconds_count{api="b\"\n",status="500"} 1
+`
+	assert.Equal(t, expected, buf.String())
+
+	t.Run("Handler", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		assert.Equal(t, ContentType, recorder.Header().Get("Content-Type"))
+		assert.Equal(t, expected, recorder.Body.String())
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		assert.Panics(t, func() {
+			registry.MustRegister(NewCounterVec("test_failures_total", "Failures."))
+		})
+	})
+
+	t.Run("Label values", func(t *testing.T) {
+		assert.Panics(t, func() {
+			failures.Inc("a", "b")
+		})
+	})
+}
@@ -151,6 +151,11 @@ func IsEmergencyMode() bool {
 	return values.GetEmergencyMode()
 }
 
+// IsConnected returns whether the RPC client is connected to MDCB.
+func IsConnected() bool {
+	return values.ClientIsConnected()
+}
+
 func LoadCount() int {
 	return values.GetLoadCounts()
 }
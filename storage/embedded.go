@@ -0,0 +1,1125 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	bolt "go.etcd.io/bbolt"
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// ------------------- EMBEDDED STORAGE -------------------------------
+
+// ErrWrongType is returned when a command of the embedded store is run against a key holding another kind of value
+var ErrWrongType = errors.New("storage: operation against a key holding the wrong kind of value")
+
+// ErrEmbeddedStoreClosed is returned when closing an embedded store which was already closed
+var ErrEmbeddedStoreClosed = errors.New("storage: embedded store closed")
+
+const (
+	embeddedString = "string"
+	embeddedList   = "list"
+	embeddedSet    = "set"
+	embeddedZSet   = "zset"
+	embeddedStream = "stream"
+
+	// defaultEmbeddedPath is the path of the embedded store when none is configured
+	defaultEmbeddedPath = "tyk.db"
+
+	// embeddedSweepInterval is the interval at which the expired keys are deleted,
+	// expired keys being ignored by the reads in the meantime
+	embeddedSweepInterval = time.Minute
+
+	// embeddedSubscriberBuffer is the number of messages a subscriber can lag behind, the next ones being dropped
+	embeddedSubscriberBuffer = 1000
+)
+
+var (
+	embeddedBucket = []byte("tyk")
+	// embeddedMembersBucket holds a bucket of members per list, set, sorted set and stream
+	embeddedMembersBucket = []byte("tyk-members")
+)
+
+// EmbeddedStore is an on-disk key value store, used in place of Redis when the storage type is `embedded`.
+// It implements the Redis commands the gateway relies on, on top of bbolt: strings and counters, lists, sets,
+// sorted sets and streams, all of which can expire, and an in-process pub/sub.
+//
+// Each key is stored as the Unix time in nanoseconds it expires at, zero when it doesn't, followed by its
+// msgpack encoded entry, which keeps binary values such as the analytics records intact. The members of lists,
+// sets, sorted sets and streams are stored in a bucket of their own, so that commands only read and write the
+// members they are about:
+//   - list and stream elements are keyed by their sequence number;
+//   - set members are keys;
+//   - sorted set members are keyed by `m` followed by the member, holding the score, and the scores by `s`
+//     followed by the score and the member, so that they are sorted by score then member.
+type EmbeddedStore struct {
+	db *bolt.DB
+
+	mu          sync.Mutex
+	subscribers map[string][]chan *redis.Message
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type embeddedEntry struct {
+	expires int64
+
+	Kind   string `msgpack:"kind"`
+	String string `msgpack:"string,omitempty"`
+	// Len is the number of members of lists, sets, sorted sets and streams
+	Len int64 `msgpack:"len,omitempty"`
+	// LastID is the ID of the last entry added to a stream
+	LastID string `msgpack:"last_id,omitempty"`
+}
+
+type embeddedStreamEntry struct {
+	ID     string            `msgpack:"id"`
+	Values map[string]string `msgpack:"values"`
+}
+
+// OpenEmbeddedStore opens the embedded store at path, creating it if needed.
+func OpenEmbeddedStore(path string) (*EmbeddedStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(embeddedBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(embeddedMembersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &EmbeddedStore{
+		db:          db,
+		subscribers: make(map[string][]chan *redis.Message),
+		done:        make(chan struct{}),
+	}
+	go s.sweep()
+
+	return s, nil
+}
+
+// Close ends the subscriptions and closes the store.
+func (s *EmbeddedStore) Close() error {
+	err := ErrEmbeddedStoreClosed
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.db.Close()
+	})
+	return err
+}
+
+func (s *EmbeddedStore) sweep() {
+	tick := time.NewTicker(embeddedSweepInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-tick.C:
+			if err := s.deleteExpired(); err != nil {
+				log.WithError(err).Error("Error trying to delete the expired keys of the embedded store")
+			}
+		}
+	}
+}
+
+// deleteExpired deletes the keys which expired.
+func (s *EmbeddedStore) deleteExpired() error {
+	return s.update(func(b *bolt.Bucket, now int64) error {
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; {
+			if expires := entryExpires(v); expires != 0 && expires <= now {
+				key := append([]byte(nil), k...)
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				if err := deleteMembers(b, string(key)); err != nil {
+					return err
+				}
+				// deleting skews the position of the cursor
+				k, v = c.Seek(key)
+				continue
+			}
+			k, v = c.Next()
+		}
+		return nil
+	})
+}
+
+func (s *EmbeddedStore) view(fn func(b *bolt.Bucket, now int64) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(embeddedBucket), time.Now().UnixNano())
+	})
+}
+
+func (s *EmbeddedStore) update(fn func(b *bolt.Bucket, now int64) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(embeddedBucket), time.Now().UnixNano())
+	})
+}
+
+func entryExpires(data []byte) int64 {
+	if len(data) < 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(data))
+}
+
+// loadEntry returns the entry of key, or nil when it doesn't exist or expired.
+func loadEntry(b *bolt.Bucket, key string, now int64) (*embeddedEntry, error) {
+	data := b.Get([]byte(key))
+	if len(data) < 8 {
+		return nil, nil
+	}
+
+	expires := entryExpires(data)
+	if expires != 0 && expires <= now {
+		return nil, nil
+	}
+
+	e := &embeddedEntry{expires: expires}
+	if err := msgpack.Unmarshal(data[8:], e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// loadTyped returns the entry of key, or nil when it doesn't exist, failing if it holds another kind of value.
+func loadTyped(b *bolt.Bucket, key string, now int64, kind string) (*embeddedEntry, error) {
+	e, err := loadEntry(b, key, now)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil && e.Kind != kind {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// loadCollection returns the entry of the list, set, sorted set or stream of key and the bucket of its members,
+// or nils when it doesn't exist, failing if it holds another kind of value. When create is set, a missing
+// collection is created, which needs a writable transaction.
+func loadCollection(b *bolt.Bucket, key string, now int64, kind string, create bool) (*embeddedEntry, *bolt.Bucket, error) {
+	e, err := loadTyped(b, key, now, kind)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all := b.Tx().Bucket(embeddedMembersBucket)
+	if e == nil {
+		if !create {
+			return nil, nil, nil
+		}
+		// the members of a collection which expired may not have been deleted yet
+		if err := deleteMembers(b, key); err != nil {
+			return nil, nil, err
+		}
+		e = &embeddedEntry{Kind: kind}
+	}
+
+	if !b.Tx().Writable() {
+		members := all.Bucket([]byte(key))
+		if members == nil {
+			return nil, nil, nil
+		}
+		return e, members, nil
+	}
+
+	members, err := all.CreateBucketIfNotExists([]byte(key))
+	return e, members, err
+}
+
+// deleteMembers deletes the members of the collection of key, if any.
+func deleteMembers(b *bolt.Bucket, key string) error {
+	err := b.Tx().Bucket(embeddedMembersBucket).DeleteBucket([]byte(key))
+	if err == bolt.ErrBucketNotFound {
+		return nil
+	}
+	return err
+}
+
+// deleteKey deletes key, along with the members of its collection.
+func deleteKey(b *bolt.Bucket, key string) error {
+	if err := b.Delete([]byte(key)); err != nil {
+		return err
+	}
+	return deleteMembers(b, key)
+}
+
+// storeEntry stores the entry of key, deleting it when it is empty, as Redis does.
+func storeEntry(b *bolt.Bucket, key string, e *embeddedEntry) error {
+	if e.empty() {
+		return deleteKey(b, key)
+	}
+
+	data, err := msgpack.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	value := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(value, uint64(e.expires))
+	return b.Put([]byte(key), append(value, data...))
+}
+
+func (e *embeddedEntry) empty() bool {
+	return e.Kind != embeddedString && e.Len <= 0
+}
+
+// expire makes the entry expire after ttl, from now, or never when ttl isn't positive.
+func (e *embeddedEntry) expire(now int64, ttl time.Duration) {
+	e.expires = 0
+	if ttl > 0 {
+		e.expires = now + int64(ttl)
+	}
+}
+
+// Get returns the value of key.
+func (s *EmbeddedStore) Get(key string) (value string, err error) {
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		e, err := loadTyped(b, key, now, embeddedString)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			return ErrKeyNotFound
+		}
+		value = e.String
+		return nil
+	})
+	return value, err
+}
+
+// MGet returns the values of keys, the values of the keys which don't exist or don't hold strings being empty.
+func (s *EmbeddedStore) MGet(keys []string) (values []string, err error) {
+	values = make([]string, len(keys))
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		for i, key := range keys {
+			e, err := loadEntry(b, key, now)
+			if err != nil {
+				return err
+			}
+			if e != nil && e.Kind == embeddedString {
+				values[i] = e.String
+			}
+		}
+		return nil
+	})
+	return values, err
+}
+
+// Set sets the value of key, expiring after ttl, or never when ttl isn't positive.
+func (s *EmbeddedStore) Set(key, value string, ttl time.Duration) error {
+	return s.MSet([]string{key}, []string{value}, []time.Duration{ttl})
+}
+
+// MSet sets the values of keys, expiring after the given ttls.
+func (s *EmbeddedStore) MSet(keys, values []string, ttls []time.Duration) error {
+	return s.update(func(b *bolt.Bucket, now int64) error {
+		for i, key := range keys {
+			// the key may have held a collection
+			if err := deleteMembers(b, key); err != nil {
+				return err
+			}
+			e := &embeddedEntry{Kind: embeddedString, String: values[i]}
+			e.expire(now, ttls[i])
+			if err := storeEntry(b, key, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Del deletes keys, and reports which of them existed.
+func (s *EmbeddedStore) Del(keys ...string) (deleted []bool, err error) {
+	deleted = make([]bool, len(keys))
+	err = s.update(func(b *bolt.Bucket, now int64) error {
+		for i, key := range keys {
+			e, err := loadEntry(b, key, now)
+			if err != nil {
+				return err
+			}
+			deleted[i] = e != nil
+			if err := deleteKey(b, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// Exists reports whether key exists.
+func (s *EmbeddedStore) Exists(key string) (exists bool, err error) {
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		e, err := loadEntry(b, key, now)
+		exists = e != nil
+		return err
+	})
+	return exists, err
+}
+
+// IncrBy increments the integer value of key by delta, from zero when it doesn't exist, keeping its expiry.
+func (s *EmbeddedStore) IncrBy(key string, delta int64) (value int64, err error) {
+	err = s.update(func(b *bolt.Bucket, now int64) error {
+		e, err := loadTyped(b, key, now, embeddedString)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			e = &embeddedEntry{Kind: embeddedString, String: "0"}
+		}
+
+		current, err := strconv.ParseInt(e.String, 10, 64)
+		if err != nil {
+			return errors.New("storage: value is not an integer or out of range")
+		}
+		value = current + delta
+		e.String = strconv.FormatInt(value, 10)
+		return storeEntry(b, key, e)
+	})
+	return value, err
+}
+
+// Expire makes key expire after ttl, deleting it when ttl isn't positive, and reports whether it exists.
+func (s *EmbeddedStore) Expire(key string, ttl time.Duration) (exists bool, err error) {
+	err = s.update(func(b *bolt.Bucket, now int64) error {
+		e, err := loadEntry(b, key, now)
+		if err != nil || e == nil {
+			return err
+		}
+		exists = true
+		if ttl <= 0 {
+			return deleteKey(b, key)
+		}
+		e.expire(now, ttl)
+		return storeEntry(b, key, e)
+	})
+	return exists, err
+}
+
+// TTL returns the time to live of key, rounded to the second. As with go-redis, it is -1ns when key doesn't
+// expire and -2ns when it doesn't exist.
+func (s *EmbeddedStore) TTL(key string) (ttl time.Duration, err error) {
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		e, err := loadEntry(b, key, now)
+		switch {
+		case err != nil:
+			return err
+		case e == nil:
+			ttl = -2
+		case e.expires == 0:
+			ttl = -1
+		default:
+			ttl = time.Duration(e.expires - now).Round(time.Second)
+		}
+		return nil
+	})
+	return ttl, err
+}
+
+// Scan returns the keys matching the glob pattern among up to count keys from cursor, in key order, and the
+// cursor of the next page, which is empty once all keys were examined. The cursor is the last key examined.
+func (s *EmbeddedStore) Scan(pattern, cursor string, count int64) (keys []string, next string, err error) {
+	if count <= 0 {
+		count = 10
+	}
+	prefix := []byte(globPrefix(pattern))
+
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		c := b.Cursor()
+		k, v := c.Seek(prefix)
+		if cursor != "" {
+			if k, v = c.Seek([]byte(cursor)); k != nil && string(k) == cursor {
+				k, v = c.Next()
+			}
+		}
+
+		for examined := int64(0); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if examined == count {
+				next = cursor
+				return nil
+			}
+			examined++
+			cursor = string(k)
+
+			if expires := entryExpires(v); expires != 0 && expires <= now {
+				continue
+			}
+			if matchGlob(pattern, cursor) {
+				keys = append(keys, cursor)
+			}
+		}
+		return nil
+	})
+	return keys, next, err
+}
+
+// Keys returns all the keys matching the glob pattern.
+func (s *EmbeddedStore) Keys(pattern string) (keys []string, err error) {
+	prefix := []byte(globPrefix(pattern))
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if expires := entryExpires(v); expires != 0 && expires <= now {
+				continue
+			}
+			if matchGlob(pattern, string(k)) {
+				keys = append(keys, string(k))
+			}
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// FlushAll deletes all the keys.
+func (s *EmbeddedStore) FlushAll() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{embeddedBucket, embeddedMembersBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RPush appends values to the list of key, and returns its length.
+func (s *EmbeddedStore) RPush(key string, values ...string) (length int64, err error) {
+	err = s.update(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedList, true)
+		if err != nil {
+			return err
+		}
+		if err := appendMembers(members, values...); err != nil {
+			return err
+		}
+		e.Len += int64(len(values))
+		length = e.Len
+		return storeEntry(b, key, e)
+	})
+	return length, err
+}
+
+// appendMembers appends values to the list or stream of members.
+func appendMembers(members *bolt.Bucket, values ...string) error {
+	for _, value := range values {
+		seq, err := members.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := members.Put(sequenceKey(seq), []byte(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// LRange returns the elements of the list of key from start to stop, which are inclusive and count from
+// the end of the list when negative.
+func (s *EmbeddedStore) LRange(key string, start, stop int64) (values []string, err error) {
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedList, false)
+		if err != nil || e == nil {
+			return err
+		}
+		from, to, ok := listRange(e.Len, start, stop)
+		if !ok {
+			return nil
+		}
+
+		c := members.Cursor()
+		i := int64(0)
+		for k, v := c.First(); k != nil && i <= to; k, v = c.Next() {
+			if i >= from {
+				values = append(values, string(v))
+			}
+			i++
+		}
+		return nil
+	})
+	return values, err
+}
+
+// LRem removes all the elements equal to value from the list of key, and returns their number.
+func (s *EmbeddedStore) LRem(key, value string) (removed int64, err error) {
+	err = s.update(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedList, false)
+		if err != nil || e == nil {
+			return err
+		}
+
+		c := members.Cursor()
+		for k, v := c.First(); k != nil; {
+			if string(v) != value {
+				k, v = c.Next()
+				continue
+			}
+			removed++
+			seq := append([]byte(nil), k...)
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			// deleting skews the position of the cursor
+			k, v = c.Seek(seq)
+		}
+		e.Len -= removed
+		return storeEntry(b, key, e)
+	})
+	return removed, err
+}
+
+// LPopAll deletes the list of key and returns its elements.
+func (s *EmbeddedStore) LPopAll(key string) (values []string, err error) {
+	err = s.update(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedList, false)
+		if err != nil || e == nil {
+			return err
+		}
+		values = make([]string, 0, e.Len)
+		err = members.ForEach(func(_, v []byte) error {
+			values = append(values, string(v))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return deleteKey(b, key)
+	})
+	return values, err
+}
+
+// embeddedPresent is the value of the set members, bbolt not telling empty values from missing ones
+var embeddedPresent = []byte{1}
+
+// SAdd adds value to the set of key.
+func (s *EmbeddedStore) SAdd(key, value string) error {
+	return s.update(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedSet, true)
+		if err != nil {
+			return err
+		}
+		if members.Get([]byte(value)) != nil {
+			return nil
+		}
+		if err := members.Put([]byte(value), embeddedPresent); err != nil {
+			return err
+		}
+		e.Len++
+		return storeEntry(b, key, e)
+	})
+}
+
+// SRem removes value from the set of key.
+func (s *EmbeddedStore) SRem(key, value string) error {
+	return s.update(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedSet, false)
+		if err != nil || e == nil || members.Get([]byte(value)) == nil {
+			return err
+		}
+		if err := members.Delete([]byte(value)); err != nil {
+			return err
+		}
+		e.Len--
+		return storeEntry(b, key, e)
+	})
+}
+
+// SMembers returns the members of the set of key, in lexicographical order.
+func (s *EmbeddedStore) SMembers(key string) (members []string, err error) {
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		e, bucket, err := loadCollection(b, key, now, embeddedSet, false)
+		if err != nil || e == nil {
+			return err
+		}
+		return bucket.ForEach(func(k, _ []byte) error {
+			members = append(members, string(k))
+			return nil
+		})
+	})
+	return members, err
+}
+
+// SIsMember reports whether value is a member of the set of key.
+func (s *EmbeddedStore) SIsMember(key, value string) (member bool, err error) {
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedSet, false)
+		if err != nil || e == nil {
+			return err
+		}
+		member = members.Get([]byte(value)) != nil
+		return nil
+	})
+	return member, err
+}
+
+const (
+	// zsetMember prefixes the sorted set members, holding their score
+	zsetMember = 'm'
+	// zsetScore prefixes the sorted set scores, followed by their member
+	zsetScore = 's'
+)
+
+// ZAdd adds member with score to the sorted set of key, or updates its score.
+func (s *EmbeddedStore) ZAdd(key, member string, score float64) error {
+	return s.update(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedZSet, true)
+		if err != nil {
+			return err
+		}
+		added, err := zadd(members, member, score)
+		if err != nil || !added {
+			return err
+		}
+		e.Len++
+		return storeEntry(b, key, e)
+	})
+}
+
+// zadd adds member with score to the sorted set of members, and reports whether it wasn't a member.
+func zadd(members *bolt.Bucket, member string, score float64) (bool, error) {
+	removed, err := zrem(members, member)
+	if err != nil {
+		return false, err
+	}
+	encoded := scoreKey(score)
+	if err := members.Put(zsetKey(zsetMember, nil, member), encoded); err != nil {
+		return false, err
+	}
+	return !removed, members.Put(zsetKey(zsetScore, encoded, member), embeddedPresent)
+}
+
+// zrem removes member from the sorted set of members, and reports whether it was a member.
+func zrem(members *bolt.Bucket, member string) (bool, error) {
+	memberKey := zsetKey(zsetMember, nil, member)
+	score := members.Get(memberKey)
+	if score == nil {
+		return false, nil
+	}
+	// the value isn't valid once the bucket is modified
+	encoded := append([]byte(nil), score...)
+	if err := members.Delete(zsetKey(zsetScore, encoded, member)); err != nil {
+		return false, err
+	}
+	return true, members.Delete(memberKey)
+}
+
+// zrangeByScore calls fn with the members of the sorted set of members with a score between min and max, in
+// order, until it returns false.
+func zrangeByScore(members *bolt.Bucket, min, max scoreBound, fn func(member string, score float64) bool) {
+	c := members.Cursor()
+	for k, _ := c.Seek(zsetKey(zsetScore, scoreKey(min.value), "")); k != nil && k[0] == zsetScore; k, _ = c.Next() {
+		score := keyScore(k[1:9])
+		if !max.above(score) {
+			return
+		}
+		if min.below(score) && !fn(string(k[9:]), score) {
+			return
+		}
+	}
+}
+
+// zremRangeByScore removes the members of the sorted set of members with a score between min and max, and
+// returns their number.
+func zremRangeByScore(members *bolt.Bucket, min, max scoreBound) (int64, error) {
+	var removed []string
+	zrangeByScore(members, min, max, func(member string, _ float64) bool {
+		removed = append(removed, member)
+		return true
+	})
+	for _, member := range removed {
+		if _, err := zrem(members, member); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(removed)), nil
+}
+
+func zsetKey(prefix byte, score []byte, member string) []byte {
+	key := make([]byte, 0, 1+len(score)+len(member))
+	key = append(key, prefix)
+	key = append(key, score...)
+	return append(key, member...)
+}
+
+// scoreKey encodes score so that the encoded scores sort as the scores do.
+func scoreKey(score float64) []byte {
+	bits := math.Float64bits(score)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return sequenceKey(bits)
+}
+
+func keyScore(key []byte) float64 {
+	bits := binary.BigEndian.Uint64(key)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
+// ZRem removes member from the sorted set of key, and reports whether it was a member.
+func (s *EmbeddedStore) ZRem(key, member string) (removed bool, err error) {
+	err = s.update(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedZSet, false)
+		if err != nil || e == nil {
+			return err
+		}
+		if removed, err = zrem(members, member); err != nil || !removed {
+			return err
+		}
+		e.Len--
+		return storeEntry(b, key, e)
+	})
+	return removed, err
+}
+
+// ZRangeByScore returns the members of the sorted set of key with a score between min and max, and their scores.
+// The bounds are numbers, exclusive when prefixed with `(`, or `-inf` and `+inf`.
+func (s *EmbeddedStore) ZRangeByScore(key, min, max string) (members []string, scores []float64, err error) {
+	from, to, err := parseScoreRange(min, max)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		e, bucket, err := loadCollection(b, key, now, embeddedZSet, false)
+		if err != nil || e == nil {
+			return err
+		}
+		zrangeByScore(bucket, from, to, func(member string, score float64) bool {
+			members = append(members, member)
+			scores = append(scores, score)
+			return true
+		})
+		return nil
+	})
+	return members, scores, err
+}
+
+// ZRemRangeByScore removes the members of the sorted set of key with a score between min and max, and returns
+// their number.
+func (s *EmbeddedStore) ZRemRangeByScore(key, min, max string) (removed int64, err error) {
+	from, to, err := parseScoreRange(min, max)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.update(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedZSet, false)
+		if err != nil || e == nil {
+			return err
+		}
+		if removed, err = zremRangeByScore(members, from, to); err != nil {
+			return err
+		}
+		e.Len -= removed
+		return storeEntry(b, key, e)
+	})
+	return removed, err
+}
+
+// ZRangeAfter returns up to count members of the sorted set of key which come after the given one in
+// lexicographical order, or from the start when after is empty. As with ZRANGEBYLEX, the members are expected
+// to all have the same score.
+func (s *EmbeddedStore) ZRangeAfter(key, after string, count int64) (members []string, err error) {
+	err = s.view(func(b *bolt.Bucket, now int64) error {
+		e, bucket, err := loadCollection(b, key, now, embeddedZSet, false)
+		if err != nil || e == nil {
+			return err
+		}
+
+		c := bucket.Cursor()
+		k, _ := c.Seek(zsetKey(zsetMember, nil, after))
+		if k != nil && after != "" && string(k[1:]) == after {
+			k, _ = c.Next()
+		}
+		for ; k != nil && k[0] == zsetMember; k, _ = c.Next() {
+			if count > 0 && int64(len(members)) == count {
+				break
+			}
+			members = append(members, string(k[1:]))
+		}
+		return nil
+	})
+	return members, err
+}
+
+// RollingWindow removes the members of the sorted set of key older than per, and returns the remaining ones.
+// When member isn't empty, it is then added with the current time as score, and the set expires after per.
+func (s *EmbeddedStore) RollingWindow(key string, per time.Duration, member string) (members []string, err error) {
+	err = s.update(func(b *bolt.Bucket, now int64) error {
+		e, bucket, err := loadCollection(b, key, now, embeddedZSet, true)
+		if err != nil {
+			return err
+		}
+
+		removed, err := zremRangeByScore(bucket, scoreBound{value: math.Inf(-1)}, scoreBound{value: float64(now - int64(per))})
+		if err != nil {
+			return err
+		}
+		e.Len -= removed
+		zrangeByScore(bucket, scoreBound{value: math.Inf(-1)}, scoreBound{value: math.Inf(1)}, func(m string, _ float64) bool {
+			members = append(members, m)
+			return true
+		})
+
+		if member != "" {
+			if per <= 0 {
+				return deleteKey(b, key)
+			}
+			added, err := zadd(bucket, member, float64(now))
+			if err != nil {
+				return err
+			}
+			if added {
+				e.Len++
+			}
+			e.expire(now, per)
+		}
+		return storeEntry(b, key, e)
+	})
+	return members, err
+}
+
+// XAdd adds an entry with the given fields to the stream of key, trimming the stream to its last maxLen
+// entries when maxLen is positive.
+func (s *EmbeddedStore) XAdd(key string, values map[string]interface{}, maxLen int64) error {
+	fields := make(map[string]string, len(values))
+	for k, v := range values {
+		fields[k] = fmt.Sprint(v)
+	}
+
+	return s.update(func(b *bolt.Bucket, now int64) error {
+		e, members, err := loadCollection(b, key, now, embeddedStream, true)
+		if err != nil {
+			return err
+		}
+
+		ms, seq := now/int64(time.Millisecond), int64(0)
+		if e.LastID != "" {
+			var lastMs, lastSeq int64
+			fmt.Sscanf(e.LastID, "%d-%d", &lastMs, &lastSeq)
+			if ms <= lastMs {
+				ms, seq = lastMs, lastSeq+1
+			}
+		}
+		e.LastID = fmt.Sprintf("%d-%d", ms, seq)
+
+		data, _ := msgpack.Marshal(embeddedStreamEntry{ID: e.LastID, Values: fields})
+		if err := appendMembers(members, string(data)); err != nil {
+			return err
+		}
+		e.Len++
+
+		c := members.Cursor()
+		for k, _ := c.First(); maxLen > 0 && e.Len > maxLen && k != nil; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			e.Len--
+		}
+		return storeEntry(b, key, e)
+	})
+}
+
+// Publish sends message to the subscribers of channel, and returns their number. Subscribers lagging behind
+// miss the message.
+func (s *EmbeddedStore) Publish(channel, message string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := &redis.Message{Channel: channel, Payload: message}
+	for _, ch := range s.subscribers[channel] {
+		select {
+		case ch <- msg:
+		default:
+			log.WithField("channel", channel).Warning("Embedded store subscriber lagging behind, message dropped")
+		}
+	}
+	return len(s.subscribers[channel])
+}
+
+// Subscribe runs callback with a *redis.Subscription once subscribed to channel, then with a *redis.Message
+// for every message published to it, until ctx is done, or the store is closed which ends it without error.
+func (s *EmbeddedStore) Subscribe(ctx context.Context, channel string, callback func(interface{})) error {
+	ch := make(chan *redis.Message, embeddedSubscriberBuffer)
+
+	s.mu.Lock()
+	s.subscribers[channel] = append(s.subscribers[channel], ch)
+	count := len(s.subscribers[channel])
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		subscribers := s.subscribers[channel]
+		for i, sub := range subscribers {
+			if sub == ch {
+				s.subscribers[channel] = append(subscribers[:i:i], subscribers[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	callback(&redis.Subscription{Kind: "subscribe", Channel: channel, Count: count})
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.done:
+			return nil
+		case msg := <-ch:
+			callback(msg)
+		}
+	}
+}
+
+// scoreBound is a bound of a range of sorted set scores.
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+// below reports whether the bound, as a minimum, is below score.
+func (b scoreBound) below(score float64) bool {
+	return b.value < score || !b.exclusive && b.value == score
+}
+
+// above reports whether the bound, as a maximum, is above score.
+func (b scoreBound) above(score float64) bool {
+	return b.value > score || !b.exclusive && b.value == score
+}
+
+func parseScoreRange(min, max string) (from, to scoreBound, err error) {
+	if from, err = parseScoreBound(min); err != nil {
+		return from, to, err
+	}
+	to, err = parseScoreBound(max)
+	return from, to, err
+}
+
+func parseScoreBound(s string) (scoreBound, error) {
+	var b scoreBound
+	if strings.HasPrefix(s, "(") {
+		b.exclusive = true
+		s = s[1:]
+	}
+
+	switch s {
+	case "-inf":
+		b.value = math.Inf(-1)
+	case "+inf", "inf":
+		b.value = math.Inf(1)
+	default:
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return b, fmt.Errorf("storage: invalid score %q", s)
+		}
+		b.value = value
+	}
+	return b, nil
+}
+
+// listRange returns the positions of a list of length n from start to stop, as LRANGE does.
+func listRange(n, start, stop int64) (int64, int64, bool) {
+	if start < 0 {
+		start += n
+		if start < 0 {
+			start = 0
+		}
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	return start, stop, start <= stop && start < n
+}
+
+// globPrefix returns the literal prefix of a glob pattern.
+func globPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// matchGlob reports whether name matches the glob pattern, which supports `*`, `?` and `\` escapes as Redis
+// does, and treats `[` literally.
+func matchGlob(pattern, name string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchGlob(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if name == "" || name[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return name == ""
+}
+
+func interfaceSlice(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
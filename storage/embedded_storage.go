@@ -0,0 +1,811 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ------------------- EMBEDDED STORAGE MANAGER -------------------------------
+
+// EmbeddedStorage is a storage manager that uses the embedded store, opened by the RedisController in place
+// of Redis when the storage type is `embedded`. Keys are prefixed and hashed as with RedisCluster.
+type EmbeddedStorage struct {
+	KeyPrefix string
+	HashKeys  bool
+	// RedisController must be passed from the gateway
+	RedisController *RedisController
+}
+
+// Connect will establish a connection this is always true because the store is opened by the RedisController
+func (s *EmbeddedStorage) Connect() bool {
+	return true
+}
+
+func (s *EmbeddedStorage) hashKey(in string) string {
+	if !s.HashKeys {
+		return in
+	}
+	return HashStr(in)
+}
+
+func (s *EmbeddedStorage) fixKey(keyName string) string {
+	return s.KeyPrefix + s.hashKey(keyName)
+}
+
+func (s *EmbeddedStorage) cleanKey(keyName string) string {
+	return strings.Replace(keyName, s.KeyPrefix, "", 1)
+}
+
+// store returns the embedded store, or ErrRedisIsDown when it isn't open yet or was disabled
+func (s *EmbeddedStorage) store() (*EmbeddedStore, error) {
+	if !s.RedisController.Connected() {
+		return nil, ErrRedisIsDown
+	}
+	e := s.RedisController.Embedded()
+	if e == nil {
+		return nil, ErrRedisIsDown
+	}
+	return e, nil
+}
+
+// GetKey will retrieve a key from the database
+func (s *EmbeddedStorage) GetKey(keyName string) (string, error) {
+	e, err := s.store()
+	if err != nil {
+		return "", err
+	}
+	value, err := e.Get(s.fixKey(keyName))
+	if err != nil {
+		log.Debug("Error trying to get value:", err)
+		return "", ErrKeyNotFound
+	}
+
+	return value, nil
+}
+
+// GetMultiKey gets multiple keys from the database
+func (s *EmbeddedStorage) GetMultiKey(keys []string) ([]string, error) {
+	e, err := s.store()
+	if err != nil {
+		return nil, err
+	}
+	keyNames := make([]string, len(keys))
+	for i, val := range keys {
+		keyNames[i] = s.fixKey(val)
+	}
+
+	values, err := e.MGet(keyNames)
+	if err != nil {
+		log.WithError(err).Debug("Error trying to get value")
+		return nil, ErrKeyNotFound
+	}
+	for _, val := range values {
+		if val != "" {
+			return values, nil
+		}
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+// GetRawMultiKey gets multiple keys by their full names, the values of the keys not found being empty
+func (s *EmbeddedStorage) GetRawMultiKey(keys []string) ([]string, error) {
+	e, err := s.store()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return e.MGet(keys)
+}
+
+func (s *EmbeddedStorage) GetKeyTTL(keyName string) (ttl int64, err error) {
+	e, err := s.store()
+	if err != nil {
+		return 0, err
+	}
+	duration, err := e.TTL(s.fixKey(keyName))
+	return int64(duration.Seconds()), err
+}
+
+func (s *EmbeddedStorage) GetRawKey(keyName string) (string, error) {
+	e, err := s.store()
+	if err != nil {
+		return "", err
+	}
+	value, err := e.Get(keyName)
+	if err != nil {
+		log.Debug("Error trying to get value:", err)
+		return "", ErrKeyNotFound
+	}
+
+	return value, nil
+}
+
+func (s *EmbeddedStorage) GetExp(keyName string) (int64, error) {
+	e, err := s.store()
+	if err != nil {
+		return 0, err
+	}
+	value, err := e.TTL(s.fixKey(keyName))
+	if err != nil {
+		log.Error("Error trying to get TTL: ", err)
+		return 0, ErrKeyNotFound
+	}
+	// as with go-redis, the ttl of a key which doesn't expire or doesn't exist is measured in nanoseconds
+	if value.Nanoseconds() == -1 || value.Nanoseconds() == -2 {
+		return value.Nanoseconds(), nil
+	}
+
+	return int64(value.Seconds()), nil
+}
+
+func (s *EmbeddedStorage) SetExp(keyName string, timeout int64) error {
+	e, err := s.store()
+	if err != nil {
+		return err
+	}
+	if _, err = e.Expire(s.fixKey(keyName), time.Duration(timeout)*time.Second); err != nil {
+		log.Error("Could not EXPIRE key: ", err)
+	}
+	return err
+}
+
+// SetKey will create (or update) a key value in the store
+func (s *EmbeddedStorage) SetKey(keyName, session string, timeout int64) error {
+	e, err := s.store()
+	if err != nil {
+		return err
+	}
+	if err := e.Set(s.fixKey(keyName), session, time.Duration(timeout)*time.Second); err != nil {
+		log.Error("Error trying to set value: ", err)
+		return err
+	}
+	return nil
+}
+
+func (s *EmbeddedStorage) SetRawKey(keyName, session string, timeout int64) error {
+	e, err := s.store()
+	if err != nil {
+		return err
+	}
+	if err := e.Set(keyName, session, time.Duration(timeout)*time.Second); err != nil {
+		log.Error("Error trying to set value: ", err)
+		return err
+	}
+	return nil
+}
+
+// Decrement will decrement a key in the store
+func (s *EmbeddedStorage) Decrement(keyName string) {
+	keyName = s.fixKey(keyName)
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	if _, err := e.IncrBy(keyName, -1); err != nil {
+		log.Error("Error trying to decrement value:", err)
+	}
+}
+
+// IncrementWithExpire will increment a key in the store
+func (s *EmbeddedStorage) IncrememntWithExpire(keyName string, expire int64) int64 {
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return 0
+	}
+	// This function uses a raw key, so we shouldn't call fixKey
+	val, err := e.IncrBy(keyName, 1)
+	if err != nil {
+		log.Error("Error trying to increment value:", err)
+	} else if val == 1 && expire > 0 {
+		log.Debug("--> Setting Expire")
+		e.Expire(keyName, time.Duration(expire)*time.Second)
+	}
+
+	return val
+}
+
+// IncrementByWithExpire adds by to a raw key, setting its expiry to expire seconds when the key is created.
+func (s *EmbeddedStorage) IncrementByWithExpire(keyName string, by, expire int64) (int64, error) {
+	e, err := s.store()
+	if err != nil {
+		return 0, err
+	}
+	val, err := e.IncrBy(keyName, by)
+	if err == nil && val == by && expire > 0 {
+		_, err = e.Expire(keyName, time.Duration(expire)*time.Second)
+	}
+	return val, err
+}
+
+func (s *EmbeddedStorage) searchStr(filter string) string {
+	filterHash := ""
+	if filter != "" {
+		filterHash = s.hashKey(filter)
+	}
+	return s.KeyPrefix + filterHash + "*"
+}
+
+// GetKeys will return all keys according to the filter (filter is a prefix - e.g. tyk.keys.*)
+func (s *EmbeddedStorage) GetKeys(filter string) []string {
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return nil
+	}
+	searchStr := s.searchStr(filter)
+	log.Debug("[STORE] Getting list by: ", searchStr)
+
+	keys, err := e.Keys(searchStr)
+	if err != nil {
+		log.Error("Error while fetching keys:", err)
+		return nil
+	}
+
+	sessions := make([]string, len(keys))
+	for i, v := range keys {
+		sessions[i] = s.cleanKey(v)
+	}
+
+	return sessions
+}
+
+// ScanKeys returns a page of the keys matching the filter (a prefix, as in GetKeys), starting at cursor,
+// and the cursor of the next page, which is empty once all keys were returned. count is a hint of the number
+// of keys to examine, so a page can hold more or fewer keys, or none at all.
+func (s *EmbeddedStorage) ScanKeys(filter, cursor string, count int64) ([]string, string, error) {
+	e, err := s.store()
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys, next, err := e.Scan(s.searchStr(filter), cursor, count)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i, v := range keys {
+		keys[i] = s.cleanKey(v)
+	}
+
+	return keys, next, nil
+}
+
+// GetKeysAndValuesWithFilter will return all keys and their values with a filter
+func (s *EmbeddedStorage) GetKeysAndValuesWithFilter(filter string) map[string]string {
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return nil
+	}
+	keys := s.GetKeys(filter)
+	if keys == nil {
+		log.Error("Error trying to get filtered client keys")
+		return nil
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	for i, v := range keys {
+		keys[i] = s.KeyPrefix + v
+	}
+
+	values, err := e.MGet(keys)
+	if err != nil {
+		log.Error("Error trying to get client keys: ", err)
+		return nil
+	}
+
+	m := make(map[string]string)
+	for i, v := range keys {
+		m[s.cleanKey(v)] = values[i]
+	}
+
+	return m
+}
+
+// GetKeysAndValues will return all keys and their values - not to be used lightly
+func (s *EmbeddedStorage) GetKeysAndValues() map[string]string {
+	return s.GetKeysAndValuesWithFilter("")
+}
+
+// DeleteKey will remove a key from the database
+func (s *EmbeddedStorage) DeleteKey(keyName string) bool {
+	log.Debug("DEL Key was: ", keyName)
+	log.Debug("DEL Key became: ", s.fixKey(keyName))
+	return s.DeleteRawKey(s.fixKey(keyName))
+}
+
+// DeleteAllKeys will remove all keys from the database.
+func (s *EmbeddedStorage) DeleteAllKeys() bool {
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return false
+	}
+	if err := e.FlushAll(); err != nil {
+		log.WithError(err).Error("Error trying to delete keys")
+		return false
+	}
+	return true
+}
+
+// DeleteRawKey will remove a key from the database without prefixing, assumes user knows what they are doing
+func (s *EmbeddedStorage) DeleteRawKey(keyName string) bool {
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return false
+	}
+	deleted, err := e.Del(keyName)
+	if err != nil {
+		log.WithError(err).Error("Error trying to delete key")
+		return false
+	}
+	return deleted[0]
+}
+
+// DeleteScanMatch will remove a group of keys in bulk
+func (s *EmbeddedStorage) DeleteScanMatch(pattern string) bool {
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return false
+	}
+	log.Debug("Deleting: ", pattern)
+
+	keys, err := e.Keys(pattern)
+	if err == nil {
+		_, err = e.Del(keys...)
+	}
+	if err != nil {
+		log.Error("Error trying to delete keys: ", err)
+		return false
+	}
+	log.Info("Deleted: ", len(keys), " records")
+
+	return true
+}
+
+// DeleteKeys will remove a group of keys in bulk
+func (s *EmbeddedStorage) DeleteKeys(keys []string) bool {
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return false
+	}
+	if len(keys) == 0 {
+		log.Debug("EmbeddedStorage called DEL - Nothing to delete")
+		return true
+	}
+
+	fixedKeys := make([]string, len(keys))
+	for i, v := range keys {
+		fixedKeys[i] = s.fixKey(v)
+	}
+	log.Debug("Deleting: ", fixedKeys)
+	if _, err := e.Del(fixedKeys...); err != nil {
+		log.Error("Error trying to delete keys: ", err)
+	}
+
+	return true
+}
+
+// SetRawKeys sets many keys by their full names in one transaction, expiring
+// after the given number of seconds, and returns the error of each key
+func (s *EmbeddedStorage) SetRawKeys(keys, values []string, timeouts []int64) ([]error, error) {
+	e, err := s.store()
+	if err != nil {
+		return nil, err
+	}
+
+	ttls := make([]time.Duration, len(timeouts))
+	for i, timeout := range timeouts {
+		ttls[i] = time.Duration(timeout) * time.Second
+	}
+	errs := make([]error, len(keys))
+	if err := e.MSet(keys, values, ttls); err != nil {
+		log.WithError(err).Error("Error trying to set values")
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return errs, nil
+}
+
+// DeleteRawKeys deletes many keys by their full names in one transaction, and
+// reports which of them existed
+func (s *EmbeddedStorage) DeleteRawKeys(keys []string) ([]bool, error) {
+	e, err := s.store()
+	if err != nil {
+		return nil, err
+	}
+	return e.Del(keys...)
+}
+
+// StartPubSubHandler will listen for a signal and run the callback for
+// every subscription and message event.
+func (s *EmbeddedStorage) StartPubSubHandler(channel string, callback func(interface{})) error {
+	e, err := s.store()
+	if err != nil {
+		return err
+	}
+	return e.Subscribe(s.RedisController.ctx, channel, callback)
+}
+
+func (s *EmbeddedStorage) Publish(channel, message string) error {
+	e, err := s.store()
+	if err != nil {
+		return err
+	}
+	e.Publish(channel, message)
+	return nil
+}
+
+func (s *EmbeddedStorage) GetAndDeleteSet(keyName string) []interface{} {
+	log.Debug("Getting raw key set: ", keyName)
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return nil
+	}
+	fixedKey := s.fixKey(keyName)
+	log.Debug("Fixed keyname is: ", fixedKey)
+
+	vals, err := e.LPopAll(fixedKey)
+	if err != nil {
+		log.Error("Multi command failed: ", err)
+		return nil
+	}
+
+	log.Debug("Analytics returned: ", len(vals))
+	if len(vals) == 0 {
+		return nil
+	}
+
+	return interfaceSlice(vals)
+}
+
+func (s *EmbeddedStorage) AppendToSet(keyName, value string) {
+	fixedKey := s.fixKey(keyName)
+	log.WithField("keyName", keyName).Debug("Pushing to raw key list")
+	log.WithField("fixedKey", fixedKey).Debug("Appending to fixed key list")
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	if _, err := e.RPush(fixedKey, value); err != nil {
+		log.WithError(err).Error("Error trying to append to set keys")
+	}
+}
+
+//Exists check if keyName exists
+func (s *EmbeddedStorage) Exists(keyName string) (bool, error) {
+	fixedKey := s.fixKey(keyName)
+	log.WithField("keyName", fixedKey).Debug("Checking if exists")
+
+	e, err := s.store()
+	if err != nil {
+		return false, err
+	}
+	exists, err := e.Exists(fixedKey)
+	if err != nil {
+		log.Error("Error trying to check if key exists: ", err)
+		return false, err
+	}
+	return exists, nil
+}
+
+// RemoveFromList delete an value from a list idetinfied with the keyName
+func (s *EmbeddedStorage) RemoveFromList(keyName, value string) error {
+	fixedKey := s.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+		"value":    value,
+	}
+	log.WithFields(logEntry).Debug("Removing value from list")
+
+	e, err := s.store()
+	if err != nil {
+		return err
+	}
+	if _, err := e.LRem(fixedKey, value); err != nil {
+		log.WithFields(logEntry).WithError(err).Error("LREM command failed")
+		return err
+	}
+
+	return nil
+}
+
+// GetListRange gets range of elements of list identified by keyName
+func (s *EmbeddedStorage) GetListRange(keyName string, from, to int64) ([]string, error) {
+	fixedKey := s.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+		"from":     from,
+		"to":       to,
+	}
+	log.WithFields(logEntry).Debug("Getting list range")
+
+	e, err := s.store()
+	if err != nil {
+		return nil, err
+	}
+	elements, err := e.LRange(fixedKey, from, to)
+	if err != nil {
+		log.WithFields(logEntry).WithError(err).Error("LRANGE command failed")
+		return nil, err
+	}
+
+	return elements, nil
+}
+
+func (s *EmbeddedStorage) AppendToSetPipelined(key string, values [][]byte) {
+	if len(values) == 0 {
+		return
+	}
+
+	fixedKey := s.fixKey(key)
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	elements := make([]string, len(values))
+	for i, val := range values {
+		elements[i] = string(val)
+	}
+	if _, err := e.RPush(fixedKey, elements...); err != nil {
+		log.WithError(err).Error("Error trying to append to set keys")
+	}
+}
+
+func (s *EmbeddedStorage) GetSet(keyName string) (map[string]string, error) {
+	log.Debug("Getting from key set: ", keyName)
+	log.Debug("Getting from fixed key set: ", s.fixKey(keyName))
+	e, err := s.store()
+	if err != nil {
+		return nil, err
+	}
+	val, err := e.SMembers(s.fixKey(keyName))
+	if err != nil {
+		log.Error("Error trying to get key set:", err)
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	for i, value := range val {
+		result[strconv.Itoa(i)] = value
+	}
+
+	return result, nil
+}
+
+func (s *EmbeddedStorage) AddToSet(keyName, value string) {
+	log.Debug("Pushing to raw key set: ", keyName)
+	log.Debug("Pushing to fixed key set: ", s.fixKey(keyName))
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	if err := e.SAdd(s.fixKey(keyName), value); err != nil {
+		log.Error("Error trying to append keys: ", err)
+	}
+}
+
+func (s *EmbeddedStorage) RemoveFromSet(keyName, value string) {
+	log.Debug("Removing from raw key set: ", keyName)
+	log.Debug("Removing from fixed key set: ", s.fixKey(keyName))
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	if err := e.SRem(s.fixKey(keyName), value); err != nil {
+		log.Error("Error trying to remove keys: ", err)
+	}
+}
+
+func (s *EmbeddedStorage) IsMemberOfSet(keyName, value string) bool {
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return false
+	}
+	val, err := e.SIsMember(s.fixKey(keyName), value)
+	if err != nil {
+		log.Error("Error trying to check set memeber: ", err)
+		return false
+	}
+
+	log.Debug("SISMEMBER", keyName, value, val, err)
+
+	return val
+}
+
+// SetRollingWindow will append to a sorted set and extract a timed window of values
+func (s *EmbeddedStorage) SetRollingWindow(keyName string, per int64, value_override string, pipeline bool) (int, []interface{}) {
+	log.Debug("Incrementing raw key: ", keyName)
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return 0, nil
+	}
+
+	member := value_override
+	if member == "-1" {
+		member = strconv.Itoa(int(time.Now().UnixNano()))
+	}
+	values, err := e.RollingWindow(keyName, time.Duration(per)*time.Second, member)
+	if err != nil {
+		log.Error("Multi command failed: ", err)
+		return 0, nil
+	}
+
+	log.Debug("Returned: ", len(values))
+
+	return len(values), interfaceSlice(values)
+}
+
+func (s *EmbeddedStorage) GetRollingWindow(keyName string, per int64, pipeline bool) (int, []interface{}) {
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return 0, nil
+	}
+
+	values, err := e.RollingWindow(keyName, time.Duration(per)*time.Second, "")
+	if err != nil {
+		log.Error("Multi command failed: ", err)
+		return 0, nil
+	}
+
+	log.Debug("Returned: ", len(values))
+
+	return len(values), interfaceSlice(values)
+}
+
+// GetPrefix returns storage key prefix
+func (s *EmbeddedStorage) GetKeyPrefix() string {
+	return s.KeyPrefix
+}
+
+// AddToSortedSet adds value with given score to sorted set identified by keyName
+func (s *EmbeddedStorage) AddToSortedSet(keyName, value string, score float64) {
+	fixedKey := s.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+	}
+	log.WithFields(logEntry).Debug("Pushing raw key to sorted set")
+
+	e, err := s.store()
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	if err := e.ZAdd(fixedKey, value, score); err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZADD command failed")
+	}
+}
+
+// GetSortedSetRange gets range of elements of sorted set identified by keyName
+func (s *EmbeddedStorage) GetSortedSetRange(keyName, scoreFrom, scoreTo string) ([]string, []float64, error) {
+	fixedKey := s.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":   keyName,
+		"fixedKey":  fixedKey,
+		"scoreFrom": scoreFrom,
+		"scoreTo":   scoreTo,
+	}
+	log.WithFields(logEntry).Debug("Getting sorted set range")
+
+	e, err := s.store()
+	if err != nil {
+		return nil, nil, err
+	}
+	elements, scores, err := e.ZRangeByScore(fixedKey, scoreFrom, scoreTo)
+	if err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZRANGEBYSCORE command failed")
+		return nil, nil, err
+	}
+
+	return elements, scores, nil
+}
+
+// RemoveSortedSetRange removes range of elements from sorted set identified by keyName
+func (s *EmbeddedStorage) RemoveSortedSetRange(keyName, scoreFrom, scoreTo string) error {
+	fixedKey := s.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":   keyName,
+		"fixedKey":  fixedKey,
+		"scoreFrom": scoreFrom,
+		"scoreTo":   scoreTo,
+	}
+	log.WithFields(logEntry).Debug("Removing sorted set range")
+
+	e, err := s.store()
+	if err != nil {
+		return err
+	}
+	if _, err := e.ZRemRangeByScore(fixedKey, scoreFrom, scoreTo); err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZREMRANGEBYSCORE command failed")
+		return err
+	}
+
+	return nil
+}
+
+// RemoveFromSortedSet removes value from the sorted set identified by keyName
+func (s *EmbeddedStorage) RemoveFromSortedSet(keyName, value string) error {
+	fixedKey := s.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+	}
+	log.WithFields(logEntry).Debug("Removing value from sorted set")
+
+	e, err := s.store()
+	if err != nil {
+		return err
+	}
+	if _, err := e.ZRem(fixedKey, value); err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZREM command failed")
+		return err
+	}
+
+	return nil
+}
+
+// GetSortedSetRangeByLex gets up to count elements of the sorted set identified by keyName, in lexicographical
+// order from the first element after the given one, or from the start when after is empty. The elements of
+// the set are expected to all have the same score.
+func (s *EmbeddedStorage) GetSortedSetRangeByLex(keyName, after string, count int64) ([]string, error) {
+	fixedKey := s.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+		"after":    after,
+	}
+	log.WithFields(logEntry).Debug("Getting sorted set range by lex")
+
+	e, err := s.store()
+	if err != nil {
+		return nil, err
+	}
+	elements, err := e.ZRangeAfter(fixedKey, after, count)
+	if err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZRANGEBYLEX command failed")
+		return nil, err
+	}
+
+	return elements, nil
+}
+
+// AddToStream adds an entry with the given fields to the stream identified by keyName,
+// trimming the stream to about maxLen entries when maxLen is positive
+func (s *EmbeddedStorage) AddToStream(keyName string, values map[string]interface{}, maxLen int64) error {
+	e, err := s.store()
+	if err != nil {
+		return err
+	}
+	if err := e.XAdd(s.fixKey(keyName), values, maxLen); err != nil {
+		log.WithField("keyName", keyName).WithError(err).Error("XADD command failed")
+		return err
+	}
+
+	return nil
+}
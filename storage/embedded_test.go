@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func openTestEmbeddedStore(t *testing.T) *EmbeddedStore {
+	s, err := OpenEmbeddedStore(filepath.Join(t.TempDir(), "tyk.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestEmbeddedStoreStrings(t *testing.T) {
+	s := openTestEmbeddedStore(t)
+
+	_, err := s.Get("a")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	require.NoError(t, s.Set("a", "1", 0))
+	require.NoError(t, s.Set("b", "2", time.Hour))
+	value, err := s.Get("a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	values, err := s.MGet([]string{"a", "missing", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "", "2"}, values)
+
+	ttl, _ := s.TTL("a")
+	assert.Equal(t, time.Duration(-1), ttl, "no expiry")
+	ttl, _ = s.TTL("b")
+	assert.Equal(t, time.Hour, ttl)
+	ttl, _ = s.TTL("missing")
+	assert.Equal(t, time.Duration(-2), ttl, "missing")
+
+	n, err := s.IncrBy("b", 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+	ttl, _ = s.TTL("b")
+	assert.Equal(t, time.Hour, ttl, "increments keep the expiry")
+
+	require.NoError(t, s.Set("c", "x", time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	exists, _ := s.Exists("c")
+	assert.False(t, exists, "expired")
+	require.NoError(t, s.deleteExpired())
+
+	keys, err := s.Keys("*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	deleted, err := s.Del("a", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, deleted)
+
+	_, err = s.RPush("b", "x")
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestEmbeddedStoreScan(t *testing.T) {
+	s := openTestEmbeddedStore(t)
+	for _, key := range []string{"apikey-1", "apikey-2", "apikey-3", "other-1"} {
+		require.NoError(t, s.Set(key, "v", 0))
+	}
+
+	var all []string
+	cursor := ""
+	for {
+		keys, next, err := s.Scan("apikey-*", cursor, 2)
+		require.NoError(t, err)
+		all = append(all, keys...)
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"apikey-1", "apikey-2", "apikey-3"}, all)
+
+	assert.True(t, matchGlob("a*c?e", "abbbcde"))
+	assert.False(t, matchGlob("a*c?e", "abbbce"))
+	assert.True(t, matchGlob(`a\*`, "a*"))
+	assert.False(t, matchGlob(`a\*`, "ab"))
+}
+
+func TestEmbeddedStoreCollections(t *testing.T) {
+	s := openTestEmbeddedStore(t)
+
+	_, err := s.RPush("list", "a", "b", "a", "c")
+	require.NoError(t, err)
+	values, _ := s.LRange("list", 1, -1)
+	assert.Equal(t, []string{"b", "a", "c"}, values)
+	removed, _ := s.LRem("list", "a")
+	assert.Equal(t, int64(2), removed)
+	values, _ = s.LPopAll("list")
+	assert.Equal(t, []string{"b", "c"}, values)
+	exists, _ := s.Exists("list")
+	assert.False(t, exists)
+
+	require.NoError(t, s.SAdd("set", "b"))
+	require.NoError(t, s.SAdd("set", "a"))
+	require.NoError(t, s.SAdd("set", "a"))
+	members, _ := s.SMembers("set")
+	assert.Equal(t, []string{"a", "b"}, members)
+	require.NoError(t, s.SRem("set", "a"))
+	isMember, _ := s.SIsMember("set", "a")
+	assert.False(t, isMember)
+
+	require.NoError(t, s.ZAdd("zset", "c", 3))
+	require.NoError(t, s.ZAdd("zset", "a", 1))
+	require.NoError(t, s.ZAdd("zset", "b", 2))
+	require.NoError(t, s.ZAdd("zset", "a", 4))
+	members, scores, err := s.ZRangeByScore("zset", "(2", "+inf")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "a"}, members)
+	assert.Equal(t, []float64{3, 4}, scores)
+	require.NoError(t, s.ZAdd("zset", "d", -1.5))
+	members, scores, _ = s.ZRangeByScore("zset", "-inf", "2")
+	assert.Equal(t, []string{"d", "b"}, members)
+	assert.Equal(t, []float64{-1.5, 2}, scores)
+	n, _ := s.ZRemRangeByScore("zset", "-inf", "3")
+	assert.Equal(t, int64(3), n)
+
+	for _, member := range []string{"k1", "k2", "k3"} {
+		require.NoError(t, s.ZAdd("lex", member, 0))
+	}
+	members, _ = s.ZRangeAfter("lex", "k1", 1)
+	assert.Equal(t, []string{"k2"}, members)
+
+	require.NoError(t, s.XAdd("stream", map[string]interface{}{"a": 1}, 2))
+	require.NoError(t, s.XAdd("stream", map[string]interface{}{"a": 2}, 2))
+	require.NoError(t, s.XAdd("stream", map[string]interface{}{"a": 3}, 2))
+	_, err = s.LRange("stream", 0, -1)
+	assert.Equal(t, ErrWrongType, err, "streams aren't lists")
+	s.view(func(b *bolt.Bucket, now int64) error {
+		e, members, _ := loadCollection(b, "stream", now, embeddedStream, false)
+		assert.Equal(t, int64(2), e.Len, "trimmed")
+		assert.Equal(t, 2, members.Stats().KeyN)
+		return nil
+	})
+
+	// the members of a collection go with it
+	_, err = s.RPush("expiring", "a", "b")
+	require.NoError(t, err)
+	_, err = s.Expire("expiring", time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = s.RPush("expiring", "c")
+	require.NoError(t, err)
+	values, _ = s.LRange("expiring", 0, -1)
+	assert.Equal(t, []string{"c"}, values)
+
+	require.NoError(t, s.Set("expiring", "v", 0))
+	_, err = s.Del("zset", "lex", "stream")
+	require.NoError(t, err)
+	s.view(func(b *bolt.Bucket, now int64) error {
+		assert.Equal(t, 1, b.Tx().Bucket(embeddedMembersBucket).Stats().BucketN-1, "only the members of set are left")
+		return nil
+	})
+}
+
+func TestEmbeddedStoreRollingWindow(t *testing.T) {
+	s := openTestEmbeddedStore(t)
+
+	for i, member := range []string{"1", "2", "3"} {
+		members, err := s.RollingWindow("window", time.Minute, member)
+		require.NoError(t, err)
+		assert.Len(t, members, i)
+	}
+	members, _ := s.RollingWindow("window", time.Minute, "")
+	assert.Len(t, members, 3)
+	ttl, _ := s.TTL("window")
+	assert.Equal(t, time.Minute, ttl)
+
+	members, _ = s.RollingWindow("window", time.Nanosecond, "")
+	assert.Empty(t, members, "out of the window")
+}
+
+func TestEmbeddedStorage(t *testing.T) {
+	conf := config.Default
+	conf.Storage.Type = "embedded"
+	conf.Storage.Path = filepath.Join(t.TempDir(), "tyk.db")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	controller := NewRedisController()
+	go controller.ConnectToRedis(ctx, nil, &conf)
+	require.True(t, controller.WaitConnect(ctx))
+
+	r := NewStore(conf.Storage.Type, controller, StoreOptions{KeyPrefix: "apikey-", HashKeys: true})
+	require.IsType(t, &EmbeddedStorage{}, r)
+	require.NoError(t, r.SetKey("k1", "session", 60))
+	value, err := r.GetKey("k1")
+	require.NoError(t, err)
+	assert.Equal(t, "session", value)
+	exp, _ := r.GetExp("k1")
+	assert.Equal(t, int64(60), exp)
+	assert.Equal(t, map[string]string{HashStr("k1"): "session"}, r.GetKeysAndValues())
+	assert.Equal(t, []string{HashStr("k1")}, r.GetKeys(""))
+	keys, next, err := r.ScanKeys("", "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{HashStr("k1")}, keys)
+	assert.Empty(t, next)
+	values, err := r.GetMultiKey([]string{"k1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"session"}, values)
+	assert.True(t, r.DeleteKey("k1"))
+	assert.False(t, r.DeleteKey("k1"))
+
+	assert.Equal(t, int64(1), r.IncrememntWithExpire("quota", 60))
+	assert.Equal(t, int64(2), r.IncrememntWithExpire("quota", 60))
+
+	count, _ := r.SetRollingWindow("rate", 60, "-1", false)
+	assert.Equal(t, 0, count)
+	count, _ = r.GetRollingWindow("rate", 60, false)
+	assert.Equal(t, 1, count)
+
+	analytics := NewStore(conf.Storage.Type, controller, StoreOptions{KeyPrefix: "analytics-", IsAnalytics: true})
+	analytics.AppendToSetPipelined("records", [][]byte{[]byte("a"), {0xff, 0}})
+	assert.Equal(t, []interface{}{"a", "\xff\x00"}, analytics.GetAndDeleteSet("records"), "binary values are kept")
+	assert.Nil(t, analytics.GetAndDeleteSet("records"))
+
+	received := make(chan interface{}, 2)
+	go r.StartPubSubHandler("channel", func(v interface{}) { received <- v })
+	assert.IsType(t, &redis.Subscription{}, <-received)
+	require.NoError(t, r.Publish("channel", "hello"))
+	msg := (<-received).(*redis.Message)
+	assert.Equal(t, "hello", msg.Payload)
+
+	controller.DisableRedis(true)
+	_, err = r.GetKey("k1")
+	assert.Equal(t, ErrRedisIsDown, err)
+}
@@ -0,0 +1,39 @@
+package kv
+
+import (
+	"os"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables read by Env
+// when none is configured.
+const DefaultEnvPrefix = "TYK_SECRET_"
+
+// Env is an implementation of a KV store which reads values from prefixed
+// environment variables.
+type Env struct {
+	prefix string
+}
+
+// NewEnv returns a configured environment KV store adapter
+func NewEnv(conf config.EnvKVConfig) (Store, error) {
+	prefix := conf.Prefix
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+
+	return &Env{prefix: prefix}, nil
+}
+
+// Get looks up the upper cased key, e.g. with the default prefix the key
+// "db_password" is read from TYK_SECRET_DB_PASSWORD.
+func (e *Env) Get(key string) (string, error) {
+	val, ok := os.LookupEnv(e.prefix + strings.ToUpper(key))
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+
+	return val, nil
+}
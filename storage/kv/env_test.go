@@ -0,0 +1,31 @@
+package kv
+
+import (
+	"os"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+var _ Store = (*Env)(nil)
+
+func TestEnv_Get(t *testing.T) {
+	os.Setenv("TYK_SECRET_API_TOKEN", "token")
+	os.Setenv("CUSTOM_API_TOKEN", "custom")
+	defer os.Unsetenv("TYK_SECRET_API_TOKEN")
+	defer os.Unsetenv("CUSTOM_API_TOKEN")
+
+	store, _ := NewEnv(config.EnvKVConfig{})
+	if val, err := store.Get("api_token"); err != nil || val != "token" {
+		t.Fatalf("Expected token, got %q, %v", val, err)
+	}
+
+	if _, err := store.Get("missing"); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	store, _ = NewEnv(config.EnvKVConfig{Prefix: "CUSTOM_"})
+	if val, err := store.Get("api_token"); err != nil || val != "custom" {
+		t.Fatalf("Expected custom, got %q, %v", val, err)
+	}
+}
@@ -0,0 +1,45 @@
+package kv
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// File is an implementation of a KV store which reads values from files,
+// e.g. Kubernetes secrets mounted as a volume. Every key is a file name.
+type File struct {
+	baseDir string
+}
+
+// NewFile returns a configured file KV store adapter
+func NewFile(conf config.FileKVConfig) (Store, error) {
+	return &File{baseDir: conf.BaseDir}, nil
+}
+
+// Get returns the content of the file, without trailing newlines. Keys are
+// resolved against the configured base directory and may not escape it.
+func (f *File) Get(key string) (string, error) {
+	if f.baseDir == "" {
+		return "", errors.New("the base directory of the file store is not configured")
+	}
+
+	path := filepath.Clean(key)
+	if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", errors.New("key should be a path relative to the base directory")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(f.baseDir, path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrKeyNotFound
+		}
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
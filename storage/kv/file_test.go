@@ -0,0 +1,54 @@
+package kv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+var _ Store = (*File)(nil)
+
+func TestFile_Get(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "password"), []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFile(config.FileKVConfig{BaseDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := store.Get("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "s3cret" {
+		t.Fatalf("Expected s3cret, got %q", val)
+	}
+
+	if _, err := store.Get(filepath.Join(dir, "password")); err == nil || err == ErrKeyNotFound {
+		t.Fatalf("Expected absolute paths to be rejected, got %v", err)
+	}
+
+	if _, err := store.Get("missing"); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	if _, err := store.Get("../password"); err == nil || err == ErrKeyNotFound {
+		t.Fatalf("Expected keys outside of the base directory to be rejected, got %v", err)
+	}
+
+	store, _ = NewFile(config.FileKVConfig{})
+	if _, err := store.Get("password"); err == nil || err == ErrKeyNotFound {
+		t.Fatalf("Expected keys to be rejected without a base directory, got %v", err)
+	}
+}
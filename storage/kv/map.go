@@ -0,0 +1,14 @@
+package kv
+
+// Map is an implementation of a KV store backed by a static map, such as the
+// "secrets" section of the gateway configuration.
+type Map map[string]string
+
+func (m Map) Get(key string) (string, error) {
+	val, ok := m[key]
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+
+	return val, nil
+}
@@ -5,8 +5,10 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -27,6 +29,9 @@ const (
 // ErrRedisIsDown is returned when we can't communicate with redis
 var ErrRedisIsDown = errors.New("storage: Redis is either down or was not configured")
 
+// ErrInvalidCursor is returned when a scan is resumed from a cursor which isn't one
+var ErrInvalidCursor = errors.New("storage: invalid cursor")
+
 // RedisCluster is a storage manager that uses the redis database.
 type RedisCluster struct {
 	KeyPrefix   string
@@ -35,6 +40,9 @@ type RedisCluster struct {
 	IsAnalytics bool
 	// RedisController must be passed from the gateway
 	RedisController *RedisController
+
+	// ctx overrides the context of the Redis calls, see WithContext
+	ctx context.Context
 }
 
 func NewRedisClusterPool(isCache, isAnalytics bool, conf config.Config) redis.UniversalClient {
@@ -93,6 +101,7 @@ func NewRedisClusterPool(isCache, isAnalytics bool, conf config.Config) redis.Un
 		log.Info("--> [REDIS] Creating single-node client")
 		client = redis.NewClient(opts.Simple())
 	}
+	client.AddHook(tracingHook{})
 
 	return client
 }
@@ -119,10 +128,10 @@ func clusterConnectionIsOpen(cluster *RedisCluster) bool {
 
 	c := cluster.RedisController.singleton(cluster.IsCache, cluster.IsAnalytics)
 	testKey := "redis-test-" + uuid.NewV4().String()
-	if err := c.Set(cluster.RedisController.ctx, testKey, "test", time.Second).Err(); err != nil {
+	if err := c.Set(cluster.context(), testKey, "test", time.Second).Err(); err != nil {
 		return false
 	}
-	if _, err := c.Get(cluster.RedisController.ctx, testKey).Result(); err != nil {
+	if _, err := c.Get(cluster.context(), testKey).Result(); err != nil {
 		return false
 	}
 	return true
@@ -170,7 +179,7 @@ func (r *RedisCluster) GetKey(keyName string) (string, error) {
 	}
 	cluster := r.singleton()
 
-	value, err := cluster.Get(r.RedisController.ctx, r.fixKey(keyName)).Result()
+	value, err := cluster.Get(r.context(), r.fixKey(keyName)).Result()
 	if err != nil {
 		log.Debug("Error trying to get value:", err)
 		return "", ErrKeyNotFound
@@ -199,9 +208,9 @@ func (r *RedisCluster) GetMultiKey(keys []string) ([]string, error) {
 			getCmds := make([]*redis.StringCmd, 0)
 			pipe := v.Pipeline()
 			for _, key := range keyNames {
-				getCmds = append(getCmds, pipe.Get(r.RedisController.ctx, key))
+				getCmds = append(getCmds, pipe.Get(r.context(), key))
 			}
-			_, err := pipe.Exec(r.RedisController.ctx)
+			_, err := pipe.Exec(r.context())
 			if err != nil && err != redis.Nil {
 				log.WithError(err).Debug("Error trying to get value")
 				return nil, ErrKeyNotFound
@@ -212,7 +221,7 @@ func (r *RedisCluster) GetMultiKey(keys []string) ([]string, error) {
 		}
 	case *redis.Client:
 		{
-			values, err := cluster.MGet(r.RedisController.ctx, keyNames...).Result()
+			values, err := cluster.MGet(r.context(), keyNames...).Result()
 			if err != nil {
 				log.WithError(err).Debug("Error trying to get value")
 				return nil, ErrKeyNotFound
@@ -236,11 +245,52 @@ func (r *RedisCluster) GetMultiKey(keys []string) ([]string, error) {
 	return nil, ErrKeyNotFound
 }
 
+// GetRawMultiKey gets multiple keys by their full names, the values of the keys not found being empty
+func (r *RedisCluster) GetRawMultiKey(keys []string) ([]string, error) {
+	if err := r.up(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	result := make([]string, len(keys))
+
+	switch v := r.singleton().(type) {
+	case *redis.ClusterClient:
+		getCmds := make([]*redis.StringCmd, len(keys))
+		pipe := v.Pipeline()
+		for i, key := range keys {
+			getCmds[i] = pipe.Get(r.context(), key)
+		}
+		if _, err := pipe.Exec(r.context()); err != nil && err != redis.Nil {
+			log.WithError(err).Debug("Error trying to get values")
+			return nil, err
+		}
+		for i, cmd := range getCmds {
+			result[i] = cmd.Val()
+		}
+	case *redis.Client:
+		values, err := v.MGet(r.context(), keys...).Result()
+		if err != nil {
+			log.WithError(err).Debug("Error trying to get values")
+			return nil, err
+		}
+		for i, val := range values {
+			if s, ok := val.(string); ok {
+				result[i] = s
+			}
+		}
+	}
+
+	return result, nil
+}
+
 func (r *RedisCluster) GetKeyTTL(keyName string) (ttl int64, err error) {
 	if err = r.up(); err != nil {
 		return 0, err
 	}
-	duration, err := r.singleton().TTL(r.RedisController.ctx, r.fixKey(keyName)).Result()
+	duration, err := r.singleton().TTL(r.context(), r.fixKey(keyName)).Result()
 	return int64(duration.Seconds()), err
 }
 
@@ -248,7 +298,7 @@ func (r *RedisCluster) GetRawKey(keyName string) (string, error) {
 	if err := r.up(); err != nil {
 		return "", err
 	}
-	value, err := r.singleton().Get(r.RedisController.ctx, keyName).Result()
+	value, err := r.singleton().Get(r.context(), keyName).Result()
 	if err != nil {
 		log.Debug("Error trying to get value:", err)
 		return "", ErrKeyNotFound
@@ -263,7 +313,7 @@ func (r *RedisCluster) GetExp(keyName string) (int64, error) {
 		return 0, err
 	}
 
-	value, err := r.singleton().TTL(r.RedisController.ctx, r.fixKey(keyName)).Result()
+	value, err := r.singleton().TTL(r.context(), r.fixKey(keyName)).Result()
 	if err != nil {
 		log.Error("Error trying to get TTL: ", err)
 		return 0, ErrKeyNotFound
@@ -280,7 +330,7 @@ func (r *RedisCluster) SetExp(keyName string, timeout int64) error {
 	if err := r.up(); err != nil {
 		return err
 	}
-	err := r.singleton().Expire(r.RedisController.ctx, r.fixKey(keyName), time.Duration(timeout)*time.Second).Err()
+	err := r.singleton().Expire(r.context(), r.fixKey(keyName), time.Duration(timeout)*time.Second).Err()
 	if err != nil {
 		log.Error("Could not EXPIRE key: ", err)
 	}
@@ -295,7 +345,7 @@ func (r *RedisCluster) SetKey(keyName, session string, timeout int64) error {
 	if err := r.up(); err != nil {
 		return err
 	}
-	err := r.singleton().Set(r.RedisController.ctx, r.fixKey(keyName), session, time.Duration(timeout)*time.Second).Err()
+	err := r.singleton().Set(r.context(), r.fixKey(keyName), session, time.Duration(timeout)*time.Second).Err()
 	if err != nil {
 		log.Error("Error trying to set value: ", err)
 		return err
@@ -307,7 +357,7 @@ func (r *RedisCluster) SetRawKey(keyName, session string, timeout int64) error {
 	if err := r.up(); err != nil {
 		return err
 	}
-	err := r.singleton().Set(r.RedisController.ctx, keyName, session, time.Duration(timeout)*time.Second).Err()
+	err := r.singleton().Set(r.context(), keyName, session, time.Duration(timeout)*time.Second).Err()
 	if err != nil {
 		log.Error("Error trying to set value: ", err)
 		return err
@@ -323,7 +373,7 @@ func (r *RedisCluster) Decrement(keyName string) {
 		log.Debug(err)
 		return
 	}
-	err := r.singleton().Decr(r.RedisController.ctx, keyName).Err()
+	err := r.singleton().Decr(r.context(), keyName).Err()
 	if err != nil {
 		log.Error("Error trying to decrement value:", err)
 	}
@@ -338,7 +388,7 @@ func (r *RedisCluster) IncrememntWithExpire(keyName string, expire int64) int64
 	}
 	// This function uses a raw key, so we shouldn't call fixKey
 	fixedKey := keyName
-	val, err := r.singleton().Incr(r.RedisController.ctx, fixedKey).Result()
+	val, err := r.singleton().Incr(r.context(), fixedKey).Result()
 
 	if err != nil {
 		log.Error("Error trying to increment value:", err)
@@ -348,12 +398,24 @@ func (r *RedisCluster) IncrememntWithExpire(keyName string, expire int64) int64
 
 	if val == 1 && expire > 0 {
 		log.Debug("--> Setting Expire")
-		r.singleton().Expire(r.RedisController.ctx, fixedKey, time.Duration(expire)*time.Second)
+		r.singleton().Expire(r.context(), fixedKey, time.Duration(expire)*time.Second)
 	}
 
 	return val
 }
 
+// IncrementByWithExpire adds by to a raw key, setting its expiry to expire seconds when the key is created.
+func (r *RedisCluster) IncrementByWithExpire(keyName string, by, expire int64) (int64, error) {
+	if err := r.up(); err != nil {
+		return 0, err
+	}
+	val, err := r.singleton().IncrBy(r.context(), keyName, by).Result()
+	if err == nil && val == by && expire > 0 {
+		err = r.singleton().Expire(r.context(), keyName, time.Duration(expire)*time.Second).Err()
+	}
+	return val, err
+}
+
 // GetKeys will return all keys according to the filter (filter is a prefix - e.g. tyk.keys.*)
 func (r *RedisCluster) GetKeys(filter string) []string {
 	if err := r.up(); err != nil {
@@ -372,8 +434,8 @@ func (r *RedisCluster) GetKeys(filter string) []string {
 	fnFetchKeys := func(client *redis.Client) ([]string, error) {
 		values := make([]string, 0)
 
-		iter := client.Scan(r.RedisController.ctx, 0, searchStr, 0).Iterator()
-		for iter.Next(r.RedisController.ctx) {
+		iter := client.Scan(r.context(), 0, searchStr, 0).Iterator()
+		for iter.Next(r.context()) {
 			values = append(values, iter.Val())
 		}
 
@@ -392,7 +454,7 @@ func (r *RedisCluster) GetKeys(filter string) []string {
 		ch := make(chan []string)
 
 		go func() {
-			err = v.ForEachMaster(r.RedisController.ctx, func(ctx context.Context, client *redis.Client) error {
+			err = v.ForEachMaster(r.context(), func(ctx context.Context, client *redis.Client) error {
 				values, err := fnFetchKeys(client)
 				if err != nil {
 					return err
@@ -423,6 +485,112 @@ func (r *RedisCluster) GetKeys(filter string) []string {
 	return sessions
 }
 
+// ScanKeys returns a page of the keys matching the filter (a prefix, as in GetKeys), starting at cursor,
+// and the cursor of the next page, which is empty once all keys were returned. count is a hint of the number
+// of keys to examine, so a page can hold more or fewer keys, or none at all.
+func (r *RedisCluster) ScanKeys(filter, cursor string, count int64) ([]string, string, error) {
+	if err := r.up(); err != nil {
+		return nil, "", err
+	}
+
+	filterHash := ""
+	if filter != "" {
+		filterHash = r.hashKey(filter)
+	}
+	searchStr := r.KeyPrefix + filterHash + "*"
+
+	var keys []string
+	var next string
+	var err error
+
+	switch v := r.singleton().(type) {
+	case *redis.ClusterClient:
+		// the cursor of a cluster is the address of the master being scanned and the position in it
+		keys, next, err = r.scanCluster(v, searchStr, cursor, count)
+	case *redis.Client:
+		var pos uint64
+		if cursor != "" {
+			if pos, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+				return nil, "", ErrInvalidCursor
+			}
+		}
+		keys, pos, err = v.Scan(r.context(), pos, searchStr, count).Result()
+		if pos != 0 {
+			next = strconv.FormatUint(pos, 10)
+		}
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i, v := range keys {
+		keys[i] = r.cleanKey(v)
+	}
+
+	return keys, next, nil
+}
+
+func (r *RedisCluster) scanCluster(cluster *redis.ClusterClient, match, cursor string, count int64) ([]string, string, error) {
+	var mu sync.Mutex
+	var addrs []string
+	err := cluster.ForEachMaster(r.context(), func(ctx context.Context, client *redis.Client) error {
+		mu.Lock()
+		addrs = append(addrs, client.Options().Addr)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(addrs) == 0 {
+		return nil, "", nil
+	}
+	sort.Strings(addrs)
+
+	addr, pos := addrs[0], uint64(0)
+	if cursor != "" {
+		i := strings.LastIndex(cursor, "@")
+		if i < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+		if pos, err = strconv.ParseUint(cursor[i+1:], 10, 64); err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		addr = cursor[:i]
+	}
+
+	var keys []string
+	var next uint64
+	scanned := false
+	err = cluster.ForEachMaster(r.context(), func(ctx context.Context, client *redis.Client) error {
+		if client.Options().Addr != addr {
+			return nil
+		}
+		var err error
+		keys, next, err = client.Scan(ctx, pos, match, count).Result()
+		scanned = true
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if !scanned {
+		// the master is gone, its keys moved to the others
+		return nil, "", ErrInvalidCursor
+	}
+
+	if next != 0 {
+		return keys, addr + "@" + strconv.FormatUint(next, 10), nil
+	}
+	for i, a := range addrs {
+		if a == addr && i+1 < len(addrs) {
+			return keys, addrs[i+1] + "@0", nil
+		}
+	}
+	return keys, "", nil
+}
+
 // GetKeysAndValuesWithFilter will return all keys and their values with a filter
 func (r *RedisCluster) GetKeysAndValuesWithFilter(filter string) map[string]string {
 	if err := r.up(); err != nil {
@@ -452,9 +620,9 @@ func (r *RedisCluster) GetKeysAndValuesWithFilter(filter string) map[string]stri
 			getCmds := make([]*redis.StringCmd, 0)
 			pipe := v.Pipeline()
 			for _, key := range keys {
-				getCmds = append(getCmds, pipe.Get(r.RedisController.ctx, key))
+				getCmds = append(getCmds, pipe.Get(r.context(), key))
 			}
-			_, err := pipe.Exec(r.RedisController.ctx)
+			_, err := pipe.Exec(r.context())
 			if err != nil && err != redis.Nil {
 				log.Error("Error trying to get client keys: ", err)
 				return nil
@@ -466,7 +634,7 @@ func (r *RedisCluster) GetKeysAndValuesWithFilter(filter string) map[string]stri
 		}
 	case *redis.Client:
 		{
-			result, err := v.MGet(r.RedisController.ctx, keys...).Result()
+			result, err := v.MGet(r.context(), keys...).Result()
 			if err != nil {
 				log.Error("Error trying to get client keys: ", err)
 				return nil
@@ -504,7 +672,7 @@ func (r *RedisCluster) DeleteKey(keyName string) bool {
 	}
 	log.Debug("DEL Key was: ", keyName)
 	log.Debug("DEL Key became: ", r.fixKey(keyName))
-	n, err := r.singleton().Del(r.RedisController.ctx, r.fixKey(keyName)).Result()
+	n, err := r.singleton().Del(r.context(), r.fixKey(keyName)).Result()
 	if err != nil {
 		log.WithError(err).Error("Error trying to delete key")
 	}
@@ -518,7 +686,7 @@ func (r *RedisCluster) DeleteAllKeys() bool {
 		log.Debug(err)
 		return false
 	}
-	n, err := r.singleton().FlushAll(r.RedisController.ctx).Result()
+	n, err := r.singleton().FlushAll(r.context()).Result()
 	if err != nil {
 		log.WithError(err).Error("Error trying to delete keys")
 	}
@@ -536,7 +704,7 @@ func (r *RedisCluster) DeleteRawKey(keyName string) bool {
 		log.Debug(err)
 		return false
 	}
-	n, err := r.singleton().Del(r.RedisController.ctx, keyName).Result()
+	n, err := r.singleton().Del(r.context(), keyName).Result()
 	if err != nil {
 		log.WithError(err).Error("Error trying to delete key")
 	}
@@ -556,8 +724,8 @@ func (r *RedisCluster) DeleteScanMatch(pattern string) bool {
 	fnScan := func(client *redis.Client) ([]string, error) {
 		values := make([]string, 0)
 
-		iter := client.Scan(r.RedisController.ctx, 0, pattern, 0).Iterator()
-		for iter.Next(r.RedisController.ctx) {
+		iter := client.Scan(r.context(), 0, pattern, 0).Iterator()
+		for iter.Next(r.context()) {
 			values = append(values, iter.Val())
 		}
 
@@ -575,7 +743,7 @@ func (r *RedisCluster) DeleteScanMatch(pattern string) bool {
 	case *redis.ClusterClient:
 		ch := make(chan []string)
 		go func() {
-			err = v.ForEachMaster(r.RedisController.ctx, func(ctx context.Context, client *redis.Client) error {
+			err = v.ForEachMaster(r.context(), func(ctx context.Context, client *redis.Client) error {
 				values, err := fnScan(client)
 				if err != nil {
 					return err
@@ -602,7 +770,7 @@ func (r *RedisCluster) DeleteScanMatch(pattern string) bool {
 	if len(keys) > 0 {
 		for _, name := range keys {
 			log.Info("Deleting: ", name)
-			err := client.Del(r.RedisController.ctx, name).Err()
+			err := client.Del(r.context(), name).Err()
 			if err != nil {
 				log.Error("Error trying to delete key: ", name, " - ", err)
 			}
@@ -633,16 +801,16 @@ func (r *RedisCluster) DeleteKeys(keys []string) bool {
 			{
 				pipe := v.Pipeline()
 				for _, k := range keys {
-					pipe.Del(r.RedisController.ctx, k)
+					pipe.Del(r.context(), k)
 				}
 
-				if _, err := pipe.Exec(r.RedisController.ctx); err != nil {
+				if _, err := pipe.Exec(r.context()); err != nil {
 					log.Error("Error trying to delete keys:", err)
 				}
 			}
 		case *redis.Client:
 			{
-				_, err := v.Del(r.RedisController.ctx, keys...).Result()
+				_, err := v.Del(r.context(), keys...).Result()
 				if err != nil {
 					log.Error("Error trying to delete keys: ", err)
 				}
@@ -655,6 +823,53 @@ func (r *RedisCluster) DeleteKeys(keys []string) bool {
 	return true
 }
 
+// SetRawKeys sets many keys by their full names in one pipeline, expiring
+// after the given number of seconds, and returns the error of each key
+func (r *RedisCluster) SetRawKeys(keys, values []string, timeouts []int64) ([]error, error) {
+	if err := r.up(); err != nil {
+		return nil, err
+	}
+
+	pipe := r.singleton().Pipeline()
+	cmds := make([]*redis.StatusCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Set(r.context(), key, values[i], time.Duration(timeouts[i])*time.Second)
+	}
+	if _, err := pipe.Exec(r.context()); err != nil {
+		log.WithError(err).Error("Error trying to set values")
+	}
+
+	errs := make([]error, len(keys))
+	for i, cmd := range cmds {
+		errs[i] = cmd.Err()
+	}
+	return errs, nil
+}
+
+// DeleteRawKeys deletes many keys by their full names in one pipeline, and
+// reports which of them existed
+func (r *RedisCluster) DeleteRawKeys(keys []string) ([]bool, error) {
+	if err := r.up(); err != nil {
+		return nil, err
+	}
+
+	pipe := r.singleton().Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Del(r.context(), key)
+	}
+	if _, err := pipe.Exec(r.context()); err != nil {
+		log.WithError(err).Error("Error trying to delete keys")
+		return nil, err
+	}
+
+	deleted := make([]bool, len(keys))
+	for i, cmd := range cmds {
+		deleted[i] = cmd.Val() > 0
+	}
+	return deleted, nil
+}
+
 // StartPubSubHandler will listen for a signal and run the callback for
 // every subscription and message event.
 func (r *RedisCluster) StartPubSubHandler(channel string, callback func(interface{})) error {
@@ -693,7 +908,7 @@ func (r *RedisCluster) Publish(channel, message string) error {
 	if err := r.up(); err != nil {
 		return err
 	}
-	err := r.singleton().Publish(r.RedisController.ctx, channel, message).Err()
+	err := r.singleton().Publish(r.context(), channel, message).Err()
 	if err != nil {
 		log.Error("Error trying to publish message: ", err)
 		return err
@@ -714,9 +929,9 @@ func (r *RedisCluster) GetAndDeleteSet(keyName string) []interface{} {
 	client := r.singleton()
 
 	var lrange *redis.StringSliceCmd
-	_, err := client.TxPipelined(r.RedisController.ctx, func(pipe redis.Pipeliner) error {
-		lrange = pipe.LRange(r.RedisController.ctx, fixedKey, 0, -1)
-		pipe.Del(r.RedisController.ctx, fixedKey)
+	_, err := client.TxPipelined(r.context(), func(pipe redis.Pipeliner) error {
+		lrange = pipe.LRange(r.context(), fixedKey, 0, -1)
+		pipe.Del(r.context(), fixedKey)
 		return nil
 	})
 	if err != nil {
@@ -747,7 +962,7 @@ func (r *RedisCluster) AppendToSet(keyName, value string) {
 		log.Debug(err)
 		return
 	}
-	if err := r.singleton().RPush(r.RedisController.ctx, fixedKey, value).Err(); err != nil {
+	if err := r.singleton().RPush(r.context(), fixedKey, value).Err(); err != nil {
 		log.WithError(err).Error("Error trying to append to set keys")
 	}
 }
@@ -757,7 +972,7 @@ func (r *RedisCluster) Exists(keyName string) (bool, error) {
 	fixedKey := r.fixKey(keyName)
 	log.WithField("keyName", fixedKey).Debug("Checking if exists")
 
-	exists, err := r.singleton().Exists(r.RedisController.ctx, fixedKey).Result()
+	exists, err := r.singleton().Exists(r.context(), fixedKey).Result()
 	if err != nil {
 		log.Error("Error trying to check if key exists: ", err)
 		return false, err
@@ -778,7 +993,7 @@ func (r *RedisCluster) RemoveFromList(keyName, value string) error {
 	}
 	log.WithFields(logEntry).Debug("Removing value from list")
 
-	if err := r.singleton().LRem(r.RedisController.ctx, fixedKey, 0, value).Err(); err != nil {
+	if err := r.singleton().LRem(r.context(), fixedKey, 0, value).Err(); err != nil {
 		log.WithFields(logEntry).WithError(err).Error("LREM command failed")
 		return err
 	}
@@ -797,7 +1012,7 @@ func (r *RedisCluster) GetListRange(keyName string, from, to int64) ([]string, e
 	}
 	log.WithFields(logEntry).Debug("Getting list range")
 
-	elements, err := r.singleton().LRange(r.RedisController.ctx, fixedKey, from, to).Result()
+	elements, err := r.singleton().LRange(r.context(), fixedKey, from, to).Result()
 	if err != nil {
 		log.WithFields(logEntry).WithError(err).Error("LRANGE command failed")
 		return nil, err
@@ -820,10 +1035,10 @@ func (r *RedisCluster) AppendToSetPipelined(key string, values [][]byte) {
 
 	pipe := client.Pipeline()
 	for _, val := range values {
-		pipe.RPush(r.RedisController.ctx, fixedKey, val)
+		pipe.RPush(r.context(), fixedKey, val)
 	}
 
-	if _, err := pipe.Exec(r.RedisController.ctx); err != nil {
+	if _, err := pipe.Exec(r.context()); err != nil {
 		log.WithError(err).Error("Error trying to append to set keys")
 	}
 }
@@ -834,7 +1049,7 @@ func (r *RedisCluster) GetSet(keyName string) (map[string]string, error) {
 	if err := r.up(); err != nil {
 		return nil, err
 	}
-	val, err := r.singleton().SMembers(r.RedisController.ctx, r.fixKey(keyName)).Result()
+	val, err := r.singleton().SMembers(r.context(), r.fixKey(keyName)).Result()
 	if err != nil {
 		log.Error("Error trying to get key set:", err)
 		return nil, err
@@ -855,7 +1070,7 @@ func (r *RedisCluster) AddToSet(keyName, value string) {
 		log.Debug(err)
 		return
 	}
-	err := r.singleton().SAdd(r.RedisController.ctx, r.fixKey(keyName), value).Err()
+	err := r.singleton().SAdd(r.context(), r.fixKey(keyName), value).Err()
 	if err != nil {
 		log.Error("Error trying to append keys: ", err)
 	}
@@ -868,7 +1083,7 @@ func (r *RedisCluster) RemoveFromSet(keyName, value string) {
 		log.Debug(err)
 		return
 	}
-	err := r.singleton().SRem(r.RedisController.ctx, r.fixKey(keyName), value).Err()
+	err := r.singleton().SRem(r.context(), r.fixKey(keyName), value).Err()
 	if err != nil {
 		log.Error("Error trying to remove keys: ", err)
 	}
@@ -879,7 +1094,7 @@ func (r *RedisCluster) IsMemberOfSet(keyName, value string) bool {
 		log.Debug(err)
 		return false
 	}
-	val, err := r.singleton().SIsMember(r.RedisController.ctx, r.fixKey(keyName), value).Result()
+	val, err := r.singleton().SIsMember(r.context(), r.fixKey(keyName), value).Result()
 
 	if err != nil {
 		log.Error("Error trying to check set memeber: ", err)
@@ -908,8 +1123,8 @@ func (r *RedisCluster) SetRollingWindow(keyName string, per int64, value_overrid
 	var zrange *redis.StringSliceCmd
 
 	pipeFn := func(pipe redis.Pipeliner) error {
-		pipe.ZRemRangeByScore(r.RedisController.ctx, keyName, "-inf", strconv.Itoa(int(onePeriodAgo.UnixNano())))
-		zrange = pipe.ZRange(r.RedisController.ctx, keyName, 0, -1)
+		pipe.ZRemRangeByScore(r.context(), keyName, "-inf", strconv.Itoa(int(onePeriodAgo.UnixNano())))
+		zrange = pipe.ZRange(r.context(), keyName, 0, -1)
 
 		element := redis.Z{
 			Score: float64(now.UnixNano()),
@@ -921,17 +1136,17 @@ func (r *RedisCluster) SetRollingWindow(keyName string, per int64, value_overrid
 			element.Member = strconv.Itoa(int(now.UnixNano()))
 		}
 
-		pipe.ZAdd(r.RedisController.ctx, keyName, &element)
-		pipe.Expire(r.RedisController.ctx, keyName, time.Duration(per)*time.Second)
+		pipe.ZAdd(r.context(), keyName, &element)
+		pipe.Expire(r.context(), keyName, time.Duration(per)*time.Second)
 
 		return nil
 	}
 
 	var err error
 	if pipeline {
-		_, err = client.Pipelined(r.RedisController.ctx, pipeFn)
+		_, err = client.Pipelined(r.context(), pipeFn)
 	} else {
-		_, err = client.TxPipelined(r.RedisController.ctx, pipeFn)
+		_, err = client.TxPipelined(r.context(), pipeFn)
 	}
 
 	if err != nil {
@@ -970,17 +1185,17 @@ func (r RedisCluster) GetRollingWindow(keyName string, per int64, pipeline bool)
 	var zrange *redis.StringSliceCmd
 
 	pipeFn := func(pipe redis.Pipeliner) error {
-		pipe.ZRemRangeByScore(r.RedisController.ctx, keyName, "-inf", strconv.Itoa(int(onePeriodAgo.UnixNano())))
-		zrange = pipe.ZRange(r.RedisController.ctx, keyName, 0, -1)
+		pipe.ZRemRangeByScore(r.context(), keyName, "-inf", strconv.Itoa(int(onePeriodAgo.UnixNano())))
+		zrange = pipe.ZRange(r.context(), keyName, 0, -1)
 
 		return nil
 	}
 
 	var err error
 	if pipeline {
-		_, err = client.Pipelined(r.RedisController.ctx, pipeFn)
+		_, err = client.Pipelined(r.context(), pipeFn)
 	} else {
-		_, err = client.TxPipelined(r.RedisController.ctx, pipeFn)
+		_, err = client.TxPipelined(r.context(), pipeFn)
 	}
 	if err != nil {
 		log.Error("Multi command failed: ", err)
@@ -1024,7 +1239,7 @@ func (r *RedisCluster) AddToSortedSet(keyName, value string, score float64) {
 		return
 	}
 	member := redis.Z{Score: score, Member: value}
-	if err := r.singleton().ZAdd(r.RedisController.ctx, fixedKey, &member).Err(); err != nil {
+	if err := r.singleton().ZAdd(r.context(), fixedKey, &member).Err(); err != nil {
 		log.WithFields(logEntry).WithError(err).Error("ZADD command failed")
 	}
 }
@@ -1041,7 +1256,7 @@ func (r *RedisCluster) GetSortedSetRange(keyName, scoreFrom, scoreTo string) ([]
 	log.WithFields(logEntry).Debug("Getting sorted set range")
 
 	args := redis.ZRangeBy{Min: scoreFrom, Max: scoreTo}
-	values, err := r.singleton().ZRangeByScoreWithScores(r.RedisController.ctx, fixedKey, &args).Result()
+	values, err := r.singleton().ZRangeByScoreWithScores(r.context(), fixedKey, &args).Result()
 	if err != nil {
 		log.WithFields(logEntry).WithError(err).Error("ZRANGEBYSCORE command failed")
 		return nil, nil, err
@@ -1073,7 +1288,7 @@ func (r *RedisCluster) RemoveSortedSetRange(keyName, scoreFrom, scoreTo string)
 	}
 	log.WithFields(logEntry).Debug("Removing sorted set range")
 
-	if err := r.singleton().ZRemRangeByScore(r.RedisController.ctx, fixedKey, scoreFrom, scoreTo).Err(); err != nil {
+	if err := r.singleton().ZRemRangeByScore(r.context(), fixedKey, scoreFrom, scoreTo).Err(); err != nil {
 		log.WithFields(logEntry).WithError(err).Error("ZREMRANGEBYSCORE command failed")
 		return err
 	}
@@ -1081,6 +1296,72 @@ func (r *RedisCluster) RemoveSortedSetRange(keyName, scoreFrom, scoreTo string)
 	return nil
 }
 
+// RemoveFromSortedSet removes value from the sorted set identified by keyName
+func (r *RedisCluster) RemoveFromSortedSet(keyName, value string) error {
+	fixedKey := r.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+	}
+	log.WithFields(logEntry).Debug("Removing value from sorted set")
+
+	if err := r.up(); err != nil {
+		return err
+	}
+	if err := r.singleton().ZRem(r.context(), fixedKey, value).Err(); err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZREM command failed")
+		return err
+	}
+
+	return nil
+}
+
+// GetSortedSetRangeByLex gets up to count elements of the sorted set identified by keyName, in lexicographical
+// order from the first element after the given one, or from the start when after is empty. The elements of
+// the set are expected to all have the same score.
+func (r *RedisCluster) GetSortedSetRangeByLex(keyName, after string, count int64) ([]string, error) {
+	fixedKey := r.fixKey(keyName)
+	logEntry := logrus.Fields{
+		"keyName":  keyName,
+		"fixedKey": fixedKey,
+		"after":    after,
+	}
+	log.WithFields(logEntry).Debug("Getting sorted set range by lex")
+
+	if err := r.up(); err != nil {
+		return nil, err
+	}
+
+	start := "-"
+	if after != "" {
+		start = "(" + after
+	}
+	args := redis.ZRangeBy{Min: start, Max: "+", Count: count}
+	elements, err := r.singleton().ZRangeByLex(r.context(), fixedKey, &args).Result()
+	if err != nil {
+		log.WithFields(logEntry).WithError(err).Error("ZRANGEBYLEX command failed")
+		return nil, err
+	}
+
+	return elements, nil
+}
+
+// AddToStream adds an entry with the given fields to the stream identified by keyName,
+// trimming the stream to about maxLen entries when maxLen is positive
+func (r *RedisCluster) AddToStream(keyName string, values map[string]interface{}, maxLen int64) error {
+	if err := r.up(); err != nil {
+		return err
+	}
+
+	args := redis.XAddArgs{Stream: r.fixKey(keyName), MaxLenApprox: maxLen, Values: values}
+	if err := r.singleton().XAdd(r.context(), &args).Err(); err != nil {
+		log.WithField("keyName", keyName).WithError(err).Error("XADD command failed")
+		return err
+	}
+
+	return nil
+}
+
 func (r *RedisCluster) ControllerInitiated() bool {
 	return r.RedisController != nil
 }
@@ -17,6 +17,9 @@ type RedisController struct {
 	redisUp             atomic.Value
 	disableRedis        atomic.Value
 
+	// embedded is the store used in place of Redis when the storage type is embedded
+	embedded atomic.Value
+
 	ctx context.Context
 }
 
@@ -72,6 +75,14 @@ func (rc *RedisController) WaitConnect(ctx context.Context) bool {
 	}
 }
 
+// Embedded returns the embedded store used in place of Redis, or nil when Redis is used.
+func (rc *RedisController) Embedded() *EmbeddedStore {
+	if v := rc.embedded.Load(); v != nil {
+		return v.(*EmbeddedStore)
+	}
+	return nil
+}
+
 func (rc *RedisController) singleton(cache, analytics bool) redis.UniversalClient {
 	if cache {
 		v := rc.singleCachePool.Load()
@@ -116,6 +127,10 @@ func (rc *RedisController) connectSingleton(cache, analytics bool, conf config.C
 //
 // onConnect will be called when we have established a successful redis connection
 func (rc *RedisController) ConnectToRedis(ctx context.Context, onConnect func(), conf *config.Config) {
+	if conf.Storage.Type == "embedded" {
+		rc.openEmbedded(ctx, onConnect, conf.Storage.Path)
+		return
+	}
 
 	tick := time.NewTicker(time.Second)
 	defer tick.Stop()
@@ -174,3 +189,46 @@ func (rc *RedisController) establishConnection(v *RedisCluster, conf config.Conf
 	}
 	return clusterConnectionIsOpen(v)
 }
+
+// openEmbedded opens the embedded store at path, retrying until it succeeds, and closes it once ctx is done.
+// As with Redis, onConnect is called when the store is enabled again after DisableRedis.
+func (rc *RedisController) openEmbedded(ctx context.Context, onConnect func(), path string) {
+	if path == "" {
+		path = defaultEmbeddedPath
+	}
+
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	var store *EmbeddedStore
+	defer func() {
+		rc.redisUp.Store(false)
+		if store != nil {
+			store.Close()
+		}
+	}()
+
+	for {
+		if store == nil {
+			var err error
+			if store, err = OpenEmbeddedStore(path); err != nil {
+				log.WithError(err).Error("Could not open the embedded store at ", path)
+			} else {
+				log.Info("--> [EMBEDDED] Opened the embedded store at ", path)
+				rc.embedded.Store(store)
+				rc.redisUp.Store(rc.shouldConnect())
+			}
+		} else if rc.shouldConnect() && !rc.Connected() {
+			rc.redisUp.Store(true)
+			if onConnect != nil {
+				onConnect()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	redis "github.com/go-redis/redis/v8"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/TykTechnologies/tyk/trace"
+)
+
+// WithContext returns a handler whose Redis calls are traced as children of
+// the span active in ctx. Only the span is taken from ctx, its cancellation
+// doesn't apply to the calls. Handlers other than RedisCluster are returned
+// unchanged.
+func WithContext(h Handler, ctx context.Context) Handler {
+	r, ok := h.(*RedisCluster)
+	if !ok || r.RedisController == nil || !trace.IsEnabled() {
+		return h
+	}
+
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return h
+	}
+
+	traced := *r
+	traced.ctx = trace.SetServiceID(opentracing.ContextWithSpan(r.RedisController.ctx, span), trace.GetServiceID(ctx))
+	return &traced
+}
+
+// context returns the context of the Redis calls.
+func (r *RedisCluster) context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return r.RedisController.ctx
+}
+
+type spanKey struct{}
+
+// tracingHook records Redis commands in spans, when they are issued in the
+// context of a traced request.
+type tracingHook struct{}
+
+func (tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return startRedisSpan(ctx, "redis "+cmd.Name(), cmd.Name()), nil
+}
+
+func (tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	finishRedisSpan(ctx, cmd.Err())
+	return nil
+}
+
+func (tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	return startRedisSpan(ctx, "redis pipeline", strings.Join(names, " ")), nil
+}
+
+func (tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+			err = cmdErr
+			break
+		}
+	}
+	finishRedisSpan(ctx, err)
+	return nil
+}
+
+func startRedisSpan(ctx context.Context, name, statement string) context.Context {
+	if !trace.IsEnabled() || opentracing.SpanFromContext(ctx) == nil {
+		return ctx
+	}
+
+	span, ctx := trace.Span(ctx, name)
+	ext.SpanKindRPCClient.Set(span)
+	ext.DBType.Set(span, "redis")
+	ext.DBStatement.Set(span, statement)
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func finishRedisSpan(ctx context.Context, err error) {
+	span, ok := ctx.Value(spanKey{}).(opentracing.Span)
+	if !ok {
+		return
+	}
+	if err != nil && err != redis.Nil {
+		ext.Error.Set(span, true)
+		span.LogKV("event", "error", "message", err.Error())
+	}
+	span.Finish()
+}
@@ -66,6 +66,46 @@ type AnalyticsHandler interface {
 	GetExp(string) (int64, error) // Returns expiry of a key
 }
 
+// Store is a storage manager of the configured storage type, either Redis or the embedded store, see NewStore.
+type Store interface {
+	Handler
+	AnalyticsHandler
+	GetRawMultiKey([]string) ([]string, error)
+	ScanKeys(filter, cursor string, count int64) ([]string, string, error)
+	SetRawKeys(keys, values []string, timeouts []int64) ([]error, error)
+	DeleteRawKeys([]string) ([]bool, error)
+	IncrementByWithExpire(key string, by, expire int64) (int64, error)
+	RemoveFromSortedSet(string, string) error
+	GetSortedSetRangeByLex(key, after string, count int64) ([]string, error)
+	AddToStream(key string, values map[string]interface{}, maxLen int64) error
+	StartPubSubHandler(string, func(interface{})) error
+	Publish(string, string) error
+}
+
+// StoreOptions are the options of the stores returned by NewStore
+type StoreOptions struct {
+	KeyPrefix string
+	HashKeys  bool
+	// IsCache and IsAnalytics select the Redis connection, the embedded store having a single one
+	IsCache     bool
+	IsAnalytics bool
+}
+
+// NewStore returns a store of the given storage type: EmbeddedStorage when it's `embedded`, RedisCluster otherwise.
+// Both use the connection of rc.
+func NewStore(storageType string, rc *RedisController, opts StoreOptions) Store {
+	if storageType == "embedded" {
+		return &EmbeddedStorage{KeyPrefix: opts.KeyPrefix, HashKeys: opts.HashKeys, RedisController: rc}
+	}
+	return &RedisCluster{
+		KeyPrefix:       opts.KeyPrefix,
+		HashKeys:        opts.HashKeys,
+		IsCache:         opts.IsCache,
+		IsAnalytics:     opts.IsAnalytics,
+		RedisController: rc,
+	}
+}
+
 const defaultHashAlgorithm = "murmur64"
 
 // If hashing algorithm is empty, use legacy key generation
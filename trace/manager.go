@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -213,3 +215,31 @@ func Inject(service string, span opentracing.Span, h http.Header) error {
 func InjectFromContext(ctx context.Context, span opentracing.Span, h http.Header) error {
 	return Inject(GetServiceID(ctx), span, h)
 }
+
+// TraceID returns the ID of the trace the active span of ctx belongs to, or
+// an empty string when there is no active span or the tracer's propagation
+// format isn't known.
+func TraceID(ctx context.Context) string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+
+	h := http.Header{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h)); err != nil {
+		return ""
+	}
+
+	// W3C trace context: version-traceid-spanid-flags
+	if parts := strings.Split(h.Get("traceparent"), "-"); len(parts) >= 4 {
+		return parts[1]
+	}
+	// Jaeger: traceid:spanid:parentid:flags, URL encoded
+	if v, err := url.QueryUnescape(h.Get("uber-trace-id")); err == nil {
+		if parts := strings.Split(v, ":"); len(parts) == 4 {
+			return parts[0]
+		}
+	}
+	// Zipkin B3
+	return h.Get("x-b3-traceid")
+}
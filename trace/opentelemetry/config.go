@@ -0,0 +1,14 @@
+package opentelemetry
+
+import (
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// Load returns an OpenTelemetry configuration from the opts.
+func Load(opts map[string]interface{}) (*config.OpenTelemetryConfig, error) {
+	var c config.OpenTelemetryConfig
+	if err := config.DecodeJSON(&c, opts); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
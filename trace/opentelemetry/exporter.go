@@ -0,0 +1,510 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+// Exporters supported by the tracer
+const (
+	ExporterGRPC = "grpc"
+	ExporterHTTP = "http"
+)
+
+const (
+	defaultGRPCEndpoint  = "localhost:4317"
+	defaultHTTPEndpoint  = "http://localhost:4318/v1/traces"
+	defaultTimeout       = 10 * time.Second
+	defaultBatchSize     = 512
+	defaultMaxQueueSize  = 2048
+	defaultFlushInterval = 5 * time.Second
+
+	httpTracesPath = "/v1/traces"
+	exportMethod   = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+
+	instrumentationName = "github.com/TykTechnologies/tyk/trace/opentelemetry"
+)
+
+// sender delivers an encoded ExportTraceServiceRequest to a collector.
+type sender interface {
+	send(ctx context.Context, req []byte) error
+	close() error
+}
+
+// exporter batches finished spans, exporting them when a batch is full or
+// when the flush interval elapses. Spans are dropped when the queue is full.
+type exporter struct {
+	sender   sender
+	resource []byte
+	log      Logger
+
+	timeout       time.Duration
+	batchSize     int
+	flushInterval time.Duration
+
+	queue   chan *Span
+	flushCh chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	dropped uint64
+}
+
+func newExporter(service string, c *config.OpenTelemetryConfig, log Logger) (*exporter, error) {
+	e := &exporter{
+		log:           log,
+		timeout:       time.Duration(c.Timeout) * time.Second,
+		batchSize:     c.BatchSize,
+		flushInterval: time.Duration(c.FlushInterval) * time.Millisecond,
+		flushCh:       make(chan chan struct{}),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if e.timeout <= 0 {
+		e.timeout = defaultTimeout
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = defaultBatchSize
+	}
+	if e.flushInterval <= 0 {
+		e.flushInterval = defaultFlushInterval
+	}
+	queueSize := c.MaxQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultMaxQueueSize
+	}
+	if e.batchSize > queueSize {
+		e.batchSize = queueSize
+	}
+	e.queue = make(chan *Span, queueSize)
+
+	var err error
+	switch c.Exporter {
+	case ExporterGRPC, "":
+		e.sender, err = newGRPCSender(c)
+	case ExporterHTTP:
+		e.sender, err = newHTTPSender(c, e.timeout)
+	default:
+		err = fmt.Errorf("opentelemetry: unknown exporter %q", c.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e.resource = encodeResource(service, c.ResourceAttributes)
+
+	go e.loop()
+
+	return e, nil
+}
+
+// enqueue adds a finished span to the export queue without blocking.
+func (e *exporter) enqueue(s *Span) {
+	select {
+	case <-e.stop:
+		return
+	default:
+	}
+
+	select {
+	case e.queue <- s:
+	default:
+		if atomic.AddUint64(&e.dropped, 1) == 1 {
+			e.log.Errorf("OpenTelemetry export queue is full, dropping spans")
+		}
+	}
+}
+
+// flush exports the queued spans and waits for the export to complete.
+func (e *exporter) flush() {
+	ch := make(chan struct{})
+	select {
+	case e.flushCh <- ch:
+		<-ch
+	case <-e.done:
+	}
+}
+
+func (e *exporter) close() error {
+	e.once.Do(func() {
+		close(e.stop)
+		<-e.done
+	})
+	return e.sender.close()
+}
+
+func (e *exporter) loop() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, e.batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		e.export(batch)
+		batch = batch[:0]
+	}
+	drain := func() {
+		for {
+			select {
+			case s := <-e.queue:
+				batch = append(batch, s)
+				if len(batch) >= e.batchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= e.batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ch := <-e.flushCh:
+			drain()
+			close(ch)
+		case <-e.stop:
+			drain()
+			return
+		}
+	}
+}
+
+func (e *exporter) export(spans []*Span) {
+	if dropped := atomic.SwapUint64(&e.dropped, 0); dropped > 0 {
+		e.log.Errorf("OpenTelemetry exporter dropped %d spans", dropped)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	if err := e.sender.send(ctx, encodeRequest(e.resource, spans)); err != nil {
+		e.log.Errorf("Failed to export %d spans: %v", len(spans), err)
+	}
+}
+
+type grpcSender struct {
+	conn    *grpc.ClientConn
+	headers metadata.MD
+}
+
+func newGRPCSender(c *config.OpenTelemetryConfig) (*grpcSender, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = defaultGRPCEndpoint
+	}
+
+	opts := []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{}))}
+	if c.Insecure {
+		opts = append(opts, grpc.WithInsecure())
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+	}
+
+	conn, err := grpc.Dial(endpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcSender{conn: conn, headers: metadata.New(c.Headers)}, nil
+}
+
+func (s *grpcSender) send(ctx context.Context, req []byte) error {
+	if len(s.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, s.headers)
+	}
+	var resp []byte
+	return s.conn.Invoke(ctx, exportMethod, req, &resp)
+}
+
+func (s *grpcSender) close() error {
+	return s.conn.Close()
+}
+
+// rawCodec passes already encoded protobuf messages through gRPC.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("opentelemetry: unexpected message type %T", v)
+	}
+	return b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("opentelemetry: unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+func (rawCodec) String() string {
+	return "proto"
+}
+
+type httpSender struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+}
+
+func newHTTPSender(c *config.OpenTelemetryConfig, timeout time.Duration) (*httpSender, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = defaultHTTPEndpoint
+	}
+	if !strings.Contains(endpoint, "://") {
+		scheme := "https://"
+		if c.Insecure {
+			scheme = "http://"
+		}
+		endpoint = scheme + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = httpTracesPath
+	}
+
+	return &httpSender{
+		client:   &http.Client{Timeout: timeout},
+		endpoint: u.String(),
+		headers:  c.Headers,
+	}, nil
+}
+
+func (s *httpSender) send(ctx context.Context, req []byte) error {
+	r, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(req))
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range s.headers {
+		r.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("opentelemetry: collector responded with " + resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSender) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// encodeResource encodes the OTLP Resource describing the gateway.
+func encodeResource(service string, attributes map[string]string) []byte {
+	attrs := []attribute{{key: "service.name", value: service}}
+
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		if k != "service.name" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs = append(attrs, attribute{key: k, value: attributes[k]})
+	}
+
+	var b []byte
+	for _, attr := range attrs {
+		b = appendMessage(b, 1, encodeKeyValue(attr))
+	}
+	return b
+}
+
+// encodeRequest encodes an ExportTraceServiceRequest holding spans.
+func encodeRequest(resource []byte, spans []*Span) []byte {
+	var scope []byte
+	scope = protowire.AppendTag(scope, 1, protowire.BytesType)
+	scope = protowire.AppendString(scope, instrumentationName)
+
+	var scopeSpans []byte
+	scopeSpans = appendMessage(scopeSpans, 1, scope)
+	for _, s := range spans {
+		scopeSpans = appendMessage(scopeSpans, 2, encodeSpan(s))
+	}
+
+	var resourceSpans []byte
+	resourceSpans = appendMessage(resourceSpans, 1, resource)
+	resourceSpans = appendMessage(resourceSpans, 2, scopeSpans)
+
+	return appendMessage(nil, 1, resourceSpans)
+}
+
+func encodeSpan(s *Span) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, s.ctx.traceID[:])
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, s.ctx.spanID[:])
+	if s.ctx.traceState != "" {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, s.ctx.traceState)
+	}
+	if s.parentID != ([8]byte{}) {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, s.parentID[:])
+	}
+	b = protowire.AppendTag(b, 5, protowire.BytesType)
+	b = protowire.AppendString(b, s.name)
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(s.kind))
+	b = protowire.AppendTag(b, 7, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.start.UnixNano()))
+	b = protowire.AppendTag(b, 8, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.end.UnixNano()))
+	for _, attr := range s.attributes {
+		b = appendMessage(b, 9, encodeKeyValue(attr))
+	}
+	for _, e := range s.events {
+		b = appendMessage(b, 11, encodeEvent(e))
+	}
+	if s.status != statusUnset {
+		var status []byte
+		if s.statusMessage != "" {
+			status = protowire.AppendTag(status, 2, protowire.BytesType)
+			status = protowire.AppendString(status, s.statusMessage)
+		}
+		status = protowire.AppendTag(status, 3, protowire.VarintType)
+		status = protowire.AppendVarint(status, uint64(s.status))
+		b = appendMessage(b, 15, status)
+	}
+
+	return b
+}
+
+func encodeEvent(e event) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(e.time.UnixNano()))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, e.name)
+	for _, attr := range e.attributes {
+		b = appendMessage(b, 3, encodeKeyValue(attr))
+	}
+	return b
+}
+
+// encodeKeyValue encodes an attribute as a KeyValue, mapping its value to
+// the matching AnyValue type.
+func encodeKeyValue(attr attribute) []byte {
+	var value []byte
+	switch v := attr.value.(type) {
+	case string:
+		value = appendString(value, v)
+	case bool:
+		value = protowire.AppendTag(value, 2, protowire.VarintType)
+		value = protowire.AppendVarint(value, protowire.EncodeBool(v))
+	case int:
+		value = appendInt(value, int64(v))
+	case int8:
+		value = appendInt(value, int64(v))
+	case int16:
+		value = appendInt(value, int64(v))
+	case int32:
+		value = appendInt(value, int64(v))
+	case int64:
+		value = appendInt(value, v)
+	case uint:
+		value = appendInt(value, int64(v))
+	case uint8:
+		value = appendInt(value, int64(v))
+	case uint16:
+		value = appendInt(value, int64(v))
+	case uint32:
+		value = appendInt(value, int64(v))
+	case uint64:
+		value = appendInt(value, int64(v))
+	case float32:
+		value = appendDouble(value, float64(v))
+	case float64:
+		value = appendDouble(value, v)
+	case error:
+		value = appendString(value, v.Error())
+	case fmt.Stringer:
+		value = appendString(value, v.String())
+	default:
+		value = appendString(value, fmt.Sprint(v))
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, attr.key)
+	return appendMessage(b, 2, value)
+}
+
+func appendString(b []byte, v string) []byte {
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendInt(b []byte, v int64) []byte {
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendDouble(b []byte, v float64) []byte {
+	b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
@@ -0,0 +1,140 @@
+package opentelemetry
+
+import (
+	"crypto/rand"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+var _ opentracing.Tracer = (*tracer)(nil)
+
+// Name is the name of this tracer.
+const Name = "opentelemetry"
+
+type Logger interface {
+	Errorf(msg string, args ...interface{})
+	Infof(msg string, args ...interface{})
+}
+
+// Trace implements tyk.Tracer, exporting spans with OTLP.
+type Trace struct {
+	opentracing.Tracer
+	exporter *exporter
+}
+
+func (Trace) Name() string {
+	return Name
+}
+
+// Close flushes the spans waiting to be exported and stops the exporter.
+func (t *Trace) Close() error {
+	return t.exporter.close()
+}
+
+// Init returns a implementation of tyk.Tracer exporting spans to an
+// OpenTelemetry collector and propagating W3C trace context.
+func Init(service string, opts map[string]interface{}, log Logger) (*Trace, error) {
+	c, err := Load(opts)
+	if err != nil {
+		return nil, err
+	}
+	if service == "" {
+		service = "tyk-gateway"
+	}
+
+	exp, err := newExporter(service, c, log)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Trace{Tracer: &tracer{exporter: exp}, exporter: exp}, nil
+}
+
+type tracer struct {
+	exporter *exporter
+}
+
+func (t *tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	var o opentracing.StartSpanOptions
+	for _, opt := range opts {
+		opt.Apply(&o)
+	}
+
+	s := &Span{
+		tracer: t,
+		name:   operationName,
+		kind:   kindInternal,
+		start:  o.StartTime,
+	}
+	if s.start.IsZero() {
+		s.start = time.Now()
+	}
+
+	var parent spanContext
+	for _, ref := range o.References {
+		if sc, ok := ref.ReferencedContext.(spanContext); ok && (sc.hasTrace() || len(sc.baggage) > 0) {
+			parent = sc
+			break
+		}
+	}
+
+	if parent.hasTrace() {
+		s.ctx.traceID = parent.traceID
+		s.ctx.sampled = parent.sampled
+		s.ctx.traceState = parent.traceState
+		s.parentID = parent.spanID
+	} else {
+		s.ctx.traceID = newTraceID()
+		s.ctx.sampled = true
+	}
+	s.ctx.spanID = newSpanID()
+	s.ctx.baggage = parent.baggage
+
+	// Spans starting a trace, or continuing one from another service, are
+	// entry points to the gateway
+	if !parent.hasTrace() || parent.remote {
+		s.kind = kindServer
+	}
+
+	for k, v := range o.Tags {
+		s.setTag(k, v)
+	}
+
+	return s
+}
+
+func (t *tracer) Inject(sm opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	sc, ok := sm.(spanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+
+	switch format {
+	case opentracing.HTTPHeaders, opentracing.TextMap:
+		return injectTextMap(sc, carrier)
+	}
+	return opentracing.ErrUnsupportedFormat
+}
+
+func (t *tracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	switch format {
+	case opentracing.HTTPHeaders, opentracing.TextMap:
+		return extractTextMap(carrier)
+	}
+	return nil, opentracing.ErrUnsupportedFormat
+}
+
+func newTraceID() (id [16]byte) {
+	for id == ([16]byte{}) {
+		rand.Read(id[:])
+	}
+	return
+}
+
+func newSpanID() (id [8]byte) {
+	for id == ([8]byte{}) {
+		rand.Read(id[:])
+	}
+	return
+}
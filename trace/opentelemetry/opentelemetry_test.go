@@ -0,0 +1,370 @@
+package opentelemetry
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Errorf(msg string, args ...interface{}) {
+	l.t.Logf(msg, args...)
+}
+
+func (l testLogger) Infof(msg string, args ...interface{}) {
+	l.t.Logf(msg, args...)
+}
+
+func TestTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := parseTraceparent(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.sampled {
+		t.Error("expected sampled context")
+	}
+	if got := hex.EncodeToString(sc.traceID[:]); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected trace id %s", got)
+	}
+	if got := formatTraceparent(sc); got != valid {
+		t.Errorf("expected %s got %s", valid, got)
+	}
+
+	// Future versions may append fields
+	if _, err := parseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-ff"); err != nil {
+		t.Errorf("expected future version to parse, got %v", err)
+	}
+
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-ff",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	} {
+		if _, err := parseTraceparent(v); err == nil {
+			t.Errorf("expected %q to be invalid", v)
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	tr := &tracer{exporter: &exporter{stop: make(chan struct{}), queue: make(chan *Span, 10)}}
+
+	h := http.Header{}
+	h.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set("Tracestate", "vendor=value")
+	h.Set("Baggage", "user=alice;prop=1, tier=gold%20plus")
+
+	parent, err := tr.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := tr.StartSpan("request", opentracing.ChildOf(parent)).(*Span)
+	if span.kind != kindServer {
+		t.Errorf("expected span continuing a remote trace to be a server span, got %d", span.kind)
+	}
+	if got := hex.EncodeToString(span.parentID[:]); got != "00f067aa0ba902b7" {
+		t.Errorf("unexpected parent id %s", got)
+	}
+	if span.BaggageItem("tier") != "gold plus" || span.BaggageItem("user") != "alice" {
+		t.Errorf("unexpected baggage %v", span.ctx.baggage)
+	}
+
+	child := tr.StartSpan("middleware", opentracing.ChildOf(span.Context())).(*Span)
+	if child.kind != kindInternal {
+		t.Errorf("expected local child to be an internal span, got %d", child.kind)
+	}
+
+	out := http.Header{}
+	if err := tr.Inject(child.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(out)); err != nil {
+		t.Fatal(err)
+	}
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + hex.EncodeToString(child.ctx.spanID[:]) + "-01"
+	if got := out.Get("Traceparent"); got != want {
+		t.Errorf("expected traceparent %s got %s", want, got)
+	}
+	if got := out.Get("Tracestate"); got != "vendor=value" {
+		t.Errorf("unexpected tracestate %s", got)
+	}
+
+	baggage := map[string]string{}
+	parseBaggage(out.Get("Baggage"), baggage)
+	if baggage["tier"] != "gold plus" || baggage["user"] != "alice" {
+		t.Errorf("unexpected injected baggage %q", out.Get("Baggage"))
+	}
+
+	if _, err := tr.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(http.Header{})); err != opentracing.ErrSpanContextNotFound {
+		t.Errorf("expected ErrSpanContextNotFound, got %v", err)
+	}
+}
+
+// field is a decoded protobuf field, holding either bytes or a number.
+type field struct {
+	num   protowire.Number
+	bytes []byte
+	value uint64
+}
+
+func decode(t *testing.T, b []byte) []field {
+	t.Helper()
+
+	var fields []field
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		f := field{num: num}
+		switch typ {
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.value, n = protowire.ConsumeFixed64(b)
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+type exportedSpan struct {
+	traceID, spanID, parentID string
+	name                      string
+	kind                      uint64
+	attributes                map[string]string
+	status                    uint64
+}
+
+// decodeRequest decodes an ExportTraceServiceRequest, returning the resource
+// attributes and the spans.
+func decodeRequest(t *testing.T, b []byte) (map[string]string, []exportedSpan) {
+	resource := map[string]string{}
+	var spans []exportedSpan
+
+	for _, rs := range decode(t, b) {
+		for _, f := range decode(t, rs.bytes) {
+			switch f.num {
+			case 1:
+				for _, attr := range decode(t, f.bytes) {
+					k, v := decodeKeyValue(t, attr.bytes)
+					resource[k] = v
+				}
+			case 2:
+				for _, ss := range decode(t, f.bytes) {
+					if ss.num == 2 {
+						spans = append(spans, decodeSpan(t, ss.bytes))
+					}
+				}
+			}
+		}
+	}
+
+	return resource, spans
+}
+
+func decodeSpan(t *testing.T, b []byte) exportedSpan {
+	s := exportedSpan{attributes: map[string]string{}}
+	for _, f := range decode(t, b) {
+		switch f.num {
+		case 1:
+			s.traceID = hex.EncodeToString(f.bytes)
+		case 2:
+			s.spanID = hex.EncodeToString(f.bytes)
+		case 4:
+			s.parentID = hex.EncodeToString(f.bytes)
+		case 5:
+			s.name = string(f.bytes)
+		case 6:
+			s.kind = f.value
+		case 9:
+			k, v := decodeKeyValue(t, f.bytes)
+			s.attributes[k] = v
+		case 15:
+			for _, sf := range decode(t, f.bytes) {
+				if sf.num == 3 {
+					s.status = sf.value
+				}
+			}
+		}
+	}
+	return s
+}
+
+func decodeKeyValue(t *testing.T, b []byte) (key, value string) {
+	for _, f := range decode(t, b) {
+		switch f.num {
+		case 1:
+			key = string(f.bytes)
+		case 2:
+			for _, v := range decode(t, f.bytes) {
+				if v.num == 1 {
+					value = string(v.bytes)
+				} else {
+					value = fmt.Sprint(v.value)
+				}
+			}
+		}
+	}
+	return
+}
+
+func recordSpans(tr *Trace) {
+	root := tr.StartSpan("api")
+	root.SetTag("method", "GET")
+
+	child := tr.StartSpan("upstream", opentracing.ChildOf(root.Context()))
+	ext.SpanKindRPCClient.Set(child)
+	ext.Error.Set(child, true)
+	child.Finish()
+	root.Finish()
+
+	unsampled := spanContext{traceID: newTraceID(), spanID: newSpanID()}
+	tr.StartSpan("unsampled", opentracing.ChildOf(unsampled)).Finish()
+}
+
+func checkSpans(t *testing.T, resource map[string]string, spans []exportedSpan) {
+	t.Helper()
+
+	if resource["service.name"] != "test-service" || resource["deployment.environment"] != "test" {
+		t.Errorf("unexpected resource %v", resource)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	child, root := spans[0], spans[1]
+	if root.name != "api" || root.kind != kindServer || root.parentID != "" || root.attributes["method"] != "GET" {
+		t.Errorf("unexpected root span %+v", root)
+	}
+	if child.name != "upstream" || child.kind != kindClient || child.status != statusError {
+		t.Errorf("unexpected child span %+v", child)
+	}
+	if child.traceID != root.traceID || child.parentID != root.spanID {
+		t.Errorf("expected upstream span to be a child of %s, got %+v", root.spanID, child)
+	}
+}
+
+func TestExportHTTP(t *testing.T) {
+	requests := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != httpTracesPath || r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Authorization") != "secret" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- body
+	}))
+	defer collector.Close()
+
+	tr, err := Init("test-service", map[string]interface{}{
+		"exporter":            ExporterHTTP,
+		"endpoint":            collector.URL,
+		"headers":             map[string]interface{}{"Authorization": "secret"},
+		"resource_attributes": map[string]interface{}{"deployment.environment": "test"},
+	}, testLogger{t})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	recordSpans(tr)
+	tr.exporter.flush()
+
+	select {
+	case body := <-requests:
+		resource, spans := decodeRequest(t, body)
+		checkSpans(t, resource, spans)
+	case <-time.After(5 * time.Second):
+		t.Fatal("spans weren't exported")
+	}
+}
+
+func TestExportGRPC(t *testing.T) {
+	requests := make(chan []byte, 1)
+	server := grpc.NewServer(
+		grpc.CustomCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			if method != exportMethod || len(md.Get("authorization")) == 0 {
+				t.Errorf("unexpected call %s %v", method, md)
+			}
+
+			var req []byte
+			if err := stream.RecvMsg(&req); err != nil {
+				return err
+			}
+			requests <- req
+			return stream.SendMsg([]byte{})
+		}),
+	)
+	defer server.Stop()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+
+	tr, err := Init("test-service", map[string]interface{}{
+		"exporter":            ExporterGRPC,
+		"endpoint":            l.Addr().String(),
+		"insecure":            true,
+		"headers":             map[string]interface{}{"authorization": "secret"},
+		"resource_attributes": map[string]interface{}{"deployment.environment": "test"},
+	}, testLogger{t})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	recordSpans(tr)
+	tr.exporter.flush()
+
+	select {
+	case body := <-requests:
+		resource, spans := decodeRequest(t, body)
+		checkSpans(t, resource, spans)
+	case <-time.After(5 * time.Second):
+		t.Fatal("spans weren't exported")
+	}
+}
+
+func TestExportQueueFull(t *testing.T) {
+	e := &exporter{stop: make(chan struct{}), queue: make(chan *Span, 1), log: testLogger{t}}
+
+	e.enqueue(&Span{})
+	e.enqueue(&Span{})
+	if e.dropped != 1 {
+		t.Errorf("expected 1 dropped span, got %d", e.dropped)
+	}
+}
@@ -0,0 +1,165 @@
+package opentelemetry
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// W3C trace context and baggage headers
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+	baggageHeader     = "baggage"
+
+	supportedVersion = "00"
+	sampledFlag      = 0x01
+)
+
+var errInvalidTraceparent = errors.New("opentelemetry: invalid traceparent")
+
+// parseTraceparent parses a traceparent header, version-traceid-spanid-flags.
+func parseTraceparent(value string) (spanContext, error) {
+	var sc spanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return sc, errInvalidTraceparent
+	}
+
+	version := parts[0]
+	if len(version) != 2 || version == "ff" || (version == supportedVersion && len(parts) != 4) {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.DecodeString(version); err != nil {
+		return sc, errInvalidTraceparent
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+
+	if !sc.hasTrace() || sc.spanID == ([8]byte{}) {
+		return sc, errInvalidTraceparent
+	}
+	sc.sampled = flags[0]&sampledFlag != 0
+
+	return sc, nil
+}
+
+func formatTraceparent(sc spanContext) string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	return supportedVersion + "-" + hex.EncodeToString(sc.traceID[:]) + "-" + hex.EncodeToString(sc.spanID[:]) + "-" + flags
+}
+
+// parseBaggage parses a baggage header, a list of key=value members where
+// properties following the value are ignored.
+func parseBaggage(value string, baggage map[string]string) {
+	for _, member := range strings.Split(value, ",") {
+		member = strings.SplitN(member, ";", 2)[0]
+		kv := strings.SplitN(member, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			continue
+		}
+		val, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			continue
+		}
+		baggage[key] = val
+	}
+}
+
+func formatBaggage(baggage map[string]string) string {
+	members := make([]string, 0, len(baggage))
+	for key, val := range baggage {
+		members = append(members, key+"="+url.PathEscape(val))
+	}
+	return strings.Join(members, ",")
+}
+
+func extractTextMap(carrier interface{}) (spanContext, error) {
+	c, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return emptyContext, opentracing.ErrInvalidCarrier
+	}
+
+	var traceparent, tracestate string
+	baggage := map[string]string{}
+
+	err := c.ForeachKey(func(key, val string) error {
+		switch strings.ToLower(key) {
+		case traceparentHeader:
+			traceparent = val
+		case tracestateHeader:
+			if tracestate != "" {
+				tracestate += ","
+			}
+			tracestate += val
+		case baggageHeader:
+			parseBaggage(val, baggage)
+		}
+		return nil
+	})
+	if err != nil {
+		return emptyContext, err
+	}
+
+	var sc spanContext
+	if traceparent != "" {
+		if sc, err = parseTraceparent(traceparent); err != nil {
+			return emptyContext, err
+		}
+		sc.traceState = tracestate
+	}
+
+	if len(baggage) > 0 {
+		sc.baggage = baggage
+	}
+
+	if !sc.hasTrace() && sc.baggage == nil {
+		return emptyContext, opentracing.ErrSpanContextNotFound
+	}
+	sc.remote = true
+
+	return sc, nil
+}
+
+func injectTextMap(sc spanContext, carrier interface{}) error {
+	c, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+
+	if sc.hasTrace() {
+		c.Set(traceparentHeader, formatTraceparent(sc))
+		if sc.traceState != "" {
+			c.Set(tracestateHeader, sc.traceState)
+		}
+	}
+	if len(sc.baggage) > 0 {
+		c.Set(baggageHeader, formatBaggage(sc.baggage))
+	}
+
+	return nil
+}
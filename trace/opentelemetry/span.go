@@ -0,0 +1,240 @@
+package opentelemetry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+var _ opentracing.SpanContext = spanContext{}
+var _ opentracing.Span = (*Span)(nil)
+
+// Span kinds, as defined by OTLP
+const (
+	kindInternal = 1
+	kindServer   = 2
+	kindClient   = 3
+	kindProducer = 4
+	kindConsumer = 5
+)
+
+// Span status codes, as defined by OTLP
+const (
+	statusUnset = 0
+	statusError = 2
+)
+
+type spanContext struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	sampled    bool
+	traceState string
+	baggage    map[string]string
+
+	// remote is set for contexts extracted from a carrier
+	remote bool
+}
+
+var emptyContext spanContext
+
+func (c spanContext) hasTrace() bool {
+	return c.traceID != [16]byte{}
+}
+
+func (c spanContext) ForeachBaggageItem(handler func(k, v string) bool) {
+	for k, v := range c.baggage {
+		if !handler(k, v) {
+			return
+		}
+	}
+}
+
+func (c spanContext) withBaggageItem(key, value string) spanContext {
+	baggage := make(map[string]string, len(c.baggage)+1)
+	for k, v := range c.baggage {
+		baggage[k] = v
+	}
+	baggage[key] = value
+	c.baggage = baggage
+	return c
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+type event struct {
+	name       string
+	time       time.Time
+	attributes []attribute
+}
+
+// Span is an OpenTracing span recorded as an OpenTelemetry span.
+type Span struct {
+	tracer *tracer
+
+	mu            sync.Mutex
+	ctx           spanContext
+	parentID      [8]byte
+	name          string
+	kind          int
+	start         time.Time
+	end           time.Time
+	attributes    []attribute
+	events        []event
+	status        int
+	statusMessage string
+	finished      bool
+}
+
+func (s *Span) Context() opentracing.SpanContext {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ctx
+}
+
+func (s *Span) Finish() {
+	s.FinishWithOptions(opentracing.FinishOptions{})
+}
+
+func (s *Span) FinishWithOptions(opts opentracing.FinishOptions) {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+
+	s.end = opts.FinishTime
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+	for _, record := range opts.LogRecords {
+		s.addEvent(record.Timestamp, record.Fields)
+	}
+	sampled := s.ctx.sampled
+	s.mu.Unlock()
+
+	if sampled {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+func (s *Span) SetOperationName(operationName string) opentracing.Span {
+	s.mu.Lock()
+	s.name = operationName
+	s.mu.Unlock()
+	return s
+}
+
+func (s *Span) SetTag(key string, value interface{}) opentracing.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setTag(key, value)
+	return s
+}
+
+func (s *Span) setTag(key string, value interface{}) {
+	switch key {
+	case string(ext.SpanKind):
+		s.kind = spanKind(value)
+	case string(ext.Error):
+		if isError, ok := value.(bool); ok && isError {
+			s.status = statusError
+		}
+	default:
+		for i := range s.attributes {
+			if s.attributes[i].key == key {
+				s.attributes[i].value = value
+				return
+			}
+		}
+		s.attributes = append(s.attributes, attribute{key: key, value: value})
+	}
+}
+
+func spanKind(value interface{}) int {
+	switch fmt.Sprint(value) {
+	case string(ext.SpanKindRPCServerEnum):
+		return kindServer
+	case string(ext.SpanKindRPCClientEnum):
+		return kindClient
+	case string(ext.SpanKindProducerEnum):
+		return kindProducer
+	case string(ext.SpanKindConsumerEnum):
+		return kindConsumer
+	}
+	return kindInternal
+}
+
+func (s *Span) LogFields(fields ...log.Field) {
+	s.mu.Lock()
+	s.addEvent(time.Now(), fields)
+	s.mu.Unlock()
+}
+
+// addEvent records log fields as an event, named by its "event" field.
+func (s *Span) addEvent(t time.Time, fields []log.Field) {
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	e := event{name: "log", time: t}
+	for _, field := range fields {
+		if field.Key() == "event" {
+			e.name = fmt.Sprint(field.Value())
+			continue
+		}
+		if field.Key() == "message" && s.status == statusError && s.statusMessage == "" {
+			s.statusMessage = fmt.Sprint(field.Value())
+		}
+		e.attributes = append(e.attributes, attribute{key: field.Key(), value: field.Value()})
+	}
+
+	s.events = append(s.events, e)
+}
+
+func (s *Span) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := log.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		s.LogFields(log.Error(err), log.String("function", "LogKV"))
+		return
+	}
+	s.LogFields(fields...)
+}
+
+func (s *Span) SetBaggageItem(restrictedKey, value string) opentracing.Span {
+	s.mu.Lock()
+	s.ctx = s.ctx.withBaggageItem(restrictedKey, value)
+	s.mu.Unlock()
+	return s
+}
+
+func (s *Span) BaggageItem(restrictedKey string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ctx.baggage[restrictedKey]
+}
+
+func (s *Span) Tracer() opentracing.Tracer {
+	return s.tracer
+}
+
+func (s *Span) LogEvent(event string) {
+	s.LogFields(log.String("event", event))
+}
+
+func (s *Span) LogEventWithPayload(event string, payload interface{}) {
+	s.LogFields(log.String("event", event), log.Object("payload", payload))
+}
+
+func (s *Span) Log(data opentracing.LogData) {
+	s.mu.Lock()
+	s.addEvent(data.Timestamp, data.ToLogRecord().Fields)
+	s.mu.Unlock()
+}